@@ -9,7 +9,10 @@ import (
 	"syscall"
 	"time"
 
+	_ "curly-computing-machine/internal/database/postgres"
+	_ "curly-computing-machine/internal/database/sqlite"
 	"curly-computing-machine/internal/server"
+	"curly-computing-machine/internal/telemetry"
 )
 
 func gracefulShutdown(apiServer *http.Server, done chan bool) {
@@ -38,6 +41,11 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 
 func main() {
 
+	shutdownTracing, err := telemetry.Setup(context.Background())
+	if err != nil {
+		log.Fatalf("telemetry setup: %v", err)
+	}
+
 	server := server.NewServer()
 
 	// Create a done channel to signal when the shutdown is complete
@@ -46,12 +54,20 @@ func main() {
 	// Run graceful shutdown in a separate goroutine
 	go gracefulShutdown(server, done)
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
 
 	// Wait for the graceful shutdown to complete
 	<-done
+
+	// Flush any spans still buffered by the exporter
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("telemetry shutdown: %v", err)
+	}
+
 	log.Println("Graceful shutdown complete.")
 }
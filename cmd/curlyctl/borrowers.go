@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// verifyBorrower verifies a borrower's email on their behalf, for when a
+// librarian has checked it in person or no mail server is configured.
+func verifyBorrower(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: curlyctl verify <borrower_id>")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	borrowerID, err := database.ParseID(flags.Arg(0))
+	if err != nil {
+		return fail("verify", fmt.Errorf("invalid borrower_id"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	db := database.New()
+	borrower, err := db.GetBorrower(ctx, borrowerID)
+	if err != nil {
+		return fail("verify", err)
+	}
+	if borrower == nil {
+		return fail("verify", fmt.Errorf("no borrower with this ID"))
+	}
+
+	// The email is checked again as it's verified, in case it changed since
+	// it was read
+	borrower, err = db.VerifyBorrower(ctx, borrowerID, borrower.Email)
+	if err != nil {
+		return fail("verify", err)
+	}
+	if borrower == nil {
+		return fail("verify", fmt.Errorf("borrower changed their email, try again"))
+	}
+
+	fmt.Printf("verified %s <%s>\n", borrower.ID.String(), borrower.Email)
+	return 0
+}
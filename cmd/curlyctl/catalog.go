@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/importer"
+	"curly-computing-machine/internal/marc"
+)
+
+// importCatalog runs an import job in the foreground, recording it like the
+// API's /import endpoints do, and prints the rows that failed.
+func importCatalog(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: curlyctl import [-format csv|marc|marcxml] [-author-email-domain domain] <file>")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "", "file format, guessed from the extension when empty")
+	domain := flags.String("author-email-domain", "", "create missing MARC authors with placeholder emails in this domain")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = formatOf(path)
+	}
+
+	var read func(io.Reader) ([]importer.Row, error)
+	switch *format {
+	case "csv":
+		read = importer.ReadBooksCSV
+	case "marc":
+		read = importer.ReadBooksMARC
+	case "marcxml":
+		read = importer.ReadBooksMARCXML
+	default:
+		return fail("import", fmt.Errorf("unknown format %q", *format))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fail("import", err)
+	}
+	defer file.Close()
+
+	rows, err := read(file)
+	if err != nil {
+		return fail("import", err)
+	}
+
+	ctx := context.Background()
+	db := database.New()
+
+	jobID, err := db.CreateImportJob(ctx, "books_"+*format, len(rows))
+	if err != nil {
+		return fail("import", err)
+	}
+
+	imp := importer.New(db)
+	imp.AuthorEmailDomain = *domain
+	imp.Run(ctx, *jobID, rows)
+
+	job, err := db.GetImportJob(ctx, *jobID)
+	if err != nil {
+		return fail("import", err)
+	}
+
+	for _, row := range job.Rows {
+		if row.Status == database.ImportRowFailed {
+			fmt.Printf("row %d: %s\n", row.Row, row.Error)
+		}
+	}
+	fmt.Printf("import %s %s: %d created, %d failed\n", jobID.String(), job.Status, job.Succeeded, job.Failed)
+	if job.Error != "" {
+		return fail("import", fmt.Errorf("%s", job.Error))
+	}
+
+	return 0
+}
+
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mrc", ".marc":
+		return "marc"
+	case ".xml":
+		return "marcxml"
+	default:
+		return "csv"
+	}
+}
+
+// exportCatalog writes every book as a MARCXML collection.
+func exportCatalog(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "", "write to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	books, err := database.New().ListBooks(ctx, database.Expand{Author: true})
+	if err != nil {
+		return fail("export", err)
+	}
+
+	records := make([]marc.Record, 0, len(books))
+	for _, book := range books {
+		authors := make(map[database.ID]*database.Author)
+		for _, contributor := range book.Contributors {
+			if contributor.Author != nil {
+				authors[contributor.AuthorID] = contributor.Author
+			}
+		}
+		records = append(records, marc.FromBook(book, authors))
+	}
+
+	if *output == "" {
+		err = marc.WriteXML(os.Stdout, records)
+		if err != nil {
+			return fail("export", err)
+		}
+		return 0
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fail("export", err)
+	}
+
+	err = marc.WriteXML(file, records)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail("export", err)
+	}
+
+	fmt.Printf("exported %d books to %s\n", len(records), *output)
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+func overdue(args []string) int {
+	flags := flag.NewFlagSet("overdue", flag.ContinueOnError)
+	grace := flags.Duration("grace", 0, "only list loans overdue by more than this")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	now := time.Now().UTC()
+	loans, err := database.New().OverdueLoans(ctx, now.Add(-*grace))
+	if err != nil {
+		return fail("overdue", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DUE\tDAYS LATE\tBOOK\tTITLE\tBORROWER\tEMAIL")
+	for _, loan := range loans {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+			loan.DueAt.Format(time.DateOnly),
+			int(now.Sub(loan.DueAt).Hours()/24),
+			loan.BookID.String(),
+			loan.BookTitle,
+			loan.BorrowerName,
+			loan.BorrowerEmail,
+		)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return fail("overdue", err)
+	}
+
+	return 0
+}
+
+func returnBook(args []string) int {
+	flags := flag.NewFlagSet("return", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: curlyctl return <book_id>")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	bookID, err := database.ParseID(flags.Arg(0))
+	if err != nil {
+		return fail("return", fmt.Errorf("invalid book_id"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err = database.New().ReturnBook(ctx, bookID)
+	if err != nil {
+		return fail("return", err)
+	}
+
+	fmt.Printf("returned %s\n", bookID.String())
+	return 0
+}
@@ -0,0 +1,67 @@
+// Command curlyctl runs administrative tasks against the library database,
+// configured with the same DB_* environment variables as the API.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	_ "curly-computing-machine/internal/database/postgres"
+	_ "curly-computing-machine/internal/database/sqlite"
+)
+
+type command struct {
+	run     func(args []string) int
+	summary string
+}
+
+var commands = map[string]command{
+	"migrate":         {migrate, "apply, revert or list schema migrations"},
+	"rebuild-indexes": {rebuildIndexes, "drop and recreate the indexes and validators of applied migrations"},
+	"check":           {check, "report references between documents that don't hold"},
+	"seed":            {seed, "add demo authors, borrowers and books"},
+	"import":          {importCatalog, "import books from a CSV, MARC21 or MARCXML file"},
+	"export":          {exportCatalog, "export every book as MARCXML"},
+	"overdue":         {overdue, "list loans past their due date"},
+	"return":          {returnBook, "return a borrowed book on behalf of its borrower"},
+	"verify":          {verifyBorrower, "mark a borrower's current email as verified"},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "curlyctl: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: curlyctl <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run curlyctl <command> -h for a command's flags.")
+}
+
+// fail reports err for the named command and returns the failure exit code.
+func fail(name string, err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	return 1
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+func rebuildIndexes(args []string) int {
+	flags := flag.NewFlagSet("rebuild-indexes", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the migrations without rebuilding them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	verb := "rebuilt"
+	if *dryRun {
+		verb = "would rebuild"
+	}
+
+	m, err := database.NewMigrator()
+	if err != nil {
+		return fail("rebuild-indexes", err)
+	}
+
+	rebuilt, err := m.Rebuild(ctx, *dryRun)
+	for _, migration := range rebuilt {
+		fmt.Printf("%s %d: %s\n", verb, migration.Version, migration.Description)
+	}
+	if err != nil {
+		return fail("rebuild-indexes", err)
+	}
+
+	return 0
+}
+
+// check exits with 1 when it finds problems, so it can run from cron or CI.
+func check(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	problems, err := database.New().CheckIntegrity(ctx)
+	if err != nil {
+		return fail("check", err)
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found\n", len(problems))
+		return 1
+	}
+
+	fmt.Println("no problems found")
+	return 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+const migrateUsage = `usage: curlyctl migrate [-dry-run] [-steps N] up|down|status
+
+  up      apply pending migrations, all of them unless -steps is set
+  down    revert applied migrations, newest first, one unless -steps is set
+  status  list migrations and when they were applied
+`
+
+// migrate runs the migrate subcommand and returns the exit code.
+func migrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), migrateUsage) }
+	dryRun := flags.Bool("dry-run", false, "list the migrations without running them")
+	steps := flags.Int("steps", 0, "number of migrations to run")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *steps < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	m, err := database.NewMigrator()
+	if err != nil {
+		return fail("migrate", err)
+	}
+
+	verb := "applied"
+	if *dryRun {
+		verb = "would apply"
+	}
+
+	var ran []database.Migration
+	switch flags.Arg(0) {
+	case "up":
+		ran, err = m.Up(ctx, *steps, *dryRun)
+	case "down":
+		if *steps == 0 {
+			*steps = 1
+		}
+		verb = "reverted"
+		if *dryRun {
+			verb = "would revert"
+		}
+		ran, err = m.Down(ctx, *steps, *dryRun)
+	case "status":
+		return migrationStatus(ctx, m)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	for _, migration := range ran {
+		fmt.Printf("%s %d: %s\n", verb, migration.Version, migration.Description)
+	}
+	if err != nil {
+		return fail("migrate", err)
+	}
+	if len(ran) == 0 {
+		fmt.Println("nothing to do")
+	}
+
+	return 0
+}
+
+func migrationStatus(ctx context.Context, m *database.Migrator) int {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return fail("migrate", err)
+	}
+
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%3d  %-25s  %s\n", status.Version, applied, status.Description)
+	}
+
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+var demoAuthors = []database.AuthorRequest{
+	{Name: "Ursula K. Le Guin", Birthday: date(1929, time.October, 21), Email: "ursula.le.guin@example.org"},
+	{Name: "Terry Pratchett", Birthday: date(1948, time.April, 28), Email: "terry.pratchett@example.org"},
+	{Name: "Octavia E. Butler", Birthday: date(1947, time.June, 22), Email: "octavia.butler@example.org"},
+}
+
+// demoBooks are keyed by the email of their author in demoAuthors.
+var demoBooks = []struct {
+	authorEmail string
+	book        database.BookRequest
+}{
+	{"ursula.le.guin@example.org", database.BookRequest{Title: "A Wizard of Earthsea", ISBN: "9780547722023", Genres: []string{"fantasy"}, Available: true}},
+	{"ursula.le.guin@example.org", database.BookRequest{Title: "The Left Hand of Darkness", ISBN: "9780441478125", Genres: []string{"science fiction"}, Available: true}},
+	{"terry.pratchett@example.org", database.BookRequest{Title: "Guards! Guards!", ISBN: "9780062225757", Genres: []string{"fantasy", "humor"}, Available: true}},
+	{"terry.pratchett@example.org", database.BookRequest{Title: "Small Gods", Genres: []string{"fantasy", "humor"}, Available: true}},
+	{"octavia.butler@example.org", database.BookRequest{Title: "Kindred", ISBN: "9780807083697", Genres: []string{"science fiction"}, Audience: database.AudienceMature, Available: true}},
+}
+
+var demoBorrowers = []database.BorrowerRequest{
+	{Name: "Ada Reader", Birthday: date(1990, time.March, 3), Email: "ada.reader@example.org"},
+	{Name: "Ben Bookworm", Birthday: date(2001, time.November, 14), Email: "ben.bookworm@example.org"},
+}
+
+// seed adds demo data through the same service calls as the API. Anything
+// that already exists is skipped, so it can be run repeatedly.
+func seed(args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	db := database.New()
+	created, skipped := 0, 0
+
+	count := func(err error) error {
+		var conflict *database.ConflictError
+		switch {
+		case errors.As(err, &conflict):
+			skipped++
+			return nil
+		case err != nil:
+			return err
+		}
+		created++
+		return nil
+	}
+
+	authors := make(map[string]database.ID)
+	for _, author := range demoAuthors {
+		id, err := db.CreateAuthor(ctx, author)
+		if err := count(err); err != nil {
+			return fail("seed", fmt.Errorf("author %s: %v", author.Name, err))
+		}
+		if id == nil {
+			existing, err := db.FindAuthorByEmail(ctx, author.Email)
+			if err != nil {
+				return fail("seed", err)
+			}
+			if existing == nil {
+				return fail("seed", fmt.Errorf("author %s: another author has this name and birthday", author.Name))
+			}
+			id = &existing.ID
+		}
+		authors[author.Email] = *id
+	}
+
+	for _, demo := range demoBooks {
+		book := demo.book
+		book.AuthorID = authors[demo.authorEmail]
+		err := book.Bind(nil)
+		if err != nil {
+			return fail("seed", fmt.Errorf("book %s: %v", book.Title, err))
+		}
+		_, err = db.AddBook(ctx, book)
+		if err := count(err); err != nil {
+			return fail("seed", fmt.Errorf("book %s: %v", book.Title, err))
+		}
+	}
+
+	for _, borrower := range demoBorrowers {
+		id, err := db.CreateBorrower(ctx, borrower)
+		if err := count(err); err != nil {
+			return fail("seed", fmt.Errorf("borrower %s: %v", borrower.Name, err))
+		}
+		// Demo borrowers can borrow straight away, without a mail server to
+		// verify their email through
+		if id != nil {
+			_, err = db.VerifyBorrower(ctx, *id, borrower.Email)
+			if err != nil {
+				return fail("seed", fmt.Errorf("borrower %s: %v", borrower.Name, err))
+			}
+		}
+	}
+
+	fmt.Printf("created %d, skipped %d that already existed\n", created, skipped)
+	return 0
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"curly-computing-machine/openapi"
+)
+
+func main() {
+	spec := flag.String("spec", "v1.yaml", "path of the spec to update")
+	flag.Parse()
+
+	content, err := os.ReadFile(*spec)
+	if err != nil {
+		log.Fatalf("read spec: %v", err)
+	}
+
+	synced, err := openapi.SyncSchemas(content, openapi.V1Types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile(*spec, synced, 0o644)
+	if err != nil {
+		log.Fatalf("write spec: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package cover validates uploaded book cover images and derives thumbnails
+// from them.
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Content types accepted for covers.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	WebP = "image/webp"
+)
+
+const (
+	// MaxDimension bounds either side of a cover, and MaxPixels its area,
+	// so small files can't decode into huge images. A cover at the limit
+	// decodes into about 32 MiB.
+	MaxDimension = 4000
+	MaxPixels    = 8_000_000
+
+	ThumbnailWidth  = 200
+	ThumbnailHeight = 300
+)
+
+var (
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or WebP image")
+	ErrInvalidImage    = errors.New("cover isn't a valid image")
+)
+
+// Validate checks that data is an image of contentType, judging by its
+// content rather than trusting the declared type alone, and that it isn't
+// too large to decode.
+func Validate(contentType string, data []byte) error {
+	if contentType != JPEG && contentType != PNG && contentType != WebP {
+		return ErrUnsupportedType
+	}
+
+	if sniffed := http.DetectContentType(data); sniffed != contentType {
+		return fmt.Errorf("%w: content is %s, not %s", ErrInvalidImage, sniffed, contentType)
+	}
+
+	config, err := decodeConfig(contentType, data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return fmt.Errorf("%w: %dx%d is larger than %dx%d", ErrInvalidImage, config.Width, config.Height, MaxDimension, MaxDimension)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrInvalidImage, config.Width, config.Height, MaxPixels)
+	}
+
+	return nil
+}
+
+// Thumbnail scales a validated image down to fit ThumbnailWidth by
+// ThumbnailHeight, keeping its aspect ratio. PNGs stay PNG to keep their
+// transparency; everything else becomes JPEG. It returns the thumbnail and
+// its content type.
+func Thumbnail(contentType string, data []byte) ([]byte, string, error) {
+	src, err := decode(contentType, data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), ThumbnailWidth, ThumbnailHeight)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var out bytes.Buffer
+	if contentType == PNG {
+		err = png.Encode(&out, dst)
+	} else {
+		contentType = JPEG
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("encode thumbnail: %v", err)
+	}
+
+	return out.Bytes(), contentType, nil
+}
+
+// fit scales width by height down to fit within maxWidth by maxHeight.
+// Images that already fit are left at their size.
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, max(1, height*maxWidth/width)
+	}
+	return max(1, width*maxHeight/height), maxHeight
+}
+
+func decodeConfig(contentType string, data []byte) (image.Config, error) {
+	switch contentType {
+	case JPEG:
+		return jpeg.DecodeConfig(bytes.NewReader(data))
+	case PNG:
+		return png.DecodeConfig(bytes.NewReader(data))
+	default:
+		return webp.DecodeConfig(bytes.NewReader(data))
+	}
+}
+
+func decode(contentType string, data []byte) (image.Image, error) {
+	switch contentType {
+	case JPEG:
+		return jpeg.Decode(bytes.NewReader(data))
+	case PNG:
+		return png.Decode(bytes.NewReader(data))
+	default:
+		return webp.Decode(bytes.NewReader(data))
+	}
+}
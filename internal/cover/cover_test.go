@@ -0,0 +1,87 @@
+package cover
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encoded(t *testing.T, contentType string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 200, A: 255})
+	}
+
+	var out bytes.Buffer
+	var err error
+	if contentType == PNG {
+		err = png.Encode(&out, img)
+	} else {
+		err = jpeg.Encode(&out, img, nil)
+	}
+	assert.NoError(t, err)
+
+	return out.Bytes()
+}
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		name        string
+		contentType string
+		data        []byte
+		err         error
+	}{
+		{name: "should accept a jpeg", contentType: JPEG, data: encoded(t, JPEG, 40, 60)},
+		{name: "should accept a png", contentType: PNG, data: encoded(t, PNG, 40, 60)},
+		{name: "should reject other types", contentType: "image/gif", data: []byte("GIF89a"), err: ErrUnsupportedType},
+		{name: "should reject content not matching its type", contentType: JPEG, data: encoded(t, PNG, 40, 60), err: ErrInvalidImage},
+		{name: "should reject a truncated image", contentType: PNG, data: encoded(t, PNG, 40, 60)[:20], err: ErrInvalidImage},
+		{name: "should reject huge dimensions", contentType: PNG, data: encoded(t, PNG, MaxDimension+1, 1), err: ErrInvalidImage},
+		{name: "should reject too many pixels", contentType: PNG, data: encoded(t, PNG, MaxDimension, MaxPixels/MaxDimension+1), err: ErrInvalidImage},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.contentType, tc.data)
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	testcases := []struct {
+		name          string
+		contentType   string
+		width, height int
+		wantType      string
+		wantW, wantH  int
+	}{
+		{name: "should scale a tall jpeg to the height", contentType: JPEG, width: 600, height: 1200, wantType: JPEG, wantW: 150, wantH: 300},
+		{name: "should scale a wide png to the width", contentType: PNG, width: 1000, height: 500, wantType: PNG, wantW: 200, wantH: 100},
+		{name: "should keep small images at their size", contentType: PNG, width: 50, height: 80, wantType: PNG, wantW: 50, wantH: 80},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			thumbnail, contentType, err := Thumbnail(tc.contentType, encoded(t, tc.contentType, tc.width, tc.height))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantType, contentType)
+
+			config, _, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantW, config.Width)
+			assert.Equal(t, tc.wantH, config.Height)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audiences books are rated for, from everyone to adults only.
+const (
+	AudienceAll    = "all"
+	AudienceTeen   = "teen"
+	AudienceMature = "mature"
+	AudienceAdult  = "adult"
+)
+
+// Audiences lists the ratings from the youngest audience to the oldest.
+var Audiences = []string{AudienceAll, AudienceTeen, AudienceMature, AudienceAdult}
+
+var audienceMinAges = map[string]int{
+	AudienceAll:    0,
+	AudienceTeen:   13,
+	AudienceMature: 16,
+	AudienceAdult:  18,
+}
+
+// AdultAge is how old borrowers must be to be guardians.
+const AdultAge = 18
+
+// MinAge is how old borrowers must be to borrow books rated for audience.
+// Books without a rating are for everyone.
+func MinAge(audience string) int {
+	return audienceMinAges[audience]
+}
+
+// AgeOn returns how old someone born on birthday is at t, in whole years.
+// Those born on February 29 turn a year older on March 1 in other years.
+func AgeOn(birthday, t time.Time) int {
+	birthday, t = birthday.UTC(), t.UTC()
+
+	age := t.Year() - birthday.Year()
+	if birthday.Month() > t.Month() || birthday.Month() == t.Month() && birthday.Day() > t.Day() {
+		age--
+	}
+	return age
+}
+
+// ErrAgeRestricted is returned by BorrowBook for borrowers too young for the
+// book's audience.
+var ErrAgeRestricted = errors.New("borrower is too young for this book")
+
+// Override is a librarian's permission to lend a book to a borrower too
+// young for its audience, and why it was given.
+type Override struct {
+	Librarian string
+	Reason    string
+}
+
+// AgeOverride records a book lent to a borrower too young for it on a
+// librarian's say-so. Overrides outlive the borrower, so they keep the
+// borrower's name as it was when the book was lent.
+type AgeOverride struct {
+	ID           ID     `json:"id" bson:"_id"`
+	BookID       ID     `json:"book_id" bson:"book_id"`
+	BorrowerID   ID     `json:"borrower_id" bson:"borrower_id"`
+	BorrowerName string `json:"borrower_name" bson:"borrower_name"`
+	Audience     string `json:"audience" bson:"audience"`
+	// BorrowerAge is how old the borrower was when the book was lent.
+	BorrowerAge int       `json:"borrower_age" bson:"borrower_age"`
+	Librarian   string    `json:"librarian" bson:"librarian"`
+	Reason      string    `json:"reason" bson:"reason"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+func (o *AgeOverride) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// CheckAge returns nil when borrower is old enough for book at now. When they
+// aren't, it returns the AgeOverride to record if a librarian has given
+// override, and ErrAgeRestricted otherwise.
+func CheckAge(book Book, borrower Borrower, override *Override, now time.Time) (*AgeOverride, error) {
+	age := AgeOn(borrower.Birthday, now)
+	if age >= MinAge(book.Audience) {
+		return nil, nil
+	}
+
+	if override == nil {
+		return nil, ErrAgeRestricted
+	}
+
+	return &AgeOverride{
+		ID:           NewID(),
+		BookID:       book.ID,
+		BorrowerID:   borrower.ID,
+		BorrowerName: borrower.Name,
+		Audience:     book.Audience,
+		BorrowerAge:  age,
+		Librarian:    override.Librarian,
+		Reason:       override.Reason,
+		CreatedAt:    now.UTC().Truncate(time.Millisecond),
+	}, nil
+}
+
+// ListAgeOverrides lists the age restrictions overridden for a borrower,
+// newest first.
+func (s *service) ListAgeOverrides(ctx context.Context, borrowerID ID) ([]AgeOverride, error) {
+	curs, err := s.ageOverridesColl.Find(ctx, bson.M{"borrower_id": borrowerID}, options.Find().SetSort(bson.M{"_id": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("find age overrides: %v", err)
+	}
+
+	overrides := []AgeOverride{}
+	err = curs.All(ctx, &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("decode age overrides: %v", err)
+	}
+
+	return overrides, nil
+}
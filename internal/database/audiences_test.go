@@ -0,0 +1,105 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgeOn(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	testcases := []struct {
+		name     string
+		birthday time.Time
+		on       time.Time
+		want     int
+	}{
+		{name: "should count a birthday that has passed", birthday: date(2010, time.March, 1), on: date(2026, time.October, 19), want: 16},
+		{name: "should count the birthday itself", birthday: date(2010, time.October, 19), on: date(2026, time.October, 19), want: 16},
+		{name: "should not count the birthday the day before", birthday: date(2010, time.October, 20), on: date(2026, time.October, 19), want: 15},
+		{name: "should not count a later month", birthday: date(2010, time.December, 1), on: date(2026, time.October, 19), want: 15},
+		{name: "should age leap day birthdays on March 1", birthday: date(2008, time.February, 29), on: date(2026, time.March, 1), want: 18},
+		{name: "should not age leap day birthdays on February 28", birthday: date(2008, time.February, 29), on: date(2026, time.February, 28), want: 17},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, AgeOn(tc.birthday, tc.on))
+		})
+	}
+}
+
+func TestCheckAge(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	teen := Borrower{ID: NewID(), Birthday: time.Date(2012, time.January, 1, 0, 0, 0, 0, time.UTC)}
+
+	t.Run("should let borrowers old enough borrow", func(t *testing.T) {
+		for _, audience := range []string{"", AudienceAll, AudienceTeen} {
+			override, err := CheckAge(Book{Audience: audience}, teen, nil, now)
+			assert.NoError(t, err, audience)
+			assert.Nil(t, override, audience)
+		}
+	})
+
+	t.Run("should refuse borrowers too young", func(t *testing.T) {
+		_, err := CheckAge(Book{Audience: AudienceMature}, teen, nil, now)
+		assert.ErrorIs(t, err, ErrAgeRestricted)
+	})
+
+	t.Run("should return the override to record", func(t *testing.T) {
+		book := Book{ID: NewID(), Audience: AudienceAdult}
+
+		override, err := CheckAge(book, teen, &Override{Librarian: "ania", Reason: "school project"}, now)
+		require.NoError(t, err)
+		require.NotNil(t, override)
+		assert.Equal(t, book.ID, override.BookID)
+		assert.Equal(t, teen.ID, override.BorrowerID)
+		assert.Equal(t, AudienceAdult, override.Audience)
+		assert.Equal(t, 14, override.BorrowerAge)
+		assert.Equal(t, "ania", override.Librarian)
+		assert.Equal(t, "school project", override.Reason)
+		assert.Equal(t, now, override.CreatedAt)
+	})
+}
+
+func TestCheckGuardian(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	childID := NewID()
+	adult := &Borrower{ID: NewID(), Birthday: time.Date(1980, time.May, 17, 0, 0, 0, 0, time.UTC)}
+	minor := &Borrower{ID: NewID(), Birthday: time.Date(2008, time.October, 20, 0, 0, 0, 0, time.UTC)}
+	child := &Borrower{ID: childID, Birthday: adult.Birthday, GuardianID: &adult.ID}
+
+	testcases := []struct {
+		name        string
+		borrowerID  ID
+		guardian    *Borrower
+		hasChildren bool
+		errMsg      string
+	}{
+		{name: "should accept adults", borrowerID: childID, guardian: adult},
+		{name: "should accept adults for new borrowers", guardian: adult},
+		{name: "should reject missing guardians", borrowerID: childID, errMsg: "guardian doesn't exist"},
+		{name: "should reject borrowers guarding themselves", borrowerID: adult.ID, guardian: adult, errMsg: "their own guardian"},
+		{name: "should reject guardians with guardians", guardian: child, errMsg: "guardians of their own"},
+		{name: "should reject guardians becoming children", borrowerID: childID, guardian: adult, hasChildren: true, errMsg: "guardians of their own"},
+		{name: "should reject minors", borrowerID: childID, guardian: minor, errMsg: "at least 18"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckGuardian(tc.borrowerID, tc.guardian, tc.hasChildren, now)
+			if tc.errMsg != "" {
+				var guardianErr *GuardianError
+				assert.ErrorAs(t, err, &guardianErr)
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
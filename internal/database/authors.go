@@ -8,17 +8,21 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Author struct {
-	ID       primitive.ObjectID `json:"id" bson:"_id"`
-	Name     string             `json:"name" bson:"name"`
-	Birthday time.Time          `json:"birthday" bson:"birthday"`
-	Email    string             `json:"email" bson:"email"`
+	ID       ID        `json:"id" bson:"_id"`
+	Name     string    `json:"name" bson:"name"`
+	Birthday time.Time `json:"birthday" bson:"birthday"`
+	Email    string    `json:"email" bson:"email"`
+	Version  int64     `json:"version" bson:"version"`
 }
 
+// ErrAuthorHasBooks is returned by DeleteAuthor for authors still credited
+// on books.
+var ErrAuthorHasBooks = errors.New("author has books")
+
 func (a *Author) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
@@ -34,10 +38,11 @@ func (a *AuthorRequest) Bind(r *http.Request) error {
 		return fmt.Errorf("birthday is required")
 	}
 
-	//TODO: regex validation
-	if a.Email == "" {
-		return fmt.Errorf("email is required")
+	email, err := NormalizeEmail(a.Email)
+	if err != nil {
+		return err
 	}
+	a.Email = email
 
 	if a.Name == "" {
 		return fmt.Errorf("name is required")
@@ -46,34 +51,27 @@ func (a *AuthorRequest) Bind(r *http.Request) error {
 	return nil
 }
 
-func (s *service) CreateAuthor(ctx context.Context, author AuthorRequest) (*primitive.ObjectID, error) {
-	authorFilter := bson.D{
-		bson.E{Key: "name", Value: author.Name},
-		bson.E{Key: "birthday", Value: author.Birthday},
-	}
-	resultByName, err := s.getAuthorByFilter(ctx, authorFilter)
-	if resultByName != nil || err != nil {
-		return nil, fmt.Errorf("author already exists")
+func (s *service) CreateAuthor(ctx context.Context, author AuthorRequest) (*ID, error) {
+	newAuthor := Author{
+		ID:       NewID(),
+		Name:     author.Name,
+		Birthday: author.Birthday,
+		Email:    author.Email,
+		Version:  1,
 	}
 
-	emailFilter := bson.D{
-		bson.E{Key: "email", Value: author.Email},
-	}
-	resultByEmail, err := s.getAuthorByFilter(ctx, emailFilter)
-	if resultByEmail != nil || err != nil {
-		return nil, fmt.Errorf("email already exists")
+	_, err := s.authorsColl.InsertOne(ctx, newAuthor)
+	if conflict := asConflict("author", err); conflict != nil {
+		return nil, conflict
 	}
-
-	result, err := s.authorsColl.InsertOne(ctx, author)
 	if err != nil {
 		return nil, fmt.Errorf("create author: %v", err)
 	}
 
-	id := result.InsertedID.(primitive.ObjectID)
-	return &id, nil
+	return &newAuthor.ID, nil
 }
 
-func (s *service) GetAuthor(ctx context.Context, authorID primitive.ObjectID) (*Author, error) {
+func (s *service) GetAuthor(ctx context.Context, authorID ID) (*Author, error) {
 	filter := bson.D{
 		bson.E{Key: "_id", Value: authorID},
 	}
@@ -91,6 +89,91 @@ func (s *service) GetAuthor(ctx context.Context, authorID primitive.ObjectID) (*
 	return &author, nil
 }
 
+// UpdateAuthor replaces an author's details if the author is still at
+// version. It returns nil when the author doesn't exist and
+// ErrVersionMismatch when it has changed since.
+func (s *service) UpdateAuthor(ctx context.Context, authorID ID, author AuthorRequest, version int64) (*Author, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"name":     author.Name,
+			"birthday": author.Birthday,
+			"email":    author.Email,
+		},
+		"$inc": bson.M{
+			"version": 1,
+		},
+	}
+
+	err := s.updateVersioned(ctx, s.authorsColl, authorID, version, update)
+	if conflict := asConflict("author", err); conflict != nil {
+		return nil, conflict
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("update author: %w", err)
+	}
+
+	return s.GetAuthor(ctx, authorID)
+}
+
+// DeleteAuthor removes an author credited on no books if the author is still
+// at version. It reports false when the author doesn't exist.
+func (s *service) DeleteAuthor(ctx context.Context, authorID ID, version int64) (bool, error) {
+	credited := bson.M{"$or": bson.A{
+		bson.M{"author_id": authorID},
+		bson.M{"contributors.author_id": authorID},
+	}}
+	books, err := s.booksColl.CountDocuments(ctx, credited)
+	if err != nil {
+		return false, fmt.Errorf("count author books: %v", err)
+	}
+	if books > 0 {
+		return false, ErrAuthorHasBooks
+	}
+
+	err = s.deleteVersioned(ctx, s.authorsColl, authorID, version)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, fmt.Errorf("delete author: %w", err)
+	}
+
+	return true, nil
+}
+
+// FindAuthorByEmail returns the author registered with email, or nil if
+// there is none.
+func (s *service) FindAuthorByEmail(ctx context.Context, email string) (*Author, error) {
+	emailFilter := bson.D{
+		bson.E{Key: "email", Value: email},
+	}
+
+	author, err := s.getAuthorByFilter(ctx, emailFilter)
+	if err != nil {
+		return nil, fmt.Errorf("find author by email: %v", err)
+	}
+
+	return author, nil
+}
+
+// FindAuthorByName returns the first author with exactly this name, or nil
+// if there is none.
+func (s *service) FindAuthorByName(ctx context.Context, name string) (*Author, error) {
+	nameFilter := bson.D{
+		bson.E{Key: "name", Value: name},
+	}
+
+	author, err := s.getAuthorByFilter(ctx, nameFilter)
+	if err != nil {
+		return nil, fmt.Errorf("find author by name: %v", err)
+	}
+
+	return author, nil
+}
+
 func (s *service) getAuthorByFilter(ctx context.Context, filter bson.D) (*Author, error) {
 	var author Author
 	err := s.authorsColl.FindOne(ctx, filter).Decode(&author)
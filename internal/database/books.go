@@ -5,90 +5,169 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Book struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id"`
-	Title       string             `json:"title" bson:"title"`
-	Description string             `json:"description" bson:"description"`
-	AuthorID    primitive.ObjectID `json:"author_id" bson:"author_id"`
-	Genres      []string           `json:"genres" bson:"genres"`
-	Available   bool               `json:"available" bson:"available"`
+	ID          ID     `json:"id" bson:"_id"`
+	Title       string `json:"title" bson:"title"`
+	ISBN        string `json:"isbn,omitempty" bson:"isbn,omitempty"`
+	Description string `json:"description" bson:"description"`
+	AuthorID    ID     `json:"author_id" bson:"author_id"`
+	// Contributors credits everyone who worked on the book, including
+	// AuthorID, the primary author.
+	Contributors []Contributor `json:"contributors" bson:"contributors"`
+	Genres       []string      `json:"genres" bson:"genres"`
+	Available    bool          `json:"available" bson:"available"`
+	// Audience is who the book is rated for; see MinAge.
+	Audience string `json:"audience" bson:"audience"`
+	Version  int64  `json:"version" bson:"version"`
+
+	// Cover locates the book's cover image, if it has one. CoverURL is where
+	// the API serves it and is filled in by the HTTP layer.
+	Cover    *Cover `json:"-" bson:"cover,omitempty"`
+	CoverURL string `json:"cover_url,omitempty" bson:"-"`
+
+	// Author and Borrower are only set when the book is read with Expand.
+	Author   *Author   `json:"author,omitempty" bson:"author,omitempty"`
+	Borrower *Borrower `json:"borrower,omitempty" bson:"borrower,omitempty"`
+}
+
+// ErrBookBorrowed is returned by DeleteBook for books on loan.
+var ErrBookBorrowed = errors.New("book is borrowed")
+
+func (b *Book) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
 }
 
 type BookRequest struct {
-	Title       string             `json:"title" bson:"title"`
-	Description string             `json:"description" bson:"description"`
-	AuthorID    primitive.ObjectID `json:"author_id" bson:"author_id"`
-	Genres      []string           `json:"genres" bson:"genres"`
-	Available   bool               `json:"available" bson:"available"`
+	Title       string `json:"title" bson:"title"`
+	ISBN        string `json:"isbn,omitempty" bson:"isbn,omitempty"`
+	Description string `json:"description,omitempty" bson:"description"`
+	AuthorID    ID     `json:"author_id,omitempty" bson:"author_id"`
+	// Contributors credits further authors, editors, translators and
+	// illustrators. AuthorID may be left out when it names any.
+	Contributors []Contributor `json:"contributors,omitempty" bson:"contributors"`
+	Genres       []string      `json:"genres,omitempty" bson:"genres"`
+	Available    bool          `json:"available,omitempty" bson:"available"`
+	Audience     string        `json:"audience,omitempty" bson:"audience"`
 }
 
 func (b *BookRequest) Bind(r *http.Request) error {
-	if b.AuthorID.IsZero() {
-		return fmt.Errorf("author_id is required")
+	primary, contributors, err := b.Credits()
+	if err != nil {
+		return err
 	}
+	b.AuthorID = primary
+	b.Contributors = contributors
 
 	if b.Title == "" {
 		return fmt.Errorf("title is required")
 	}
 
+	if b.ISBN != "" {
+		isbn, err := NormalizeISBN(b.ISBN)
+		if err != nil {
+			return err
+		}
+		b.ISBN = isbn
+	}
+
+	b.Audience = b.RatedAudience()
+	if !slices.Contains(Audiences, b.Audience) {
+		return fmt.Errorf("audience must be one of %s", strings.Join(Audiences, ", "))
+	}
+
 	return nil
 }
 
-func (s *service) ListBooks(ctx context.Context) ([]Book, error) {
-	filter := bson.D{}
+// Credits returns the primary author and the full list of contributors. The
+// primary author is AuthorID when set, otherwise the first credited author.
+func (b *BookRequest) Credits() (ID, []Contributor, error) {
+	contributors, err := normalizeContributors(b.AuthorID, b.Contributors)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(contributors) == 0 {
+		return "", nil, fmt.Errorf("author_id is required")
+	}
 
-	var books []Book
+	primary := b.AuthorID
+	if primary.IsZero() {
+		primary = primaryAuthor(contributors)
+	}
 
-	curs, err := s.booksColl.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("find books: %v", err)
+	return primary, contributors, nil
+}
+
+// RatedAudience is the audience the book is rated for, defaulting to
+// everyone when unset.
+func (b *BookRequest) RatedAudience() string {
+	if b.Audience == "" {
+		return AudienceAll
 	}
+	return b.Audience
+}
 
-	err = curs.All(ctx, &books)
+func (s *service) ListBooks(ctx context.Context, expand Expand) ([]Book, error) {
+	filter := bson.D{}
+
+	books, err := s.findBooks(ctx, filter, expand)
 	if err != nil {
-		return nil, fmt.Errorf("decode all books: %v", err)
+		return nil, fmt.Errorf("find books: %v", err)
 	}
 
 	return books, nil
 }
 
-func (s *service) AddBook(ctx context.Context, book BookRequest) (*primitive.ObjectID, error) {
-	author, err := s.GetAuthor(ctx, book.AuthorID)
+func (s *service) AddBook(ctx context.Context, book BookRequest) (*ID, error) {
+	authorID, contributors, err := book.Credits()
 	if err != nil {
-		return nil, fmt.Errorf("get author: %v", err)
-	}
-	if author == nil {
-		return nil, fmt.Errorf("author doesn't exists")
+		return nil, err
 	}
 
-	bookFilter := bson.D{
-		bson.E{Key: "title", Value: book.Title},
-		bson.E{Key: "author_id", Value: book.AuthorID},
-	}
-	bookExists, err := s.getBookByFilter(ctx, bookFilter)
-	if err != nil {
-		return nil, fmt.Errorf("book validating: %v", err)
-	}
-	if bookExists != nil {
-		return nil, fmt.Errorf("book already exists")
+	newBook := Book{
+		ID:           NewID(),
+		Title:        book.Title,
+		ISBN:         book.ISBN,
+		Description:  book.Description,
+		AuthorID:     authorID,
+		Contributors: contributors,
+		Genres:       book.Genres,
+		Available:    book.Available,
+		Audience:     book.RatedAudience(),
+		Version:      1,
 	}
 
-	result, err := s.booksColl.InsertOne(ctx, book)
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		err := s.checkContributors(ctx, contributors)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.booksColl.InsertOne(ctx, newBook)
+		if conflict := asConflict("book", err); conflict != nil {
+			return conflict
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create new book: %w", err)
+		}
+
+		return s.writeOutbox(ctx, BookCreated, BookCreatedData{Book: newBook})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new book: %v", err)
+		return nil, err
 	}
 
-	id := result.InsertedID.(primitive.ObjectID)
-	return &id, nil
+	return &newBook.ID, nil
 }
 
-func (s *service) GetBook(ctx context.Context, bookID primitive.ObjectID) (*Book, error) {
+func (s *service) GetBook(ctx context.Context, bookID ID) (*Book, error) {
 	filter := bson.D{
 		bson.E{Key: "_id", Value: bookID},
 	}
@@ -100,52 +179,181 @@ func (s *service) GetBook(ctx context.Context, bookID primitive.ObjectID) (*Book
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("get book: %v", err)
+		return nil, fmt.Errorf("get book: %w", err)
 	}
 
 	return &book, nil
 }
 
-func (s *service) BorrowBook(ctx context.Context, bookID primitive.ObjectID, borrowerID primitive.ObjectID) error {
-	book, err := s.GetBook(ctx, bookID)
-	if err != nil {
-		return fmt.Errorf("get book: %v", err)
-	}
-
-	if book == nil {
-		return fmt.Errorf("book doesn't exist")
+// GetBookByISBN returns the book with a normalized ISBN-13, or nil if there
+// is none.
+func (s *service) GetBookByISBN(ctx context.Context, isbn string) (*Book, error) {
+	filter := bson.D{
+		bson.E{Key: "isbn", Value: isbn},
 	}
 
-	borrower, err := s.GetBorrower(ctx, borrowerID)
+	book, err := s.getBookByFilter(ctx, filter)
 	if err != nil {
-		return fmt.Errorf("get borrower %v", err)
+		return nil, fmt.Errorf("get book by isbn: %v", err)
 	}
 
-	if borrower == nil {
-		return fmt.Errorf("borrower doesn't exist")
+	return book, nil
+}
+
+func (s *service) BorrowBook(ctx context.Context, bookID ID, borrowerID ID) error {
+	return s.borrowBook(ctx, bookID, borrowerID, nil)
+}
+
+// BorrowBookWithOverride borrows a book like BorrowBook, but lends it to a
+// borrower too young for it on a librarian's say-so, recording that it did.
+func (s *service) BorrowBookWithOverride(ctx context.Context, bookID ID, borrowerID ID, override Override) error {
+	return s.borrowBook(ctx, bookID, borrowerID, &override)
+}
+
+func (s *service) borrowBook(ctx context.Context, bookID ID, borrowerID ID, override *Override) error {
+	return s.inTx(ctx, func(ctx context.Context) error {
+		book, err := s.GetBook(ctx, bookID)
+		if err != nil {
+			return fmt.Errorf("get book: %w", err)
+		}
+
+		if book == nil {
+			return fmt.Errorf("book doesn't exist")
+		}
+
+		borrower, err := s.GetBorrower(ctx, borrowerID)
+		if err != nil {
+			return fmt.Errorf("get borrower %w", err)
+		}
+
+		if borrower == nil {
+			return fmt.Errorf("borrower doesn't exist")
+		}
+
+		if borrower.VerifiedAt == nil {
+			return ErrBorrowerNotVerified
+		}
+
+		ageOverride, err := CheckAge(*book, *borrower, override, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if !book.Available {
+			return fmt.Errorf("book isn't available")
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"available": false,
+			},
+			"$inc": bson.M{
+				"version": 1,
+			},
+		}
+
+		// Only one of several concurrent borrows may take the book
+		filter := bson.M{"_id": book.ID, "available": true}
+		result, err := s.booksColl.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("book available update: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("book isn't available")
+		}
+
+		loan := NewLoan(bookID)
+		err = s.borrowBookByUser(ctx, borrowerID, loan)
+		if err != nil {
+			return fmt.Errorf("borrow book by user: %w", err)
+		}
+
+		if ageOverride != nil {
+			_, err = s.ageOverridesColl.InsertOne(ctx, ageOverride)
+			if err != nil {
+				return fmt.Errorf("record age override: %w", err)
+			}
+		}
+
+		return s.writeOutbox(ctx, BookBorrowed, LoanData{Loan: loan, BorrowerID: borrowerID})
+	})
+}
+
+// UpdateBook replaces the catalog fields of a book if it is still at version.
+// Availability is left alone since it's owned by borrowing. It returns nil when
+// the book doesn't exist and ErrVersionMismatch when it has changed since.
+func (s *service) UpdateBook(ctx context.Context, bookID ID, book BookRequest, version int64) (*Book, error) {
+	authorID, contributors, err := book.Credits()
+	if err != nil {
+		return nil, err
 	}
 
-	if !book.Available {
-		return fmt.Errorf("book isn't available")
+	err = s.checkContributors(ctx, contributors)
+	if err != nil {
+		return nil, err
 	}
 
 	update := bson.M{
 		"$set": bson.M{
-			"available": false,
+			"title":        book.Title,
+			"description":  book.Description,
+			"author_id":    authorID,
+			"contributors": contributors,
+			"genres":       book.Genres,
+			"audience":     book.RatedAudience(),
+		},
+		"$inc": bson.M{
+			"version": 1,
 		},
 	}
 
-	_, err = s.booksColl.UpdateByID(ctx, book.ID, update)
+	if book.ISBN != "" {
+		update["$set"].(bson.M)["isbn"] = book.ISBN
+	} else {
+		// A missing ISBN is left out of the unique index, an empty one isn't
+		update["$unset"] = bson.M{"isbn": ""}
+	}
+
+	err = s.updateVersioned(ctx, s.booksColl, bookID, version, update)
+	if conflict := asConflict("book", err); conflict != nil {
+		return nil, conflict
+	}
 	if err != nil {
-		return fmt.Errorf("book available update: %v", err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("update book: %w", err)
 	}
 
-	err = s.borrowBookByUser(ctx, borrowerID, bookID)
+	return s.GetBook(ctx, bookID)
+}
+
+// DeleteBook removes a book if it is still at version and not on loan. It
+// reports false when the book doesn't exist.
+func (s *service) DeleteBook(ctx context.Context, bookID ID, version int64) (bool, error) {
+	book, err := s.GetBook(ctx, bookID)
 	if err != nil {
-		return fmt.Errorf("borrow book by user: %v", err)
+		return false, fmt.Errorf("get book: %w", err)
+	}
+	if book == nil {
+		return false, nil
 	}
 
-	return nil
+	if !book.Available {
+		return false, ErrBookBorrowed
+	}
+
+	err = s.deleteVersioned(ctx, s.booksColl, bookID, version)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, fmt.Errorf("delete book: %w", err)
+	}
+
+	s.deleteCoverFiles(ctx, book.Cover)
+
+	return true, nil
 }
 
 func (s *service) getBookByFilter(ctx context.Context, filter bson.D) (*Book, error) {
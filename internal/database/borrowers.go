@@ -8,19 +8,35 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Borrower struct {
-	ID       primitive.ObjectID   `json:"id" bson:"_id"`
-	Name     string               `json:"name" bson:"name"`
-	Birthday time.Time            `json:"birthday" bson:"birthday"`
-	Email    string               `json:"email" bson:"email"`
-	Books    []primitive.ObjectID `json:"books" bson:"books"`
+	ID       ID        `json:"id" bson:"_id"`
+	Name     string    `json:"name" bson:"name"`
+	Birthday time.Time `json:"birthday" bson:"birthday"`
+	Email    string    `json:"email" bson:"email"`
+	Books    []ID      `json:"books" bson:"books"`
+	Loans    []Loan    `json:"loans" bson:"loans"`
+	// VerifiedAt is when the borrower proved they own Email. They can't
+	// borrow until they have, and changing Email clears it. Borrowers
+	// without one are stored with an explicit null, so they can be told
+	// apart from those created before verification existed.
+	VerifiedAt *time.Time `json:"verified_at,omitempty" bson:"verified_at"`
+	// GuardianID is the parent or guardian managing a child's account.
+	GuardianID *ID   `json:"guardian_id,omitempty" bson:"guardian_id,omitempty"`
+	Version    int64 `json:"version" bson:"version"`
 }
 
+// ErrBorrowerNotVerified is returned by BorrowBook for borrowers who haven't
+// verified their email.
+var ErrBorrowerNotVerified = errors.New("borrower hasn't verified their email")
+
+// ErrBorrowerHasBooks is returned by DeleteBorrower for borrowers with books
+// on loan.
+var ErrBorrowerHasBooks = errors.New("borrower has borrowed books")
+
 func (b *Borrower) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
@@ -29,6 +45,9 @@ type BorrowerRequest struct {
 	Name     string    `json:"name" bson:"name"`
 	Birthday time.Time `json:"birthday" bson:"birthday"`
 	Email    string    `json:"email" bson:"email"`
+	// GuardianID links a child's account to an adult borrower who manages
+	// it.
+	GuardianID *ID `json:"guardian_id,omitempty" bson:"guardian_id,omitempty"`
 }
 
 func (b *BorrowerRequest) Bind(r *http.Request) error {
@@ -36,8 +55,18 @@ func (b *BorrowerRequest) Bind(r *http.Request) error {
 		return fmt.Errorf("birthday is required")
 	}
 
-	if b.Email == "" {
-		return fmt.Errorf("email is required")
+	email, err := NormalizeEmail(b.Email)
+	if err != nil {
+		return err
+	}
+	b.Email = email
+
+	if b.GuardianID != nil {
+		guardianID, err := ParseID(b.GuardianID.String())
+		if err != nil {
+			return fmt.Errorf("invalid guardian_id")
+		}
+		b.GuardianID = &guardianID
 	}
 
 	if b.Name == "" {
@@ -47,34 +76,42 @@ func (b *BorrowerRequest) Bind(r *http.Request) error {
 	return nil
 }
 
-func (s *service) CreateBorrower(ctx context.Context, borrower BorrowerRequest) (*primitive.ObjectID, error) {
-	borrowerFilter := bson.D{
-		bson.E{Key: "name", Value: borrower.Name},
-		bson.E{Key: "birthday", Value: borrower.Birthday},
-	}
-	resultByName, err := s.getBorrowerByFilter(ctx, borrowerFilter)
-	if resultByName != nil || err != nil {
-		return nil, fmt.Errorf("borrower already exists")
+func (s *service) CreateBorrower(ctx context.Context, borrower BorrowerRequest) (*ID, error) {
+	newBorrower := Borrower{
+		ID:         NewID(),
+		Name:       borrower.Name,
+		Birthday:   borrower.Birthday,
+		Email:      borrower.Email,
+		GuardianID: borrower.GuardianID,
+		Books:      []ID{},
+		Loans:      []Loan{},
+		Version:    1,
 	}
 
-	emailFilter := bson.D{
-		bson.E{Key: "email", Value: borrower.Email},
-	}
-	resultByEmail, err := s.getBorrowerByFilter(ctx, emailFilter)
-	if resultByEmail != nil || err != nil {
-		return nil, fmt.Errorf("email already exists")
-	}
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		err := s.checkGuardian(ctx, "", borrower)
+		if err != nil {
+			return err
+		}
 
-	result, err := s.borrowersColl.InsertOne(ctx, borrower)
+		_, err = s.borrowersColl.InsertOne(ctx, newBorrower)
+		if conflict := asConflict("borrower", err); conflict != nil {
+			return conflict
+		}
+		if err != nil {
+			return fmt.Errorf("create borrower: %w", err)
+		}
+
+		return s.writeOutbox(ctx, BorrowerCreated, BorrowerCreatedData{Borrower: newBorrower})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create borrower: %v", err)
+		return nil, err
 	}
 
-	id := result.InsertedID.(primitive.ObjectID)
-	return &id, nil
+	return &newBorrower.ID, nil
 }
 
-func (s *service) GetBorrower(ctx context.Context, borrowerID primitive.ObjectID) (*Borrower, error) {
+func (s *service) GetBorrower(ctx context.Context, borrowerID ID) (*Borrower, error) {
 	filter := bson.D{
 		bson.E{Key: "_id", Value: borrowerID},
 	}
@@ -86,16 +123,16 @@ func (s *service) GetBorrower(ctx context.Context, borrowerID primitive.ObjectID
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("get borrower: %v", err)
+		return nil, fmt.Errorf("get borrower: %w", err)
 	}
 
 	return &borrower, nil
 }
 
-func (s *service) BorrowedBooks(ctx context.Context, borrowerID primitive.ObjectID) ([]Book, error) {
+func (s *service) BorrowedBooks(ctx context.Context, borrowerID ID, expand Expand) ([]Book, error) {
 	borrower, err := s.GetBorrower(ctx, borrowerID)
 	if err != nil {
-		return nil, fmt.Errorf("get borrower: %v", err)
+		return nil, fmt.Errorf("get borrower: %w", err)
 	}
 	if borrower == nil {
 		return nil, fmt.Errorf("borrower doesn't exist")
@@ -111,41 +148,141 @@ func (s *service) BorrowedBooks(ctx context.Context, borrowerID primitive.Object
 		},
 	}
 
-	cursor, err := s.booksColl.Find(ctx, filter)
+	books, err := s.findBooks(ctx, filter, expand)
 	if err != nil {
 		return nil, fmt.Errorf("find books: %v", err)
 	}
-	defer cursor.Close(ctx)
 
-	var books []Book
-	err = cursor.All(ctx, &books)
+	return books, nil
+}
+
+// UpdateBorrower replaces a borrower's details if the borrower is still at
+// version. It returns nil when the borrower doesn't exist and
+// ErrVersionMismatch when it has changed since.
+func (s *service) UpdateBorrower(ctx context.Context, borrowerID ID, borrower BorrowerRequest, version int64) (*Borrower, error) {
+	current, err := s.GetBorrower(ctx, borrowerID)
+	if err != nil {
+		return nil, fmt.Errorf("get borrower: %w", err)
+	}
+	if current == nil {
+		return nil, nil
+	}
+
+	err = s.checkGuardian(ctx, borrowerID, borrower)
 	if err != nil {
-		return nil, fmt.Errorf("decode books: %v", err)
+		return nil, err
 	}
 
-	return books, nil
-}
+	set := bson.M{
+		"name":     borrower.Name,
+		"birthday": borrower.Birthday,
+		"email":    borrower.Email,
+	}
+	// A new email has to be verified again. The version check below fails
+	// if the email changed since it was read.
+	if borrower.Email != current.Email {
+		set["verified_at"] = nil
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{
+			"version": 1,
+		},
+	}
+	if borrower.GuardianID != nil {
+		set["guardian_id"] = borrower.GuardianID
+	} else {
+		update["$unset"] = bson.M{"guardian_id": ""}
+	}
 
-func (s *service) getBorrowerByFilter(ctx context.Context, filter bson.D) (*Borrower, error) {
-	var borrower Borrower
-	err := s.borrowersColl.FindOne(ctx, filter).Decode(&borrower)
+	err = s.updateVersioned(ctx, s.borrowersColl, borrowerID, version, update)
+	if conflict := asConflict("borrower", err); conflict != nil {
+		return nil, conflict
+	}
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
 		}
+		return nil, fmt.Errorf("update borrower: %w", err)
+	}
+
+	return s.GetBorrower(ctx, borrowerID)
+}
+
+// VerifyBorrower marks a borrower verified if their email is still email,
+// and returns them. It returns nil when there's no such borrower or their
+// email has changed.
+func (s *service) VerifyBorrower(ctx context.Context, borrowerID ID, email string) (*Borrower, error) {
+	filter := bson.M{"_id": borrowerID, "email": email, "verified_at": nil}
+	update := bson.M{
+		"$set": bson.M{"verified_at": time.Now().UTC().Truncate(time.Millisecond)},
+		"$inc": bson.M{"version": 1},
+	}
+
+	_, err := s.borrowersColl.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("verify borrower: %v", err)
+	}
+
+	borrower, err := s.GetBorrower(ctx, borrowerID)
+	if err != nil || borrower == nil || borrower.Email != email {
 		return nil, err
 	}
-	return &borrower, nil
+
+	return borrower, nil
+}
+
+// DeleteBorrower removes a borrower with no borrowed books if the borrower is
+// still at version. It reports false when the borrower doesn't exist.
+func (s *service) DeleteBorrower(ctx context.Context, borrowerID ID, version int64) (bool, error) {
+	borrower, err := s.GetBorrower(ctx, borrowerID)
+	if err != nil {
+		return false, fmt.Errorf("get borrower: %w", err)
+	}
+	if borrower == nil {
+		return false, nil
+	}
+
+	if len(borrower.Books) > 0 {
+		return false, ErrBorrowerHasBooks
+	}
+
+	children, err := s.borrowersColl.CountDocuments(ctx, bson.M{"guardian_id": borrowerID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("count children: %v", err)
+	}
+	if children > 0 {
+		return false, ErrGuardianOfOthers
+	}
+
+	err = s.deleteVersioned(ctx, s.borrowersColl, borrowerID, version)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, fmt.Errorf("delete borrower: %w", err)
+	}
+
+	err = s.deleteNotifications(ctx, borrowerID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-func (s *service) borrowBookByUser(ctx context.Context, borrowerID primitive.ObjectID, bookID primitive.ObjectID) error {
+func (s *service) borrowBookByUser(ctx context.Context, borrowerID ID, loan Loan) error {
 	filter := bson.M{
 		"_id": borrowerID,
 	}
 
 	update := bson.M{
 		"$push": bson.M{
-			"books": bookID,
+			"books": loan.BookID,
+			"loans": loan,
+		},
+		"$inc": bson.M{
+			"version": 1,
 		},
 	}
 
@@ -157,7 +294,7 @@ func (s *service) borrowBookByUser(ctx context.Context, borrowerID primitive.Obj
 		if err == mongo.ErrNoDocuments {
 			return fmt.Errorf("borrower doesn't exist")
 		}
-		return fmt.Errorf("find and update: %v", err)
+		return fmt.Errorf("find and update: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,242 @@
+// Package cache wraps a database.Service with a read-through cache for
+// catalog reads: books, book lists and authors. Writes through the wrapper
+// invalidate the entries they affect, so a single API instance never serves
+// what it has itself overwritten; other instances sharing a Redis store see
+// the same invalidations, while ones with their own in-process store catch up
+// when entries expire.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultTTL is how long entries live when CACHE_TTL isn't set.
+const DefaultTTL = time.Minute
+
+// DefaultSize is how many entries the in-process store holds when
+// CACHE_SIZE isn't set.
+const DefaultSize = 10_000
+
+var (
+	storeName = os.Getenv("CACHE_STORE")
+	ttl       = os.Getenv("CACHE_TTL")
+	size      = os.Getenv("CACHE_SIZE")
+	redisURL  = os.Getenv("CACHE_REDIS_URL")
+)
+
+// Store keeps encoded entries until they expire. Implementations must be
+// safe for concurrent use.
+type Store interface {
+	// Get returns the entry for key and whether there was one.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Stats counts how the cache has been used since it was created.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Collapsed counts misses that waited for a concurrent load of the same
+	// entry instead of reading the database themselves.
+	Collapsed     uint64
+	Invalidations uint64
+	// Errors counts store failures. Reads that fail fall back to the
+	// database.
+	Errors uint64
+}
+
+// HitRatio is the share of reads served from the cache.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// service caches reads from the Service it embeds. Methods it doesn't
+// override go straight through.
+type service struct {
+	database.Service
+
+	store Store
+	ttl   time.Duration
+	group singleflight.Group
+
+	// generation is bumped by every invalidation. Loads that started before
+	// one don't store what they read, since it may be what was invalidated.
+	generation atomic.Uint64
+
+	hits, misses, collapsed, invalidations, errors atomic.Uint64
+}
+
+// New wraps next with the cache configured by CACHE_STORE: "memory" (the
+// default) keeps up to CACHE_SIZE entries in process, "redis" shares them
+// through the server at CACHE_REDIS_URL and "none" returns next as it is.
+// Entries live for CACHE_TTL. It exits if the store can't be set up.
+func New(next database.Service) database.Service {
+	entryTTL := DefaultTTL
+	if ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("invalid CACHE_TTL %q: %v", ttl, err)
+		}
+		entryTTL = parsed
+	}
+
+	var store Store
+	switch storeName {
+	case "", "memory":
+		entries := DefaultSize
+		if size != "" {
+			parsed, err := strconv.Atoi(size)
+			if err != nil || parsed <= 0 {
+				log.Fatalf("invalid CACHE_SIZE %q", size)
+			}
+			entries = parsed
+		}
+		store = NewLRU(entries)
+	case "redis":
+		redis, err := NewRedis(redisURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = redis
+	case "none":
+		return next
+	default:
+		log.Fatalf("unknown cache store %q, want memory, redis or none", storeName)
+	}
+
+	return NewService(next, store, entryTTL)
+}
+
+// NewService wraps next so catalog reads are served from store for up to
+// ttl.
+func NewService(next database.Service, store Store, ttl time.Duration) database.Service {
+	return &service{Service: next, store: store, ttl: ttl}
+}
+
+// Stats returns the counters so far.
+func (s *service) Stats() Stats {
+	return Stats{
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		Collapsed:     s.collapsed.Load(),
+		Invalidations: s.invalidations.Load(),
+		Errors:        s.errors.Load(),
+	}
+}
+
+// Health reports the wrapped service's health along with the cache counters.
+func (s *service) Health() map[string]string {
+	health := s.Service.Health()
+
+	stats := s.Stats()
+	health["cache_hits"] = strconv.FormatUint(stats.Hits, 10)
+	health["cache_misses"] = strconv.FormatUint(stats.Misses, 10)
+	health["cache_collapsed"] = strconv.FormatUint(stats.Collapsed, 10)
+	health["cache_errors"] = strconv.FormatUint(stats.Errors, 10)
+	health["cache_hit_ratio"] = strconv.FormatFloat(stats.HitRatio(), 'f', 3, 64)
+
+	return health
+}
+
+// read returns the entry for key, calling load on a miss. Concurrent misses
+// of the same key share one load. Nil results aren't stored, so things that
+// are created later aren't hidden.
+func read[T any](ctx context.Context, s *service, key string, load func(ctx context.Context) (*T, error)) (*T, error) {
+	span := trace.SpanFromContext(ctx)
+
+	data, ok, err := s.store.Get(ctx, key)
+	if err != nil {
+		s.errors.Add(1)
+		log.Printf("cache: get %s: %v", key, err)
+	}
+	if ok {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			s.hits.Add(1)
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			return &value, nil
+		}
+	}
+
+	s.misses.Add(1)
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	// The load outlives the caller that started it when others are waiting
+	// on it
+	loadCtx := context.WithoutCancel(ctx)
+	loaded := false
+	result, err, _ := s.group.Do(key, func() (any, error) {
+		loaded = true
+		generation := s.generation.Load()
+
+		value, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %v", key, err)
+		}
+
+		if value != nil && s.generation.Load() == generation {
+			err := s.store.Set(loadCtx, key, data, s.ttl)
+			if err != nil {
+				s.errors.Add(1)
+				log.Printf("cache: set %s: %v", key, err)
+			}
+		}
+
+		return data, nil
+	})
+	if !loaded {
+		s.collapsed.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Every caller decodes its own copy, so none can change another's
+	var value *T
+	err = json.Unmarshal(result.([]byte), &value)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %v", key, err)
+	}
+
+	return value, nil
+}
+
+// invalidate drops the entries for keys. Loads in flight when it's called
+// won't store their results.
+func (s *service) invalidate(ctx context.Context, keys ...string) {
+	s.generation.Add(1)
+	for _, key := range keys {
+		s.group.Forget(key)
+	}
+
+	err := s.store.Delete(context.WithoutCancel(ctx), keys...)
+	if err != nil {
+		s.errors.Add(1)
+		log.Printf("cache: invalidate %v: %v", keys, err)
+		return
+	}
+
+	s.invalidations.Add(uint64(len(keys)))
+}
@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/conformance"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) database.Service {
+		return NewService(memory.New(), NewLRU(100), time.Minute)
+	})
+}
+
+// countingService counts the catalog reads that reach the database, and
+// holds them while release is set.
+type countingService struct {
+	database.Service
+
+	loads   atomic.Int64
+	release chan struct{}
+}
+
+func (c *countingService) wait() {
+	c.loads.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+}
+
+func (c *countingService) ListBooks(ctx context.Context, expand database.Expand) ([]database.Book, error) {
+	c.wait()
+	return c.Service.ListBooks(ctx, expand)
+}
+
+func (c *countingService) GetBookExpanded(ctx context.Context, bookID database.ID, expand database.Expand) (*database.Book, error) {
+	c.wait()
+	return c.Service.GetBookExpanded(ctx, bookID, expand)
+}
+
+func (c *countingService) GetAuthor(ctx context.Context, authorID database.ID) (*database.Author, error) {
+	c.wait()
+	return c.Service.GetAuthor(ctx, authorID)
+}
+
+var birthday = time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+
+// newTestService returns a cached service over a catalog with one author
+// and one of their books.
+func newTestService(t *testing.T) (*service, *countingService, database.ID, database.ID) {
+	t.Helper()
+	ctx := context.Background()
+
+	next := &countingService{Service: memory.New()}
+	authorID, err := next.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "bober@author.com"})
+	require.NoError(t, err)
+	bookID, err := next.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+
+	return NewService(next, NewLRU(100), time.Minute).(*service), next, *authorID, *bookID
+}
+
+func TestReads(t *testing.T) {
+	ctx := context.Background()
+
+	testcases := []struct {
+		name string
+		read func(srv database.Service, authorID, bookID database.ID) (any, error)
+	}{
+		{
+			name: "book",
+			read: func(srv database.Service, authorID, bookID database.ID) (any, error) {
+				return srv.GetBook(ctx, bookID)
+			},
+		},
+		{
+			name: "book with authors",
+			read: func(srv database.Service, authorID, bookID database.ID) (any, error) {
+				return srv.GetBookExpanded(ctx, bookID, database.Expand{Author: true})
+			},
+		},
+		{
+			name: "books",
+			read: func(srv database.Service, authorID, bookID database.ID) (any, error) {
+				return srv.ListBooks(ctx, database.Expand{})
+			},
+		},
+		{
+			name: "author",
+			read: func(srv database.Service, authorID, bookID database.ID) (any, error) {
+				return srv.GetAuthor(ctx, authorID)
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should serve a repeated read of a "+testcase.name+" from the cache", func(t *testing.T) {
+			srv, next, authorID, bookID := newTestService(t)
+
+			first, err := testcase.read(srv, authorID, bookID)
+			require.NoError(t, err)
+			second, err := testcase.read(srv, authorID, bookID)
+			require.NoError(t, err)
+
+			assert.Equal(t, first, second)
+			assert.Equal(t, int64(1), next.loads.Load())
+			assert.Equal(t, Stats{Hits: 1, Misses: 1}, srv.Stats())
+		})
+	}
+
+	t.Run("should not cache reads that embed borrowers", func(t *testing.T) {
+		srv, next, _, bookID := newTestService(t)
+
+		for i := 0; i < 2; i++ {
+			_, err := srv.GetBookExpanded(ctx, bookID, database.Expand{Borrower: true})
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, int64(2), next.loads.Load())
+	})
+
+	t.Run("should not cache missing books", func(t *testing.T) {
+		srv, next, _, _ := newTestService(t)
+
+		for i := 0; i < 2; i++ {
+			book, err := srv.GetBook(ctx, database.NewID())
+			require.NoError(t, err)
+			assert.Nil(t, book)
+		}
+
+		assert.Equal(t, int64(2), next.loads.Load())
+	})
+
+	t.Run("should return copies callers can change", func(t *testing.T) {
+		srv, _, _, bookID := newTestService(t)
+
+		book, err := srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		book.Title = "Changed"
+		book.Contributors[0].Role = "changed"
+
+		book, err = srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		assert.Equal(t, "Hobbit", book.Title)
+		assert.Equal(t, database.RoleAuthor, book.Contributors[0].Role)
+	})
+
+	t.Run("should keep covers", func(t *testing.T) {
+		srv, _, _, bookID := newTestService(t)
+
+		_, err := srv.SetBookCover(ctx, bookID, database.CoverUpload{ContentType: "image/png", Image: []byte("cover")}, 1)
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			book, err := srv.GetBook(ctx, bookID)
+			require.NoError(t, err)
+			require.NotNil(t, book.Cover)
+			assert.Equal(t, "image/png", book.Cover.ContentType)
+		}
+	})
+}
+
+func TestInvalidation(t *testing.T) {
+	ctx := context.Background()
+
+	testcases := []struct {
+		name  string
+		read  func(srv database.Service, bookID database.ID) (any, error)
+		write func(t *testing.T, srv database.Service, authorID, bookID database.ID)
+	}{
+		{
+			name: "adding a book",
+			read: func(srv database.Service, bookID database.ID) (any, error) {
+				return srv.ListBooks(ctx, database.Expand{})
+			},
+			write: func(t *testing.T, srv database.Service, authorID, bookID database.ID) {
+				_, err := srv.AddBook(ctx, database.BookRequest{Title: "Silmarillion", AuthorID: authorID})
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "updating a book",
+			read: func(srv database.Service, bookID database.ID) (any, error) {
+				return srv.GetBook(ctx, bookID)
+			},
+			write: func(t *testing.T, srv database.Service, authorID, bookID database.ID) {
+				_, err := srv.UpdateBook(ctx, bookID, database.BookRequest{Title: "The Hobbit", AuthorID: authorID}, 1)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "borrowing a book",
+			read: func(srv database.Service, bookID database.ID) (any, error) {
+				return srv.ListBooks(ctx, database.Expand{Author: true})
+			},
+			write: func(t *testing.T, srv database.Service, authorID, bookID database.ID) {
+				borrowerID, err := srv.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "bober@hotmail.com"})
+				require.NoError(t, err)
+				_, err = srv.VerifyBorrower(ctx, *borrowerID, "bober@hotmail.com")
+				require.NoError(t, err)
+				err = srv.BorrowBook(ctx, bookID, *borrowerID)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "uploading a cover",
+			read: func(srv database.Service, bookID database.ID) (any, error) {
+				return srv.GetBookExpanded(ctx, bookID, database.Expand{Author: true})
+			},
+			write: func(t *testing.T, srv database.Service, authorID, bookID database.ID) {
+				_, err := srv.SetBookCover(ctx, bookID, database.CoverUpload{ContentType: "image/png", Image: []byte("cover")}, 1)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "updating an author of an expanded book",
+			read: func(srv database.Service, bookID database.ID) (any, error) {
+				return srv.GetBookExpanded(ctx, bookID, database.Expand{Author: true})
+			},
+			write: func(t *testing.T, srv database.Service, authorID, bookID database.ID) {
+				_, err := srv.UpdateAuthor(ctx, authorID, database.AuthorRequest{Name: "Bober Jr", Birthday: birthday, Email: "bober@author.com"}, 1)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "a write that fails on a stale version",
+			read: func(srv database.Service, bookID database.ID) (any, error) {
+				return srv.GetBook(ctx, bookID)
+			},
+			write: func(t *testing.T, srv database.Service, authorID, bookID database.ID) {
+				_, err := srv.DeleteBook(ctx, bookID, 5)
+				require.ErrorIs(t, err, database.ErrVersionMismatch)
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should reload after "+testcase.name, func(t *testing.T) {
+			srv, next, authorID, bookID := newTestService(t)
+
+			_, err := testcase.read(srv, bookID)
+			require.NoError(t, err)
+
+			testcase.write(t, srv, authorID, bookID)
+			loads := next.loads.Load()
+
+			cached, err := testcase.read(srv, bookID)
+			require.NoError(t, err)
+			assert.Equal(t, loads+1, next.loads.Load())
+
+			uncached, err := testcase.read(next.Service, bookID)
+			require.NoError(t, err)
+			assert.Equal(t, uncached, cached)
+		})
+	}
+}
+
+func TestConcurrentMisses(t *testing.T) {
+	srv, next, _, bookID := newTestService(t)
+	next.release = make(chan struct{})
+
+	const readers = 10
+	var wg sync.WaitGroup
+	books := make([]*database.Book, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			books[i], _ = srv.GetBook(context.Background(), bookID)
+		}(i)
+	}
+
+	// Let every reader miss and join the load before it finishes
+	require.Eventually(t, func() bool { return srv.Stats().Misses == readers }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), next.loads.Load())
+	assert.Equal(t, uint64(readers-1), srv.Stats().Collapsed)
+	for _, book := range books {
+		require.NotNil(t, book)
+		assert.Equal(t, "Hobbit", book.Title)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv, _, _, bookID := newTestService(t)
+
+	for i := 0; i < 4; i++ {
+		_, err := srv.GetBook(context.Background(), bookID)
+		require.NoError(t, err)
+	}
+
+	health := srv.Health()
+	assert.Equal(t, "It's healthy", health["message"])
+	assert.Equal(t, "3", health["cache_hits"])
+	assert.Equal(t, "1", health["cache_misses"])
+	assert.Equal(t, "0.750", health["cache_hit_ratio"])
+}
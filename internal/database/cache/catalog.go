@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"log"
+
+	"curly-computing-machine/internal/database"
+)
+
+// Keys are namespaced so a shared Redis can hold other things too. Reads
+// that embed borrowers aren't cached: loans change far more often than the
+// catalog.
+const (
+	keyPrefix       = "curly:"
+	bookKeyPrefix   = keyPrefix + "book:"
+	booksKey        = keyPrefix + "books"
+	authorKeyPrefix = keyPrefix + "author:"
+	withAuthors     = ":author"
+)
+
+func bookKey(bookID database.ID, expand database.Expand) string {
+	if expand.Author {
+		return bookKeyPrefix + bookID.String() + withAuthors
+	}
+	return bookKeyPrefix + bookID.String()
+}
+
+func booksKeyFor(expand database.Expand) string {
+	if expand.Author {
+		return booksKey + withAuthors
+	}
+	return booksKey
+}
+
+func authorKey(authorID database.ID) string {
+	return authorKeyPrefix + authorID.String()
+}
+
+// cachedBook is how books are stored. Book leaves its cover out of JSON,
+// since the API shows a URL instead.
+type cachedBook struct {
+	database.Book
+	Cover *database.Cover `json:"cover,omitempty"`
+}
+
+func newCachedBook(book database.Book) cachedBook {
+	return cachedBook{Book: book, Cover: book.Cover}
+}
+
+func (c cachedBook) book() database.Book {
+	book := c.Book
+	book.Cover = c.Cover
+	return book
+}
+
+func (s *service) ListBooks(ctx context.Context, expand database.Expand) ([]database.Book, error) {
+	if expand.Borrower {
+		return s.Service.ListBooks(ctx, expand)
+	}
+
+	cached, err := read(ctx, s, booksKeyFor(expand), func(ctx context.Context) (*[]cachedBook, error) {
+		books, err := s.Service.ListBooks(ctx, expand)
+		if err != nil {
+			return nil, err
+		}
+
+		cached := make([]cachedBook, 0, len(books))
+		for _, book := range books {
+			cached = append(cached, newCachedBook(book))
+		}
+		return &cached, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	books := make([]database.Book, 0, len(*cached))
+	for _, book := range *cached {
+		books = append(books, book.book())
+	}
+	return books, nil
+}
+
+func (s *service) GetBook(ctx context.Context, bookID database.ID) (*database.Book, error) {
+	return s.GetBookExpanded(ctx, bookID, database.Expand{})
+}
+
+// GetBookExpanded is GetBook with the related documents in expand embedded.
+func (s *service) GetBookExpanded(ctx context.Context, bookID database.ID, expand database.Expand) (*database.Book, error) {
+	if expand.Borrower {
+		return s.Service.GetBookExpanded(ctx, bookID, expand)
+	}
+
+	cached, err := read(ctx, s, bookKey(bookID, expand), func(ctx context.Context) (*cachedBook, error) {
+		book, err := s.Service.GetBookExpanded(ctx, bookID, expand)
+		if err != nil || book == nil {
+			return nil, err
+		}
+
+		cached := newCachedBook(*book)
+		return &cached, nil
+	})
+	if err != nil || cached == nil {
+		return nil, err
+	}
+
+	book := cached.book()
+	return &book, nil
+}
+
+func (s *service) GetAuthor(ctx context.Context, authorID database.ID) (*database.Author, error) {
+	return read(ctx, s, authorKey(authorID), func(ctx context.Context) (*database.Author, error) {
+		return s.Service.GetAuthor(ctx, authorID)
+	})
+}
+
+// Writes invalidate whether or not they succeed: a version mismatch means
+// the cached entry is stale anyway.
+
+func (s *service) AddBook(ctx context.Context, book database.BookRequest) (*database.ID, error) {
+	id, err := s.Service.AddBook(ctx, book)
+	s.invalidate(ctx, booksKey, booksKey+withAuthors)
+	return id, err
+}
+
+func (s *service) UpdateBook(ctx context.Context, bookID database.ID, book database.BookRequest, version int64) (*database.Book, error) {
+	updated, err := s.Service.UpdateBook(ctx, bookID, book, version)
+	s.invalidateBook(ctx, bookID)
+	return updated, err
+}
+
+func (s *service) DeleteBook(ctx context.Context, bookID database.ID, version int64) (bool, error) {
+	deleted, err := s.Service.DeleteBook(ctx, bookID, version)
+	s.invalidateBook(ctx, bookID)
+	return deleted, err
+}
+
+func (s *service) BorrowBook(ctx context.Context, bookID database.ID, borrowerID database.ID) error {
+	err := s.Service.BorrowBook(ctx, bookID, borrowerID)
+	s.invalidateBook(ctx, bookID)
+	return err
+}
+
+func (s *service) BorrowBookWithOverride(ctx context.Context, bookID database.ID, borrowerID database.ID, override database.Override) error {
+	err := s.Service.BorrowBookWithOverride(ctx, bookID, borrowerID, override)
+	s.invalidateBook(ctx, bookID)
+	return err
+}
+
+func (s *service) ReturnBook(ctx context.Context, bookID database.ID) error {
+	err := s.Service.ReturnBook(ctx, bookID)
+	s.invalidateBook(ctx, bookID)
+	return err
+}
+
+func (s *service) SetBookCover(ctx context.Context, bookID database.ID, cover database.CoverUpload, version int64) (*database.Book, error) {
+	book, err := s.Service.SetBookCover(ctx, bookID, cover, version)
+	s.invalidateBook(ctx, bookID)
+	return book, err
+}
+
+// UpdateAuthor also drops the books crediting the author, since they embed
+// the author when expanded.
+func (s *service) UpdateAuthor(ctx context.Context, authorID database.ID, author database.AuthorRequest, version int64) (*database.Author, error) {
+	updated, err := s.Service.UpdateAuthor(ctx, authorID, author, version)
+
+	keys := []string{authorKey(authorID), booksKey + withAuthors}
+	books, booksErr := s.Service.BooksByContributor(ctx, authorID, "")
+	if booksErr != nil {
+		// The books embedding the author stay stale until they expire
+		s.errors.Add(1)
+		log.Printf("cache: find books by author %s: %v", authorID.String(), booksErr)
+	}
+	for _, book := range books {
+		keys = append(keys, bookKey(book.ID, database.Expand{Author: true}))
+	}
+	s.invalidate(ctx, keys...)
+
+	return updated, err
+}
+
+// DeleteAuthor only succeeds for authors credited on no books, so no book
+// embeds them.
+func (s *service) DeleteAuthor(ctx context.Context, authorID database.ID, version int64) (bool, error) {
+	deleted, err := s.Service.DeleteAuthor(ctx, authorID, version)
+	s.invalidate(ctx, authorKey(authorID))
+	return deleted, err
+}
+
+// invalidateBook drops a book in every cached form, and the lists it's in.
+func (s *service) invalidateBook(ctx context.Context, bookID database.ID) {
+	s.invalidate(ctx,
+		bookKey(bookID, database.Expand{}),
+		bookKey(bookID, database.Expand{Author: true}),
+		booksKey,
+		booksKey+withAuthors,
+	)
+}
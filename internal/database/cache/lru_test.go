@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	store := NewLRU(2).(*lru)
+	store.now = func() time.Time { return now }
+
+	get := func(key string) (string, bool) {
+		value, ok, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		return string(value), ok
+	}
+
+	t.Run("should return stored entries", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+
+		value, ok := get("a")
+		assert.True(t, ok)
+		assert.Equal(t, "1", value)
+
+		_, ok = get("missing")
+		assert.False(t, ok)
+	})
+
+	t.Run("should evict the least recently used entry", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "b", []byte("2"), time.Minute))
+		get("a")
+		require.NoError(t, store.Set(ctx, "c", []byte("3"), time.Minute))
+
+		_, ok := get("b")
+		assert.False(t, ok)
+		_, ok = get("a")
+		assert.True(t, ok)
+		_, ok = get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("should replace an entry in place", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "a", []byte("4"), time.Minute))
+
+		value, _ := get("a")
+		assert.Equal(t, "4", value)
+		assert.Equal(t, 2, store.order.Len())
+	})
+
+	t.Run("should expire entries", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		_, ok := get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 1, store.order.Len())
+	})
+
+	t.Run("should delete entries", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "d", []byte("5"), time.Minute))
+		require.NoError(t, store.Delete(ctx, "d", "missing"))
+
+		_, ok := get("d")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	store, err := NewRedis("redis://" + server.Addr())
+	require.NoError(t, err)
+
+	t.Run("should miss keys that aren't set", func(t *testing.T) {
+		_, ok, err := store.Get(ctx, "curly:book:1")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("should return stored entries until they expire", func(t *testing.T) {
+		err := store.Set(ctx, "curly:book:1", []byte(`{"title":"Hobbit"}`), time.Minute)
+		require.NoError(t, err)
+
+		value, ok, err := store.Get(ctx, "curly:book:1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, `{"title":"Hobbit"}`, string(value))
+
+		server.FastForward(time.Minute)
+		_, ok, err = store.Get(ctx, "curly:book:1")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("should delete entries", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "curly:books", []byte("[]"), time.Minute))
+		require.NoError(t, store.Delete(ctx, "curly:books", "curly:books:author"))
+
+		assert.False(t, server.Exists("curly:books"))
+	})
+
+	t.Run("should fall back to the database when the server is down", func(t *testing.T) {
+		srv, next, _, bookID := newTestService(t)
+		srv.store = store
+		server.Close()
+
+		book, err := srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		assert.Equal(t, "Hobbit", book.Title)
+		assert.Equal(t, int64(1), next.loads.Load())
+		assert.NotZero(t, srv.Stats().Errors)
+	})
+}
+
+func TestNewRedis(t *testing.T) {
+	testcases := []struct {
+		name string
+		url  string
+	}{
+		{name: "missing url", url: ""},
+		{name: "invalid url", url: "http://localhost"},
+		{name: "unreachable server", url: "redis://127.0.0.1:1"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should fail for "+testcase.name, func(t *testing.T) {
+			store, err := NewRedis(testcase.url)
+			assert.Error(t, err)
+			assert.Nil(t, store)
+		})
+	}
+}
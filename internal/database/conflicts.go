@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ConflictError is returned by writes that would break a unique index, such
+// as creating a second author with the same email.
+type ConflictError struct {
+	// Resource is the kind of document written: "author", "borrower" or "book".
+	Resource string
+	// Field is the field that must be unique. Name and title conflicts are
+	// on the resource's identity, name+birthday or title+author_id. It is
+	// empty when the violated index isn't known.
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" || e.Field == "name" || e.Field == "title" {
+		return e.Resource + " already exists"
+	}
+	return e.Field + " already exists"
+}
+
+// uniqueIndexFields maps the unique indexes created by migrations to the
+// field reported when they are violated.
+var uniqueIndexFields = map[string]string{
+	"email_1":             "email",
+	"name_1_birthday_1":   "name",
+	"author_id_1_title_1": "title",
+	"isbn_1":              "isbn",
+}
+
+var duplicateKeyIndex = regexp.MustCompile(`index: (\S+) dup key`)
+
+// asConflict turns a duplicate key error from writing resource into a
+// ConflictError and returns nil for any other error.
+func asConflict(resource string, err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+
+	conflict := &ConflictError{Resource: resource}
+
+	var writeErr mongo.WriteException
+	var cmdErr mongo.CommandError
+	message := err.Error()
+	if errors.As(err, &writeErr) && len(writeErr.WriteErrors) > 0 {
+		message = writeErr.WriteErrors[0].Message
+	} else if errors.As(err, &cmdErr) {
+		message = cmdErr.Message
+	}
+
+	if match := duplicateKeyIndex.FindStringSubmatch(message); match != nil {
+		conflict.Field = uniqueIndexFields[match[1]]
+	}
+
+	return conflict
+}
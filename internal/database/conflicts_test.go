@@ -0,0 +1,63 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAsConflict(t *testing.T) {
+	duplicate := func(index string) error {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+			Code:    11000,
+			Message: fmt.Sprintf(`E11000 duplicate key error collection: curly.authors index: %s dup key: { email: "bober@author.com" }`, index),
+		}}}
+	}
+
+	testcases := []struct {
+		name     string
+		err      error
+		conflict *ConflictError
+		errMsg   string
+	}{
+		{
+			name:     "email",
+			err:      duplicate("email_1"),
+			conflict: &ConflictError{Resource: "author", Field: "email"},
+			errMsg:   "email already exists",
+		},
+		{
+			name:     "name and birthday",
+			err:      duplicate("name_1_birthday_1"),
+			conflict: &ConflictError{Resource: "author", Field: "name"},
+			errMsg:   "author already exists",
+		},
+		{
+			name:     "unknown index",
+			err:      duplicate("legacy_1"),
+			conflict: &ConflictError{Resource: "author"},
+			errMsg:   "author already exists",
+		},
+		{
+			name: "other write error",
+			err:  mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 121, Message: "Document failed validation"}}},
+		},
+		{
+			name: "no error",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := asConflict("author", tc.err)
+			if tc.conflict == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.Equal(t, tc.conflict, err)
+			assert.EqualError(t, err, tc.errMsg)
+		})
+	}
+}
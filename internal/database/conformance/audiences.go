@@ -0,0 +1,241 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAgeRestrictions(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	// Ages are counted from today, so birthdays are too
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	bornYearsAgo := func(years int) time.Time {
+		return today.AddDate(-years, 0, -1)
+	}
+
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	parentID := createVerifiedBorrower(t, srv, "Bober", "bober@hotmail.com")
+
+	createChild := func(t *testing.T, name, email string, age int) database.ID {
+		t.Helper()
+
+		id, err := srv.CreateBorrower(ctx, database.BorrowerRequest{
+			Name:       name,
+			Birthday:   bornYearsAgo(age),
+			Email:      email,
+			GuardianID: &parentID,
+		})
+		require.NoError(t, err)
+
+		borrower, err := srv.VerifyBorrower(ctx, *id, email)
+		require.NoError(t, err)
+		require.NotNil(t, borrower)
+
+		return *id
+	}
+	childID := createChild(t, "Bobrzyk", "bobrzyk@hotmail.com", 10)
+	teenID := createChild(t, "Bobrzyca", "bobrzyca@hotmail.com", 14)
+
+	addRatedBook := func(t *testing.T, title, audience string) database.ID {
+		t.Helper()
+
+		id, err := srv.AddBook(ctx, database.BookRequest{Title: title, AuthorID: authorID, Available: true, Audience: audience})
+		require.NoError(t, err)
+
+		return *id
+	}
+
+	t.Run("should rate books for everyone by default", func(t *testing.T) {
+		book, err := srv.GetBook(ctx, addBook(t, srv, "Hobbit", authorID))
+		require.NoError(t, err)
+		assert.Equal(t, database.AudienceAll, book.Audience)
+	})
+
+	t.Run("should update a book's audience", func(t *testing.T) {
+		bookID := addBook(t, srv, "Silmarillion", authorID)
+
+		book, err := srv.UpdateBook(ctx, bookID, database.BookRequest{Title: "Silmarillion", AuthorID: authorID, Audience: database.AudienceTeen}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, database.AudienceTeen, book.Audience)
+	})
+
+	t.Run("should lend books to borrowers old enough for them", func(t *testing.T) {
+		bookID := addRatedBook(t, "Catcher in the Rye", database.AudienceTeen)
+
+		require.NoError(t, srv.BorrowBook(ctx, bookID, teenID))
+		require.NoError(t, srv.ReturnBook(ctx, bookID))
+		require.NoError(t, srv.BorrowBook(ctx, bookID, parentID))
+		require.NoError(t, srv.ReturnBook(ctx, bookID))
+	})
+
+	t.Run("should not lend books to borrowers too young for them", func(t *testing.T) {
+		bookID := addRatedBook(t, "It", database.AudienceMature)
+
+		err := srv.BorrowBook(ctx, bookID, teenID)
+		assert.ErrorIs(t, err, database.ErrAgeRestricted)
+
+		book, err := srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		assert.True(t, book.Available)
+	})
+
+	t.Run("should lend and record overridden age restrictions", func(t *testing.T) {
+		bookID := addRatedBook(t, "American Psycho", database.AudienceAdult)
+
+		err := srv.BorrowBookWithOverride(ctx, bookID, childID, database.Override{Librarian: "ania", Reason: "school project"})
+		require.NoError(t, err)
+
+		book, err := srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		assert.False(t, book.Available)
+
+		overrides, err := srv.ListAgeOverrides(ctx, childID)
+		require.NoError(t, err)
+		require.Len(t, overrides, 1)
+		assert.Equal(t, bookID, overrides[0].BookID)
+		assert.Equal(t, childID, overrides[0].BorrowerID)
+		assert.Equal(t, "Bobrzyk", overrides[0].BorrowerName)
+		assert.Equal(t, database.AudienceAdult, overrides[0].Audience)
+		assert.Equal(t, 10, overrides[0].BorrowerAge)
+		assert.Equal(t, "ania", overrides[0].Librarian)
+		assert.Equal(t, "school project", overrides[0].Reason)
+		assert.WithinDuration(t, time.Now(), overrides[0].CreatedAt, time.Minute)
+
+		require.NoError(t, srv.ReturnBook(ctx, bookID))
+	})
+
+	t.Run("should not record overrides that weren't needed", func(t *testing.T) {
+		bookID := addRatedBook(t, "Matilda", database.AudienceAll)
+
+		err := srv.BorrowBookWithOverride(ctx, bookID, teenID, database.Override{Librarian: "ania", Reason: "just in case"})
+		require.NoError(t, err)
+		require.NoError(t, srv.ReturnBook(ctx, bookID))
+
+		overrides, err := srv.ListAgeOverrides(ctx, teenID)
+		require.NoError(t, err)
+		assert.Empty(t, overrides)
+	})
+
+	t.Run("should list a guardian's children oldest first", func(t *testing.T) {
+		children, err := srv.ListChildren(ctx, parentID)
+		require.NoError(t, err)
+		require.Len(t, children, 2)
+		assert.Equal(t, teenID, children[0].ID)
+		assert.Equal(t, childID, children[1].ID)
+		require.NotNil(t, children[0].GuardianID)
+		assert.Equal(t, parentID, *children[0].GuardianID)
+
+		children, err = srv.ListChildren(ctx, childID)
+		require.NoError(t, err)
+		assert.Empty(t, children)
+	})
+
+	t.Run("should refuse guardians who can't be", func(t *testing.T) {
+		minorID, err := srv.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bobrek", Birthday: bornYearsAgo(17), Email: "bobrek@hotmail.com"})
+		require.NoError(t, err)
+		missingID := database.NewID()
+
+		tests := []struct {
+			name       string
+			guardianID database.ID
+		}{
+			{name: "missing", guardianID: missingID},
+			{name: "underage", guardianID: *minorID},
+			{name: "child", guardianID: childID},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := srv.CreateBorrower(ctx, database.BorrowerRequest{
+					Name:       "Bobas",
+					Birthday:   bornYearsAgo(5),
+					Email:      "bobas@hotmail.com",
+					GuardianID: &tt.guardianID,
+				})
+				var guardianErr *database.GuardianError
+				assert.True(t, errors.As(err, &guardianErr), "got %v", err)
+			})
+		}
+
+		t.Run("guardian becoming a child", func(t *testing.T) {
+			current, err := srv.GetBorrower(ctx, parentID)
+			require.NoError(t, err)
+
+			_, err = srv.UpdateBorrower(ctx, parentID, database.BorrowerRequest{
+				Name:       current.Name,
+				Birthday:   current.Birthday,
+				Email:      current.Email,
+				GuardianID: &teenID,
+			}, current.Version)
+			var guardianErr *database.GuardianError
+			assert.True(t, errors.As(err, &guardianErr), "got %v", err)
+		})
+
+		t.Run("themselves", func(t *testing.T) {
+			current, err := srv.GetBorrower(ctx, *minorID)
+			require.NoError(t, err)
+
+			_, err = srv.UpdateBorrower(ctx, *minorID, database.BorrowerRequest{
+				Name:       current.Name,
+				Birthday:   current.Birthday,
+				Email:      current.Email,
+				GuardianID: minorID,
+			}, current.Version)
+			var guardianErr *database.GuardianError
+			assert.True(t, errors.As(err, &guardianErr), "got %v", err)
+		})
+	})
+
+	t.Run("should unlink children from their guardian", func(t *testing.T) {
+		current, err := srv.GetBorrower(ctx, teenID)
+		require.NoError(t, err)
+
+		borrower, err := srv.UpdateBorrower(ctx, teenID, database.BorrowerRequest{
+			Name:     current.Name,
+			Birthday: current.Birthday,
+			Email:    current.Email,
+		}, current.Version)
+		require.NoError(t, err)
+		assert.Nil(t, borrower.GuardianID)
+
+		children, err := srv.ListChildren(ctx, parentID)
+		require.NoError(t, err)
+		require.Len(t, children, 1)
+		assert.Equal(t, childID, children[0].ID)
+	})
+
+	t.Run("should not delete guardians of other borrowers", func(t *testing.T) {
+		current, err := srv.GetBorrower(ctx, parentID)
+		require.NoError(t, err)
+
+		_, err = srv.DeleteBorrower(ctx, parentID, current.Version)
+		assert.ErrorIs(t, err, database.ErrGuardianOfOthers)
+
+		current, err = srv.GetBorrower(ctx, childID)
+		require.NoError(t, err)
+
+		deleted, err := srv.DeleteBorrower(ctx, childID, current.Version)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		// Overrides are kept as a record of what was lent
+		overrides, err := srv.ListAgeOverrides(ctx, childID)
+		require.NoError(t, err)
+		require.Len(t, overrides, 1)
+		assert.Equal(t, "Bobrzyk", overrides[0].BorrowerName)
+
+		current, err = srv.GetBorrower(ctx, parentID)
+		require.NoError(t, err)
+
+		deleted, err = srv.DeleteBorrower(ctx, parentID, current.Version)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+	})
+}
@@ -0,0 +1,531 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuthors(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	otherID := createAuthor(t, srv, "Skunks", "skunks@author.com")
+
+	t.Run("should get author", func(t *testing.T) {
+		author, err := srv.GetAuthor(ctx, authorID)
+		require.NoError(t, err)
+		require.NotNil(t, author)
+		assert.Equal(t, authorID, author.ID)
+		assert.Equal(t, "Bober", author.Name)
+		assert.Equal(t, "bober@author.com", author.Email)
+		assert.True(t, birthday.Equal(author.Birthday))
+		assert.Equal(t, int64(1), author.Version)
+	})
+
+	t.Run("should find author by email and name", func(t *testing.T) {
+		author, err := srv.FindAuthorByEmail(ctx, "bober@author.com")
+		require.NoError(t, err)
+		require.NotNil(t, author)
+		assert.Equal(t, authorID, author.ID)
+
+		author, err = srv.FindAuthorByName(ctx, "Bober")
+		require.NoError(t, err)
+		require.NotNil(t, author)
+		assert.Equal(t, authorID, author.ID)
+	})
+
+	lookups := []struct {
+		name string
+		find func() (*database.Author, error)
+	}{
+		{name: "id", find: func() (*database.Author, error) { return srv.GetAuthor(ctx, database.NewID()) }},
+		{name: "empty id", find: func() (*database.Author, error) { return srv.GetAuthor(ctx, "") }},
+		{name: "email", find: func() (*database.Author, error) { return srv.FindAuthorByEmail(ctx, "nobody@author.com") }},
+		{name: "name", find: func() (*database.Author, error) { return srv.FindAuthorByName(ctx, "Nobody") }},
+	}
+
+	for _, lookup := range lookups {
+		t.Run("should return nil for a missing author by "+lookup.name, func(t *testing.T) {
+			author, err := lookup.find()
+			assert.NoError(t, err)
+			assert.Nil(t, author)
+		})
+	}
+
+	duplicates := []struct {
+		name    string
+		request database.AuthorRequest
+		field   string
+		errMsg  string
+	}{
+		{
+			name:    "name and birthday",
+			request: database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "pingvin@author.com"},
+			field:   "name",
+			errMsg:  "author already exists",
+		},
+		{
+			name:    "email",
+			request: database.AuthorRequest{Name: "Pingvin", Birthday: birthday, Email: "bober@author.com"},
+			field:   "email",
+			errMsg:  "email already exists",
+		},
+	}
+
+	for _, duplicate := range duplicates {
+		t.Run("should refuse a duplicate "+duplicate.name, func(t *testing.T) {
+			id, err := srv.CreateAuthor(ctx, duplicate.request)
+			var conflict *database.ConflictError
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, "author", conflict.Resource)
+			assert.Equal(t, duplicate.field, conflict.Field)
+			assert.EqualError(t, err, duplicate.errMsg)
+			assert.Nil(t, id)
+		})
+
+		t.Run("should refuse to update to a duplicate "+duplicate.name, func(t *testing.T) {
+			author, err := srv.UpdateAuthor(ctx, otherID, duplicate.request, 1)
+			var conflict *database.ConflictError
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, duplicate.field, conflict.Field)
+			assert.Nil(t, author)
+		})
+	}
+
+	t.Run("should allow the same name with another birthday", func(t *testing.T) {
+		id, err := srv.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: birthday.AddDate(1, 0, 0), Email: "bober2@author.com"})
+		assert.NoError(t, err)
+		assert.NotNil(t, id)
+	})
+
+	t.Run("should update author and bump version", func(t *testing.T) {
+		author, err := srv.UpdateAuthor(ctx, authorID, database.AuthorRequest{Name: "Bober Jr", Birthday: birthday, Email: "bober@author.com"}, 1)
+		require.NoError(t, err)
+		require.NotNil(t, author)
+		assert.Equal(t, "Bober Jr", author.Name)
+		assert.Equal(t, int64(2), author.Version)
+	})
+
+	t.Run("should not update author with a stale version", func(t *testing.T) {
+		author, err := srv.UpdateAuthor(ctx, authorID, database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "bober@author.com"}, 1)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+		assert.Nil(t, author)
+	})
+
+	t.Run("should not update author if author doesn't exist", func(t *testing.T) {
+		author, err := srv.UpdateAuthor(ctx, database.NewID(), database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "new@author.com"}, 1)
+		assert.NoError(t, err)
+		assert.Nil(t, author)
+	})
+
+	t.Run("should not delete author with a stale version", func(t *testing.T) {
+		deleted, err := srv.DeleteAuthor(ctx, authorID, 1)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+		assert.False(t, deleted)
+	})
+
+	t.Run("should delete author", func(t *testing.T) {
+		deleted, err := srv.DeleteAuthor(ctx, authorID, 2)
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+
+		author, err := srv.GetAuthor(ctx, authorID)
+		assert.NoError(t, err)
+		assert.Nil(t, author)
+	})
+
+	t.Run("should not delete author if author doesn't exist", func(t *testing.T) {
+		deleted, err := srv.DeleteAuthor(ctx, authorID, 2)
+		assert.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
+
+func testBorrowers(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+	borrowerID := createBorrower(t, srv, "Bober", "bober@hotmail.com")
+	otherID := createBorrower(t, srv, "Skunks", "skunks@hotmail.com")
+
+	t.Run("should get borrower with no books", func(t *testing.T) {
+		borrower, err := srv.GetBorrower(ctx, borrowerID)
+		require.NoError(t, err)
+		require.NotNil(t, borrower)
+		assert.Equal(t, "Bober", borrower.Name)
+		assert.Equal(t, "bober@hotmail.com", borrower.Email)
+		assert.True(t, birthday.Equal(borrower.Birthday))
+		assert.Empty(t, borrower.Books)
+		assert.Empty(t, borrower.Loans)
+		assert.Equal(t, int64(1), borrower.Version)
+	})
+
+	t.Run("should list no borrowed books for borrower without books", func(t *testing.T) {
+		books, err := srv.BorrowedBooks(ctx, borrowerID, database.Expand{})
+		assert.NoError(t, err)
+		assert.Empty(t, books)
+	})
+
+	lookups := []struct {
+		name string
+		id   database.ID
+	}{
+		{name: "id", id: database.NewID()},
+		{name: "empty id", id: ""},
+	}
+
+	for _, lookup := range lookups {
+		t.Run("should return nil for a missing borrower by "+lookup.name, func(t *testing.T) {
+			borrower, err := srv.GetBorrower(ctx, lookup.id)
+			assert.NoError(t, err)
+			assert.Nil(t, borrower)
+		})
+	}
+
+	t.Run("should not list borrowed books if borrower doesn't exist", func(t *testing.T) {
+		books, err := srv.BorrowedBooks(ctx, database.NewID(), database.Expand{})
+		assert.EqualError(t, err, "borrower doesn't exist")
+		assert.Nil(t, books)
+	})
+
+	duplicates := []struct {
+		name    string
+		request database.BorrowerRequest
+		field   string
+		errMsg  string
+	}{
+		{
+			name:    "name and birthday",
+			request: database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "other@hotmail.com"},
+			field:   "name",
+			errMsg:  "borrower already exists",
+		},
+		{
+			name:    "email",
+			request: database.BorrowerRequest{Name: "Bober", Birthday: birthday.AddDate(0, 0, 1), Email: "bober@hotmail.com"},
+			field:   "email",
+			errMsg:  "email already exists",
+		},
+	}
+
+	for _, duplicate := range duplicates {
+		t.Run("should refuse a duplicate "+duplicate.name, func(t *testing.T) {
+			id, err := srv.CreateBorrower(ctx, duplicate.request)
+			var conflict *database.ConflictError
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, "borrower", conflict.Resource)
+			assert.Equal(t, duplicate.field, conflict.Field)
+			assert.EqualError(t, err, duplicate.errMsg)
+			assert.Nil(t, id)
+		})
+
+		t.Run("should refuse to update to a duplicate "+duplicate.name, func(t *testing.T) {
+			borrower, err := srv.UpdateBorrower(ctx, otherID, duplicate.request, 1)
+			var conflict *database.ConflictError
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, duplicate.field, conflict.Field)
+			assert.Nil(t, borrower)
+		})
+	}
+
+	t.Run("should update borrower and bump version", func(t *testing.T) {
+		borrower, err := srv.UpdateBorrower(ctx, borrowerID, database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "bober@gmail.com"}, 1)
+		require.NoError(t, err)
+		require.NotNil(t, borrower)
+		assert.Equal(t, "bober@gmail.com", borrower.Email)
+		assert.Equal(t, int64(2), borrower.Version)
+	})
+
+	t.Run("should not update borrower with a stale version", func(t *testing.T) {
+		borrower, err := srv.UpdateBorrower(ctx, borrowerID, database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "bober@hotmail.com"}, 1)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+		assert.Nil(t, borrower)
+	})
+
+	t.Run("should not update borrower if borrower doesn't exist", func(t *testing.T) {
+		borrower, err := srv.UpdateBorrower(ctx, database.NewID(), database.BorrowerRequest{Name: "Nobody", Birthday: birthday, Email: "nobody@hotmail.com"}, 1)
+		assert.NoError(t, err)
+		assert.Nil(t, borrower)
+	})
+
+	t.Run("should not delete borrower with a stale version", func(t *testing.T) {
+		deleted, err := srv.DeleteBorrower(ctx, borrowerID, 1)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+		assert.False(t, deleted)
+	})
+
+	t.Run("should delete borrower", func(t *testing.T) {
+		deleted, err := srv.DeleteBorrower(ctx, borrowerID, 2)
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+
+		borrower, err := srv.GetBorrower(ctx, borrowerID)
+		assert.NoError(t, err)
+		assert.Nil(t, borrower)
+	})
+
+	t.Run("should not delete borrower if borrower doesn't exist", func(t *testing.T) {
+		deleted, err := srv.DeleteBorrower(ctx, borrowerID, 2)
+		assert.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
+
+func testBooks(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	translatorID := createAuthor(t, srv, "Skunk", "skunk@author.com")
+
+	t.Run("should list no books in an empty catalog", func(t *testing.T) {
+		books, err := srv.ListBooks(ctx, database.Expand{})
+		assert.NoError(t, err)
+		assert.NotNil(t, books)
+		assert.Empty(t, books)
+	})
+
+	request := database.BookRequest{
+		Title:       "Hobbit",
+		ISBN:        "9780261102217",
+		Description: "The Hobbit is set in Middle-earth",
+		AuthorID:    authorID,
+		Contributors: []database.Contributor{
+			{AuthorID: translatorID, Role: database.RoleTranslator},
+		},
+		Genres:    []string{"fantasy"},
+		Available: true,
+	}
+	bookID, err := srv.AddBook(ctx, request)
+	require.NoError(t, err)
+
+	t.Run("should get book with its contributors", func(t *testing.T) {
+		book, err := srv.GetBook(ctx, *bookID)
+		require.NoError(t, err)
+		require.NotNil(t, book)
+		assert.Equal(t, "Hobbit", book.Title)
+		assert.Equal(t, request.ISBN, book.ISBN)
+		assert.Equal(t, request.Description, book.Description)
+		assert.Equal(t, authorID, book.AuthorID)
+		assert.Equal(t, []string{"fantasy"}, book.Genres)
+		assert.True(t, book.Available)
+		assert.Equal(t, int64(1), book.Version)
+		assert.Nil(t, book.Cover)
+		assert.Nil(t, book.Author)
+		assert.Nil(t, book.Borrower)
+		assert.Equal(t, []database.Contributor{
+			{AuthorID: authorID, Role: database.RoleAuthor},
+			{AuthorID: translatorID, Role: database.RoleTranslator},
+		}, book.Contributors)
+	})
+
+	t.Run("should list books", func(t *testing.T) {
+		books, err := srv.ListBooks(ctx, database.Expand{})
+		require.NoError(t, err)
+		require.Len(t, books, 1)
+		assert.Equal(t, *bookID, books[0].ID)
+	})
+
+	t.Run("should get book by isbn", func(t *testing.T) {
+		book, err := srv.GetBookByISBN(ctx, request.ISBN)
+		require.NoError(t, err)
+		require.NotNil(t, book)
+		assert.Equal(t, *bookID, book.ID)
+	})
+
+	lookups := []struct {
+		name string
+		find func() (*database.Book, error)
+	}{
+		{name: "id", find: func() (*database.Book, error) { return srv.GetBook(ctx, database.NewID()) }},
+		{name: "empty id", find: func() (*database.Book, error) { return srv.GetBook(ctx, "") }},
+		{name: "isbn", find: func() (*database.Book, error) { return srv.GetBookByISBN(ctx, "9780000000002") }},
+		{name: "expanded id", find: func() (*database.Book, error) {
+			return srv.GetBookExpanded(ctx, database.NewID(), database.Expand{Author: true, Borrower: true})
+		}},
+	}
+
+	for _, lookup := range lookups {
+		t.Run("should return nil for a missing book by "+lookup.name, func(t *testing.T) {
+			book, err := lookup.find()
+			assert.NoError(t, err)
+			assert.Nil(t, book)
+		})
+	}
+
+	t.Run("should embed authors when expanded", func(t *testing.T) {
+		book, err := srv.GetBookExpanded(ctx, *bookID, database.Expand{Author: true})
+		require.NoError(t, err)
+		require.NotNil(t, book.Author)
+		assert.Equal(t, "Bober", book.Author.Name)
+		require.NotNil(t, book.Contributors[0].Author)
+		assert.Equal(t, "Bober", book.Contributors[0].Author.Name)
+		require.NotNil(t, book.Contributors[1].Author)
+		assert.Equal(t, "Skunk", book.Contributors[1].Author.Name)
+		assert.Nil(t, book.Borrower)
+	})
+
+	t.Run("should credit the first author as primary", func(t *testing.T) {
+		id, err := srv.AddBook(ctx, database.BookRequest{
+			Title: "Silmarillion",
+			Contributors: []database.Contributor{
+				{AuthorID: translatorID, Role: database.RoleEditor},
+				{AuthorID: authorID},
+			},
+			Available: true,
+		})
+		require.NoError(t, err)
+
+		book, err := srv.GetBook(ctx, *id)
+		require.NoError(t, err)
+		assert.Equal(t, authorID, book.AuthorID)
+		assert.Equal(t, []database.Contributor{
+			{AuthorID: translatorID, Role: database.RoleEditor},
+			{AuthorID: authorID, Role: database.RoleAuthor},
+		}, book.Contributors)
+	})
+
+	contributions := []struct {
+		name     string
+		authorID database.ID
+		role     string
+		books    int
+	}{
+		{name: "should list books in any role", authorID: translatorID, books: 2},
+		{name: "should list books in a role", authorID: translatorID, role: database.RoleTranslator, books: 1},
+		{name: "should not list books in another role", authorID: translatorID, role: database.RoleIllustrator, books: 0},
+		{name: "should list books of the primary author", authorID: authorID, role: database.RoleAuthor, books: 2},
+		{name: "should list no books for a missing author", authorID: database.NewID(), books: 0},
+	}
+
+	for _, contribution := range contributions {
+		t.Run(contribution.name, func(t *testing.T) {
+			books, err := srv.BooksByContributor(ctx, contribution.authorID, contribution.role)
+			require.NoError(t, err)
+			assert.NotNil(t, books)
+			assert.Len(t, books, contribution.books)
+		})
+	}
+
+	failures := []struct {
+		name   string
+		book   database.BookRequest
+		errMsg string
+	}{
+		{
+			name:   "author doesn't exist",
+			book:   database.BookRequest{Title: "Hoho", AuthorID: database.NewID(), Available: true},
+			errMsg: "author doesn't exist",
+		},
+		{
+			name: "contributor doesn't exist",
+			book: database.BookRequest{
+				Title:        "Hoho",
+				AuthorID:     authorID,
+				Contributors: []database.Contributor{{AuthorID: database.NewID(), Role: database.RoleEditor}},
+			},
+			errMsg: "author doesn't exist",
+		},
+		{
+			name:   "title already exists for the author",
+			book:   database.BookRequest{Title: "Hobbit", AuthorID: authorID},
+			errMsg: "book already exists",
+		},
+		{
+			name:   "isbn already exists",
+			book:   database.BookRequest{Title: "The Hobbit", ISBN: request.ISBN, AuthorID: translatorID},
+			errMsg: "isbn already exists",
+		},
+	}
+
+	for _, failure := range failures {
+		t.Run("should not add book if "+failure.name, func(t *testing.T) {
+			id, err := srv.AddBook(ctx, failure.book)
+			assert.ErrorContains(t, err, failure.errMsg)
+			assert.Nil(t, id)
+		})
+	}
+
+	t.Run("should name the missing author", func(t *testing.T) {
+		missingID := database.NewID()
+		book := database.BookRequest{Title: "Hoho", AuthorID: authorID, Contributors: []database.Contributor{{AuthorID: missingID, Role: database.RoleEditor}}}
+
+		_, err := srv.AddBook(ctx, book)
+		var missing *database.MissingAuthorError
+		require.ErrorAs(t, err, &missing)
+		assert.Equal(t, missingID, missing.AuthorID)
+
+		_, err = srv.UpdateBook(ctx, *bookID, book, 1)
+		require.ErrorAs(t, err, &missing)
+		assert.Equal(t, missingID, missing.AuthorID)
+	})
+
+	t.Run("should allow the same title by another author", func(t *testing.T) {
+		id, err := srv.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: translatorID})
+		assert.NoError(t, err)
+		assert.NotNil(t, id)
+	})
+
+	t.Run("should refuse to delete a credited author", func(t *testing.T) {
+		deleted, err := srv.DeleteAuthor(ctx, translatorID, 1)
+		assert.ErrorIs(t, err, database.ErrAuthorHasBooks)
+		assert.EqualError(t, err, "author has books")
+		assert.False(t, deleted)
+	})
+
+	t.Run("should update book and bump version", func(t *testing.T) {
+		update := request
+		update.Title = "The Hobbit"
+		update.ISBN = ""
+		book, err := srv.UpdateBook(ctx, *bookID, update, 1)
+		require.NoError(t, err)
+		require.NotNil(t, book)
+		assert.Equal(t, "The Hobbit", book.Title)
+		assert.Empty(t, book.ISBN)
+		assert.Equal(t, int64(2), book.Version)
+	})
+
+	t.Run("should free the isbn of an updated book", func(t *testing.T) {
+		book, err := srv.GetBookByISBN(ctx, request.ISBN)
+		assert.NoError(t, err)
+		assert.Nil(t, book)
+	})
+
+	t.Run("should not update book with a stale version", func(t *testing.T) {
+		book, err := srv.UpdateBook(ctx, *bookID, request, 1)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+		assert.Nil(t, book)
+	})
+
+	t.Run("should not update book if book doesn't exist", func(t *testing.T) {
+		book, err := srv.UpdateBook(ctx, database.NewID(), request, 1)
+		assert.NoError(t, err)
+		assert.Nil(t, book)
+	})
+
+	t.Run("should not delete book with a stale version", func(t *testing.T) {
+		deleted, err := srv.DeleteBook(ctx, *bookID, 1)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+		assert.False(t, deleted)
+	})
+
+	t.Run("should delete book", func(t *testing.T) {
+		deleted, err := srv.DeleteBook(ctx, *bookID, 2)
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+
+		book, err := srv.GetBook(ctx, *bookID)
+		assert.NoError(t, err)
+		assert.Nil(t, book)
+
+		books, err := srv.BooksByContributor(ctx, translatorID, database.RoleTranslator)
+		assert.NoError(t, err)
+		assert.Empty(t, books)
+	})
+
+	t.Run("should not delete book if book doesn't exist", func(t *testing.T) {
+		deleted, err := srv.DeleteBook(ctx, *bookID, 2)
+		assert.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
@@ -0,0 +1,108 @@
+// Package conformance checks that a database.Service backend behaves the way
+// the API relies on. Every backend runs it from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) database.Service {
+//			return emptyService(t)
+//		})
+//	}
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewService returns a Service with no data in it. It is called once per
+// test, so backends can reset shared storage instead of creating new.
+type NewService func(t *testing.T) database.Service
+
+// contracts are the parts of the Service contract. Each one gets a service
+// of its own.
+var contracts = []struct {
+	name string
+	test func(t *testing.T, srv database.Service)
+}{
+	{name: "authors", test: testAuthors},
+	{name: "borrowers", test: testBorrowers},
+	{name: "books", test: testBooks},
+	{name: "borrowing", test: testBorrowing},
+	{name: "concurrent borrowing", test: testConcurrentBorrowing},
+	{name: "idempotency keys", test: testIdempotencyKeys},
+	{name: "import jobs", test: testImportJobs},
+	{name: "covers", test: testCovers},
+	{name: "webhooks", test: testWebhooks},
+	{name: "outbox", test: testOutbox},
+	{name: "notifications", test: testNotifications},
+	{name: "email verification", test: testEmailVerification},
+	{name: "age restrictions", test: testAgeRestrictions},
+}
+
+// Run checks the services made by newService against every part of the
+// Service contract.
+func Run(t *testing.T, newService NewService) {
+	for _, contract := range contracts {
+		t.Run(contract.name, func(t *testing.T) {
+			contract.test(t, newService(t))
+		})
+	}
+}
+
+var birthday = time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+
+func createAuthor(t *testing.T, srv database.Service, name, email string) database.ID {
+	t.Helper()
+
+	id, err := srv.CreateAuthor(context.Background(), database.AuthorRequest{
+		Name:     name,
+		Birthday: birthday,
+		Email:    email,
+	})
+	require.NoError(t, err)
+
+	return *id
+}
+
+func createBorrower(t *testing.T, srv database.Service, name, email string) database.ID {
+	t.Helper()
+
+	id, err := srv.CreateBorrower(context.Background(), database.BorrowerRequest{
+		Name:     name,
+		Birthday: birthday,
+		Email:    email,
+	})
+	require.NoError(t, err)
+
+	return *id
+}
+
+// createVerifiedBorrower creates a borrower who has verified their email, so
+// they can borrow.
+func createVerifiedBorrower(t *testing.T, srv database.Service, name, email string) database.ID {
+	t.Helper()
+
+	id := createBorrower(t, srv, name, email)
+	borrower, err := srv.VerifyBorrower(context.Background(), id, email)
+	require.NoError(t, err)
+	require.NotNil(t, borrower)
+
+	return id
+}
+
+func addBook(t *testing.T, srv database.Service, title string, authorID database.ID) database.ID {
+	t.Helper()
+
+	id, err := srv.AddBook(context.Background(), database.BookRequest{
+		Title:     title,
+		AuthorID:  authorID,
+		Available: true,
+	})
+	require.NoError(t, err)
+
+	return *id
+}
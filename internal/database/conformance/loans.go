@@ -0,0 +1,182 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBorrowing(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	borrowerID := createVerifiedBorrower(t, srv, "Bober", "bober@hotmail.com")
+	bookID := addBook(t, srv, "Hobbit", authorID)
+
+	t.Run("should borrow an available book", func(t *testing.T) {
+		err := srv.BorrowBook(ctx, bookID, borrowerID)
+		require.NoError(t, err)
+
+		book, err := srv.GetBookExpanded(ctx, bookID, database.Expand{Borrower: true})
+		require.NoError(t, err)
+		assert.False(t, book.Available)
+		require.NotNil(t, book.Borrower)
+		assert.Equal(t, borrowerID, book.Borrower.ID)
+
+		borrower, err := srv.GetBorrower(ctx, borrowerID)
+		require.NoError(t, err)
+		assert.Equal(t, []database.ID{bookID}, borrower.Books)
+		require.Len(t, borrower.Loans, 1)
+		assert.Equal(t, database.LoanPeriod, borrower.Loans[0].DueAt.Sub(borrower.Loans[0].BorrowedAt))
+
+		books, err := srv.BorrowedBooks(ctx, borrowerID, database.Expand{})
+		require.NoError(t, err)
+		require.Len(t, books, 1)
+		assert.Equal(t, bookID, books[0].ID)
+	})
+
+	t.Run("should embed the author and borrower of borrowed books when expanded", func(t *testing.T) {
+		books, err := srv.BorrowedBooks(ctx, borrowerID, database.Expand{Author: true, Borrower: true})
+		require.NoError(t, err)
+		require.Len(t, books, 1)
+		require.NotNil(t, books[0].Author)
+		assert.Equal(t, "bober@author.com", books[0].Author.Email)
+		require.NotNil(t, books[0].Borrower)
+		assert.Equal(t, borrowerID, books[0].Borrower.ID)
+		assert.Equal(t, []database.ID{bookID}, books[0].Borrower.Books)
+
+		book, err := srv.GetBookExpanded(ctx, bookID, database.Expand{})
+		require.NoError(t, err)
+		assert.Nil(t, book.Author)
+		assert.Nil(t, book.Borrower)
+	})
+
+	testcases := []struct {
+		name       string
+		bookID     database.ID
+		borrowerID database.ID
+		errMsg     string
+	}{
+		{
+			name:       "book isn't available",
+			bookID:     bookID,
+			borrowerID: borrowerID,
+			errMsg:     "book isn't available",
+		},
+		{
+			name:       "book doesn't exist",
+			bookID:     database.NewID(),
+			borrowerID: borrowerID,
+			errMsg:     "book doesn't exist",
+		},
+		{
+			name:       "borrower doesn't exist",
+			bookID:     bookID,
+			borrowerID: database.NewID(),
+			errMsg:     "borrower doesn't exist",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should not borrow if "+testcase.name, func(t *testing.T) {
+			err := srv.BorrowBook(ctx, testcase.bookID, testcase.borrowerID)
+			assert.EqualError(t, err, testcase.errMsg)
+		})
+	}
+
+	t.Run("should refuse to delete a borrowed book or its borrower", func(t *testing.T) {
+		_, err := srv.DeleteBook(ctx, bookID, 2)
+		assert.ErrorIs(t, err, database.ErrBookBorrowed)
+		assert.EqualError(t, err, "book is borrowed")
+
+		// Created, verified, then borrowing
+		_, err = srv.DeleteBorrower(ctx, borrowerID, 3)
+		assert.ErrorIs(t, err, database.ErrBorrowerHasBooks)
+		assert.EqualError(t, err, "borrower has borrowed books")
+	})
+
+	t.Run("should list overdue loans", func(t *testing.T) {
+		loans, err := srv.OverdueLoans(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, loans)
+
+		loans, err = srv.OverdueLoans(ctx, time.Now().Add(database.LoanPeriod+time.Hour))
+		require.NoError(t, err)
+		require.Len(t, loans, 1)
+		assert.Equal(t, bookID, loans[0].BookID)
+		assert.Equal(t, "Hobbit", loans[0].BookTitle)
+		assert.Equal(t, borrowerID, loans[0].BorrowerID)
+		assert.Equal(t, "bober@hotmail.com", loans[0].BorrowerEmail)
+	})
+
+	t.Run("should find no integrity problems", func(t *testing.T) {
+		problems, err := srv.CheckIntegrity(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, problems)
+	})
+
+	t.Run("should return a borrowed book", func(t *testing.T) {
+		err := srv.ReturnBook(ctx, bookID)
+		require.NoError(t, err)
+
+		book, err := srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		assert.True(t, book.Available)
+
+		borrower, err := srv.GetBorrower(ctx, borrowerID)
+		require.NoError(t, err)
+		assert.Empty(t, borrower.Books)
+		assert.Empty(t, borrower.Loans)
+	})
+
+	t.Run("should not return a book that isn't borrowed", func(t *testing.T) {
+		err := srv.ReturnBook(ctx, bookID)
+		assert.EqualError(t, err, "book isn't borrowed")
+
+		err = srv.ReturnBook(ctx, database.NewID())
+		assert.EqualError(t, err, "book doesn't exist")
+	})
+}
+
+// testConcurrentBorrowing races borrowers for one book; exactly one of them
+// may get it.
+func testConcurrentBorrowing(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	bookID := addBook(t, srv, "Hobbit", authorID)
+
+	const borrowers = 8
+	borrowerIDs := make([]database.ID, borrowers)
+	for i := range borrowerIDs {
+		borrowerIDs[i] = createVerifiedBorrower(t, srv, fmt.Sprintf("Bober %d", i), fmt.Sprintf("bober%d@hotmail.com", i))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, borrowers)
+	for i, borrowerID := range borrowerIDs {
+		wg.Add(1)
+		go func(i int, borrowerID database.ID) {
+			defer wg.Done()
+			errs[i] = srv.BorrowBook(ctx, bookID, borrowerID)
+		}(i, borrowerID)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+
+	problems, err := srv.CheckIntegrity(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
@@ -0,0 +1,141 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotifications(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	borrowerID := createBorrower(t, srv, "Bober", "bober@hotmail.com")
+	otherID := createBorrower(t, srv, "Skunk", "skunk@hotmail.com")
+
+	t.Run("should have no preferences until they're set", func(t *testing.T) {
+		prefs, err := srv.GetNotificationPreferences(ctx, borrowerID)
+		require.NoError(t, err)
+		assert.Nil(t, prefs)
+	})
+
+	t.Run("should set and replace preferences", func(t *testing.T) {
+		err := srv.SetNotificationPreferences(ctx, borrowerID, database.NotificationPreferences{
+			Locale: "es",
+			OptOut: []string{database.NotificationDueSoon, database.NotificationWelcome},
+		})
+		require.NoError(t, err)
+
+		prefs, err := srv.GetNotificationPreferences(ctx, borrowerID)
+		require.NoError(t, err)
+		require.NotNil(t, prefs)
+		assert.Equal(t, "es", prefs.Locale)
+		assert.Equal(t, []string{database.NotificationDueSoon, database.NotificationWelcome}, prefs.OptOut)
+
+		err = srv.SetNotificationPreferences(ctx, borrowerID, database.NotificationPreferences{Locale: "en", OptOut: []string{}})
+		require.NoError(t, err)
+
+		prefs, err = srv.GetNotificationPreferences(ctx, borrowerID)
+		require.NoError(t, err)
+		require.NotNil(t, prefs)
+		assert.Equal(t, "en", prefs.Locale)
+		assert.Empty(t, prefs.OptOut)
+
+		others, err := srv.GetNotificationPreferences(ctx, otherID)
+		require.NoError(t, err)
+		assert.Nil(t, others)
+	})
+
+	newNotification := func(borrowerID database.ID, key string) database.Notification {
+		notification := database.NewNotification(borrowerID, database.NotificationOverdue, key)
+		notification.Locale = "en"
+		notification.To = "bober@hotmail.com"
+		notification.Subject = "Hobbit is overdue"
+		return notification
+	}
+
+	t.Run("should reserve each notification once", func(t *testing.T) {
+		reserved, err := srv.ReserveNotification(ctx, newNotification(borrowerID, "loan-1"), 3)
+		require.NoError(t, err)
+		assert.True(t, reserved)
+
+		reserved, err = srv.ReserveNotification(ctx, newNotification(borrowerID, "loan-1"), 3)
+		require.NoError(t, err)
+		assert.False(t, reserved, "it's being sent")
+
+		reserved, err = srv.ReserveNotification(ctx, newNotification(otherID, "loan-1"), 3)
+		require.NoError(t, err)
+		assert.True(t, reserved, "another borrower's")
+
+		sentAt := time.Now().UTC().Truncate(time.Millisecond)
+		sent := newNotification(borrowerID, "loan-1")
+		sent.Status = database.NotificationSent
+		sent.SentAt = &sentAt
+		require.NoError(t, srv.UpdateNotification(ctx, sent))
+
+		reserved, err = srv.ReserveNotification(ctx, newNotification(borrowerID, "loan-1"), 3)
+		require.NoError(t, err)
+		assert.False(t, reserved, "it's been sent")
+	})
+
+	t.Run("should retry failed notifications until they run out of attempts", func(t *testing.T) {
+		failed := newNotification(borrowerID, "loan-2")
+		for attempt := 1; attempt <= 2; attempt++ {
+			reserved, err := srv.ReserveNotification(ctx, failed, 2)
+			require.NoError(t, err)
+			require.True(t, reserved, "attempt %d", attempt)
+
+			failed.Status = database.NotificationFailed
+			failed.Error = "mailbox unavailable"
+			require.NoError(t, srv.UpdateNotification(ctx, failed))
+			failed.Status = database.NotificationSending
+		}
+
+		reserved, err := srv.ReserveNotification(ctx, failed, 2)
+		require.NoError(t, err)
+		assert.False(t, reserved)
+	})
+
+	t.Run("should list a borrower's notifications newest first", func(t *testing.T) {
+		notifications, err := srv.ListNotifications(ctx, borrowerID)
+		require.NoError(t, err)
+		require.Len(t, notifications, 2)
+
+		assert.Equal(t, "loan-2", notifications[0].Key)
+		assert.Equal(t, database.NotificationFailed, notifications[0].Status)
+		assert.Equal(t, 2, notifications[0].Attempts)
+		assert.Equal(t, "mailbox unavailable", notifications[0].Error)
+		assert.Nil(t, notifications[0].SentAt)
+
+		assert.Equal(t, "loan-1", notifications[1].Key)
+		assert.Equal(t, database.NotificationSent, notifications[1].Status)
+		assert.Equal(t, 1, notifications[1].Attempts)
+		assert.Equal(t, database.NotificationOverdue, notifications[1].Kind)
+		assert.Equal(t, "bober@hotmail.com", notifications[1].To)
+		assert.Equal(t, "Hobbit is overdue", notifications[1].Subject)
+		assert.Equal(t, "en", notifications[1].Locale)
+		assert.NotNil(t, notifications[1].SentAt)
+	})
+
+	t.Run("should delete them along with the borrower", func(t *testing.T) {
+		borrower, err := srv.GetBorrower(ctx, otherID)
+		require.NoError(t, err)
+		require.NoError(t, srv.SetNotificationPreferences(ctx, otherID, database.DefaultNotificationPreferences()))
+
+		deleted, err := srv.DeleteBorrower(ctx, otherID, borrower.Version)
+		require.NoError(t, err)
+		require.True(t, deleted)
+
+		prefs, err := srv.GetNotificationPreferences(ctx, otherID)
+		require.NoError(t, err)
+		assert.Nil(t, prefs)
+
+		notifications, err := srv.ListNotifications(ctx, otherID)
+		require.NoError(t, err)
+		assert.Empty(t, notifications)
+	})
+}
@@ -0,0 +1,113 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOutbox(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	borrowerID := createVerifiedBorrower(t, srv, "Bober", "bober@hotmail.com")
+	bookID := addBook(t, srv, "Hobbit", authorID)
+	require.NoError(t, srv.BorrowBook(ctx, bookID, borrowerID))
+	require.NoError(t, srv.ReturnBook(ctx, bookID))
+
+	// Failed writes record nothing
+	_, err := srv.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: authorID, Available: true})
+	require.Error(t, err)
+	require.Error(t, srv.ReturnBook(ctx, bookID))
+	require.Error(t, srv.BorrowBook(ctx, bookID, database.NewID()))
+
+	asOf := time.Now().Add(time.Second)
+	var events []database.OutboxEvent
+
+	t.Run("should record events with the changes they report", func(t *testing.T) {
+		events, err = srv.ClaimOutboxEvents(ctx, asOf, time.Minute, 10)
+		require.NoError(t, err)
+
+		types := make([]string, 0, len(events))
+		for _, event := range events {
+			types = append(types, event.Type)
+		}
+		require.Equal(t, []string{database.BorrowerCreated, database.BookCreated, database.BookBorrowed, database.BookReturned}, types)
+
+		var borrower database.BorrowerCreatedData
+		require.NoError(t, json.Unmarshal(events[0].Payload, &borrower))
+		assert.Equal(t, borrowerID, borrower.Borrower.ID)
+		assert.Equal(t, "bober@hotmail.com", borrower.Borrower.Email)
+
+		var book database.BookCreatedData
+		require.NoError(t, json.Unmarshal(events[1].Payload, &book))
+		assert.Equal(t, bookID, book.Book.ID)
+		assert.Equal(t, "Hobbit", book.Book.Title)
+		assert.Equal(t, authorID, book.Book.AuthorID)
+
+		var borrowed, returned database.LoanData
+		require.NoError(t, json.Unmarshal(events[2].Payload, &borrowed))
+		require.NoError(t, json.Unmarshal(events[3].Payload, &returned))
+		assert.Equal(t, bookID, borrowed.BookID)
+		assert.Equal(t, borrowerID, borrowed.BorrowerID)
+		assert.Equal(t, borrowed.BorrowedAt.Add(database.LoanPeriod), borrowed.DueAt)
+		assert.Equal(t, borrowed, returned)
+
+		for _, event := range events {
+			assert.False(t, event.ID.IsZero())
+			assert.Zero(t, event.Attempts)
+			assert.Nil(t, event.DispatchedAt)
+		}
+	})
+
+	t.Run("should hold claimed events until their lease ends", func(t *testing.T) {
+		claimed, err := srv.ClaimOutboxEvents(ctx, asOf, time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		claimed, err = srv.ClaimOutboxEvents(ctx, asOf.Add(time.Minute), time.Minute, 2)
+		require.NoError(t, err)
+		require.Len(t, claimed, 2)
+		assert.Equal(t, events[0].ID, claimed[0].ID)
+		assert.Equal(t, events[1].ID, claimed[1].ID)
+	})
+
+	t.Run("should stop claiming dispatched events", func(t *testing.T) {
+		require.Len(t, events, 4)
+
+		dispatchedAt := asOf.UTC().Truncate(time.Millisecond)
+		for _, event := range events[:3] {
+			event.DispatchedAt = &dispatchedAt
+			require.NoError(t, srv.UpdateOutboxEvent(ctx, event))
+		}
+
+		failed := events[3]
+		failed.Attempts = 1
+		failed.LastError = "broker is down"
+		failed.NextAttemptAt = asOf.Add(time.Hour).UTC().Truncate(time.Millisecond)
+		require.NoError(t, srv.UpdateOutboxEvent(ctx, failed))
+
+		claimed, err := srv.ClaimOutboxEvents(ctx, asOf.Add(time.Hour), time.Minute, 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, failed.ID, claimed[0].ID)
+		assert.Equal(t, 1, claimed[0].Attempts)
+		assert.Equal(t, "broker is down", claimed[0].LastError)
+	})
+
+	t.Run("should prune dispatched events", func(t *testing.T) {
+		pruned, err := srv.PruneOutbox(ctx, asOf.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, pruned)
+
+		pruned, err = srv.PruneOutbox(ctx, asOf.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 3, pruned)
+	})
+}
@@ -0,0 +1,214 @@
+package conformance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testIdempotencyKeys(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	t.Run("should reserve a free key", func(t *testing.T) {
+		existing, err := srv.ReserveIdempotencyKey(ctx, "key-1", "hash-1")
+		assert.NoError(t, err)
+		assert.Nil(t, existing)
+	})
+
+	t.Run("should return the pending reservation for a taken key", func(t *testing.T) {
+		existing, err := srv.ReserveIdempotencyKey(ctx, "key-1", "hash-2")
+		require.NoError(t, err)
+		require.NotNil(t, existing)
+		assert.False(t, existing.Completed)
+		assert.Equal(t, "hash-1", existing.RequestHash)
+	})
+
+	t.Run("should return the stored response once completed", func(t *testing.T) {
+		err := srv.CompleteIdempotencyKey(ctx, "key-1", http.StatusCreated, "application/json", []byte(`{"id":"1"}`), time.Hour)
+		require.NoError(t, err)
+
+		existing, err := srv.ReserveIdempotencyKey(ctx, "key-1", "hash-1")
+		require.NoError(t, err)
+		require.NotNil(t, existing)
+		assert.True(t, existing.Completed)
+		assert.Equal(t, http.StatusCreated, existing.StatusCode)
+		assert.Equal(t, "application/json", existing.ContentType)
+		assert.Equal(t, []byte(`{"id":"1"}`), existing.Body)
+	})
+
+	t.Run("should free a released key", func(t *testing.T) {
+		err := srv.ReleaseIdempotencyKey(ctx, "key-1")
+		require.NoError(t, err)
+
+		existing, err := srv.ReserveIdempotencyKey(ctx, "key-1", "hash-2")
+		assert.NoError(t, err)
+		assert.Nil(t, existing)
+	})
+
+	t.Run("should reuse an expired key", func(t *testing.T) {
+		err := srv.CompleteIdempotencyKey(ctx, "key-1", http.StatusCreated, "", nil, -time.Second)
+		require.NoError(t, err)
+
+		existing, err := srv.ReserveIdempotencyKey(ctx, "key-1", "hash-3")
+		assert.NoError(t, err)
+		assert.Nil(t, existing)
+	})
+}
+
+func testImportJobs(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	jobID, err := srv.CreateImportJob(ctx, "books_csv", 2)
+	require.NoError(t, err)
+
+	t.Run("should start a running job", func(t *testing.T) {
+		job, err := srv.GetImportJob(ctx, *jobID)
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.Equal(t, database.ImportJobRunning, job.Status)
+		assert.Equal(t, 2, job.Total)
+		assert.Empty(t, job.Rows)
+		assert.Nil(t, job.FinishedAt)
+	})
+
+	t.Run("should record rows in order and finish", func(t *testing.T) {
+		bookID := database.NewID()
+		err := srv.RecordImportRow(ctx, *jobID, database.ImportRowResult{Row: 2, Status: database.ImportRowCreated, BookID: &bookID})
+		require.NoError(t, err)
+		err = srv.RecordImportRow(ctx, *jobID, database.ImportRowResult{Row: 3, Status: database.ImportRowFailed, Error: "book already exists"})
+		require.NoError(t, err)
+		err = srv.FinishImportJob(ctx, *jobID, "")
+		require.NoError(t, err)
+
+		job, err := srv.GetImportJob(ctx, *jobID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobCompleted, job.Status)
+		assert.Equal(t, 1, job.Succeeded)
+		assert.Equal(t, 1, job.Failed)
+		require.Len(t, job.Rows, 2)
+		assert.Equal(t, bookID, *job.Rows[0].BookID)
+		assert.Nil(t, job.Rows[1].BookID)
+		assert.Equal(t, "book already exists", job.Rows[1].Error)
+		assert.NotNil(t, job.FinishedAt)
+	})
+
+	t.Run("should interrupt only idle running jobs", func(t *testing.T) {
+		idleID, err := srv.CreateImportJob(ctx, "books_csv", 1)
+		require.NoError(t, err)
+
+		interrupted, err := srv.InterruptImportJobs(ctx, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Zero(t, interrupted)
+
+		interrupted, err = srv.InterruptImportJobs(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 1, interrupted)
+
+		job, err := srv.GetImportJob(ctx, *idleID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobInterrupted, job.Status)
+		assert.Equal(t, database.ImportInterruptedError, job.Error)
+		assert.NotNil(t, job.FinishedAt)
+
+		job, err = srv.GetImportJob(ctx, *jobID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobCompleted, job.Status)
+	})
+
+	t.Run("should keep interrupted jobs interrupted", func(t *testing.T) {
+		idleID, err := srv.CreateImportJob(ctx, "books_csv", 1)
+		require.NoError(t, err)
+		_, err = srv.InterruptImportJobs(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+
+		err = srv.RecordImportRow(ctx, *idleID, database.ImportRowResult{Row: 2, Status: database.ImportRowFailed, Error: "book already exists"})
+		assert.ErrorIs(t, err, database.ErrImportJobNotRunning)
+		err = srv.FinishImportJob(ctx, *idleID, "")
+		assert.ErrorIs(t, err, database.ErrImportJobNotRunning)
+
+		job, err := srv.GetImportJob(ctx, *idleID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobInterrupted, job.Status)
+		assert.Equal(t, database.ImportInterruptedError, job.Error)
+		assert.Empty(t, job.Rows)
+		assert.Zero(t, job.Failed)
+	})
+
+	t.Run("should return nil for a missing job", func(t *testing.T) {
+		job, err := srv.GetImportJob(ctx, database.NewID())
+		assert.NoError(t, err)
+		assert.Nil(t, job)
+	})
+}
+
+func testCovers(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	bookID := addBook(t, srv, "Hobbit", authorID)
+
+	upload := database.CoverUpload{
+		ContentType:          "image/png",
+		Image:                []byte("cover"),
+		ThumbnailContentType: "image/jpeg",
+		Thumbnail:            []byte("thumbnail"),
+	}
+
+	t.Run("should have no cover until one is uploaded", func(t *testing.T) {
+		file, err := srv.GetBookCover(ctx, bookID, false)
+		assert.NoError(t, err)
+		assert.Nil(t, file)
+	})
+
+	t.Run("should store the cover and its thumbnail", func(t *testing.T) {
+		book, err := srv.SetBookCover(ctx, bookID, upload, 1)
+		require.NoError(t, err)
+		require.NotNil(t, book.Cover)
+		assert.Equal(t, int64(2), book.Version)
+
+		file, err := srv.GetBookCover(ctx, bookID, false)
+		require.NoError(t, err)
+		require.NotNil(t, file)
+		assert.Equal(t, []byte("cover"), file.Data)
+		assert.Equal(t, "image/png", file.ContentType)
+		assert.Equal(t, book.Cover.ID, file.ID)
+
+		thumbnail, err := srv.GetBookCover(ctx, bookID, true)
+		require.NoError(t, err)
+		require.NotNil(t, thumbnail)
+		assert.Equal(t, []byte("thumbnail"), thumbnail.Data)
+		assert.Equal(t, "image/jpeg", thumbnail.ContentType)
+	})
+
+	t.Run("should replace the previous cover", func(t *testing.T) {
+		upload.Image = []byte("new cover")
+		book, err := srv.SetBookCover(ctx, bookID, upload, 2)
+		require.NoError(t, err)
+
+		file, err := srv.GetBookCover(ctx, bookID, false)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new cover"), file.Data)
+		assert.Equal(t, book.Cover.ID, file.ID)
+	})
+
+	t.Run("should keep the cover when the version doesn't match", func(t *testing.T) {
+		upload.Image = []byte("stale cover")
+		_, err := srv.SetBookCover(ctx, bookID, upload, 2)
+		assert.ErrorIs(t, err, database.ErrVersionMismatch)
+
+		file, err := srv.GetBookCover(ctx, bookID, false)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new cover"), file.Data)
+	})
+
+	t.Run("should not store covers for missing books", func(t *testing.T) {
+		book, err := srv.SetBookCover(ctx, database.NewID(), upload, 1)
+		assert.NoError(t, err)
+		assert.Nil(t, book)
+	})
+}
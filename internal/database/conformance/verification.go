@@ -0,0 +1,92 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEmailVerification(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	authorID := createAuthor(t, srv, "Bober", "bober@author.com")
+	bookID := addBook(t, srv, "Hobbit", authorID)
+	borrowerID := createBorrower(t, srv, "Bober", "bober@hotmail.com")
+
+	t.Run("should create borrowers unverified", func(t *testing.T) {
+		borrower, err := srv.GetBorrower(ctx, borrowerID)
+		require.NoError(t, err)
+		assert.Nil(t, borrower.VerifiedAt)
+	})
+
+	t.Run("should not lend to unverified borrowers", func(t *testing.T) {
+		err := srv.BorrowBook(ctx, bookID, borrowerID)
+		assert.ErrorIs(t, err, database.ErrBorrowerNotVerified)
+
+		book, err := srv.GetBook(ctx, bookID)
+		require.NoError(t, err)
+		assert.True(t, book.Available)
+	})
+
+	t.Run("should not verify another email or borrower", func(t *testing.T) {
+		borrower, err := srv.VerifyBorrower(ctx, borrowerID, "other@hotmail.com")
+		require.NoError(t, err)
+		assert.Nil(t, borrower)
+
+		borrower, err = srv.VerifyBorrower(ctx, database.NewID(), "bober@hotmail.com")
+		require.NoError(t, err)
+		assert.Nil(t, borrower)
+	})
+
+	t.Run("should verify the borrower's email once", func(t *testing.T) {
+		borrower, err := srv.VerifyBorrower(ctx, borrowerID, "bober@hotmail.com")
+		require.NoError(t, err)
+		require.NotNil(t, borrower)
+		require.NotNil(t, borrower.VerifiedAt)
+		assert.Equal(t, int64(2), borrower.Version)
+		verifiedAt := *borrower.VerifiedAt
+
+		borrower, err = srv.VerifyBorrower(ctx, borrowerID, "bober@hotmail.com")
+		require.NoError(t, err)
+		require.NotNil(t, borrower)
+		assert.True(t, verifiedAt.Equal(*borrower.VerifiedAt))
+		assert.Equal(t, int64(2), borrower.Version)
+
+		require.NoError(t, srv.BorrowBook(ctx, bookID, borrowerID))
+		require.NoError(t, srv.ReturnBook(ctx, bookID))
+	})
+
+	t.Run("should keep verification when the email stays", func(t *testing.T) {
+		current, err := srv.GetBorrower(ctx, borrowerID)
+		require.NoError(t, err)
+
+		borrower, err := srv.UpdateBorrower(ctx, borrowerID, database.BorrowerRequest{Name: "Bober Skunk", Birthday: birthday, Email: "bober@hotmail.com"}, current.Version)
+		require.NoError(t, err)
+		assert.NotNil(t, borrower.VerifiedAt)
+	})
+
+	t.Run("should clear verification when the email changes", func(t *testing.T) {
+		current, err := srv.GetBorrower(ctx, borrowerID)
+		require.NoError(t, err)
+
+		borrower, err := srv.UpdateBorrower(ctx, borrowerID, database.BorrowerRequest{Name: "Bober Skunk", Birthday: birthday, Email: "bober@gmail.com"}, current.Version)
+		require.NoError(t, err)
+		assert.Nil(t, borrower.VerifiedAt)
+
+		err = srv.BorrowBook(ctx, bookID, borrowerID)
+		assert.ErrorIs(t, err, database.ErrBorrowerNotVerified)
+
+		borrower, err = srv.VerifyBorrower(ctx, borrowerID, "bober@hotmail.com")
+		require.NoError(t, err)
+		assert.Nil(t, borrower, "the old email can't be verified")
+
+		borrower, err = srv.VerifyBorrower(ctx, borrowerID, "bober@gmail.com")
+		require.NoError(t, err)
+		require.NotNil(t, borrower)
+		assert.NotNil(t, borrower.VerifiedAt)
+	})
+}
@@ -0,0 +1,153 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testWebhooks(t *testing.T, srv database.Service) {
+	ctx := context.Background()
+
+	borrowingID, err := srv.CreateWebhook(ctx, database.WebhookRequest{
+		URL:    "https://accounting.example.com/hooks",
+		Secret: "0123456789abcdef",
+		Events: []string{database.BookBorrowed, database.BookReturned},
+	})
+	require.NoError(t, err)
+	catalogID, err := srv.CreateWebhook(ctx, database.WebhookRequest{
+		URL:    "https://notify.example.com/hooks",
+		Secret: "fedcba9876543210",
+		Events: []string{database.BookCreated},
+	})
+	require.NoError(t, err)
+
+	borrowed := database.WebhookEvent{ID: "event-1", Type: database.BookBorrowed, Payload: json.RawMessage(`{"type":"book.borrowed"}`)}
+
+	t.Run("should list webhooks with their secrets", func(t *testing.T) {
+		webhooks, err := srv.ListWebhooks(ctx)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 2)
+		assert.Equal(t, *borrowingID, webhooks[0].ID)
+		assert.Equal(t, "https://accounting.example.com/hooks", webhooks[0].URL)
+		assert.Equal(t, "0123456789abcdef", webhooks[0].Secret)
+		assert.Equal(t, []string{database.BookBorrowed, database.BookReturned}, webhooks[0].Events)
+		assert.False(t, webhooks[0].CreatedAt.IsZero())
+
+		webhook, err := srv.GetWebhook(ctx, *catalogID)
+		require.NoError(t, err)
+		require.NotNil(t, webhook)
+		assert.Equal(t, []string{database.BookCreated}, webhook.Events)
+
+		webhook, err = srv.GetWebhook(ctx, database.NewID())
+		assert.NoError(t, err)
+		assert.Nil(t, webhook)
+	})
+
+	t.Run("should queue events for the webhooks subscribed to them once", func(t *testing.T) {
+		queued, err := srv.QueueWebhookDeliveries(ctx, borrowed)
+		require.NoError(t, err)
+		assert.Equal(t, 1, queued)
+
+		queued, err = srv.QueueWebhookDeliveries(ctx, borrowed)
+		require.NoError(t, err)
+		assert.Equal(t, 0, queued)
+
+		queued, err = srv.QueueWebhookDeliveries(ctx, database.WebhookEvent{ID: "event-2", Type: database.LoanOverdue, Payload: json.RawMessage(`{}`)})
+		require.NoError(t, err)
+		assert.Equal(t, 0, queued)
+
+		deliveries, err := srv.ListWebhookDeliveries(ctx, "")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, *borrowingID, deliveries[0].WebhookID)
+		assert.Equal(t, "event-1", deliveries[0].EventID)
+		assert.Equal(t, database.BookBorrowed, deliveries[0].EventType)
+		assert.JSONEq(t, `{"type":"book.borrowed"}`, string(deliveries[0].Payload))
+		assert.Equal(t, database.DeliveryPending, deliveries[0].Status)
+		assert.Zero(t, deliveries[0].Attempts)
+		assert.Nil(t, deliveries[0].DeliveredAt)
+	})
+
+	t.Run("should claim due deliveries earliest first until their lease runs out", func(t *testing.T) {
+		_, err := srv.QueueWebhookDeliveries(ctx, database.WebhookEvent{ID: "event-3", Type: database.BookReturned, Payload: json.RawMessage(`{}`)})
+		require.NoError(t, err)
+
+		now := time.Now().UTC()
+		claimed, err := srv.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 2)
+		assert.Equal(t, "event-1", claimed[0].EventID)
+		assert.Equal(t, "event-3", claimed[1].EventID)
+
+		claimed, err = srv.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		claimed, err = srv.ClaimWebhookDeliveries(ctx, now.Add(time.Minute), time.Minute, 1)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 1)
+	})
+
+	t.Run("should record attempts and list deliveries by status", func(t *testing.T) {
+		deliveries, err := srv.ListWebhookDeliveries(ctx, "")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		assert.Equal(t, "event-3", deliveries[0].EventID, "newest first")
+
+		dead := deliveries[1]
+		dead.Status = database.DeliveryDead
+		dead.Attempts = 8
+		dead.LastError = "500 Internal Server Error"
+		require.NoError(t, srv.UpdateWebhookDelivery(ctx, dead))
+
+		deliveredAt := time.Now().UTC().Truncate(time.Millisecond)
+		delivered := deliveries[0]
+		delivered.Status = database.DeliveryDelivered
+		delivered.Attempts = 1
+		delivered.DeliveredAt = &deliveredAt
+		require.NoError(t, srv.UpdateWebhookDelivery(ctx, delivered))
+
+		deadLetters, err := srv.ListWebhookDeliveries(ctx, database.DeliveryDead)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, dead.ID, deadLetters[0].ID)
+		assert.Equal(t, 8, deadLetters[0].Attempts)
+		assert.Equal(t, "500 Internal Server Error", deadLetters[0].LastError)
+
+		got, err := srv.GetWebhookDelivery(ctx, delivered.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, database.DeliveryDelivered, got.Status)
+		require.NotNil(t, got.DeliveredAt)
+		assert.True(t, deliveredAt.Equal(*got.DeliveredAt))
+
+		claimed, err := srv.ClaimWebhookDeliveries(ctx, time.Now().Add(time.Hour), time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		got, err = srv.GetWebhookDelivery(ctx, database.NewID())
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("should delete webhooks along with their deliveries", func(t *testing.T) {
+		deleted, err := srv.DeleteWebhook(ctx, *borrowingID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		deliveries, err := srv.ListWebhookDeliveries(ctx, "")
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+
+		deleted, err = srv.DeleteWebhook(ctx, *borrowingID)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
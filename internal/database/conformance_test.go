@@ -0,0 +1,22 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/conformance"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) database.Service {
+		srv := database.New()
+
+		err := database.DeleteColls(context.Background(), srv)
+		require.NoError(t, err)
+
+		return srv
+	})
+}
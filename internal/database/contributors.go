@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+var contributorRoles = map[string]bool{
+	RoleAuthor:      true,
+	RoleEditor:      true,
+	RoleTranslator:  true,
+	RoleIllustrator: true,
+}
+
+// Contributor is an author credited on a book in some role.
+type Contributor struct {
+	AuthorID ID     `json:"author_id" bson:"author_id"`
+	Role     string `json:"role" bson:"role"`
+	// Author is only set when the book is read with Expand.
+	Author *Author `json:"author,omitempty" bson:"author,omitempty"`
+}
+
+// MissingAuthorError is returned by book writes crediting an author who
+// doesn't exist.
+type MissingAuthorError struct {
+	AuthorID ID
+}
+
+func (e *MissingAuthorError) Error() string {
+	return "author doesn't exist: " + e.AuthorID.String()
+}
+
+// IsContributorRole reports whether role is one books can credit.
+func IsContributorRole(role string) bool {
+	return contributorRoles[role]
+}
+
+// normalizeContributors fills in the author role where it was left out and
+// drops repeated credits. The primary author, if set, is credited as an
+// author when the list doesn't already credit them as one, even if it
+// credits them in another role.
+func normalizeContributors(primary ID, contributors []Contributor) ([]Contributor, error) {
+	normalized := []Contributor{}
+	seen := make(map[Contributor]bool)
+
+	add := func(contributor Contributor) error {
+		if contributor.AuthorID.IsZero() {
+			return fmt.Errorf("contributors need an author_id")
+		}
+		if contributor.Role == "" {
+			contributor.Role = RoleAuthor
+		}
+		if !contributorRoles[contributor.Role] {
+			return fmt.Errorf("unknown contributor role %q", contributor.Role)
+		}
+		contributor.Author = nil
+		if !seen[contributor] {
+			seen[contributor] = true
+			normalized = append(normalized, contributor)
+		}
+		return nil
+	}
+
+	if !primary.IsZero() {
+		credited := false
+		for _, contributor := range contributors {
+			isAuthor := contributor.Role == "" || contributor.Role == RoleAuthor
+			credited = credited || (contributor.AuthorID == primary && isAuthor)
+		}
+		if !credited {
+			add(Contributor{AuthorID: primary, Role: RoleAuthor})
+		}
+	}
+
+	for _, contributor := range contributors {
+		err := add(contributor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return normalized, nil
+}
+
+// primaryAuthor is the first contributor credited as an author, or the first
+// contributor for books with none, such as edited anthologies.
+func primaryAuthor(contributors []Contributor) ID {
+	for _, contributor := range contributors {
+		if contributor.Role == RoleAuthor {
+			return contributor.AuthorID
+		}
+	}
+	if len(contributors) > 0 {
+		return contributors[0].AuthorID
+	}
+	return ""
+}
+
+// checkContributors reports the first contributor whose author doesn't exist.
+func (s *service) checkContributors(ctx context.Context, contributors []Contributor) error {
+	ids := []ID{}
+	for _, contributor := range contributors {
+		ids = append(ids, contributor.AuthorID)
+	}
+
+	curs, err := s.authorsColl.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return fmt.Errorf("get authors: %w", err)
+	}
+
+	authors := []Author{}
+	err = curs.All(ctx, &authors)
+	if err != nil {
+		return fmt.Errorf("decode authors: %w", err)
+	}
+
+	found := make(map[ID]bool, len(authors))
+	for _, author := range authors {
+		found[author.ID] = true
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			return &MissingAuthorError{AuthorID: id}
+		}
+	}
+
+	return nil
+}
+
+// BooksByContributor lists the books crediting an author, in any role when
+// role is empty.
+func (s *service) BooksByContributor(ctx context.Context, authorID ID, role string) ([]Book, error) {
+	match := bson.M{"author_id": authorID}
+	if role != "" {
+		match["role"] = role
+	}
+
+	filter := bson.D{
+		bson.E{Key: "contributors", Value: bson.M{"$elemMatch": match}},
+	}
+
+	books := []Book{}
+
+	curs, err := s.booksColl.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("find books by contributor: %v", err)
+	}
+
+	err = curs.All(ctx, &books)
+	if err != nil {
+		return nil, fmt.Errorf("decode books by contributor: %v", err)
+	}
+
+	return books, nil
+}
+
+// migrateContributors credits the author_id of books stored before
+// contributors existed as their sole author.
+func migrateContributors(ctx context.Context, booksColl *mongo.Collection) error {
+	filter := bson.M{
+		"contributors": bson.M{"$exists": false},
+		"author_id":    bson.M{"$exists": true},
+	}
+	update := mongo.Pipeline{
+		bson.D{bson.E{Key: "$set", Value: bson.M{
+			"contributors": bson.A{bson.M{"author_id": "$author_id", "role": RoleAuthor}},
+		}}},
+	}
+
+	_, err := booksColl.UpdateMany(ctx, filter, update)
+	return err
+}
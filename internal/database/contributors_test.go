@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredits(t *testing.T) {
+	authorID, editorID := NewID(), NewID()
+
+	testcases := []struct {
+		name    string
+		request BookRequest
+		primary ID
+		want    []Contributor
+	}{
+		{
+			name:    "should credit the primary author",
+			request: BookRequest{AuthorID: authorID},
+			primary: authorID,
+			want:    []Contributor{{AuthorID: authorID, Role: RoleAuthor}},
+		},
+		{
+			name:    "should not credit the primary author twice",
+			request: BookRequest{AuthorID: authorID, Contributors: []Contributor{{AuthorID: editorID, Role: RoleEditor}, {AuthorID: authorID}}},
+			primary: authorID,
+			want:    []Contributor{{AuthorID: editorID, Role: RoleEditor}, {AuthorID: authorID, Role: RoleAuthor}},
+		},
+		{
+			name:    "should credit the primary author as an author when credited in another role",
+			request: BookRequest{AuthorID: authorID, Contributors: []Contributor{{AuthorID: authorID, Role: RoleEditor}}},
+			primary: authorID,
+			want:    []Contributor{{AuthorID: authorID, Role: RoleAuthor}, {AuthorID: authorID, Role: RoleEditor}},
+		},
+		{
+			name:    "should default the primary author to the first author credited",
+			request: BookRequest{Contributors: []Contributor{{AuthorID: editorID, Role: RoleEditor}, {AuthorID: authorID}}},
+			primary: authorID,
+			want:    []Contributor{{AuthorID: editorID, Role: RoleEditor}, {AuthorID: authorID, Role: RoleAuthor}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary, contributors, err := tc.request.Credits()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.primary, primary)
+			assert.Equal(t, tc.want, contributors)
+		})
+	}
+}
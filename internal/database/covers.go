@@ -0,0 +1,181 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cover records where a book's cover image and its thumbnail are kept in
+// GridFS.
+type Cover struct {
+	ID                   ID        `bson:"id"`
+	ContentType          string    `bson:"content_type"`
+	ThumbnailID          ID        `bson:"thumbnail_id"`
+	ThumbnailContentType string    `bson:"thumbnail_content_type"`
+	UploadedAt           time.Time `bson:"uploaded_at"`
+}
+
+// CoverUpload is a validated cover image along with its thumbnail.
+type CoverUpload struct {
+	ContentType          string
+	Image                []byte
+	ThumbnailContentType string
+	Thumbnail            []byte
+}
+
+// CoverFile is a stored cover image or thumbnail.
+type CoverFile struct {
+	ID          ID
+	ContentType string
+	UploadedAt  time.Time
+	Data        []byte
+}
+
+// SetBookCover stores a book's cover and thumbnail if the book is still at
+// version, replacing any previous ones, and bumps the book's version. It
+// returns nil when the book doesn't exist. The previous files are deleted
+// only once the book points at the new ones.
+func (s *service) SetBookCover(ctx context.Context, bookID ID, upload CoverUpload, version int64) (*Book, error) {
+	cover := Cover{
+		ContentType:          upload.ContentType,
+		ThumbnailContentType: upload.ThumbnailContentType,
+		UploadedAt:           time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	var err error
+	cover.ID, err = s.uploadCoverFile(bookID, "cover", upload.ContentType, upload.Image)
+	if err != nil {
+		return nil, fmt.Errorf("upload cover: %v", err)
+	}
+
+	cover.ThumbnailID, err = s.uploadCoverFile(bookID, "thumbnail", upload.ThumbnailContentType, upload.Thumbnail)
+	if err != nil {
+		s.deleteCoverFiles(ctx, &Cover{ID: cover.ID})
+		return nil, fmt.Errorf("upload cover thumbnail: %v", err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"cover": cover,
+		},
+		"$inc": bson.M{
+			"version": 1,
+		},
+	}
+
+	// The book as it was before the update names the files it replaced
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.M{"cover": 1}).
+		SetReturnDocument(options.Before)
+
+	var previous Book
+	err = s.booksColl.FindOneAndUpdate(ctx, versionFilter(bookID, version), update, opts).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = s.missingOrMismatch(ctx, s.booksColl, bookID)
+	}
+	if err != nil {
+		s.deleteCoverFiles(ctx, &cover)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("set book cover: %w", err)
+	}
+
+	s.deleteCoverFiles(ctx, previous.Cover)
+
+	return s.GetBook(ctx, bookID)
+}
+
+// GetBookCover reads a book's cover, or its thumbnail. It returns nil when
+// the book doesn't exist or has no cover.
+func (s *service) GetBookCover(ctx context.Context, bookID ID, thumbnail bool) (*CoverFile, error) {
+	book, err := s.GetBook(ctx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("get book: %v", err)
+	}
+	if book == nil || book.Cover == nil {
+		return nil, nil
+	}
+
+	file := CoverFile{
+		ID:          book.Cover.ID,
+		ContentType: book.Cover.ContentType,
+		UploadedAt:  book.Cover.UploadedAt,
+	}
+	if thumbnail {
+		file.ID = book.Cover.ThumbnailID
+		file.ContentType = book.Cover.ThumbnailContentType
+	}
+
+	fileID, err := objectID(file.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var data bytes.Buffer
+	_, err = s.coversBucket.DownloadToStream(fileID, &data)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("download cover: %v", err)
+	}
+	file.Data = data.Bytes()
+
+	return &file, nil
+}
+
+func (s *service) uploadCoverFile(bookID ID, kind, contentType string, data []byte) (ID, error) {
+	// GridFS marshals metadata and file ids without the client's registry
+	bookOID, err := objectID(bookID)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := bson.M{
+		"book_id":      bookOID,
+		"kind":         kind,
+		"content_type": contentType,
+	}
+
+	fileID, err := s.coversBucket.UploadFromStream(
+		bookID.String()+"/"+kind,
+		bytes.NewReader(data),
+		options.GridFSUpload().SetMetadata(metadata),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return ID(fileID.Hex()), nil
+}
+
+// deleteCoverFiles removes a cover's files. Failures only leave orphaned
+// files behind, so they are logged rather than returned.
+func (s *service) deleteCoverFiles(ctx context.Context, cover *Cover) {
+	if cover == nil {
+		return
+	}
+
+	for _, id := range []ID{cover.ID, cover.ThumbnailID} {
+		if id.IsZero() {
+			continue
+		}
+		fileID, err := objectID(id)
+		if err == nil {
+			err = s.coversBucket.DeleteContext(ctx, fileID)
+		}
+		if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			log.Printf("delete cover file %s: %v", id.String(), err)
+		}
+	}
+}
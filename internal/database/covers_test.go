@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBookCoverFiles checks that GridFS only keeps the current cover, even
+// when a replacement is rejected; the rest of the cover contract is in the
+// conformance suite.
+func TestBookCoverFiles(t *testing.T) {
+	srv := New()
+
+	err := srv.(*service).deleteColls(context.Background())
+	require.NoError(t, err)
+
+	authorID, err := srv.CreateAuthor(context.Background(), AuthorRequest{
+		Name:     "Bober",
+		Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Email:    "bober@author.com",
+	})
+	require.NoError(t, err)
+
+	bookID, err := srv.AddBook(context.Background(), BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+
+	upload := CoverUpload{
+		ContentType:          "image/png",
+		Image:                []byte("cover"),
+		ThumbnailContentType: "image/png",
+		Thumbnail:            []byte("thumbnail"),
+	}
+
+	for version := int64(1); version <= 2; version++ {
+		_, err := srv.SetBookCover(context.Background(), *bookID, upload, version)
+		require.NoError(t, err)
+	}
+
+	_, err = srv.SetBookCover(context.Background(), *bookID, upload, 1)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	files, err := srv.(*service).coversBucket.GetFilesCollection().CountDocuments(context.Background(), map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), files)
+}
@@ -2,64 +2,226 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
+// ErrVersionMismatch is returned by conditional writes when the document has
+// been changed since the version the caller read.
+var ErrVersionMismatch = errors.New("version mismatch")
+
 type Service interface {
 	Health() map[string]string
 
-	ListBooks(ctx context.Context) ([]Book, error)
-	AddBook(ctx context.Context, book BookRequest) (*primitive.ObjectID, error)
-	GetBook(ctx context.Context, bookID primitive.ObjectID) (*Book, error)
-	BorrowBook(ctx context.Context, bookID primitive.ObjectID, borrowerID primitive.ObjectID) error
+	ListBooks(ctx context.Context, expand Expand) ([]Book, error)
+	AddBook(ctx context.Context, book BookRequest) (*ID, error)
+	GetBook(ctx context.Context, bookID ID) (*Book, error)
+	GetBookExpanded(ctx context.Context, bookID ID, expand Expand) (*Book, error)
+	GetBookByISBN(ctx context.Context, isbn string) (*Book, error)
+	BooksByContributor(ctx context.Context, authorID ID, role string) ([]Book, error)
+	UpdateBook(ctx context.Context, bookID ID, book BookRequest, version int64) (*Book, error)
+	DeleteBook(ctx context.Context, bookID ID, version int64) (bool, error)
+	BorrowBook(ctx context.Context, bookID ID, borrowerID ID) error
+	BorrowBookWithOverride(ctx context.Context, bookID ID, borrowerID ID, override Override) error
+	ReturnBook(ctx context.Context, bookID ID) error
+	OverdueLoans(ctx context.Context, asOf time.Time) ([]OverdueLoan, error)
+
+	CreateAuthor(ctx context.Context, author AuthorRequest) (*ID, error)
+	GetAuthor(ctx context.Context, authorID ID) (*Author, error)
+	FindAuthorByEmail(ctx context.Context, email string) (*Author, error)
+	FindAuthorByName(ctx context.Context, name string) (*Author, error)
+	UpdateAuthor(ctx context.Context, authorID ID, author AuthorRequest, version int64) (*Author, error)
+	DeleteAuthor(ctx context.Context, authorID ID, version int64) (bool, error)
+
+	CreateBorrower(ctx context.Context, borrower BorrowerRequest) (*ID, error)
+	GetBorrower(ctx context.Context, borrowerID ID) (*Borrower, error)
+	UpdateBorrower(ctx context.Context, borrowerID ID, borrower BorrowerRequest, version int64) (*Borrower, error)
+	DeleteBorrower(ctx context.Context, borrowerID ID, version int64) (bool, error)
+	VerifyBorrower(ctx context.Context, borrowerID ID, email string) (*Borrower, error)
+	BorrowedBooks(ctx context.Context, borrowerID ID, expand Expand) ([]Book, error)
+	ListChildren(ctx context.Context, guardianID ID) ([]Borrower, error)
+	ListAgeOverrides(ctx context.Context, borrowerID ID) ([]AgeOverride, error)
+
+	ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
 
-	CreateAuthor(ctx context.Context, author AuthorRequest) (*primitive.ObjectID, error)
-	GetAuthor(ctx context.Context, authorID primitive.ObjectID) (*Author, error)
+	CreateImportJob(ctx context.Context, kind string, total int) (*ID, error)
+	RecordImportRow(ctx context.Context, jobID ID, result ImportRowResult) error
+	FinishImportJob(ctx context.Context, jobID ID, jobErr string) error
+	InterruptImportJobs(ctx context.Context, idleSince time.Time) (int, error)
+	GetImportJob(ctx context.Context, jobID ID) (*ImportJob, error)
+	SetBookCover(ctx context.Context, bookID ID, cover CoverUpload, version int64) (*Book, error)
+	GetBookCover(ctx context.Context, bookID ID, thumbnail bool) (*CoverFile, error)
 
-	CreateBorrower(ctx context.Context, borrower BorrowerRequest) (*primitive.ObjectID, error)
-	GetBorrower(ctx context.Context, borrowerID primitive.ObjectID) (*Borrower, error)
-	BorrowedBooks(ctx context.Context, borrowerID primitive.ObjectID) ([]Book, error)
-	// TODO: Could be useful ReturnBorrowed()
+	CheckIntegrity(ctx context.Context) ([]IntegrityProblem, error)
+
+	CreateWebhook(ctx context.Context, webhook WebhookRequest) (*ID, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	GetWebhook(ctx context.Context, webhookID ID) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID ID) (bool, error)
+	QueueWebhookDeliveries(ctx context.Context, event WebhookEvent) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, deliveryID ID) (*WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, status string) ([]WebhookDelivery, error)
+
+	ClaimOutboxEvents(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]OutboxEvent, error)
+	UpdateOutboxEvent(ctx context.Context, event OutboxEvent) error
+	PruneOutbox(ctx context.Context, before time.Time) (int, error)
+
+	GetNotificationPreferences(ctx context.Context, borrowerID ID) (*NotificationPreferences, error)
+	SetNotificationPreferences(ctx context.Context, borrowerID ID, prefs NotificationPreferences) error
+	ReserveNotification(ctx context.Context, notification Notification, maxAttempts int) (bool, error)
+	UpdateNotification(ctx context.Context, notification Notification) error
+	ListNotifications(ctx context.Context, borrowerID ID) ([]Notification, error)
 }
 
 type service struct {
-	db            *mongo.Client
-	booksColl     *mongo.Collection
-	authorsColl   *mongo.Collection
-	borrowersColl *mongo.Collection
+	db              *mongo.Client
+	booksColl       *mongo.Collection
+	authorsColl     *mongo.Collection
+	borrowersColl   *mongo.Collection
+	idempotencyColl *mongo.Collection
+	importJobsColl  *mongo.Collection
+	coversBucket    *gridfs.Bucket
+
+	webhooksColl          *mongo.Collection
+	webhookDeliveriesColl *mongo.Collection
+	outboxColl            *mongo.Collection
+
+	notificationPreferencesColl *mongo.Collection
+	notificationsColl           *mongo.Collection
+
+	ageOverridesColl *mongo.Collection
+
+	// transactions is whether the deployment supports them; see inTx.
+	transactions bool
 }
 
 var (
 	host     = os.Getenv("DB_HOST")
 	port     = os.Getenv("DB_PORT")
 	database = os.Getenv("DB_DATABASE")
+
+	// directConnection talks to DB_HOST alone instead of discovering the rest
+	// of its replica set, for single-node sets whose member address is only
+	// reachable from inside their own network.
+	directConnection = os.Getenv("DB_DIRECT_CONNECTION") == "true"
+	// allowStandalone lets the API run against a server without
+	// transactions, giving up writing changes and their outbox events
+	// atomically.
+	allowStandalone = os.Getenv("DB_ALLOW_STANDALONE") == "true"
 )
 
+func init() {
+	Register("mongo", Driver{
+		Open: openMongo,
+		Migrations: func() (MigrationTarget, error) {
+			client, err := connect()
+			if err != nil {
+				return nil, err
+			}
+			return newMongoMigrations(client.Database(database), migrations), nil
+		},
+	})
+}
+
+// New opens the backend chosen by DB_DRIVER, exiting if it can't.
 func New() Service {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%s", host, port)))
+	driver, err := configuredDriver()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv, err := driver.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return srv
+}
+
+func openMongo() (Service, error) {
+	client, err := connect()
+	if err != nil {
+		return nil, err
+	}
 
 	booksColl := client.Database(database).Collection("books")
 	authorsColl := client.Database(database).Collection("authors")
 	borrowersColl := client.Database(database).Collection("borrowers")
+	idempotencyColl := client.Database(database).Collection("idempotency_keys")
+	importJobsColl := client.Database(database).Collection("import_jobs")
+	webhooksColl := client.Database(database).Collection("webhooks")
+	webhookDeliveriesColl := client.Database(database).Collection("webhook_deliveries")
+	outboxColl := client.Database(database).Collection("outbox")
+	notificationPreferencesColl := client.Database(database).Collection("notification_preferences")
+	notificationsColl := client.Database(database).Collection("notifications")
+	ageOverridesColl := client.Database(database).Collection("age_overrides")
 
+	coversBucket, err := gridfs.NewBucket(client.Database(database), options.GridFSBucket().SetName("covers"))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
 
+	err = MigrateOnStartup(newMongoMigrations(client.Database(database), migrations))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	transactions := supportsTransactions(ctx, client)
+	if !transactions {
+		if !allowStandalone {
+			return nil, fmt.Errorf("mongo: %s:%s isn't a replica set, so changes and their outbox events can't be written in one transaction; run it as one or set DB_ALLOW_STANDALONE=true", host, port)
+		}
+		log.Printf("mongo: not a replica set; outbox events are written without transactions")
 	}
+
 	return &service{
-		db:            client,
-		booksColl:     booksColl,
-		authorsColl:   authorsColl,
-		borrowersColl: borrowersColl,
+		db:              client,
+		booksColl:       booksColl,
+		authorsColl:     authorsColl,
+		borrowersColl:   borrowersColl,
+		idempotencyColl: idempotencyColl,
+		importJobsColl:  importJobsColl,
+		coversBucket:    coversBucket,
+
+		webhooksColl:          webhooksColl,
+		webhookDeliveriesColl: webhookDeliveriesColl,
+		outboxColl:            outboxColl,
+
+		notificationPreferencesColl: notificationPreferencesColl,
+		notificationsColl:           notificationsColl,
+
+		ageOverridesColl: ageOverridesColl,
+
+		transactions: transactions,
+	}, nil
+}
+
+func connect() (*mongo.Client, error) {
+	opts := options.Client().
+		ApplyURI(fmt.Sprintf("mongodb://%s:%s", host, port)).
+		SetRegistry(idRegistry()).
+		SetMonitor(otelmongo.NewMonitor())
+	if directConnection {
+		opts.SetDirect(true)
 	}
+
+	return mongo.Connect(context.Background(), opts)
 }
 
 func (s *service) Health() map[string]string {
@@ -75,3 +237,55 @@ func (s *service) Health() map[string]string {
 		"message": "It's healthy",
 	}
 }
+
+// updateVersioned applies update to the document only if it is still at
+// version. It returns mongo.ErrNoDocuments when the document doesn't exist and
+// ErrVersionMismatch when it has moved on.
+func (s *service) updateVersioned(ctx context.Context, coll *mongo.Collection, id ID, version int64, update bson.M) error {
+	result, err := coll.UpdateOne(ctx, versionFilter(id, version), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return s.missingOrMismatch(ctx, coll, id)
+	}
+
+	return nil
+}
+
+// deleteVersioned removes the document only if it is still at version, with
+// the same errors as updateVersioned.
+func (s *service) deleteVersioned(ctx context.Context, coll *mongo.Collection, id ID, version int64) error {
+	result, err := coll.DeleteOne(ctx, versionFilter(id, version))
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return s.missingOrMismatch(ctx, coll, id)
+	}
+
+	return nil
+}
+
+func (s *service) missingOrMismatch(ctx context.Context, coll *mongo.Collection, id ID) error {
+	count, err := coll.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return ErrVersionMismatch
+}
+
+// versionFilter matches id at version. Documents written before versioning
+// was introduced have no version field and count as version 0.
+func versionFilter(id ID, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
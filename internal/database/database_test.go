@@ -10,7 +10,8 @@ import (
 )
 
 func mustStartMongoContainer() (func(context.Context) error, error) {
-	dbContainer, err := mongodb.Run(context.Background(), "mongo:latest")
+	// A replica set, so writes and their outbox events run in transactions
+	dbContainer, err := mongodb.Run(context.Background(), "mongo:latest", mongodb.WithReplicaSet("rs0"))
 	if err != nil {
 		return nil, err
 	}
@@ -27,6 +28,8 @@ func mustStartMongoContainer() (func(context.Context) error, error) {
 
 	host = dbHost
 	port = dbPort.Port()
+	// The member's address is the container's own, unreachable from here
+	directConnection = true
 
 	return dbContainer.Terminate, err
 }
@@ -75,5 +78,40 @@ func (s *service) deleteColls(ctx context.Context) error {
 		return err
 	}
 	_, err = s.borrowersColl.DeleteMany(ctx, filter)
-	return err
+	if err != nil {
+		return err
+	}
+	_, err = s.idempotencyColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.importJobsColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.webhooksColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.webhookDeliveriesColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.outboxColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.notificationPreferencesColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.notificationsColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = s.ageOverridesColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return s.coversBucket.DropContext(ctx)
 }
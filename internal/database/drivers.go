@@ -0,0 +1,70 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Driver opens one storage backend. Backends register a driver, usually from
+// an init function, and DB_DRIVER chooses between them.
+type Driver struct {
+	// Open connects to the backend, applying pending migrations unless
+	// DB_MIGRATE_ON_STARTUP is false.
+	Open func() (Service, error)
+	// Migrations connects to the backend for running migrations by hand.
+	Migrations func() (MigrationTarget, error)
+}
+
+// DefaultDriver is used when DB_DRIVER isn't set.
+const DefaultDriver = "mongo"
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+
+	driverName = os.Getenv("DB_DRIVER")
+)
+
+// Register makes a backend available under name. It panics if the name is
+// taken, like database/sql.Register.
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, taken := drivers[name]; taken {
+		panic("database: driver registered twice: " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers lists the registered backends.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func configuredDriver() (Driver, error) {
+	name := driverName
+	if name == "" {
+		name = DefaultDriver
+	}
+
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return Driver{}, fmt.Errorf("unknown DB_DRIVER %q, have %v", name, Drivers())
+	}
+
+	return driver, nil
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+)
+
+// NormalizeEmail checks that email is an RFC 5322 address, on its own
+// without a display name, and returns it trimmed and lower-cased. Emails
+// are stored and compared in this form, so the same address written
+// differently can't be registered twice.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", fmt.Errorf("email is required")
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", fmt.Errorf("email must be an address like name@example.com")
+	}
+
+	return strings.ToLower(email), nil
+}
+
+// StoredEmail is the email a record was stored with.
+type StoredEmail struct {
+	ID    ID     `bson:"_id"`
+	Email string `bson:"email"`
+}
+
+// NormalizeStoredEmails is for migrating emails stored before NormalizeEmail
+// was applied to them. It returns the trimmed and lower-cased email of each
+// record whose email isn't already, by ID, leaving emails that aren't valid
+// addresses otherwise as they are. Records whose emails would end up the same
+// are reported in the error instead, since which of them keeps the address is
+// for someone to decide; records names them in it, like "borrowers".
+func NormalizeStoredEmails(records string, stored []StoredEmail) (map[ID]string, error) {
+	byEmail := map[string][]string{}
+	for _, record := range stored {
+		email := strings.ToLower(strings.TrimSpace(record.Email))
+		byEmail[email] = append(byEmail[email], record.ID.String())
+	}
+
+	var collisions []string
+	for email, ids := range byEmail {
+		if len(ids) > 1 {
+			slices.Sort(ids)
+			collisions = append(collisions, fmt.Sprintf("%q (%s)", email, strings.Join(ids, ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		slices.Sort(collisions)
+		return nil, fmt.Errorf("%s share emails once trimmed and lower-cased; change all but one of each before migrating: %s", records, strings.Join(collisions, "; "))
+	}
+
+	normalized := map[ID]string{}
+	for _, record := range stored {
+		email := strings.ToLower(strings.TrimSpace(record.Email))
+		if email != record.Email {
+			normalized[record.ID] = email
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	testcases := []struct {
+		name   string
+		email  string
+		want   string
+		errMsg string
+	}{
+		{name: "should keep a normal address", email: "bober@hotmail.com", want: "bober@hotmail.com"},
+		{name: "should trim and lower-case", email: "  Bober.Skunk@HotMail.COM\t", want: "bober.skunk@hotmail.com"},
+		{name: "should accept plus tags and subdomains", email: "bober+books@mail.example.co.uk", want: "bober+books@mail.example.co.uk"},
+		{name: "should reject a missing email", email: "  ", errMsg: "email is required"},
+		{name: "should reject a missing domain", email: "bober@", errMsg: "must be an address"},
+		{name: "should reject a missing at sign", email: "bober.hotmail.com", errMsg: "must be an address"},
+		{name: "should reject spaces", email: "bober skunk@hotmail.com", errMsg: "must be an address"},
+		{name: "should reject a display name", email: "Bober <bober@hotmail.com>", errMsg: "must be an address"},
+		{name: "should reject angle brackets", email: "<bober@hotmail.com>", errMsg: "must be an address"},
+		{name: "should reject several addresses", email: "bober@hotmail.com, skunk@hotmail.com", errMsg: "must be an address"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			email, err := NormalizeEmail(tc.email)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, email)
+		})
+	}
+}
+
+func TestNormalizeStoredEmails(t *testing.T) {
+	t.Run("should normalize the emails that aren't", func(t *testing.T) {
+		normalized, err := NormalizeStoredEmails("borrowers", []StoredEmail{
+			{ID: "1", Email: "bober@hotmail.com"},
+			{ID: "2", Email: " Skunk@HotMail.com "},
+			{ID: "3", Email: "not an address"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[ID]string{"2": "skunk@hotmail.com"}, normalized)
+	})
+
+	t.Run("should report emails that would collide", func(t *testing.T) {
+		_, err := NormalizeStoredEmails("borrowers", []StoredEmail{
+			{ID: "1", Email: "bober@hotmail.com"},
+			{ID: "2", Email: "Bober@hotmail.com"},
+			{ID: "3", Email: "skunk@hotmail.com "},
+			{ID: "4", Email: "SKUNK@hotmail.com"},
+			{ID: "5", Email: "pingvin@hotmail.com"},
+		})
+		assert.EqualError(t, err, `borrowers share emails once trimmed and lower-cased; change all but one of each before migrating: "bober@hotmail.com" (1, 2); "skunk@hotmail.com" (3, 4)`)
+	})
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Types of BookEvent.
+const (
+	BookCreated  = "book.created"
+	BookUpdated  = "book.updated"
+	BookBorrowed = "book.borrowed"
+	BookReturned = "book.returned"
+	BookDeleted  = "book.deleted"
+)
+
+// ErrCannotResume is returned when asked to resume after an event that is
+// no longer known, e.g. because it's too old or from before a restart.
+// Clients should reload what they show and watch from now on.
+var ErrCannotResume = errors.New("can't resume after that event")
+
+// BookEvent is a change to a book.
+type BookEvent struct {
+	// ID identifies the event so watching can resume after it.
+	ID     string    `json:"-"`
+	Type   string    `json:"type"`
+	BookID ID        `json:"book_id"`
+	Time   time.Time `json:"time"`
+	// Book is the book as it was after the change, or nil once it's deleted.
+	Book *Book `json:"book,omitempty"`
+}
+
+// BookWatcher is implemented by backends that can report changes to books
+// made by anyone, not just through this process.
+type BookWatcher interface {
+	// WatchBooks sends changes to books until ctx is done or watching fails,
+	// then closes the channel. With after set, it starts with the changes
+	// that followed that event, or fails with ErrCannotResume.
+	WatchBooks(ctx context.Context, after string) (<-chan BookEvent, error)
+}
+
+// bookChange is the part of a change stream event WatchBooks uses.
+type bookChange struct {
+	ResumeToken struct {
+		Data string `bson:"_data"`
+	} `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID ID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      *Book `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// WatchBooks follows a change stream on the books collection, which needs
+// MongoDB to run as a replica set. Event IDs are the stream's resume tokens.
+func (s *service) WatchBooks(ctx context.Context, after string) (<-chan BookEvent, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if after != "" {
+		opts.SetResumeAfter(bson.M{"_data": after})
+	}
+
+	stream, err := s.booksColl.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		if after != "" {
+			return nil, fmt.Errorf("%w: %v", ErrCannotResume, err)
+		}
+		return nil, fmt.Errorf("watch books: %v", err)
+	}
+
+	events := make(chan BookEvent)
+	go func() {
+		defer close(events)
+		defer stream.Close(context.Background())
+
+		for stream.Next(ctx) {
+			var change bookChange
+			err := stream.Decode(&change)
+			if err != nil {
+				log.Printf("decode book change: %v", err)
+				continue
+			}
+
+			eventType := bookEventType(change.OperationType, change.UpdateDescription.UpdatedFields)
+			if eventType == "" {
+				continue
+			}
+
+			event := BookEvent{
+				ID:     change.ResumeToken.Data,
+				Type:   eventType,
+				BookID: change.DocumentKey.ID,
+				Time:   time.Unix(int64(change.ClusterTime.T), 0).UTC(),
+				Book:   change.FullDocument,
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if stream.Err() != nil && ctx.Err() == nil {
+			log.Printf("watch books: %v", stream.Err())
+		}
+	}()
+
+	return events, nil
+}
+
+// bookEventType names a change stream operation on a book. Updates that
+// only flip availability are loans; other operations, like dropping the
+// collection, aren't book events and give "".
+func bookEventType(operation string, updated bson.M) string {
+	switch operation {
+	case "insert":
+		return BookCreated
+	case "delete":
+		return BookDeleted
+	case "replace":
+		return BookUpdated
+	case "update":
+		available, ok := updated["available"].(bool)
+		if !ok {
+			return BookUpdated
+		}
+		for field := range updated {
+			if field != "available" && field != "version" {
+				return BookUpdated
+			}
+		}
+		if available {
+			return BookReturned
+		}
+		return BookBorrowed
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBookEventType(t *testing.T) {
+	testcases := []struct {
+		name      string
+		operation string
+		updated   bson.M
+		expected  string
+	}{
+		{name: "insert", operation: "insert", expected: BookCreated},
+		{name: "delete", operation: "delete", expected: BookDeleted},
+		{name: "replace", operation: "replace", expected: BookUpdated},
+		{name: "borrow", operation: "update", updated: bson.M{"available": false, "version": int64(2)}, expected: BookBorrowed},
+		{name: "return", operation: "update", updated: bson.M{"available": true, "version": int64(3)}, expected: BookReturned},
+		{name: "update", operation: "update", updated: bson.M{"title": "The Hobbit", "version": int64(2)}, expected: BookUpdated},
+		{name: "update with availability", operation: "update", updated: bson.M{"title": "The Hobbit", "available": true}, expected: BookUpdated},
+		{name: "drop", operation: "drop", expected: ""},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			assert.Equal(t, testcase.expected, bookEventType(testcase.operation, testcase.updated))
+		})
+	}
+}
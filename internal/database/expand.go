@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Expand selects the related documents embedded in books that are read with
+// it. The zero value embeds nothing.
+type Expand struct {
+	// Author embeds the primary author and each contributor's author.
+	Author bool
+	// Borrower embeds the borrower of books that are on loan.
+	Borrower bool
+}
+
+// GetBookExpanded is GetBook with the related documents in expand embedded.
+func (s *service) GetBookExpanded(ctx context.Context, bookID ID, expand Expand) (*Book, error) {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: bookID},
+	}
+
+	books, err := s.findBooks(ctx, filter, expand)
+	if err != nil {
+		return nil, fmt.Errorf("get book: %v", err)
+	}
+
+	if len(books) == 0 {
+		return nil, nil
+	}
+
+	return &books[0], nil
+}
+
+// findBooks reads the books matching filter, embedding related documents with
+// $lookup so expanding costs a single round trip.
+func (s *service) findBooks(ctx context.Context, filter any, expand Expand) ([]Book, error) {
+	books := []Book{}
+
+	curs, err := s.booksColl.Aggregate(ctx, s.bookPipeline(filter, expand))
+	if err != nil {
+		return nil, err
+	}
+
+	err = curs.All(ctx, &books)
+	if err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+func (s *service) bookPipeline(filter any, expand Expand) mongo.Pipeline {
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$match", Value: filter}},
+	}
+
+	if expand.Author {
+		authorOf := func(id string) bson.M {
+			return bson.M{"$arrayElemAt": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": "$expanded_authors",
+					"cond":  bson.M{"$eq": bson.A{"$$this._id", id}},
+				}},
+				0,
+			}}
+		}
+
+		pipeline = append(pipeline,
+			bson.D{bson.E{Key: "$lookup", Value: bson.M{
+				"from":         s.authorsColl.Name(),
+				"localField":   "contributors.author_id",
+				"foreignField": "_id",
+				"as":           "expanded_authors",
+			}}},
+			bson.D{bson.E{Key: "$set", Value: bson.M{
+				"author": authorOf("$author_id"),
+				"contributors": bson.M{"$map": bson.M{
+					"input": "$contributors",
+					"as":    "contributor",
+					"in": bson.M{"$mergeObjects": bson.A{
+						"$$contributor",
+						bson.M{"author": authorOf("$$contributor.author_id")},
+					}},
+				}},
+			}}},
+			bson.D{bson.E{Key: "$unset", Value: "expanded_authors"}},
+		)
+	}
+
+	if expand.Borrower {
+		pipeline = append(pipeline,
+			bson.D{bson.E{Key: "$lookup", Value: bson.M{
+				"from":         s.borrowersColl.Name(),
+				"localField":   "_id",
+				"foreignField": "books",
+				"as":           "expanded_borrowers",
+			}}},
+			bson.D{bson.E{Key: "$set", Value: bson.M{
+				"borrower": bson.M{"$arrayElemAt": bson.A{"$expanded_borrowers", 0}},
+			}}},
+			bson.D{bson.E{Key: "$unset", Value: "expanded_borrowers"}},
+		)
+	}
+
+	return pipeline
+}
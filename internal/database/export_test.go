@@ -0,0 +1,8 @@
+package database
+
+import "context"
+
+// DeleteColls empties a Mongo service for tests outside the package.
+func DeleteColls(ctx context.Context, srv Service) error {
+	return srv.(*service).deleteColls(ctx)
+}
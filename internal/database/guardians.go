@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GuardianError is returned by borrower writes naming a guardian who can't
+// be one.
+type GuardianError struct {
+	Reason string
+}
+
+func (e *GuardianError) Error() string {
+	return e.Reason
+}
+
+// ErrGuardianOfOthers is returned by DeleteBorrower for borrowers who are
+// still the guardian of others.
+var ErrGuardianOfOthers = errors.New("borrower is the guardian of other borrowers")
+
+// CheckGuardian reports why guardian, nil when it doesn't exist, can't be
+// the guardian of the borrower with borrowerID, which is zero for borrowers
+// yet to be created. Guardians must be adults, and children can't be
+// guardians in turn, so hasChildren is whether the borrower is a guardian
+// already.
+func CheckGuardian(borrowerID ID, guardian *Borrower, hasChildren bool, now time.Time) error {
+	switch {
+	case guardian == nil:
+		return &GuardianError{Reason: "guardian doesn't exist"}
+	case guardian.ID == borrowerID:
+		return &GuardianError{Reason: "borrower can't be their own guardian"}
+	case guardian.GuardianID != nil || hasChildren:
+		return &GuardianError{Reason: "guardians can't have guardians of their own"}
+	case AgeOn(guardian.Birthday, now) < AdultAge:
+		return &GuardianError{Reason: fmt.Sprintf("guardian must be at least %d", AdultAge)}
+	}
+	return nil
+}
+
+// checkGuardian checks the guardian borrower names, if any, for the borrower
+// with borrowerID.
+func (s *service) checkGuardian(ctx context.Context, borrowerID ID, borrower BorrowerRequest) error {
+	if borrower.GuardianID == nil {
+		return nil
+	}
+
+	guardian, err := s.GetBorrower(ctx, *borrower.GuardianID)
+	if err != nil {
+		return fmt.Errorf("get guardian: %w", err)
+	}
+
+	hasChildren := false
+	if !borrowerID.IsZero() {
+		count, err := s.borrowersColl.CountDocuments(ctx, bson.M{"guardian_id": borrowerID}, options.Count().SetLimit(1))
+		if err != nil {
+			return fmt.Errorf("count children: %w", err)
+		}
+		hasChildren = count > 0
+	}
+
+	return CheckGuardian(borrowerID, guardian, hasChildren, time.Now())
+}
+
+// ListChildren lists the borrowers whose guardian is guardianID, oldest
+// first.
+func (s *service) ListChildren(ctx context.Context, guardianID ID) ([]Borrower, error) {
+	curs, err := s.borrowersColl.Find(ctx, bson.M{"guardian_id": guardianID}, options.Find().SetSort(bson.D{{Key: "birthday", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("find children: %v", err)
+	}
+
+	children := []Borrower{}
+	err = curs.All(ctx, &children)
+	if err != nil {
+		return nil, fmt.Errorf("decode children: %v", err)
+	}
+
+	return children, nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ID identifies a document in any backend. IDs are 24 lowercase hex digits
+// laid out like MongoDB ObjectIDs, so the Mongo backend stores them natively
+// and IDs stay valid when data moves between backends.
+type ID string
+
+// ErrInvalidID is returned by ParseID for strings that aren't IDs.
+var ErrInvalidID = errors.New("invalid id")
+
+var (
+	idProcess [5]byte
+	idCounter atomic.Uint32
+)
+
+func init() {
+	var seed [9]byte
+	_, err := rand.Read(seed[:])
+	if err != nil {
+		panic(fmt.Sprintf("seed ids: %v", err))
+	}
+	copy(idProcess[:], seed[:5])
+	idCounter.Store(binary.BigEndian.Uint32(seed[5:]))
+}
+
+// NewID returns a new ID: a timestamp, a random per-process value and a
+// counter, so IDs created later sort after earlier ones.
+func NewID() ID {
+	var b [12]byte
+	binary.BigEndian.PutUint32(b[0:4], uint32(time.Now().Unix()))
+	copy(b[4:9], idProcess[:])
+	count := idCounter.Add(1)
+	b[9], b[10], b[11] = byte(count>>16), byte(count>>8), byte(count)
+
+	return ID(hex.EncodeToString(b[:]))
+}
+
+// ParseID checks that s is an ID, accepting uppercase hex digits.
+func ParseID(s string) (ID, error) {
+	if len(s) != 24 {
+		return "", ErrInvalidID
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+
+	return ID(hex.EncodeToString(b)), nil
+}
+
+// IsZero reports whether id is unset.
+func (id ID) IsZero() bool {
+	return id == ""
+}
+
+func (id ID) String() string {
+	return string(id)
+}
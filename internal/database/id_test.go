@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseID(t *testing.T) {
+	testcases := []struct {
+		name string
+		in   string
+		id   ID
+		err  error
+	}{
+		{name: "lowercase", in: "6650a1b2c3d4e5f601234567", id: "6650a1b2c3d4e5f601234567"},
+		{name: "uppercase", in: "6650A1B2C3D4E5F601234567", id: "6650a1b2c3d4e5f601234567"},
+		{name: "too short", in: "6650a1b2", err: ErrInvalidID},
+		{name: "not hex", in: "6650a1b2c3d4e5f60123456z", err: ErrInvalidID},
+		{name: "empty", in: "", err: ErrInvalidID},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := ParseID(tc.in)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.id, id)
+		})
+	}
+}
+
+func TestNewID(t *testing.T) {
+	first, second := NewID(), NewID()
+	assert.NotEqual(t, first, second)
+	assert.Less(t, string(first), string(second))
+
+	parsed, err := ParseID(first.String())
+	assert.NoError(t, err)
+	assert.Equal(t, first, parsed)
+}
+
+func TestIDCodec(t *testing.T) {
+	type doc struct {
+		ID    ID   `bson:"_id"`
+		Books []ID `bson:"books"`
+		Unset ID   `bson:"unset"`
+	}
+
+	id := NewID()
+	raw, err := bson.MarshalWithRegistry(idRegistry(), doc{ID: id, Books: []ID{id}})
+	assert.NoError(t, err)
+
+	var stored struct {
+		ID    primitive.ObjectID   `bson:"_id"`
+		Books []primitive.ObjectID `bson:"books"`
+		Unset primitive.ObjectID   `bson:"unset"`
+	}
+	err = bson.Unmarshal(raw, &stored)
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), stored.ID.Hex())
+	assert.Equal(t, id.String(), stored.Books[0].Hex())
+	assert.True(t, stored.Unset.IsZero())
+
+	var decoded doc
+	err = bson.UnmarshalWithRegistry(idRegistry(), raw, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, doc{ID: id, Books: []ID{id}}, decoded)
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var idType = reflect.TypeOf(ID(""))
+
+// idRegistry stores IDs as ObjectIDs, so documents written before IDs were
+// backend neutral, and queries against them, keep working. The unset ID is
+// the zero ObjectID.
+func idRegistry() *bsoncodec.Registry {
+	registry := bson.NewRegistry()
+	registry.RegisterTypeEncoder(idType, bsoncodec.ValueEncoderFunc(encodeID))
+	registry.RegisterTypeDecoder(idType, bsoncodec.ValueDecoderFunc(decodeID))
+	return registry
+}
+
+func encodeID(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	oid, err := objectID(ID(val.String()))
+	if err != nil {
+		return err
+	}
+	return vw.WriteObjectID(oid)
+}
+
+func decodeID(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var id ID
+	switch vr.Type() {
+	case bsontype.ObjectID:
+		oid, err := vr.ReadObjectID()
+		if err != nil {
+			return err
+		}
+		if !oid.IsZero() {
+			id = ID(oid.Hex())
+		}
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		id = ID(s)
+	case bsontype.Null:
+		err := vr.ReadNull()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot decode %v into an ID", vr.Type())
+	}
+
+	val.SetString(string(id))
+	return nil
+}
+
+func objectID(id ID) (primitive.ObjectID, error) {
+	if id.IsZero() {
+		return primitive.NilObjectID, nil
+	}
+
+	oid, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("id %q isn't an ObjectID", string(id))
+	}
+	return oid, nil
+}
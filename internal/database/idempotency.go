@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PendingIdempotencyTTL bounds how long an in-flight reservation blocks
+// retries if the request that made it never completes.
+const PendingIdempotencyTTL = time.Minute
+
+type IdempotencyRecord struct {
+	Key         string    `bson:"_id"`
+	RequestHash string    `bson:"request_hash"`
+	Completed   bool      `bson:"completed"`
+	StatusCode  int       `bson:"status_code"`
+	ContentType string    `bson:"content_type"`
+	Body        []byte    `bson:"body"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// ReserveIdempotencyKey claims key for a request. It returns nil when the key
+// was free and is now reserved, or the existing record when another request
+// already holds it.
+func (s *service) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*IdempotencyRecord, error) {
+	record := IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(PendingIdempotencyTTL),
+	}
+
+	// The TTL monitor only runs once a minute, so an expired record may still
+	// be around; drop it and try again once.
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := s.idempotencyColl.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("reserve idempotency key: %v", err)
+		}
+
+		var existing IdempotencyRecord
+		err = s.idempotencyColl.FindOne(ctx, bson.M{"_id": key}).Decode(&existing)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			return nil, fmt.Errorf("get idempotency key: %v", err)
+		}
+
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, nil
+		}
+
+		_, err = s.idempotencyColl.DeleteOne(ctx, bson.M{"_id": key, "expires_at": existing.ExpiresAt})
+		if err != nil {
+			return nil, fmt.Errorf("delete expired idempotency key: %v", err)
+		}
+	}
+
+	return nil, fmt.Errorf("reserve idempotency key: key is contended")
+}
+
+// CompleteIdempotencyKey stores the response for a reserved key so retries can
+// replay it until ttl elapses.
+func (s *service) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error {
+	update := bson.M{
+		"$set": bson.M{
+			"completed":    true,
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"body":         body,
+			"expires_at":   time.Now().Add(ttl),
+		},
+	}
+
+	_, err := s.idempotencyColl.UpdateByID(ctx, key, update)
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %v", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a reservation so the request can be retried.
+func (s *service) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.idempotencyColl.DeleteOne(ctx, bson.M{"_id": key})
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %v", err)
+	}
+
+	return nil
+}
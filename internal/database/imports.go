@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ImportJobRunning     = "running"
+	ImportJobCompleted   = "completed"
+	ImportJobFailed      = "failed"
+	ImportJobInterrupted = "interrupted"
+
+	ImportRowCreated = "created"
+	ImportRowFailed  = "failed"
+)
+
+// ImportInterruptedError is the error an interrupted job reports.
+const ImportInterruptedError = "the import stopped before every row was handled"
+
+// ErrImportJobNotRunning is returned when recording to a job that's missing
+// or no longer running, such as one interrupted while its import was slow.
+var ErrImportJobNotRunning = errors.New("import job isn't running")
+
+type ImportJob struct {
+	ID         ID                `json:"id" bson:"_id"`
+	Kind       string            `json:"kind" bson:"kind"`
+	Status     string            `json:"status" bson:"status"`
+	Total      int               `json:"total" bson:"total"`
+	Succeeded  int               `json:"succeeded" bson:"succeeded"`
+	Failed     int               `json:"failed" bson:"failed"`
+	Rows       []ImportRowResult `json:"rows" bson:"rows"`
+	Error      string            `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at" bson:"updated_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+func (j *ImportJob) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type ImportRowResult struct {
+	Row    int    `json:"row" bson:"row"`
+	Status string `json:"status" bson:"status"`
+	BookID *ID    `json:"book_id,omitempty" bson:"book_id,omitempty"`
+	Error  string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// CreateImportJob starts tracking an import of total rows.
+func (s *service) CreateImportJob(ctx context.Context, kind string, total int) (*ID, error) {
+	now := time.Now().UTC()
+	job := ImportJob{
+		ID:        NewID(),
+		Kind:      kind,
+		Status:    ImportJobRunning,
+		Total:     total,
+		Rows:      []ImportRowResult{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := s.importJobsColl.InsertOne(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("create import job: %v", err)
+	}
+
+	return &job.ID, nil
+}
+
+// RecordImportRow appends the outcome of one row to the job.
+func (s *service) RecordImportRow(ctx context.Context, jobID ID, result ImportRowResult) error {
+	counter := "succeeded"
+	if result.Status != ImportRowCreated {
+		counter = "failed"
+	}
+
+	update := bson.M{
+		"$push": bson.M{
+			"rows": result,
+		},
+		"$inc": bson.M{
+			counter: 1,
+		},
+		"$set": bson.M{
+			"updated_at": time.Now().UTC(),
+		},
+	}
+
+	updated, err := s.importJobsColl.UpdateOne(ctx, bson.M{"_id": jobID, "status": ImportJobRunning}, update)
+	if err != nil {
+		return fmt.Errorf("record import row: %v", err)
+	}
+	if updated.MatchedCount == 0 {
+		return fmt.Errorf("record import row: %w", ErrImportJobNotRunning)
+	}
+
+	return nil
+}
+
+// FinishImportJob marks the job done. A non-empty jobErr means the import
+// stopped early.
+func (s *service) FinishImportJob(ctx context.Context, jobID ID, jobErr string) error {
+	status := ImportJobCompleted
+	if jobErr != "" {
+		status = ImportJobFailed
+	}
+
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{
+			"status":      status,
+			"error":       jobErr,
+			"updated_at":  now,
+			"finished_at": now,
+		},
+	}
+
+	updated, err := s.importJobsColl.UpdateOne(ctx, bson.M{"_id": jobID, "status": ImportJobRunning}, update)
+	if err != nil {
+		return fmt.Errorf("finish import job: %v", err)
+	}
+	if updated.MatchedCount == 0 {
+		return fmt.Errorf("finish import job: %w", ErrImportJobNotRunning)
+	}
+
+	return nil
+}
+
+// InterruptImportJobs marks running jobs that haven't recorded a row since
+// idleSince as interrupted: whatever was running them stopped. It returns how
+// many it marked.
+func (s *service) InterruptImportJobs(ctx context.Context, idleSince time.Time) (int, error) {
+	filter := bson.M{
+		"status":     ImportJobRunning,
+		"updated_at": bson.M{"$lt": idleSince},
+	}
+
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{
+			"status":      ImportJobInterrupted,
+			"error":       ImportInterruptedError,
+			"updated_at":  now,
+			"finished_at": now,
+		},
+	}
+
+	result, err := s.importJobsColl.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("interrupt import jobs: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
+
+func (s *service) GetImportJob(ctx context.Context, jobID ID) (*ImportJob, error) {
+	filter := bson.D{
+		bson.E{Key: "_id", Value: jobID},
+	}
+
+	var job ImportJob
+
+	err := s.importJobsColl.FindOne(ctx, filter).Decode(&job)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get import job: %v", err)
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IntegrityProblem is a reference between documents that doesn't hold, such
+// as a borrower holding a book that no longer exists.
+type IntegrityProblem struct {
+	Collection string
+	ID         ID
+	Problem    string
+}
+
+func (p IntegrityProblem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Collection, p.ID.String(), p.Problem)
+}
+
+// CheckIntegrity looks for references between authors, books and borrowers
+// that don't hold. It reports nothing for a consistent database.
+func (s *service) CheckIntegrity(ctx context.Context) ([]IntegrityProblem, error) {
+	problems := []IntegrityProblem{}
+
+	checks := []func(ctx context.Context) ([]IntegrityProblem, error){
+		s.missingBorrowedBooks,
+		s.missingLoans,
+		s.missingBookAuthors,
+		s.inconsistentLoans,
+	}
+	for _, check := range checks {
+		found, err := check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, found...)
+	}
+
+	return problems, nil
+}
+
+// missingReferences is the shape of checks that report, per document, the
+// ids it refers to that don't exist.
+type missingReferences struct {
+	ID      ID   `bson:"_id"`
+	Missing []ID `bson:"missing"`
+}
+
+func (s *service) missingBorrowedBooks(ctx context.Context) ([]IntegrityProblem, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$match", Value: bson.M{"books.0": bson.M{"$exists": true}}}},
+		bson.D{bson.E{Key: "$lookup", Value: bson.M{
+			"from":         s.booksColl.Name(),
+			"localField":   "books",
+			"foreignField": "_id",
+			"as":           "found",
+		}}},
+		bson.D{bson.E{Key: "$project", Value: bson.M{
+			"missing": bson.M{"$setDifference": bson.A{"$books", "$found._id"}},
+		}}},
+		bson.D{bson.E{Key: "$match", Value: bson.M{"missing.0": bson.M{"$exists": true}}}},
+	}
+
+	results := []missingReferences{}
+	err := s.aggregateAll(ctx, s.borrowersColl, pipeline, &results)
+	if err != nil {
+		return nil, fmt.Errorf("check borrowed books: %v", err)
+	}
+
+	problems := []IntegrityProblem{}
+	for _, result := range results {
+		for _, id := range result.Missing {
+			problems = append(problems, IntegrityProblem{
+				Collection: s.borrowersColl.Name(),
+				ID:         result.ID,
+				Problem:    fmt.Sprintf("borrows book %s, which doesn't exist", id.String()),
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+// missingLoans finds loans of books the borrower no longer holds. Books
+// borrowed before loans were recorded have no loan, so the reverse isn't
+// checked.
+func (s *service) missingLoans(ctx context.Context) ([]IntegrityProblem, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$match", Value: bson.M{"loans.0": bson.M{"$exists": true}}}},
+		bson.D{bson.E{Key: "$project", Value: bson.M{
+			"missing": bson.M{"$setDifference": bson.A{"$loans.book_id", bson.M{"$ifNull": bson.A{"$books", bson.A{}}}}},
+		}}},
+		bson.D{bson.E{Key: "$match", Value: bson.M{"missing.0": bson.M{"$exists": true}}}},
+	}
+
+	results := []missingReferences{}
+	err := s.aggregateAll(ctx, s.borrowersColl, pipeline, &results)
+	if err != nil {
+		return nil, fmt.Errorf("check loans: %v", err)
+	}
+
+	problems := []IntegrityProblem{}
+	for _, result := range results {
+		for _, id := range result.Missing {
+			problems = append(problems, IntegrityProblem{
+				Collection: s.borrowersColl.Name(),
+				ID:         result.ID,
+				Problem:    fmt.Sprintf("has a loan of book %s it doesn't borrow", id.String()),
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+func (s *service) missingBookAuthors(ctx context.Context) ([]IntegrityProblem, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$project", Value: bson.M{
+			"authors": bson.M{"$setUnion": bson.A{
+				bson.A{"$author_id"},
+				bson.M{"$ifNull": bson.A{"$contributors.author_id", bson.A{}}},
+			}},
+		}}},
+		bson.D{bson.E{Key: "$lookup", Value: bson.M{
+			"from":         s.authorsColl.Name(),
+			"localField":   "authors",
+			"foreignField": "_id",
+			"as":           "found",
+		}}},
+		bson.D{bson.E{Key: "$project", Value: bson.M{
+			// Books without an author_id get a null in authors; that's for
+			// the validator to catch, not a missing reference
+			"missing": bson.M{"$setDifference": bson.A{"$authors", bson.M{"$setUnion": bson.A{"$found._id", bson.A{nil}}}}},
+		}}},
+		bson.D{bson.E{Key: "$match", Value: bson.M{"missing.0": bson.M{"$exists": true}}}},
+	}
+
+	results := []missingReferences{}
+	err := s.aggregateAll(ctx, s.booksColl, pipeline, &results)
+	if err != nil {
+		return nil, fmt.Errorf("check book authors: %v", err)
+	}
+
+	problems := []IntegrityProblem{}
+	for _, result := range results {
+		for _, id := range result.Missing {
+			problems = append(problems, IntegrityProblem{
+				Collection: s.booksColl.Name(),
+				ID:         result.ID,
+				Problem:    fmt.Sprintf("credits author %s, which doesn't exist", id.String()),
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+// inconsistentLoans finds books on loan that are still marked available, and
+// books that more than one borrower holds.
+func (s *service) inconsistentLoans(ctx context.Context) ([]IntegrityProblem, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$lookup", Value: bson.M{
+			"from":         s.borrowersColl.Name(),
+			"localField":   "_id",
+			"foreignField": "books",
+			"as":           "borrowers",
+		}}},
+		bson.D{bson.E{Key: "$project", Value: bson.M{
+			"available": 1,
+			"borrowers": "$borrowers._id",
+		}}},
+		bson.D{bson.E{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"available": true, "borrowers.0": bson.M{"$exists": true}},
+			bson.M{"borrowers.1": bson.M{"$exists": true}},
+		}}}},
+	}
+
+	results := []struct {
+		ID        ID   `bson:"_id"`
+		Available bool `bson:"available"`
+		Borrowers []ID `bson:"borrowers"`
+	}{}
+	err := s.aggregateAll(ctx, s.booksColl, pipeline, &results)
+	if err != nil {
+		return nil, fmt.Errorf("check book loans: %v", err)
+	}
+
+	problems := []IntegrityProblem{}
+	for _, result := range results {
+		if result.Available {
+			problems = append(problems, IntegrityProblem{
+				Collection: s.booksColl.Name(),
+				ID:         result.ID,
+				Problem:    fmt.Sprintf("is available but borrowed by %s", result.Borrowers[0].String()),
+			})
+		}
+		if len(result.Borrowers) > 1 {
+			problems = append(problems, IntegrityProblem{
+				Collection: s.booksColl.Name(),
+				ID:         result.ID,
+				Problem:    fmt.Sprintf("is borrowed by %d borrowers", len(result.Borrowers)),
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+func (s *service) aggregateAll(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, results any) error {
+	curs, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+
+	return curs.All(ctx, results)
+}
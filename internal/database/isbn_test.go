@@ -0,0 +1,37 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	testcases := []struct {
+		name   string
+		isbn   string
+		want   string
+		errMsg string
+	}{
+		{name: "should keep a valid isbn-13", isbn: "9780261102217", want: "9780261102217"},
+		{name: "should strip hyphens and spaces", isbn: " 978-0-261 10221-7 ", want: "9780261102217"},
+		{name: "should convert an isbn-10", isbn: "0-261-10221-4", want: "9780261102217"},
+		{name: "should accept an X check digit", isbn: "0-8044-2957-x", want: "9780804429573"},
+		{name: "should reject a bad isbn-13 checksum", isbn: "9780261102218", errMsg: "invalid checksum"},
+		{name: "should reject a bad isbn-10 checksum", isbn: "0261102215", errMsg: "invalid checksum"},
+		{name: "should reject letters", isbn: "97802611022AB", errMsg: "invalid checksum"},
+		{name: "should reject other lengths", isbn: "12345", errMsg: "must have 10 or 13 digits"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			isbn, err := NormalizeISBN(tc.isbn)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, isbn)
+		})
+	}
+}
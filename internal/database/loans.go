@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LoanPeriod is how long a borrowed book may be kept.
+const LoanPeriod = 14 * 24 * time.Hour
+
+// Loan is a book a borrower has out and when it is due back.
+type Loan struct {
+	BookID     ID        `json:"book_id" bson:"book_id"`
+	BorrowedAt time.Time `json:"borrowed_at" bson:"borrowed_at"`
+	DueAt      time.Time `json:"due_at" bson:"due_at"`
+}
+
+// OverdueLoan is a loan past its due date along with who has the book.
+type OverdueLoan struct {
+	Loan          `bson:"inline"`
+	BookTitle     string `json:"book_title" bson:"book_title"`
+	BorrowerID    ID     `json:"borrower_id" bson:"borrower_id"`
+	BorrowerName  string `json:"borrower_name" bson:"borrower_name"`
+	BorrowerEmail string `json:"borrower_email" bson:"borrower_email"`
+}
+
+// NewLoan starts a loan of bookID running for LoanPeriod from now.
+func NewLoan(bookID ID) Loan {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return Loan{
+		BookID:     bookID,
+		BorrowedAt: now,
+		DueAt:      now.Add(LoanPeriod),
+	}
+}
+
+// ReturnBook ends the loan of a book, taking it off its borrower and making
+// it available again.
+func (s *service) ReturnBook(ctx context.Context, bookID ID) error {
+	return s.inTx(ctx, func(ctx context.Context) error {
+		book, err := s.GetBook(ctx, bookID)
+		if err != nil {
+			return fmt.Errorf("get book: %w", err)
+		}
+
+		if book == nil {
+			return fmt.Errorf("book doesn't exist")
+		}
+
+		// The loan is read first for the event, since returning drops it
+		returned := LoanData{Loan: Loan{BookID: bookID}}
+		var borrower Borrower
+		err = s.borrowersColl.FindOne(ctx, bson.M{"books": bookID}).Decode(&borrower)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("return book by user: %w", err)
+		}
+		if err == nil {
+			returned.BorrowerID = borrower.ID
+			for _, loan := range borrower.Loans {
+				if loan.BookID == bookID {
+					returned.Loan = loan
+				}
+			}
+		}
+
+		update := bson.M{
+			"$pull": bson.M{
+				"books": bookID,
+				"loans": bson.M{"book_id": bookID},
+			},
+			"$inc": bson.M{
+				"version": 1,
+			},
+		}
+
+		result, err := s.borrowersColl.UpdateMany(ctx, bson.M{"books": bookID}, update)
+		if err != nil {
+			return fmt.Errorf("return book by user: %w", err)
+		}
+
+		if result.MatchedCount == 0 && book.Available {
+			return fmt.Errorf("book isn't borrowed")
+		}
+
+		update = bson.M{
+			"$set": bson.M{
+				"available": true,
+			},
+			"$inc": bson.M{
+				"version": 1,
+			},
+		}
+
+		_, err = s.booksColl.UpdateByID(ctx, bookID, update)
+		if err != nil {
+			return fmt.Errorf("book available update: %w", err)
+		}
+
+		return s.writeOutbox(ctx, BookReturned, returned)
+	})
+}
+
+// OverdueLoans lists the loans that were due before asOf, most overdue
+// first.
+func (s *service) OverdueLoans(ctx context.Context, asOf time.Time) ([]OverdueLoan, error) {
+	overdue := bson.M{"loans.due_at": bson.M{"$lt": asOf}}
+
+	pipeline := mongo.Pipeline{
+		bson.D{bson.E{Key: "$match", Value: overdue}},
+		bson.D{bson.E{Key: "$unwind", Value: "$loans"}},
+		bson.D{bson.E{Key: "$match", Value: overdue}},
+		bson.D{bson.E{Key: "$lookup", Value: bson.M{
+			"from":         s.booksColl.Name(),
+			"localField":   "loans.book_id",
+			"foreignField": "_id",
+			"as":           "book",
+		}}},
+		bson.D{bson.E{Key: "$project", Value: bson.M{
+			"_id":            0,
+			"book_id":        "$loans.book_id",
+			"borrowed_at":    "$loans.borrowed_at",
+			"due_at":         "$loans.due_at",
+			"book_title":     bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$book.title", 0}}, ""}},
+			"borrower_id":    "$_id",
+			"borrower_name":  "$name",
+			"borrower_email": "$email",
+		}}},
+		bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "due_at", Value: 1}}}},
+	}
+
+	curs, err := s.borrowersColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("find overdue loans: %v", err)
+	}
+
+	loans := []OverdueLoan{}
+	err = curs.All(ctx, &loans)
+	if err != nil {
+		return nil, fmt.Errorf("decode overdue loans: %v", err)
+	}
+
+	return loans, nil
+}
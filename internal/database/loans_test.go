@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	srv := New()
+	s := srv.(*service)
+
+	err := s.deleteColls(context.Background())
+	assert.NoError(t, err)
+
+	borrowerID, err := srv.CreateBorrower(context.Background(), BorrowerRequest{
+		Name:     "Bober",
+		Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Email:    "bober@hotmail.com",
+	})
+	assert.NoError(t, err)
+	_, err = srv.VerifyBorrower(context.Background(), *borrowerID, "bober@hotmail.com")
+	assert.NoError(t, err)
+
+	authorID, err := srv.CreateAuthor(context.Background(), AuthorRequest{
+		Name:     "Bober",
+		Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Email:    "bober@author.com",
+	})
+	assert.NoError(t, err)
+
+	bookID, err := srv.AddBook(context.Background(), BookRequest{
+		Title:     "Hobbit",
+		AuthorID:  *authorID,
+		Available: true,
+	})
+	assert.NoError(t, err)
+
+	err = srv.BorrowBook(context.Background(), *bookID, *borrowerID)
+	assert.NoError(t, err)
+
+	t.Run("should find nothing in a consistent database", func(t *testing.T) {
+		problems, err := srv.CheckIntegrity(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, problems)
+	})
+
+	t.Run("should find borrowed books that don't exist", func(t *testing.T) {
+		missing := NewID()
+		_, err := s.borrowersColl.UpdateByID(context.Background(), *borrowerID, bson.M{"$push": bson.M{"books": missing}})
+		assert.NoError(t, err)
+
+		problems, err := srv.CheckIntegrity(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, problems, 1)
+		assert.Equal(t, *borrowerID, problems[0].ID)
+		assert.Contains(t, problems[0].Problem, missing.String())
+	})
+
+	t.Run("should find borrowed books marked available", func(t *testing.T) {
+		_, err := s.booksColl.UpdateByID(context.Background(), *bookID, bson.M{"$set": bson.M{"available": true}})
+		assert.NoError(t, err)
+
+		problems, err := srv.CheckIntegrity(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, problems, 2)
+		assert.Equal(t, *bookID, problems[1].ID)
+		assert.Contains(t, problems[1].Problem, "is available but borrowed")
+	})
+}
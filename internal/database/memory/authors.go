@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"curly-computing-machine/internal/database"
+)
+
+func (s *service) CreateAuthor(ctx context.Context, author database.AuthorRequest) (*database.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := database.NewID()
+	if conflict := s.authorConflict(id, author); conflict != nil {
+		return nil, conflict
+	}
+
+	s.authors[id] = database.Author{
+		ID:       id,
+		Name:     author.Name,
+		Birthday: author.Birthday.UTC(),
+		Email:    author.Email,
+		Version:  1,
+	}
+
+	return &id, nil
+}
+
+func (s *service) GetAuthor(ctx context.Context, authorID database.ID) (*database.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.author(authorID), nil
+}
+
+// UpdateAuthor replaces an author's details if the author is still at
+// version. It returns nil when the author doesn't exist and
+// database.ErrVersionMismatch when it has changed since.
+func (s *service) UpdateAuthor(ctx context.Context, authorID database.ID, author database.AuthorRequest, version int64) (*database.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.authors[authorID]
+	if !ok {
+		return nil, nil
+	}
+	if current.Version != version {
+		return nil, fmt.Errorf("update author: %w", database.ErrVersionMismatch)
+	}
+	if conflict := s.authorConflict(authorID, author); conflict != nil {
+		return nil, conflict
+	}
+
+	current.Name = author.Name
+	current.Birthday = author.Birthday.UTC()
+	current.Email = author.Email
+	current.Version++
+	s.authors[authorID] = current
+
+	return &current, nil
+}
+
+// DeleteAuthor removes an author credited on no books if the author is still
+// at version. It reports false when the author doesn't exist.
+func (s *service) DeleteAuthor(ctx context.Context, authorID database.ID, version int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.authors[authorID]
+	if !ok {
+		return false, nil
+	}
+	if current.Version != version {
+		return false, fmt.Errorf("delete author: %w", database.ErrVersionMismatch)
+	}
+
+	for _, book := range s.books {
+		if book.AuthorID == authorID || credits(book, authorID, "") {
+			return false, database.ErrAuthorHasBooks
+		}
+	}
+
+	delete(s.authors, authorID)
+	return true, nil
+}
+
+// FindAuthorByEmail returns the author registered with email, or nil if
+// there is none.
+func (s *service) FindAuthorByEmail(ctx context.Context, email string) (*database.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findAuthor(func(author database.Author) bool { return author.Email == email }), nil
+}
+
+// FindAuthorByName returns the first author with exactly this name, or nil
+// if there is none.
+func (s *service) FindAuthorByName(ctx context.Context, name string) (*database.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findAuthor(func(author database.Author) bool { return author.Name == name }), nil
+}
+
+// author returns a copy of the author with id, or nil if there is none.
+func (s *service) author(id database.ID) *database.Author {
+	author, ok := s.authors[id]
+	if !ok {
+		return nil
+	}
+	return &author
+}
+
+func (s *service) findAuthor(match func(author database.Author) bool) *database.Author {
+	for _, id := range sortedIDs(s.authors) {
+		if match(s.authors[id]) {
+			return s.author(id)
+		}
+	}
+	return nil
+}
+
+// authorConflict reports an author other than id that already has the
+// email, or the name and birthday, of author.
+func (s *service) authorConflict(id database.ID, author database.AuthorRequest) error {
+	for _, other := range s.authors {
+		if other.ID == id {
+			continue
+		}
+		if other.Email == author.Email {
+			return &database.ConflictError{Resource: "author", Field: "email"}
+		}
+		if other.Name == author.Name && other.Birthday.Equal(author.Birthday) {
+			return &database.ConflictError{Resource: "author", Field: "name"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"curly-computing-machine/internal/database"
+)
+
+func (s *service) ListBooks(ctx context.Context, expand database.Expand) ([]database.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findBooks(func(database.Book) bool { return true }, expand), nil
+}
+
+func (s *service) AddBook(ctx context.Context, book database.BookRequest) (*database.ID, error) {
+	authorID, contributors, err := book.Credits()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.checkContributors(contributors)
+	if err != nil {
+		return nil, err
+	}
+
+	id := database.NewID()
+	stored := database.Book{
+		ID:           id,
+		Title:        book.Title,
+		ISBN:         book.ISBN,
+		Description:  book.Description,
+		AuthorID:     authorID,
+		Contributors: contributors,
+		Genres:       genres(book.Genres),
+		Available:    book.Available,
+		Audience:     book.RatedAudience(),
+		Version:      1,
+	}
+	if conflict := s.bookConflict(stored); conflict != nil {
+		return nil, conflict
+	}
+
+	err = s.writeOutbox(database.BookCreated, database.BookCreatedData{Book: stored})
+	if err != nil {
+		return nil, err
+	}
+
+	s.books[id] = stored
+	return &id, nil
+}
+
+func (s *service) GetBook(ctx context.Context, bookID database.ID) (*database.Book, error) {
+	return s.GetBookExpanded(ctx, bookID, database.Expand{})
+}
+
+// GetBookExpanded is GetBook with the related documents in expand embedded.
+func (s *service) GetBookExpanded(ctx context.Context, bookID database.ID, expand database.Expand) (*database.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.book(bookID, expand), nil
+}
+
+// GetBookByISBN returns the book with a normalized ISBN-13, or nil if there
+// is none.
+func (s *service) GetBookByISBN(ctx context.Context, isbn string) (*database.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	books := s.findBooks(func(book database.Book) bool { return book.ISBN != "" && book.ISBN == isbn }, database.Expand{})
+	if len(books) == 0 {
+		return nil, nil
+	}
+
+	return &books[0], nil
+}
+
+// BooksByContributor lists the books crediting an author, in any role when
+// role is empty.
+func (s *service) BooksByContributor(ctx context.Context, authorID database.ID, role string) ([]database.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findBooks(func(book database.Book) bool { return credits(book, authorID, role) }, database.Expand{}), nil
+}
+
+// UpdateBook replaces the catalog fields of a book if it is still at version.
+// Availability is left alone since it's owned by borrowing. It returns nil when
+// the book doesn't exist and database.ErrVersionMismatch when it has changed
+// since.
+func (s *service) UpdateBook(ctx context.Context, bookID database.ID, book database.BookRequest, version int64) (*database.Book, error) {
+	authorID, contributors, err := book.Credits()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.checkContributors(contributors)
+	if err != nil {
+		return nil, err
+	}
+
+	current, ok := s.books[bookID]
+	if !ok {
+		return nil, nil
+	}
+	if current.Version != version {
+		return nil, fmt.Errorf("update book: %w", database.ErrVersionMismatch)
+	}
+
+	current.Title = book.Title
+	current.ISBN = book.ISBN
+	current.Description = book.Description
+	current.AuthorID = authorID
+	current.Contributors = contributors
+	current.Genres = genres(book.Genres)
+	current.Audience = book.RatedAudience()
+	current.Version++
+	if conflict := s.bookConflict(current); conflict != nil {
+		return nil, conflict
+	}
+
+	s.books[bookID] = current
+	return s.book(bookID, database.Expand{}), nil
+}
+
+// DeleteBook removes a book if it is still at version and not on loan. It
+// reports false when the book doesn't exist. Its cover files go with it.
+func (s *service) DeleteBook(ctx context.Context, bookID database.ID, version int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.books[bookID]
+	if !ok {
+		return false, nil
+	}
+	if !current.Available {
+		return false, database.ErrBookBorrowed
+	}
+	if current.Version != version {
+		return false, fmt.Errorf("delete book: %w", database.ErrVersionMismatch)
+	}
+
+	s.deleteCoverFiles(current.Cover)
+	delete(s.books, bookID)
+	return true, nil
+}
+
+// book returns a copy of the book with id and whatever expand embeds, or nil
+// if there is none.
+func (s *service) book(id database.ID, expand database.Expand) *database.Book {
+	book, ok := s.books[id]
+	if !ok {
+		return nil
+	}
+
+	book.Contributors = append([]database.Contributor{}, book.Contributors...)
+	book.Genres = append([]string{}, book.Genres...)
+	if book.Cover != nil {
+		cover := *book.Cover
+		book.Cover = &cover
+	}
+
+	if expand.Author {
+		book.Author = s.author(book.AuthorID)
+		for i := range book.Contributors {
+			book.Contributors[i].Author = s.author(book.Contributors[i].AuthorID)
+		}
+	}
+
+	if expand.Borrower {
+		if loan, ok := s.loans[id]; ok {
+			book.Borrower = s.borrower(loan.borrowerID)
+		}
+	}
+
+	return &book
+}
+
+// findBooks returns copies of the books match accepts, in order.
+func (s *service) findBooks(match func(book database.Book) bool, expand database.Expand) []database.Book {
+	books := []database.Book{}
+	for _, id := range sortedIDs(s.books) {
+		if match(s.books[id]) {
+			books = append(books, *s.book(id, expand))
+		}
+	}
+	return books
+}
+
+// checkContributors reports the first contributor whose author doesn't exist.
+func (s *service) checkContributors(contributors []database.Contributor) error {
+	for _, contributor := range contributors {
+		if _, ok := s.authors[contributor.AuthorID]; !ok {
+			return &database.MissingAuthorError{AuthorID: contributor.AuthorID}
+		}
+	}
+	return nil
+}
+
+// bookConflict reports another book that already has the ISBN, or the
+// title by the same author, of book.
+func (s *service) bookConflict(book database.Book) error {
+	for _, other := range s.books {
+		if other.ID == book.ID {
+			continue
+		}
+		if book.ISBN != "" && other.ISBN == book.ISBN {
+			return &database.ConflictError{Resource: "book", Field: "isbn"}
+		}
+		if other.AuthorID == book.AuthorID && other.Title == book.Title {
+			return &database.ConflictError{Resource: "book", Field: "title"}
+		}
+	}
+	return nil
+}
+
+// credits reports whether book credits authorID in role, or in any role
+// when role is empty.
+func credits(book database.Book, authorID database.ID, role string) bool {
+	for _, contributor := range book.Contributors {
+		if contributor.AuthorID == authorID && (role == "" || contributor.Role == role) {
+			return true
+		}
+	}
+	return false
+}
+
+// genres stores a missing list of genres as an empty one.
+func genres(genres []string) []string {
+	return append([]string{}, genres...)
+}
@@ -0,0 +1,234 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+func (s *service) CreateBorrower(ctx context.Context, borrower database.BorrowerRequest) (*database.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := database.NewID()
+	if conflict := s.borrowerConflict(id, borrower); conflict != nil {
+		return nil, conflict
+	}
+	if err := s.checkGuardian("", borrower); err != nil {
+		return nil, err
+	}
+
+	stored := database.Borrower{
+		ID:         id,
+		Name:       borrower.Name,
+		Birthday:   borrower.Birthday.UTC(),
+		Email:      borrower.Email,
+		GuardianID: borrower.GuardianID,
+		Version:    1,
+	}
+
+	created := stored
+	created.Books, created.Loans = []database.ID{}, []database.Loan{}
+	err := s.writeOutbox(database.BorrowerCreated, database.BorrowerCreatedData{Borrower: created})
+	if err != nil {
+		return nil, err
+	}
+
+	s.borrowers[id] = stored
+	return &id, nil
+}
+
+func (s *service) GetBorrower(ctx context.Context, borrowerID database.ID) (*database.Borrower, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.borrower(borrowerID), nil
+}
+
+func (s *service) BorrowedBooks(ctx context.Context, borrowerID database.ID, expand database.Expand) ([]database.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.borrowers[borrowerID]; !ok {
+		return nil, fmt.Errorf("borrower doesn't exist")
+	}
+
+	return s.findBooks(func(book database.Book) bool {
+		loan, ok := s.loans[book.ID]
+		return ok && loan.borrowerID == borrowerID
+	}, expand), nil
+}
+
+// UpdateBorrower replaces a borrower's details if the borrower is still at
+// version. It returns nil when the borrower doesn't exist and
+// database.ErrVersionMismatch when it has changed since.
+func (s *service) UpdateBorrower(ctx context.Context, borrowerID database.ID, borrower database.BorrowerRequest, version int64) (*database.Borrower, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.borrowers[borrowerID]
+	if !ok {
+		return nil, nil
+	}
+	if current.Version != version {
+		return nil, fmt.Errorf("update borrower: %w", database.ErrVersionMismatch)
+	}
+	if conflict := s.borrowerConflict(borrowerID, borrower); conflict != nil {
+		return nil, conflict
+	}
+	if err := s.checkGuardian(borrowerID, borrower); err != nil {
+		return nil, err
+	}
+
+	if current.Email != borrower.Email {
+		current.VerifiedAt = nil
+	}
+	current.Name = borrower.Name
+	current.Birthday = borrower.Birthday.UTC()
+	current.Email = borrower.Email
+	current.GuardianID = borrower.GuardianID
+	current.Version++
+	s.borrowers[borrowerID] = current
+
+	return s.borrower(borrowerID), nil
+}
+
+// VerifyBorrower marks a borrower verified if their email is still email,
+// and returns them. It returns nil when there's no such borrower or their
+// email has changed.
+func (s *service) VerifyBorrower(ctx context.Context, borrowerID database.ID, email string) (*database.Borrower, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.borrowers[borrowerID]
+	if !ok || current.Email != email {
+		return nil, nil
+	}
+
+	if current.VerifiedAt == nil {
+		verifiedAt := time.Now().UTC().Truncate(time.Millisecond)
+		current.VerifiedAt = &verifiedAt
+		current.Version++
+		s.borrowers[borrowerID] = current
+	}
+
+	return s.borrower(borrowerID), nil
+}
+
+// DeleteBorrower removes a borrower with no borrowed books if the borrower is
+// still at version. It reports false when the borrower doesn't exist.
+func (s *service) DeleteBorrower(ctx context.Context, borrowerID database.ID, version int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.borrowers[borrowerID]
+	if !ok {
+		return false, nil
+	}
+	if current.Version != version {
+		return false, fmt.Errorf("delete borrower: %w", database.ErrVersionMismatch)
+	}
+
+	for _, loan := range s.loans {
+		if loan.borrowerID == borrowerID {
+			return false, database.ErrBorrowerHasBooks
+		}
+	}
+	if len(s.children(borrowerID)) > 0 {
+		return false, database.ErrGuardianOfOthers
+	}
+
+	delete(s.borrowers, borrowerID)
+	delete(s.preferences, borrowerID)
+	for id, notification := range s.notifications {
+		if notification.BorrowerID == borrowerID {
+			delete(s.notifications, id)
+		}
+	}
+	return true, nil
+}
+
+// ListChildren lists the borrowers whose guardian is guardianID, oldest
+// first.
+func (s *service) ListChildren(ctx context.Context, guardianID database.ID) ([]database.Borrower, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	children := []database.Borrower{}
+	for _, id := range s.children(guardianID) {
+		children = append(children, *s.borrower(id))
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Birthday.Before(children[j].Birthday)
+	})
+	return children, nil
+}
+
+// children lists the IDs of the borrowers whose guardian is guardianID, in
+// order.
+func (s *service) children(guardianID database.ID) []database.ID {
+	ids := []database.ID{}
+	for _, id := range sortedIDs(s.borrowers) {
+		if guardian := s.borrowers[id].GuardianID; guardian != nil && *guardian == guardianID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// checkGuardian checks the guardian borrower names, if any, for the borrower
+// with borrowerID.
+func (s *service) checkGuardian(borrowerID database.ID, borrower database.BorrowerRequest) error {
+	if borrower.GuardianID == nil {
+		return nil
+	}
+
+	hasChildren := !borrowerID.IsZero() && len(s.children(borrowerID)) > 0
+	return database.CheckGuardian(borrowerID, s.borrower(*borrower.GuardianID), hasChildren, time.Now())
+}
+
+// borrower returns a copy of the borrower with id along with their loans,
+// oldest first, or nil if there is none.
+func (s *service) borrower(id database.ID) *database.Borrower {
+	borrower, ok := s.borrowers[id]
+	if !ok {
+		return nil
+	}
+
+	borrower.Books = []database.ID{}
+	borrower.Loans = []database.Loan{}
+	for _, bookID := range sortedIDs(s.loans) {
+		loan := s.loans[bookID]
+		if loan.borrowerID == id {
+			borrower.Loans = append(borrower.Loans, loan.Loan)
+		}
+	}
+	sort.SliceStable(borrower.Loans, func(i, j int) bool {
+		return borrower.Loans[i].BorrowedAt.Before(borrower.Loans[j].BorrowedAt)
+	})
+	for _, loan := range borrower.Loans {
+		borrower.Books = append(borrower.Books, loan.BookID)
+	}
+
+	return &borrower
+}
+
+// borrowerConflict reports a borrower other than id that already has the
+// email, or the name and birthday, of borrower.
+func (s *service) borrowerConflict(id database.ID, borrower database.BorrowerRequest) error {
+	for _, other := range s.borrowers {
+		if other.ID == id {
+			continue
+		}
+		if other.Email == borrower.Email {
+			return &database.ConflictError{Resource: "borrower", Field: "email"}
+		}
+		if other.Name == borrower.Name && other.Birthday.Equal(borrower.Birthday) {
+			return &database.ConflictError{Resource: "borrower", Field: "name"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+func (s *service) BorrowBook(ctx context.Context, bookID database.ID, borrowerID database.ID) error {
+	return s.borrowBook(bookID, borrowerID, nil)
+}
+
+// BorrowBookWithOverride borrows a book like BorrowBook, but lends it to a
+// borrower too young for it on a librarian's say-so, recording that it did.
+func (s *service) BorrowBookWithOverride(ctx context.Context, bookID database.ID, borrowerID database.ID, override database.Override) error {
+	return s.borrowBook(bookID, borrowerID, &override)
+}
+
+func (s *service) borrowBook(bookID database.ID, borrowerID database.ID, override *database.Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[bookID]
+	if !ok {
+		return fmt.Errorf("book doesn't exist")
+	}
+
+	borrower, ok := s.borrowers[borrowerID]
+	if !ok {
+		return fmt.Errorf("borrower doesn't exist")
+	}
+
+	if borrower.VerifiedAt == nil {
+		return database.ErrBorrowerNotVerified
+	}
+
+	ageOverride, err := database.CheckAge(book, borrower, override, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if !book.Available {
+		return fmt.Errorf("book isn't available")
+	}
+
+	lent := database.NewLoan(bookID)
+	err = s.writeOutbox(database.BookBorrowed, database.LoanData{Loan: lent, BorrowerID: borrowerID})
+	if err != nil {
+		return err
+	}
+
+	book.Available = false
+	book.Version++
+	s.books[bookID] = book
+
+	borrower.Version++
+	s.borrowers[borrowerID] = borrower
+
+	s.loans[bookID] = loan{Loan: lent, borrowerID: borrowerID}
+	if ageOverride != nil {
+		s.ageOverrides[ageOverride.ID] = *ageOverride
+	}
+	return nil
+}
+
+// ListAgeOverrides lists the age restrictions overridden for a borrower,
+// newest first.
+func (s *service) ListAgeOverrides(ctx context.Context, borrowerID database.ID) ([]database.AgeOverride, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	overrides := []database.AgeOverride{}
+	ids := sortedIDs(s.ageOverrides)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if override := s.ageOverrides[ids[i]]; override.BorrowerID == borrowerID {
+			overrides = append(overrides, override)
+		}
+	}
+	return overrides, nil
+}
+
+// ReturnBook ends the loan of a book, taking it off its borrower and making
+// it available again.
+func (s *service) ReturnBook(ctx context.Context, bookID database.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[bookID]
+	if !ok {
+		return fmt.Errorf("book doesn't exist")
+	}
+
+	loan, borrowed := s.loans[bookID]
+	if !borrowed && book.Available {
+		return fmt.Errorf("book isn't borrowed")
+	}
+
+	returned := database.LoanData{Loan: database.Loan{BookID: bookID}}
+	if borrowed {
+		returned = database.LoanData{Loan: loan.Loan, BorrowerID: loan.borrowerID}
+	}
+	err := s.writeOutbox(database.BookReturned, returned)
+	if err != nil {
+		return err
+	}
+
+	if borrowed {
+		borrower := s.borrowers[loan.borrowerID]
+		borrower.Version++
+		s.borrowers[loan.borrowerID] = borrower
+		delete(s.loans, bookID)
+	}
+
+	book.Available = true
+	book.Version++
+	s.books[bookID] = book
+	return nil
+}
+
+// OverdueLoans lists the loans that were due before asOf, most overdue
+// first.
+func (s *service) OverdueLoans(ctx context.Context, asOf time.Time) ([]database.OverdueLoan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loans := []database.OverdueLoan{}
+	for _, loan := range s.loans {
+		if !loan.DueAt.Before(asOf) {
+			continue
+		}
+		borrower := s.borrowers[loan.borrowerID]
+		loans = append(loans, database.OverdueLoan{
+			Loan:          loan.Loan,
+			BookTitle:     s.books[loan.BookID].Title,
+			BorrowerID:    borrower.ID,
+			BorrowerName:  borrower.Name,
+			BorrowerEmail: borrower.Email,
+		})
+	}
+	sort.Slice(loans, func(i, j int) bool { return loans[i].DueAt.Before(loans[j].DueAt) })
+
+	return loans, nil
+}
+
+// CheckIntegrity looks for books on loan that are still marked available.
+// Loans are keyed by book and removed along with it, so nothing else can
+// dangle.
+func (s *service) CheckIntegrity(ctx context.Context) ([]database.IntegrityProblem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	problems := []database.IntegrityProblem{}
+	for _, bookID := range sortedIDs(s.loans) {
+		if s.books[bookID].Available {
+			problems = append(problems, database.IntegrityProblem{
+				Collection: "books",
+				ID:         bookID,
+				Problem:    fmt.Sprintf("is available but borrowed by %s", s.loans[bookID].borrowerID.String()),
+			})
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,77 @@
+// Package memory keeps the library in process memory. It's a fake for tests
+// of code built on database.Service, and passes the same conformance suite as
+// the real backends so it can stand in for them.
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"curly-computing-machine/internal/database"
+)
+
+type service struct {
+	mu sync.Mutex
+
+	authors     map[database.ID]database.Author
+	borrowers   map[database.ID]database.Borrower
+	books       map[database.ID]database.Book
+	loans       map[database.ID]loan
+	idempotency map[string]database.IdempotencyRecord
+	importJobs  map[database.ID]database.ImportJob
+	coverFiles  map[database.ID]database.CoverFile
+
+	webhooks   map[database.ID]database.Webhook
+	deliveries map[database.ID]database.WebhookDelivery
+	outbox     map[database.ID]database.OutboxEvent
+
+	preferences   map[database.ID]database.NotificationPreferences
+	notifications map[database.ID]database.Notification
+
+	ageOverrides map[database.ID]database.AgeOverride
+}
+
+// loan is a database.Loan along with its borrower, keyed by book.
+type loan struct {
+	database.Loan
+	borrowerID database.ID
+}
+
+// New returns an empty Service.
+func New() database.Service {
+	return &service{
+		authors:     map[database.ID]database.Author{},
+		borrowers:   map[database.ID]database.Borrower{},
+		books:       map[database.ID]database.Book{},
+		loans:       map[database.ID]loan{},
+		idempotency: map[string]database.IdempotencyRecord{},
+		importJobs:  map[database.ID]database.ImportJob{},
+		coverFiles:  map[database.ID]database.CoverFile{},
+
+		webhooks:   map[database.ID]database.Webhook{},
+		deliveries: map[database.ID]database.WebhookDelivery{},
+		outbox:     map[database.ID]database.OutboxEvent{},
+
+		preferences:   map[database.ID]database.NotificationPreferences{},
+		notifications: map[database.ID]database.Notification{},
+
+		ageOverrides: map[database.ID]database.AgeOverride{},
+	}
+}
+
+func (s *service) Health() map[string]string {
+	return map[string]string{
+		"message": "It's healthy",
+	}
+}
+
+// sortedIDs returns the keys of m in order, which like the other backends'
+// IDs is the order they were created in.
+func sortedIDs[V any](m map[database.ID]V) []database.ID {
+	ids := make([]database.ID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) database.Service {
+		return New()
+	})
+}
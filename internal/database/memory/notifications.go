@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"curly-computing-machine/internal/database"
+)
+
+func (s *service) GetNotificationPreferences(ctx context.Context, borrowerID database.ID) (*database.NotificationPreferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs, ok := s.preferences[borrowerID]
+	if !ok {
+		return nil, nil
+	}
+	prefs.OptOut = slices.Clone(prefs.OptOut)
+	return &prefs, nil
+}
+
+func (s *service) SetNotificationPreferences(ctx context.Context, borrowerID database.ID, prefs database.NotificationPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs.OptOut = slices.Clone(prefs.OptOut)
+	s.preferences[borrowerID] = prefs
+	return nil
+}
+
+func (s *service) ReserveNotification(ctx context.Context, notification database.Notification, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, existing := range s.notifications {
+		if existing.BorrowerID != notification.BorrowerID || existing.Kind != notification.Kind || existing.Key != notification.Key {
+			continue
+		}
+		if existing.Status != database.NotificationFailed || existing.Attempts >= maxAttempts {
+			return false, nil
+		}
+
+		existing.Locale = notification.Locale
+		existing.To = notification.To
+		existing.Subject = notification.Subject
+		existing.Status = database.NotificationSending
+		existing.Error = ""
+		existing.Attempts++
+		s.notifications[id] = existing
+		return true, nil
+	}
+
+	s.notifications[notification.ID] = notification
+	return true, nil
+}
+
+func (s *service) UpdateNotification(ctx context.Context, notification database.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, existing := range s.notifications {
+		if existing.BorrowerID == notification.BorrowerID && existing.Kind == notification.Kind && existing.Key == notification.Key {
+			existing.Status = notification.Status
+			existing.Error = notification.Error
+			existing.SentAt = notification.SentAt
+			s.notifications[id] = existing
+		}
+	}
+	return nil
+}
+
+func (s *service) ListNotifications(ctx context.Context, borrowerID database.ID) ([]database.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notifications := []database.Notification{}
+	ids := sortedIDs(s.notifications)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if notification := s.notifications[ids[i]]; notification.BorrowerID == borrowerID {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications, nil
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// writeOutbox records an event along with the change it reports, which the
+// caller is making under the same lock.
+func (s *service) writeOutbox(eventType string, data any) error {
+	event, err := database.NewOutboxEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	s.outbox[event.ID] = event
+	return nil
+}
+
+func (s *service) ClaimOutboxEvents(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]database.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []database.OutboxEvent{}
+	for _, id := range sortedIDs(s.outbox) {
+		event := s.outbox[id]
+		if event.DispatchedAt == nil && !event.NextAttemptAt.After(asOf) {
+			due = append(due, event)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i, event := range due {
+		event.NextAttemptAt = asOf.Add(lease)
+		s.outbox[event.ID] = event
+		event.Payload = append(json.RawMessage(nil), event.Payload...)
+		due[i] = event
+	}
+	return due, nil
+}
+
+func (s *service) UpdateOutboxEvent(ctx context.Context, event database.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.outbox[event.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.Attempts = event.Attempts
+	stored.NextAttemptAt = event.NextAttemptAt
+	stored.LastError = event.LastError
+	stored.DispatchedAt = event.DispatchedAt
+	s.outbox[event.ID] = stored
+	return nil
+}
+
+func (s *service) PruneOutbox(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for id, event := range s.outbox {
+		if event.DispatchedAt != nil && event.DispatchedAt.Before(before) {
+			delete(s.outbox, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
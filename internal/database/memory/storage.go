@@ -0,0 +1,231 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// ReserveIdempotencyKey claims key for a request. It returns nil when the key
+// was free and is now reserved, or the existing record when another request
+// already holds it. Expired records are taken over in place.
+func (s *service) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*database.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.idempotency[key]; ok && existing.ExpiresAt.After(now) {
+		existing.Body = append([]byte(nil), existing.Body...)
+		return &existing, nil
+	}
+
+	s.idempotency[key] = database.IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(database.PendingIdempotencyTTL),
+	}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the response for a reserved key so retries can
+// replay it until ttl elapses.
+func (s *service) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.idempotency[key]
+	if !ok {
+		return nil
+	}
+
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	record.ExpiresAt = time.Now().Add(ttl)
+	s.idempotency[key] = record
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a reservation so the request can be retried.
+func (s *service) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotency, key)
+	return nil
+}
+
+// CreateImportJob starts tracking an import of total rows.
+func (s *service) CreateImportJob(ctx context.Context, kind string, total int) (*database.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := database.NewID()
+	now := time.Now().UTC()
+	s.importJobs[id] = database.ImportJob{
+		ID:        id,
+		Kind:      kind,
+		Status:    database.ImportJobRunning,
+		Total:     total,
+		Rows:      []database.ImportRowResult{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return &id, nil
+}
+
+// RecordImportRow appends the outcome of one row to the job.
+func (s *service) RecordImportRow(ctx context.Context, jobID database.ID, result database.ImportRowResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.importJobs[jobID]
+	if !ok || job.Status != database.ImportJobRunning {
+		return fmt.Errorf("record import row: %w", database.ErrImportJobNotRunning)
+	}
+
+	job.Rows = append(job.Rows, result)
+	if result.Status == database.ImportRowCreated {
+		job.Succeeded++
+	} else {
+		job.Failed++
+	}
+	job.UpdatedAt = time.Now().UTC()
+	s.importJobs[jobID] = job
+	return nil
+}
+
+// FinishImportJob marks the job done. A non-empty jobErr means the import
+// stopped early.
+func (s *service) FinishImportJob(ctx context.Context, jobID database.ID, jobErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.importJobs[jobID]
+	if !ok || job.Status != database.ImportJobRunning {
+		return fmt.Errorf("finish import job: %w", database.ErrImportJobNotRunning)
+	}
+
+	job.Status = database.ImportJobCompleted
+	if jobErr != "" {
+		job.Status = database.ImportJobFailed
+	}
+	job.Error = jobErr
+	finishedAt := time.Now().UTC()
+	job.UpdatedAt = finishedAt
+	job.FinishedAt = &finishedAt
+	s.importJobs[jobID] = job
+	return nil
+}
+
+// InterruptImportJobs marks running jobs that haven't recorded a row since
+// idleSince as interrupted.
+func (s *service) InterruptImportJobs(ctx context.Context, idleSince time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	interrupted := 0
+	now := time.Now().UTC()
+	for id, job := range s.importJobs {
+		if job.Status != database.ImportJobRunning || !job.UpdatedAt.Before(idleSince) {
+			continue
+		}
+
+		job.Status = database.ImportJobInterrupted
+		job.Error = database.ImportInterruptedError
+		finishedAt := now
+		job.UpdatedAt = finishedAt
+		job.FinishedAt = &finishedAt
+		s.importJobs[id] = job
+		interrupted++
+	}
+	return interrupted, nil
+}
+
+func (s *service) GetImportJob(ctx context.Context, jobID database.ID) (*database.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.importJobs[jobID]
+	if !ok {
+		return nil, nil
+	}
+
+	job.Rows = append([]database.ImportRowResult{}, job.Rows...)
+	return &job, nil
+}
+
+// SetBookCover stores a book's cover and thumbnail if the book is still at
+// version, replacing any previous ones, and bumps the book's version. It
+// returns nil when the book doesn't exist.
+func (s *service) SetBookCover(ctx context.Context, bookID database.ID, upload database.CoverUpload, version int64) (*database.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[bookID]
+	if !ok {
+		return nil, nil
+	}
+	if book.Version != version {
+		return nil, fmt.Errorf("set book cover: %w", database.ErrVersionMismatch)
+	}
+
+	cover := database.Cover{
+		ID:                   database.NewID(),
+		ContentType:          upload.ContentType,
+		ThumbnailID:          database.NewID(),
+		ThumbnailContentType: upload.ThumbnailContentType,
+		UploadedAt:           time.Now().UTC().Truncate(time.Millisecond),
+	}
+	s.coverFiles[cover.ID] = database.CoverFile{
+		ID:          cover.ID,
+		ContentType: cover.ContentType,
+		UploadedAt:  cover.UploadedAt,
+		Data:        append([]byte(nil), upload.Image...),
+	}
+	s.coverFiles[cover.ThumbnailID] = database.CoverFile{
+		ID:          cover.ThumbnailID,
+		ContentType: cover.ThumbnailContentType,
+		UploadedAt:  cover.UploadedAt,
+		Data:        append([]byte(nil), upload.Thumbnail...),
+	}
+
+	s.deleteCoverFiles(book.Cover)
+	book.Cover = &cover
+	book.Version++
+	s.books[bookID] = book
+
+	return s.book(bookID, database.Expand{}), nil
+}
+
+// GetBookCover reads a book's cover, or its thumbnail. It returns nil when
+// the book doesn't exist or has no cover.
+func (s *service) GetBookCover(ctx context.Context, bookID database.ID, thumbnail bool) (*database.CoverFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[bookID]
+	if !ok || book.Cover == nil {
+		return nil, nil
+	}
+
+	id := book.Cover.ID
+	if thumbnail {
+		id = book.Cover.ThumbnailID
+	}
+
+	file := s.coverFiles[id]
+	file.Data = append([]byte(nil), file.Data...)
+	return &file, nil
+}
+
+func (s *service) deleteCoverFiles(cover *database.Cover) {
+	if cover == nil {
+		return
+	}
+	delete(s.coverFiles, cover.ID)
+	delete(s.coverFiles, cover.ThumbnailID)
+}
@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+func (s *service) CreateWebhook(ctx context.Context, webhook database.WebhookRequest) (*database.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := database.NewID()
+	s.webhooks[id] = database.Webhook{
+		ID:        id,
+		URL:       webhook.URL,
+		Secret:    webhook.Secret,
+		Events:    append([]string{}, webhook.Events...),
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	return &id, nil
+}
+
+func (s *service) ListWebhooks(ctx context.Context) ([]database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []database.Webhook{}
+	for _, id := range sortedIDs(s.webhooks) {
+		webhooks = append(webhooks, copyWebhook(s.webhooks[id]))
+	}
+	return webhooks, nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, webhookID database.ID) (*database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[webhookID]
+	if !ok {
+		return nil, nil
+	}
+
+	webhook = copyWebhook(webhook)
+	return &webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (s *service) DeleteWebhook(ctx context.Context, webhookID database.ID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[webhookID]; !ok {
+		return false, nil
+	}
+
+	delete(s.webhooks, webhookID)
+	for id, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			delete(s.deliveries, id)
+		}
+	}
+	return true, nil
+}
+
+// QueueWebhookDeliveries queues event for every webhook subscribed to its
+// type that hasn't had it queued already, and returns how many it queued.
+func (s *service) QueueWebhookDeliveries(ctx context.Context, event database.WebhookEvent) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := 0
+	for _, webhookID := range sortedIDs(s.webhooks) {
+		if !slices.Contains(s.webhooks[webhookID].Events, event.Type) || s.queued(webhookID, event.ID) {
+			continue
+		}
+
+		delivery := database.NewWebhookDelivery(webhookID, event)
+		delivery.Payload = append([]byte(nil), event.Payload...)
+		s.deliveries[delivery.ID] = delivery
+		queued++
+	}
+	return queued, nil
+}
+
+func (s *service) queued(webhookID database.ID, eventID string) bool {
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID && delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due by asOf,
+// earliest first, and puts their next attempt off by lease so no other
+// worker takes them meanwhile.
+func (s *service) ClaimWebhookDeliveries(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []database.WebhookDelivery{}
+	for _, id := range sortedIDs(s.deliveries) {
+		delivery := s.deliveries[id]
+		if delivery.Status == database.DeliveryPending && !delivery.NextAttemptAt.After(asOf) {
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i, delivery := range due {
+		delivery.NextAttemptAt = asOf.Add(lease)
+		s.deliveries[delivery.ID] = delivery
+		due[i] = copyDelivery(delivery)
+	}
+	return due, nil
+}
+
+// UpdateWebhookDelivery saves the outcome of an attempt: its status,
+// attempts, next attempt, last error and when it was delivered.
+func (s *service) UpdateWebhookDelivery(ctx context.Context, delivery database.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.deliveries[delivery.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastError = delivery.LastError
+	stored.DeliveredAt = delivery.DeliveredAt
+	s.deliveries[delivery.ID] = stored
+	return nil
+}
+
+func (s *service) GetWebhookDelivery(ctx context.Context, deliveryID database.ID) (*database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[deliveryID]
+	if !ok {
+		return nil, nil
+	}
+
+	delivery = copyDelivery(delivery)
+	return &delivery, nil
+}
+
+// ListWebhookDeliveries lists deliveries with status, or all of them when
+// it's empty, newest first.
+func (s *service) ListWebhookDeliveries(ctx context.Context, status string) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []database.WebhookDelivery{}
+	ids := sortedIDs(s.deliveries)
+	for i := len(ids) - 1; i >= 0; i-- {
+		delivery := s.deliveries[ids[i]]
+		if status == "" || delivery.Status == status {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+	return deliveries, nil
+}
+
+func copyWebhook(webhook database.Webhook) database.Webhook {
+	webhook.Events = append([]string{}, webhook.Events...)
+	return webhook
+}
+
+func copyDelivery(delivery database.WebhookDelivery) database.WebhookDelivery {
+	delivery.Payload = append([]byte(nil), delivery.Payload...)
+	if delivery.DeliveredAt != nil {
+		deliveredAt := *delivery.DeliveredAt
+		delivery.DeliveredAt = &deliveredAt
+	}
+	return delivery
+}
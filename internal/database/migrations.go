@@ -0,0 +1,477 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigration is a Migration along with how to run it against Mongo.
+// Down undoes Up; data changes may leave Down as a no-op.
+type mongoMigration struct {
+	Migration
+	Up   func(ctx context.Context, db *mongo.Database) error
+	Down func(ctx context.Context, db *mongo.Database) error
+}
+
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// mongoMigrations runs migrations against a Mongo database and records the
+// applied ones in its migrations collection.
+type mongoMigrations struct {
+	db         *mongo.Database
+	coll       *mongo.Collection
+	migrations []mongoMigration
+}
+
+func newMongoMigrations(db *mongo.Database, migrations []mongoMigration) *mongoMigrations {
+	sorted := append([]mongoMigration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return &mongoMigrations{
+		db:         db,
+		coll:       db.Collection("migrations"),
+		migrations: sorted,
+	}
+}
+
+func (m *mongoMigrations) Migrations() []Migration {
+	migrations := make([]Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		migrations = append(migrations, migration.Migration)
+	}
+	return migrations
+}
+
+func (m *mongoMigrations) Applied(ctx context.Context) (map[int]time.Time, error) {
+	curs, err := m.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("find migrations: %v", err)
+	}
+
+	records := []migrationRecord{}
+	err = curs.All(ctx, &records)
+	if err != nil {
+		return nil, fmt.Errorf("decode migrations: %v", err)
+	}
+
+	applied := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Version] = record.AppliedAt
+	}
+
+	return applied, nil
+}
+
+func (m *mongoMigrations) Apply(ctx context.Context, migration Migration) error {
+	err := m.find(migration.Version).Up(ctx, m.db)
+	if err != nil {
+		return err
+	}
+
+	record := migrationRecord{
+		Version:     migration.Version,
+		Description: migration.Description,
+		AppliedAt:   time.Now().UTC(),
+	}
+	_, err = m.coll.InsertOne(ctx, record)
+	// Another instance starting at the same time may have recorded it
+	// first; migrations are idempotent, so that's fine.
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("record migration: %v", err)
+	}
+
+	return nil
+}
+
+func (m *mongoMigrations) Revert(ctx context.Context, migration Migration) error {
+	err := m.find(migration.Version).Down(ctx, m.db)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.coll.DeleteOne(ctx, bson.M{"_id": migration.Version})
+	if err != nil {
+		return fmt.Errorf("unrecord migration: %v", err)
+	}
+
+	return nil
+}
+
+// RebuildIndexes reverts the applied migrations, newest first, then applies
+// them again. Uniqueness isn't enforced while it runs, so it's best done with
+// the API stopped.
+func (m *mongoMigrations) RebuildIndexes(ctx context.Context, applied []Migration) error {
+	for i := len(applied) - 1; i >= 0; i-- {
+		err := m.find(applied[i].Version).Down(ctx, m.db)
+		if err != nil {
+			return fmt.Errorf("revert migration %d: %v", applied[i].Version, err)
+		}
+	}
+
+	for _, migration := range applied {
+		err := m.find(migration.Version).Up(ctx, m.db)
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", migration.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *mongoMigrations) find(version int) mongoMigration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	panic(fmt.Sprintf("unknown migration %d", version))
+}
+
+// migrations are the schema changes in the order they shipped. Append new
+// ones with the next version; never renumber or edit applied ones.
+var migrations = []mongoMigration{
+	{
+		Migration: Migration{Version: 1, Description: "expire idempotency keys"},
+		Up: createIndex("idempotency_keys", mongo.IndexModel{
+			Keys:    bson.D{bson.E{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}),
+		Down: dropIndex("idempotency_keys", "expires_at_1"),
+	},
+	{
+		Migration: Migration{Version: 2, Description: "unique book isbn"},
+		Up: createIndex("books", mongo.IndexModel{
+			Keys: bson.D{bson.E{Key: "isbn", Value: 1}},
+			// ISBNs are optional, so only books that have one are held unique
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"isbn": bson.M{"$type": "string"}}),
+		}),
+		Down: dropIndex("books", "isbn_1"),
+	},
+	{
+		Migration: Migration{Version: 3, Description: "book contributors"},
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := migrateContributors(ctx, db.Collection("books"))
+			if err != nil {
+				return err
+			}
+			return createIndex("books", mongo.IndexModel{
+				Keys: bson.D{bson.E{Key: "contributors.author_id", Value: 1}},
+			})(ctx, db)
+		},
+		// The contributors lists are kept; author_id was never removed
+		Down: dropIndex("books", "contributors.author_id_1"),
+	},
+	{
+		Migration: Migration{Version: 4, Description: "unique author and borrower emails"},
+		Up: all(
+			createIndex("authors", mongo.IndexModel{
+				Keys:    bson.D{bson.E{Key: "email", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}),
+			createIndex("borrowers", mongo.IndexModel{
+				Keys:    bson.D{bson.E{Key: "email", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}),
+		),
+		Down: all(dropIndex("authors", "email_1"), dropIndex("borrowers", "email_1")),
+	},
+	{
+		Migration: Migration{Version: 5, Description: "unique author, borrower and book names"},
+		Up: all(
+			createIndex("authors", mongo.IndexModel{
+				Keys:    bson.D{bson.E{Key: "name", Value: 1}, bson.E{Key: "birthday", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}),
+			createIndex("borrowers", mongo.IndexModel{
+				Keys:    bson.D{bson.E{Key: "name", Value: 1}, bson.E{Key: "birthday", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}),
+			// author_id leads so the index also serves lookups by author
+			createIndex("books", mongo.IndexModel{
+				Keys:    bson.D{bson.E{Key: "author_id", Value: 1}, bson.E{Key: "title", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}),
+		),
+		Down: all(
+			dropIndex("authors", "name_1_birthday_1"),
+			dropIndex("borrowers", "name_1_birthday_1"),
+			dropIndex("books", "author_id_1_title_1"),
+		),
+	},
+	{
+		Migration: Migration{Version: 6, Description: "index borrowed books"},
+		Up: createIndex("borrowers", mongo.IndexModel{
+			Keys: bson.D{bson.E{Key: "books", Value: 1}},
+		}),
+		Down: dropIndex("borrowers", "books_1"),
+	},
+	{
+		Migration: Migration{Version: 7, Description: "validate authors, borrowers and books"},
+		Up: all(
+			setValidator("authors", authorsSchema),
+			setValidator("borrowers", borrowersSchema),
+			setValidator("books", booksSchema),
+		),
+		Down: all(
+			setValidator("authors", bson.M{}),
+			setValidator("borrowers", bson.M{}),
+			setValidator("books", bson.M{}),
+		),
+	},
+	{
+		Migration: Migration{Version: 8, Description: "queue webhook deliveries"},
+		// Each event is delivered to a webhook once, and workers look for
+		// the pending deliveries that are due
+		Up: all(
+			createIndex("webhook_deliveries", mongo.IndexModel{
+				Keys:    bson.D{bson.E{Key: "webhook_id", Value: 1}, bson.E{Key: "event_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}),
+			createIndex("webhook_deliveries", mongo.IndexModel{
+				Keys: bson.D{bson.E{Key: "status", Value: 1}, bson.E{Key: "next_attempt_at", Value: 1}},
+			}),
+		),
+		Down: all(
+			dropIndex("webhook_deliveries", "webhook_id_1_event_id_1"),
+			dropIndex("webhook_deliveries", "status_1_next_attempt_at_1"),
+		),
+	},
+	{
+		Migration: Migration{Version: 9, Description: "index the outbox"},
+		// Relays look for the undispatched events that are due. Creating the
+		// index also creates the collection, which transactions writing to
+		// it can't do on older servers
+		Up: createIndex("outbox", mongo.IndexModel{
+			Keys: bson.D{bson.E{Key: "dispatched_at", Value: 1}, bson.E{Key: "next_attempt_at", Value: 1}},
+		}),
+		Down: dropIndex("outbox", "dispatched_at_1_next_attempt_at_1"),
+	},
+	{
+		Migration: Migration{Version: 10, Description: "log sent notifications"},
+		// Each kind of email about the same thing is sent to a borrower once
+		Up: createIndex("notifications", mongo.IndexModel{
+			Keys: bson.D{
+				bson.E{Key: "borrower_id", Value: 1},
+				bson.E{Key: "kind", Value: 1},
+				bson.E{Key: "key", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		}),
+		Down: dropIndex("notifications", "borrower_id_1_kind_1_key_1"),
+	},
+	{
+		Migration: Migration{Version: 11, Description: "verify existing borrowers"},
+		// Borrowers from before emails were verified keep borrowing. Newer
+		// ones have a verified_at, if only a null one, so running this again
+		// leaves them alone
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("borrowers").UpdateMany(ctx,
+				bson.M{"verified_at": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"verified_at": time.Now().UTC().Truncate(time.Millisecond)}},
+			)
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+	},
+	{
+		Migration: Migration{Version: 12, Description: "rate books and link children to guardians"},
+		// Books from before ratings are for everyone. Guardians look up their
+		// children, and age overrides are listed by borrower; creating that
+		// index creates the collection overrides are written to in
+		// transactions
+		Up: all(
+			func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("books").UpdateMany(ctx,
+					bson.M{"audience": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"audience": AudienceAll}},
+				)
+				return err
+			},
+			createIndex("borrowers", mongo.IndexModel{Keys: bson.D{bson.E{Key: "guardian_id", Value: 1}}}),
+			createIndex("age_overrides", mongo.IndexModel{Keys: bson.D{bson.E{Key: "borrower_id", Value: 1}}}),
+		),
+		Down: all(
+			dropIndex("borrowers", "guardian_id_1"),
+			dropIndex("age_overrides", "borrower_id_1"),
+		),
+	},
+	{
+		Migration: Migration{Version: 13, Description: "normalize author and borrower emails"},
+		// Emails stored before they were normalized on the way in are
+		// normalized too, so they match when looked up and can't be
+		// registered again written differently. The old forms aren't kept
+		Up:   normalizeEmails,
+		Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+	},
+	{
+		Migration: Migration{Version: 14, Description: "track import job progress"},
+		// Jobs from before progress was tracked last moved when they
+		// finished, or when they started if they never did. Running jobs
+		// are swept by when they last moved
+		Up: all(
+			func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("import_jobs").UpdateMany(ctx,
+					bson.M{"updated_at": bson.M{"$exists": false}},
+					mongo.Pipeline{
+						bson.D{bson.E{Key: "$set", Value: bson.M{
+							"updated_at": bson.M{"$ifNull": bson.A{"$finished_at", "$created_at"}},
+						}}},
+					},
+				)
+				return err
+			},
+			createIndex("import_jobs", mongo.IndexModel{Keys: bson.D{
+				bson.E{Key: "status", Value: 1},
+				bson.E{Key: "updated_at", Value: 1},
+			}}),
+		),
+		Down: dropIndex("import_jobs", "status_1_updated_at_1"),
+	},
+}
+
+// normalizeEmails trims and lower-cases stored author and borrower emails,
+// changing none of them if any would collide.
+func normalizeEmails(ctx context.Context, db *mongo.Database) error {
+	normalized := map[string]map[ID]string{}
+	for _, coll := range []string{"authors", "borrowers"} {
+		curs, err := db.Collection(coll).Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"email": 1}))
+		if err != nil {
+			return fmt.Errorf("find %s: %v", coll, err)
+		}
+
+		var stored []StoredEmail
+		err = curs.All(ctx, &stored)
+		if err != nil {
+			return fmt.Errorf("decode %s: %v", coll, err)
+		}
+
+		normalized[coll], err = NormalizeStoredEmails(coll, stored)
+		if err != nil {
+			return err
+		}
+	}
+
+	for coll, emails := range normalized {
+		for id, email := range emails {
+			_, err := db.Collection(coll).UpdateByID(ctx, id, bson.M{"$set": bson.M{"email": email}})
+			if err != nil {
+				return fmt.Errorf("normalize %s email: %v", coll, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	authorsSchema = bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"name", "birthday", "email"},
+		"properties": bson.M{
+			"name":     bson.M{"bsonType": "string", "minLength": 1},
+			"birthday": bson.M{"bsonType": "date"},
+			"email":    bson.M{"bsonType": "string", "minLength": 1},
+			"version":  bson.M{"bsonType": bson.A{"int", "long"}},
+		},
+	}}
+
+	borrowersSchema = bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"name", "birthday", "email"},
+		"properties": bson.M{
+			"name":     bson.M{"bsonType": "string", "minLength": 1},
+			"birthday": bson.M{"bsonType": "date"},
+			"email":    bson.M{"bsonType": "string", "minLength": 1},
+			"books":    bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "objectId"}},
+			"version":  bson.M{"bsonType": bson.A{"int", "long"}},
+		},
+	}}
+
+	booksSchema = bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"title", "author_id"},
+		"properties": bson.M{
+			"title":     bson.M{"bsonType": "string", "minLength": 1},
+			"isbn":      bson.M{"bsonType": "string", "pattern": "^97[89][0-9]{10}$"},
+			"author_id": bson.M{"bsonType": "objectId"},
+			"contributors": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "object",
+					"required": bson.A{"author_id", "role"},
+					"properties": bson.M{
+						"author_id": bson.M{"bsonType": "objectId"},
+						"role":      bson.M{"enum": bson.A{RoleAuthor, RoleEditor, RoleTranslator, RoleIllustrator}},
+					},
+				},
+			},
+			"genres":    bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "string"}},
+			"available": bson.M{"bsonType": "bool"},
+			"version":   bson.M{"bsonType": bson.A{"int", "long"}},
+		},
+	}}
+)
+
+func createIndex(coll string, index mongo.IndexModel) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).Indexes().CreateOne(ctx, index)
+		return err
+	}
+}
+
+func dropIndex(coll, name string) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(coll).Indexes().DropOne(ctx, name)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound") {
+			return nil
+		}
+		return err
+	}
+}
+
+// setValidator validates writes to coll against validator, creating the
+// collection if needed. Documents already stored that don't match are left
+// alone until they are next written.
+func setValidator(coll string, validator bson.M) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		err := db.CreateCollection(ctx, coll, options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel("moderate"))
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Name != "NamespaceExists" {
+			return err
+		}
+
+		return db.RunCommand(ctx, bson.D{
+			bson.E{Key: "collMod", Value: coll},
+			bson.E{Key: "validator", Value: validator},
+			bson.E{Key: "validationLevel", Value: "moderate"},
+		}).Err()
+	}
+}
+
+func all(steps ...func(ctx context.Context, db *mongo.Database) error) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, step := range steps {
+			err := step(ctx, db)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
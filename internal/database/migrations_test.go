@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMigrator(t *testing.T) {
+	client, err := connect()
+	assert.NoError(t, err)
+
+	db := client.Database("curly_migrations_test")
+	err = db.Drop(context.Background())
+	assert.NoError(t, err)
+
+	m := &Migrator{target: newMongoMigrations(db, migrations)}
+	latest := migrations[len(migrations)-1].Version
+
+	t.Run("should list every migration as pending", func(t *testing.T) {
+		statuses, err := m.Status(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, statuses, len(migrations))
+		for _, status := range statuses {
+			assert.Nil(t, status.AppliedAt)
+		}
+	})
+
+	t.Run("should not apply anything on a dry run", func(t *testing.T) {
+		pending, err := m.Up(context.Background(), 0, true)
+		assert.NoError(t, err)
+		assert.Len(t, pending, len(migrations))
+
+		count, err := db.Collection("migrations").CountDocuments(context.Background(), bson.M{})
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("should apply pending migrations in order", func(t *testing.T) {
+		applied, err := m.Up(context.Background(), 2, false)
+		assert.NoError(t, err)
+		assert.Len(t, applied, 2)
+		assert.Equal(t, 1, applied[0].Version)
+
+		applied, err = m.Up(context.Background(), 0, false)
+		assert.NoError(t, err)
+		assert.Len(t, applied, len(migrations)-2)
+
+		applied, err = m.Up(context.Background(), 0, false)
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("should reject duplicate emails", func(t *testing.T) {
+		_, err := db.Collection("authors").InsertOne(context.Background(), bson.M{"name": "Bober", "birthday": time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC), "email": "bober@author.com"})
+		assert.NoError(t, err)
+		_, err = db.Collection("authors").InsertOne(context.Background(), bson.M{"name": "Pingvin", "birthday": time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC), "email": "bober@author.com"})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+	})
+
+	t.Run("should reject books that don't match the schema", func(t *testing.T) {
+		_, err := db.Collection("books").InsertOne(context.Background(), bson.M{"title": "Untitled"})
+		assert.Error(t, err)
+	})
+
+	t.Run("should normalize stored emails", func(t *testing.T) {
+		birthday := time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+		borrowers := db.Collection("borrowers")
+		res, err := borrowers.InsertOne(context.Background(), bson.M{"name": "Bober", "birthday": birthday, "email": " Bober@HotMail.com"})
+		require.NoError(t, err)
+		_, err = borrowers.InsertOne(context.Background(), bson.M{"name": "Skunk", "birthday": birthday, "email": "bober@hotmail.com"})
+		require.NoError(t, err)
+
+		err = normalizeEmails(context.Background(), db)
+		assert.ErrorContains(t, err, `"bober@hotmail.com" (`)
+
+		_, err = borrowers.DeleteOne(context.Background(), bson.M{"name": "Skunk"})
+		require.NoError(t, err)
+		require.NoError(t, normalizeEmails(context.Background(), db))
+
+		var borrower struct {
+			Email string `bson:"email"`
+		}
+		require.NoError(t, borrowers.FindOne(context.Background(), bson.M{"_id": res.InsertedID}).Decode(&borrower))
+		assert.Equal(t, "bober@hotmail.com", borrower.Email)
+	})
+
+	t.Run("should revert the latest migration", func(t *testing.T) {
+		reverted, err := m.Down(context.Background(), 1, true)
+		assert.NoError(t, err)
+		assert.Len(t, reverted, 1)
+		assert.Equal(t, latest, reverted[0].Version)
+
+		reverted, err = m.Down(context.Background(), 1, false)
+		assert.NoError(t, err)
+		assert.Len(t, reverted, 1)
+
+		statuses, err := m.Status(context.Background())
+		assert.NoError(t, err)
+		assert.Nil(t, statuses[len(statuses)-1].AppliedAt)
+		assert.NotNil(t, statuses[0].AppliedAt)
+	})
+
+	t.Run("should revert everything", func(t *testing.T) {
+		_, err := m.Down(context.Background(), 0, false)
+		assert.NoError(t, err)
+
+		count, err := db.Collection("migrations").CountDocuments(context.Background(), bson.M{})
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
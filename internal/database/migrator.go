@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+var migrateOnStartup = os.Getenv("DB_MIGRATE_ON_STARTUP") != "false"
+
+// Migration is one versioned change to a backend's schema, indexes or data.
+type Migration struct {
+	Version     int
+	Description string
+}
+
+// MigrationStatus is a migration along with when it was applied, if it has
+// been.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// MigrationTarget is a backend's side of running migrations: what they are,
+// how to run them and where they are recorded.
+type MigrationTarget interface {
+	// Migrations lists every migration, oldest first.
+	Migrations() []Migration
+	// Applied reports when each applied migration ran, by version.
+	Applied(ctx context.Context) (map[int]time.Time, error)
+	// Apply runs a migration and records it as applied.
+	Apply(ctx context.Context, migration Migration) error
+	// Revert undoes a migration and removes its record.
+	Revert(ctx context.Context, migration Migration) error
+	// RebuildIndexes recreates the indexes made by the applied migrations.
+	RebuildIndexes(ctx context.Context, applied []Migration) error
+}
+
+// Migrator applies a backend's migrations in version order.
+type Migrator struct {
+	target MigrationTarget
+}
+
+// NewMigrator connects to the backend chosen by DB_DRIVER for running
+// migrations outside of the API, such as from the command line.
+func NewMigrator() (*Migrator, error) {
+	driver, err := configuredDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := driver.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{target: target}, nil
+}
+
+// MigrateOnStartup applies target's pending migrations, as backends do when
+// opened, unless DB_MIGRATE_ON_STARTUP is false.
+func MigrateOnStartup(target MigrationTarget) error {
+	if !migrateOnStartup {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	applied, err := (&Migrator{target: target}).Up(ctx, 0, false)
+	for _, migration := range applied {
+		log.Printf("applied migration %d: %s", migration.Version, migration.Description)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate database: %v", err)
+	}
+
+	return nil
+}
+
+// Status lists every known migration, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.target.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range m.target.Migrations() {
+		status := MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies up to steps pending migrations, or all of them when steps is
+// zero, and returns the ones it applied. With dryRun it only returns the
+// ones it would apply.
+func (m *Migrator) Up(ctx context.Context, steps int, dryRun bool) ([]Migration, error) {
+	applied, err := m.target.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, migration := range m.target.Migrations() {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+
+	if dryRun {
+		return pending, nil
+	}
+
+	done := []Migration{}
+	for _, migration := range pending {
+		err := m.target.Apply(ctx, migration)
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Description, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts up to steps applied migrations, newest first, and returns
+// the ones it reverted. With dryRun it only returns the ones it would revert.
+func (m *Migrator) Down(ctx context.Context, steps int, dryRun bool) ([]Migration, error) {
+	reverting, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(reverting)-1; i < j; i, j = i+1, j-1 {
+		reverting[i], reverting[j] = reverting[j], reverting[i]
+	}
+	if steps > 0 && steps < len(reverting) {
+		reverting = reverting[:steps]
+	}
+
+	if dryRun {
+		return reverting, nil
+	}
+
+	done := []Migration{}
+	for _, migration := range reverting {
+		err := m.target.Revert(ctx, migration)
+		if err != nil {
+			return done, fmt.Errorf("revert migration %d (%s): %v", migration.Version, migration.Description, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Rebuild recreates the indexes made by the applied migrations, which are
+// returned. Which migrations are recorded as applied doesn't change. With
+// dryRun it only returns the migrations whose indexes it would rebuild.
+func (m *Migrator) Rebuild(ctx context.Context, dryRun bool) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return applied, nil
+	}
+
+	err = m.target.RebuildIndexes(ctx, applied)
+	if err != nil {
+		return nil, fmt.Errorf("rebuild indexes: %v", err)
+	}
+
+	return applied, nil
+}
+
+// applied lists the applied migrations, oldest first.
+func (m *Migrator) applied(ctx context.Context) ([]Migration, error) {
+	applied, err := m.target.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	for _, migration := range m.target.Migrations() {
+		if _, ok := applied[migration.Version]; ok {
+			migrations = append(migrations, migration)
+		}
+	}
+
+	return migrations, nil
+}
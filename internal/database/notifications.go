@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of email sent to borrowers.
+const (
+	NotificationWelcome   = "welcome"
+	NotificationDueSoon   = "due_soon"
+	NotificationOverdue   = "overdue"
+	NotificationHoldReady = "hold_ready"
+	// NotificationVerifyEmail carries the link borrowers follow to verify
+	// their email address. It's always sent, since they can't borrow
+	// without it.
+	NotificationVerifyEmail = "verify_email"
+)
+
+// NotificationKinds are the kinds of email borrowers can opt out of.
+var NotificationKinds = []string{NotificationWelcome, NotificationDueSoon, NotificationOverdue, NotificationHoldReady}
+
+const (
+	// NotificationSending notifications are reserved and on their way to the
+	// mail server.
+	NotificationSending = "sending"
+	NotificationSent    = "sent"
+	// NotificationFailed notifications are tried again until they run out
+	// of attempts.
+	NotificationFailed = "failed"
+)
+
+// DefaultLocale is the locale of borrowers who haven't chosen one.
+const DefaultLocale = "en"
+
+// NotificationPreferences are what a borrower wants to be emailed about and
+// in which language.
+type NotificationPreferences struct {
+	Locale string `json:"locale" bson:"locale"`
+	// OptOut lists the kinds of email the borrower doesn't want.
+	OptOut []string `json:"opt_out" bson:"opt_out"`
+}
+
+// DefaultNotificationPreferences are the preferences of borrowers who haven't
+// set any: every kind of email, in the default locale.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{Locale: DefaultLocale, OptOut: []string{}}
+}
+
+func (p *NotificationPreferences) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+func (p *NotificationPreferences) Bind(r *http.Request) error {
+	if p.Locale == "" {
+		p.Locale = DefaultLocale
+	}
+	if !localePattern.MatchString(p.Locale) {
+		return fmt.Errorf("locale must be a language code like \"en\" or \"pt-BR\"")
+	}
+
+	if p.OptOut == nil {
+		p.OptOut = []string{}
+	}
+	for _, kind := range p.OptOut {
+		if !slices.Contains(NotificationKinds, kind) {
+			return fmt.Errorf("unknown notification %q", kind)
+		}
+	}
+	slices.Sort(p.OptOut)
+	p.OptOut = slices.Compact(p.OptOut)
+
+	return nil
+}
+
+// Wants reports whether the borrower hasn't opted out of kind.
+func (p NotificationPreferences) Wants(kind string) bool {
+	return !slices.Contains(p.OptOut, kind)
+}
+
+// Notification is an email to a borrower, as recorded in the sent-message
+// log.
+type Notification struct {
+	ID         ID     `json:"id" bson:"_id"`
+	BorrowerID ID     `json:"borrower_id" bson:"borrower_id"`
+	Kind       string `json:"kind" bson:"kind"`
+	// Key is what the email is about, like a loan, so that the borrower
+	// gets each one once however often it's looked for.
+	Key       string     `json:"key" bson:"key"`
+	Locale    string     `json:"locale" bson:"locale"`
+	To        string     `json:"to" bson:"to"`
+	Subject   string     `json:"subject" bson:"subject"`
+	Status    string     `json:"status" bson:"status"`
+	Attempts  int        `json:"attempts" bson:"attempts"`
+	Error     string     `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+}
+
+// NewNotification is a first attempt at sending borrowerID the kind of email
+// about key.
+func NewNotification(borrowerID ID, kind, key string) Notification {
+	return Notification{
+		ID:         NewID(),
+		BorrowerID: borrowerID,
+		Kind:       kind,
+		Key:        key,
+		Status:     NotificationSending,
+		Attempts:   1,
+		CreatedAt:  time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// GetNotificationPreferences returns nil when the borrower hasn't set any.
+func (s *service) GetNotificationPreferences(ctx context.Context, borrowerID ID) (*NotificationPreferences, error) {
+	var prefs NotificationPreferences
+	err := s.notificationPreferencesColl.FindOne(ctx, bson.M{"_id": borrowerID}).Decode(&prefs)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get notification preferences: %v", err)
+	}
+
+	return &prefs, nil
+}
+
+func (s *service) SetNotificationPreferences(ctx context.Context, borrowerID ID, prefs NotificationPreferences) error {
+	_, err := s.notificationPreferencesColl.ReplaceOne(ctx, bson.M{"_id": borrowerID}, prefs, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("set notification preferences: %v", err)
+	}
+
+	return nil
+}
+
+// ReserveNotification records notification as being sent, unless the same
+// kind of email about the same key has been sent or is being sent already.
+// A failed one is taken over when it has had fewer than maxAttempts.
+func (s *service) ReserveNotification(ctx context.Context, notification Notification, maxAttempts int) (bool, error) {
+	_, err := s.notificationsColl.InsertOne(ctx, notification)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, fmt.Errorf("reserve notification: %v", err)
+	}
+
+	filter := bson.M{
+		"borrower_id": notification.BorrowerID,
+		"kind":        notification.Kind,
+		"key":         notification.Key,
+		"status":      NotificationFailed,
+		"attempts":    bson.M{"$lt": maxAttempts},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"locale":  notification.Locale,
+			"to":      notification.To,
+			"subject": notification.Subject,
+			"status":  NotificationSending,
+		},
+		"$unset": bson.M{"error": ""},
+		"$inc":   bson.M{"attempts": 1},
+	}
+	result, err := s.notificationsColl.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("reserve notification: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UpdateNotification saves how sending a reserved notification went: its
+// status, error and when it was sent.
+func (s *service) UpdateNotification(ctx context.Context, notification Notification) error {
+	filter := bson.M{"borrower_id": notification.BorrowerID, "kind": notification.Kind, "key": notification.Key}
+	update := bson.M{
+		"$set": bson.M{
+			"status":  notification.Status,
+			"error":   notification.Error,
+			"sent_at": notification.SentAt,
+		},
+	}
+
+	_, err := s.notificationsColl.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("update notification: %v", err)
+	}
+
+	return nil
+}
+
+// ListNotifications lists the emails sent to a borrower, newest first.
+func (s *service) ListNotifications(ctx context.Context, borrowerID ID) ([]Notification, error) {
+	curs, err := s.notificationsColl.Find(ctx, bson.M{"borrower_id": borrowerID}, options.Find().SetSort(bson.M{"_id": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("find notifications: %v", err)
+	}
+
+	notifications := []Notification{}
+	err = curs.All(ctx, &notifications)
+	if err != nil {
+		return nil, fmt.Errorf("decode notifications: %v", err)
+	}
+
+	return notifications, nil
+}
+
+// deleteNotifications removes a borrower's preferences and sent-message log
+// along with the borrower.
+func (s *service) deleteNotifications(ctx context.Context, borrowerID ID) error {
+	_, err := s.notificationPreferencesColl.DeleteOne(ctx, bson.M{"_id": borrowerID})
+	if err != nil {
+		return fmt.Errorf("delete notification preferences: %v", err)
+	}
+
+	_, err = s.notificationsColl.DeleteMany(ctx, bson.M{"borrower_id": borrowerID})
+	if err != nil {
+		return fmt.Errorf("delete notifications: %v", err)
+	}
+
+	return nil
+}
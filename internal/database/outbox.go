@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it reports, so it's recorded if and only if the change is. A relay
+// dispatches it afterwards, at least once.
+type OutboxEvent struct {
+	// ID stays the same across dispatches, so whoever receives the event can
+	// tell when it's been dispatched again.
+	ID        ID              `json:"id" bson:"_id"`
+	Type      string          `json:"type" bson:"type"`
+	Payload   json.RawMessage `json:"payload" bson:"payload"`
+	CreatedAt time.Time       `json:"created_at" bson:"created_at"`
+
+	// Attempts counts failed dispatches; the next is due at NextAttemptAt.
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	DispatchedAt  *time.Time `json:"dispatched_at,omitempty" bson:"dispatched_at,omitempty"`
+}
+
+// BookCreatedData is the payload of book.created events.
+type BookCreatedData struct {
+	Book Book `json:"book"`
+}
+
+// LoanData is the payload of book.borrowed and book.returned events.
+// BorrowerID is empty when a book marked unavailable is returned without
+// anyone having borrowed it.
+type LoanData struct {
+	Loan
+	BorrowerID ID `json:"borrower_id,omitempty"`
+}
+
+// BorrowerCreatedData is the payload of borrower.created events.
+type BorrowerCreatedData struct {
+	Borrower Borrower `json:"borrower"`
+}
+
+// NewOutboxEvent is an event of eventType with data as its payload, due for
+// dispatch at once.
+func NewOutboxEvent(eventType string, data any) (OutboxEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("encode %s event: %v", eventType, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return OutboxEvent{
+		ID:            NewID(),
+		Type:          eventType,
+		Payload:       payload,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// inTx runs fn in a transaction, which needs a replica set. Standalone
+// servers, only used with DB_ALLOW_STANDALONE, run fn as it is, so changes
+// and the outbox events reporting them can be split by a crash.
+//
+// Transactions that fail on a transient error, such as a write conflict with
+// a concurrent one, are retried, which relies on fn wrapping driver errors
+// with %w so their labels still show.
+func (s *service) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactions {
+		return fn(ctx)
+	}
+
+	session, err := s.db.StartSession()
+	if err != nil {
+		return fmt.Errorf("start session: %v", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// supportsTransactions reports whether client is connected to a replica set
+// or a sharded cluster.
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.M{"hello": 1}).Decode(&hello)
+	if err != nil {
+		return false
+	}
+
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
+
+// writeOutbox records an event of eventType with data; ctx should carry the
+// transaction of the change it reports.
+func (s *service) writeOutbox(ctx context.Context, eventType string, data any) error {
+	event, err := NewOutboxEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.outboxColl.InsertOne(ctx, event)
+	if err != nil {
+		return fmt.Errorf("write %s event: %w", eventType, err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents returns up to limit undispatched events due by asOf,
+// oldest first, and puts their next attempt off by lease so no other relay
+// takes them meanwhile.
+func (s *service) ClaimOutboxEvents(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	filter := bson.M{"dispatched_at": nil, "next_attempt_at": bson.M{"$lte": asOf}}
+	update := bson.M{"$set": bson.M{"next_attempt_at": asOf.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{bson.E{Key: "next_attempt_at", Value: 1}, bson.E{Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	events := []OutboxEvent{}
+	for len(events) < limit {
+		var event OutboxEvent
+		err := s.outboxColl.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("claim outbox event: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// UpdateOutboxEvent saves the outcome of a dispatch: attempts, next attempt,
+// last error and when it was dispatched.
+func (s *service) UpdateOutboxEvent(ctx context.Context, event OutboxEvent) error {
+	update := bson.M{
+		"$set": bson.M{
+			"attempts":        event.Attempts,
+			"next_attempt_at": event.NextAttemptAt,
+			"last_error":      event.LastError,
+			"dispatched_at":   event.DispatchedAt,
+		},
+	}
+
+	_, err := s.outboxColl.UpdateByID(ctx, event.ID, update)
+	if err != nil {
+		return fmt.Errorf("update outbox event: %v", err)
+	}
+
+	return nil
+}
+
+// PruneOutbox deletes events dispatched before before and returns how many
+// it deleted.
+func (s *service) PruneOutbox(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.outboxColl.DeleteMany(ctx, bson.M{"dispatched_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %v", err)
+	}
+
+	return int(result.DeletedCount), nil
+}
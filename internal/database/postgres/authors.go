@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const authorColumns = "id, name, birthday, email, version"
+
+func (s *service) CreateAuthor(ctx context.Context, author database.AuthorRequest) (*database.ID, error) {
+	id := database.NewID()
+
+	_, err := s.pool.Exec(ctx,
+		"INSERT INTO authors (id, name, birthday, email, version) VALUES ($1, $2, $3, $4, 1)",
+		id, author.Name, author.Birthday, author.Email,
+	)
+	if conflict := asConflict("author", err); conflict != nil {
+		return nil, conflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create author: %v", err)
+	}
+
+	return &id, nil
+}
+
+func (s *service) GetAuthor(ctx context.Context, authorID database.ID) (*database.Author, error) {
+	author, err := s.getAuthorBy(ctx, "id", authorID)
+	if err != nil {
+		return nil, fmt.Errorf("get author: %v", err)
+	}
+
+	return author, nil
+}
+
+// UpdateAuthor replaces an author's details if the author is still at
+// version. It returns nil when the author doesn't exist and
+// database.ErrVersionMismatch when it has changed since.
+func (s *service) UpdateAuthor(ctx context.Context, authorID database.ID, author database.AuthorRequest, version int64) (*database.Author, error) {
+	var updated *database.Author
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		exists, err := checkVersion(ctx, tx, "authors", authorID, version)
+		if err != nil || !exists {
+			return err
+		}
+
+		updated, err = scanAuthor(tx.QueryRow(ctx,
+			"UPDATE authors SET name = $2, birthday = $3, email = $4, version = version + 1 WHERE id = $1 RETURNING "+authorColumns,
+			authorID, author.Name, author.Birthday, author.Email,
+		))
+		return err
+	})
+	if conflict := asConflict("author", err); conflict != nil {
+		return nil, conflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update author: %w", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteAuthor removes an author credited on no books if the author is still
+// at version. It reports false when the author doesn't exist.
+func (s *service) DeleteAuthor(ctx context.Context, authorID database.ID, version int64) (bool, error) {
+	var deleted bool
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		exists, err := checkVersion(ctx, tx, "authors", authorID, version)
+		if err != nil || !exists {
+			return err
+		}
+
+		var credited bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM books WHERE author_id = $1)
+				OR EXISTS (SELECT 1 FROM book_contributors WHERE author_id = $1)`,
+			authorID,
+		).Scan(&credited)
+		if err != nil {
+			return fmt.Errorf("count author books: %v", err)
+		}
+		if credited {
+			return database.ErrAuthorHasBooks
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM authors WHERE id = $1", authorID)
+		deleted = err == nil
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrVersionMismatch) {
+			return false, fmt.Errorf("delete author: %w", err)
+		}
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// FindAuthorByEmail returns the author registered with email, or nil if
+// there is none.
+func (s *service) FindAuthorByEmail(ctx context.Context, email string) (*database.Author, error) {
+	author, err := s.getAuthorBy(ctx, "email", email)
+	if err != nil {
+		return nil, fmt.Errorf("find author by email: %v", err)
+	}
+
+	return author, nil
+}
+
+// FindAuthorByName returns the first author with exactly this name, or nil
+// if there is none.
+func (s *service) FindAuthorByName(ctx context.Context, name string) (*database.Author, error) {
+	author, err := s.getAuthorBy(ctx, "name", name)
+	if err != nil {
+		return nil, fmt.Errorf("find author by name: %v", err)
+	}
+
+	return author, nil
+}
+
+// getAuthorBy reads the first author whose column equals value, or nil if
+// there is none.
+func (s *service) getAuthorBy(ctx context.Context, column string, value any) (*database.Author, error) {
+	author, err := scanAuthor(s.pool.QueryRow(ctx,
+		"SELECT "+authorColumns+" FROM authors WHERE "+column+" = $1 ORDER BY id LIMIT 1",
+		value,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return author, err
+}
+
+// authorsByID reads the authors with ids, keyed by id.
+func authorsByID(ctx context.Context, q querier, ids []database.ID) (map[database.ID]*database.Author, error) {
+	authors := map[database.ID]*database.Author{}
+	if len(ids) == 0 {
+		return authors, nil
+	}
+
+	rows, err := q.Query(ctx, "SELECT "+authorColumns+" FROM authors WHERE id = ANY($1)", idStrings(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		author, err := scanAuthor(rows)
+		if err != nil {
+			return nil, err
+		}
+		authors[author.ID] = author
+	}
+
+	return authors, rows.Err()
+}
+
+func scanAuthor(row pgx.Row) (*database.Author, error) {
+	var author database.Author
+	err := row.Scan(&author.ID, &author.Name, &author.Birthday, &author.Email, &author.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	author.Birthday = author.Birthday.UTC()
+	return &author, nil
+}
@@ -0,0 +1,449 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const bookColumns = `id, title, isbn, description, author_id, genres, audience, available, version,
+	cover_id, cover_content_type, cover_thumbnail_id, cover_thumbnail_content_type, cover_uploaded_at`
+
+func (s *service) ListBooks(ctx context.Context, expand database.Expand) ([]database.Book, error) {
+	books, err := s.findBooks(ctx, "true", nil, expand)
+	if err != nil {
+		return nil, fmt.Errorf("find books: %v", err)
+	}
+
+	return books, nil
+}
+
+func (s *service) AddBook(ctx context.Context, book database.BookRequest) (*database.ID, error) {
+	authorID, contributors, err := book.Credits()
+	if err != nil {
+		return nil, err
+	}
+
+	id := database.NewID()
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		err := checkContributors(ctx, tx, contributors)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO books (id, title, isbn, description, author_id, genres, audience, available, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1)`,
+			id, book.Title, nullable(book.ISBN), book.Description, authorID, genres(book.Genres), book.RatedAudience(), book.Available,
+		)
+		if conflict := asConflict("book", err); conflict != nil {
+			return conflict
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create new book: %v", err)
+		}
+
+		err = setContributors(ctx, tx, id, contributors)
+		if err != nil {
+			return err
+		}
+
+		return writeOutbox(ctx, tx, database.BookCreated, database.BookCreatedData{Book: database.Book{
+			ID:           id,
+			Title:        book.Title,
+			ISBN:         book.ISBN,
+			Description:  book.Description,
+			AuthorID:     authorID,
+			Contributors: contributors,
+			Genres:       book.Genres,
+			Audience:     book.RatedAudience(),
+			Available:    book.Available,
+			Version:      1,
+		}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+func (s *service) GetBook(ctx context.Context, bookID database.ID) (*database.Book, error) {
+	book, err := s.GetBookExpanded(ctx, bookID, database.Expand{})
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// GetBookExpanded is GetBook with the related documents in expand embedded.
+func (s *service) GetBookExpanded(ctx context.Context, bookID database.ID, expand database.Expand) (*database.Book, error) {
+	books, err := s.findBooks(ctx, "id = $1", []any{bookID}, expand)
+	if err != nil {
+		return nil, fmt.Errorf("get book: %v", err)
+	}
+
+	if len(books) == 0 {
+		return nil, nil
+	}
+
+	return &books[0], nil
+}
+
+// GetBookByISBN returns the book with a normalized ISBN-13, or nil if there
+// is none.
+func (s *service) GetBookByISBN(ctx context.Context, isbn string) (*database.Book, error) {
+	books, err := s.findBooks(ctx, "isbn = $1", []any{isbn}, database.Expand{})
+	if err != nil {
+		return nil, fmt.Errorf("get book by isbn: %v", err)
+	}
+
+	if len(books) == 0 {
+		return nil, nil
+	}
+
+	return &books[0], nil
+}
+
+// BooksByContributor lists the books crediting an author, in any role when
+// role is empty.
+func (s *service) BooksByContributor(ctx context.Context, authorID database.ID, role string) ([]database.Book, error) {
+	where := "id IN (SELECT book_id FROM book_contributors WHERE author_id = $1)"
+	args := []any{authorID}
+	if role != "" {
+		where = "id IN (SELECT book_id FROM book_contributors WHERE author_id = $1 AND role = $2)"
+		args = append(args, role)
+	}
+
+	books, err := s.findBooks(ctx, where, args, database.Expand{})
+	if err != nil {
+		return nil, fmt.Errorf("find books by contributor: %v", err)
+	}
+
+	return books, nil
+}
+
+// UpdateBook replaces the catalog fields of a book if it is still at version.
+// Availability is left alone since it's owned by borrowing. It returns nil when
+// the book doesn't exist and database.ErrVersionMismatch when it has changed
+// since.
+func (s *service) UpdateBook(ctx context.Context, bookID database.ID, book database.BookRequest, version int64) (*database.Book, error) {
+	authorID, contributors, err := book.Credits()
+	if err != nil {
+		return nil, err
+	}
+
+	var updated bool
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		err := checkContributors(ctx, tx, contributors)
+		if err != nil {
+			return err
+		}
+
+		exists, err := checkVersion(ctx, tx, "books", bookID, version)
+		if err != nil {
+			return fmt.Errorf("update book: %w", err)
+		}
+		if !exists {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE books
+			SET title = $2, isbn = $3, description = $4, author_id = $5, genres = $6, audience = $7, version = version + 1
+			WHERE id = $1`,
+			bookID, book.Title, nullable(book.ISBN), book.Description, authorID, genres(book.Genres), book.RatedAudience(),
+		)
+		if conflict := asConflict("book", err); conflict != nil {
+			return conflict
+		}
+		if err != nil {
+			return fmt.Errorf("update book: %v", err)
+		}
+
+		updated = true
+		return setContributors(ctx, tx, bookID, contributors)
+	})
+	if err != nil || !updated {
+		return nil, err
+	}
+
+	return s.GetBook(ctx, bookID)
+}
+
+// DeleteBook removes a book if it is still at version and not on loan. It
+// reports false when the book doesn't exist. Its cover files go with it.
+func (s *service) DeleteBook(ctx context.Context, bookID database.ID, version int64) (bool, error) {
+	var deleted bool
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		var available bool
+		err := tx.QueryRow(ctx, "SELECT available FROM books WHERE id = $1 FOR UPDATE", bookID).Scan(&available)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("get book: %v", err)
+		}
+
+		if !available {
+			return database.ErrBookBorrowed
+		}
+
+		_, err = checkVersion(ctx, tx, "books", bookID, version)
+		if err != nil {
+			return fmt.Errorf("delete book: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM books WHERE id = $1", bookID)
+		if err != nil {
+			return fmt.Errorf("delete book: %v", err)
+		}
+
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// findBooks reads the books matching where, a condition on the books table
+// using args, along with their contributors and whatever expand embeds.
+func (s *service) findBooks(ctx context.Context, where string, args []any, expand database.Expand) ([]database.Book, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+bookColumns+" FROM books WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []database.Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, *book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.loadContributors(ctx, books)
+	if err != nil {
+		return nil, err
+	}
+
+	if expand.Author {
+		err = s.expandAuthors(ctx, books)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if expand.Borrower {
+		err = s.expandBorrowers(ctx, books)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return books, nil
+}
+
+func (s *service) loadContributors(ctx context.Context, books []database.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	index := make(map[database.ID]int, len(books))
+	ids := make([]database.ID, 0, len(books))
+	for i := range books {
+		index[books[i].ID] = i
+		ids = append(ids, books[i].ID)
+	}
+
+	rows, err := s.pool.Query(ctx,
+		"SELECT book_id, author_id, role FROM book_contributors WHERE book_id = ANY($1) ORDER BY book_id, position",
+		idStrings(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID database.ID
+		var contributor database.Contributor
+		err := rows.Scan(&bookID, &contributor.AuthorID, &contributor.Role)
+		if err != nil {
+			return err
+		}
+		book := &books[index[bookID]]
+		book.Contributors = append(book.Contributors, contributor)
+	}
+
+	return rows.Err()
+}
+
+// expandAuthors embeds the primary author and each contributor's author.
+func (s *service) expandAuthors(ctx context.Context, books []database.Book) error {
+	ids := []database.ID{}
+	for _, book := range books {
+		ids = append(ids, book.AuthorID)
+		for _, contributor := range book.Contributors {
+			ids = append(ids, contributor.AuthorID)
+		}
+	}
+
+	authors, err := authorsByID(ctx, s.pool, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range books {
+		books[i].Author = authors[books[i].AuthorID]
+		for j := range books[i].Contributors {
+			books[i].Contributors[j].Author = authors[books[i].Contributors[j].AuthorID]
+		}
+	}
+
+	return nil
+}
+
+// expandBorrowers embeds the borrower of books that are on loan.
+func (s *service) expandBorrowers(ctx context.Context, books []database.Book) error {
+	ids := make([]database.ID, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT book_id, borrower_id FROM loans WHERE book_id = ANY($1)", idStrings(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	borrowerOf := map[database.ID]database.ID{}
+	borrowerIDs := []database.ID{}
+	for rows.Next() {
+		var bookID, borrowerID database.ID
+		err := rows.Scan(&bookID, &borrowerID)
+		if err != nil {
+			return err
+		}
+		borrowerOf[bookID] = borrowerID
+		borrowerIDs = append(borrowerIDs, borrowerID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	borrowers, err := borrowersByID(ctx, s.pool, borrowerIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range books {
+		if borrowerID, ok := borrowerOf[books[i].ID]; ok {
+			books[i].Borrower = borrowers[borrowerID]
+		}
+	}
+
+	return nil
+}
+
+// checkContributors reports the first contributor whose author doesn't exist.
+func checkContributors(ctx context.Context, q querier, contributors []database.Contributor) error {
+	ids := []database.ID{}
+	for _, contributor := range contributors {
+		ids = append(ids, contributor.AuthorID)
+	}
+
+	authors, err := authorsByID(ctx, q, ids)
+	if err != nil {
+		return fmt.Errorf("get authors: %v", err)
+	}
+
+	for _, id := range ids {
+		if authors[id] == nil {
+			return &database.MissingAuthorError{AuthorID: id}
+		}
+	}
+
+	return nil
+}
+
+// setContributors replaces the credits of a book, keeping their order.
+func setContributors(ctx context.Context, tx pgx.Tx, bookID database.ID, contributors []database.Contributor) error {
+	_, err := tx.Exec(ctx, "DELETE FROM book_contributors WHERE book_id = $1", bookID)
+	if err != nil {
+		return fmt.Errorf("clear contributors: %v", err)
+	}
+
+	for i, contributor := range contributors {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO book_contributors (book_id, position, author_id, role) VALUES ($1, $2, $3, $4)",
+			bookID, i, contributor.AuthorID, contributor.Role,
+		)
+		if err != nil {
+			return fmt.Errorf("add contributor: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func scanBook(row pgx.Row) (*database.Book, error) {
+	var book database.Book
+	var isbn, coverID, coverType, thumbnailID, thumbnailType *string
+	var coverUploadedAt *time.Time
+
+	err := row.Scan(
+		&book.ID, &book.Title, &isbn, &book.Description, &book.AuthorID, &book.Genres, &book.Audience, &book.Available, &book.Version,
+		&coverID, &coverType, &thumbnailID, &thumbnailType, &coverUploadedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if isbn != nil {
+		book.ISBN = *isbn
+	}
+	if coverID != nil {
+		book.Cover = &database.Cover{
+			ID:                   database.ID(*coverID),
+			ContentType:          *coverType,
+			ThumbnailID:          database.ID(*thumbnailID),
+			ThumbnailContentType: *thumbnailType,
+			UploadedAt:           coverUploadedAt.UTC(),
+		}
+	}
+	book.Contributors = []database.Contributor{}
+
+	return &book, nil
+}
+
+// nullable stores empty strings as NULL, for columns like isbn where unset
+// values mustn't collide in a unique constraint.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// genres stores a missing list of genres as an empty one.
+func genres(genres []string) []string {
+	if genres == nil {
+		return []string{}
+	}
+	return genres
+}
@@ -0,0 +1,325 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const borrowerColumns = `id, name, birthday, email, verified_at,
+	(SELECT guardian_id FROM guardians WHERE borrower_id = borrowers.id), version`
+
+func (s *service) CreateBorrower(ctx context.Context, borrower database.BorrowerRequest) (*database.ID, error) {
+	id := database.NewID()
+
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO borrowers (id, name, birthday, email, version) VALUES ($1, $2, $3, $4, 1)",
+			id, borrower.Name, borrower.Birthday, borrower.Email,
+		)
+		if conflict := asConflict("borrower", err); conflict != nil {
+			return conflict
+		}
+		if err != nil {
+			return fmt.Errorf("create borrower: %v", err)
+		}
+
+		err = setGuardian(ctx, tx, id, borrower)
+		if err != nil {
+			return err
+		}
+
+		return writeOutbox(ctx, tx, database.BorrowerCreated, database.BorrowerCreatedData{Borrower: database.Borrower{
+			ID:         id,
+			Name:       borrower.Name,
+			Birthday:   borrower.Birthday.UTC(),
+			Email:      borrower.Email,
+			GuardianID: borrower.GuardianID,
+			Books:      []database.ID{},
+			Loans:      []database.Loan{},
+			Version:    1,
+		}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+func (s *service) GetBorrower(ctx context.Context, borrowerID database.ID) (*database.Borrower, error) {
+	borrowers, err := borrowersByID(ctx, s.pool, []database.ID{borrowerID})
+	if err != nil {
+		return nil, fmt.Errorf("get borrower: %v", err)
+	}
+
+	return borrowers[borrowerID], nil
+}
+
+func (s *service) BorrowedBooks(ctx context.Context, borrowerID database.ID, expand database.Expand) ([]database.Book, error) {
+	borrower, err := s.GetBorrower(ctx, borrowerID)
+	if err != nil {
+		return nil, fmt.Errorf("get borrower: %v", err)
+	}
+	if borrower == nil {
+		return nil, fmt.Errorf("borrower doesn't exist")
+	}
+
+	books, err := s.findBooks(ctx, "id IN (SELECT book_id FROM loans WHERE borrower_id = $1)", []any{borrowerID}, expand)
+	if err != nil {
+		return nil, fmt.Errorf("find books: %v", err)
+	}
+
+	return books, nil
+}
+
+// UpdateBorrower replaces a borrower's details if the borrower is still at
+// version. It returns nil when the borrower doesn't exist and
+// database.ErrVersionMismatch when it has changed since.
+func (s *service) UpdateBorrower(ctx context.Context, borrowerID database.ID, borrower database.BorrowerRequest, version int64) (*database.Borrower, error) {
+	var updated bool
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		exists, err := checkVersion(ctx, tx, "borrowers", borrowerID, version)
+		if err != nil || !exists {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			// A new email has to be verified again
+			`UPDATE borrowers
+			SET name = $2, birthday = $3, email = $4,
+				verified_at = CASE WHEN email = $4 THEN verified_at END, version = version + 1
+			WHERE id = $1`,
+			borrowerID, borrower.Name, borrower.Birthday, borrower.Email,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = setGuardian(ctx, tx, borrowerID, borrower)
+		updated = err == nil
+		return err
+	})
+	if conflict := asConflict("borrower", err); conflict != nil {
+		return nil, conflict
+	}
+	var guardianErr *database.GuardianError
+	if errors.As(err, &guardianErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update borrower: %w", err)
+	}
+	if !updated {
+		return nil, nil
+	}
+
+	return s.GetBorrower(ctx, borrowerID)
+}
+
+// VerifyBorrower marks a borrower verified if their email is still email,
+// and returns them. It returns nil when there's no such borrower or their
+// email has changed.
+func (s *service) VerifyBorrower(ctx context.Context, borrowerID database.ID, email string) (*database.Borrower, error) {
+	_, err := s.pool.Exec(ctx,
+		"UPDATE borrowers SET verified_at = $1, version = version + 1 WHERE id = $2 AND email = $3 AND verified_at IS NULL",
+		time.Now().UTC().Truncate(time.Millisecond), borrowerID, email,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("verify borrower: %v", err)
+	}
+
+	borrower, err := s.GetBorrower(ctx, borrowerID)
+	if err != nil || borrower == nil || borrower.Email != email {
+		return nil, err
+	}
+
+	return borrower, nil
+}
+
+// DeleteBorrower removes a borrower with no borrowed books if the borrower is
+// still at version. It reports false when the borrower doesn't exist.
+func (s *service) DeleteBorrower(ctx context.Context, borrowerID database.ID, version int64) (bool, error) {
+	var deleted bool
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		exists, err := checkVersion(ctx, tx, "borrowers", borrowerID, version)
+		if err != nil || !exists {
+			return err
+		}
+
+		var borrowing bool
+		err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM loans WHERE borrower_id = $1)", borrowerID).Scan(&borrowing)
+		if err != nil {
+			return fmt.Errorf("get borrower loans: %v", err)
+		}
+		if borrowing {
+			return database.ErrBorrowerHasBooks
+		}
+
+		var guardian bool
+		err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM guardians WHERE guardian_id = $1)", borrowerID).Scan(&guardian)
+		if err != nil {
+			return fmt.Errorf("get borrower children: %v", err)
+		}
+		if guardian {
+			return database.ErrGuardianOfOthers
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM borrowers WHERE id = $1", borrowerID)
+		deleted = err == nil
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrVersionMismatch) || errors.Is(err, database.ErrGuardianOfOthers) {
+			return false, fmt.Errorf("delete borrower: %w", err)
+		}
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// ListChildren lists the borrowers whose guardian is guardianID, oldest
+// first.
+func (s *service) ListChildren(ctx context.Context, guardianID database.ID) ([]database.Borrower, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT borrowers.id FROM guardians JOIN borrowers ON borrowers.id = guardians.borrower_id
+		WHERE guardians.guardian_id = $1 ORDER BY borrowers.birthday, borrowers.id`,
+		guardianID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find children: %v", err)
+	}
+
+	defer rows.Close()
+
+	ids := []database.ID{}
+	for rows.Next() {
+		var id database.ID
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("decode children: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find children: %v", err)
+	}
+
+	borrowers, err := borrowersByID(ctx, s.pool, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get children: %v", err)
+	}
+
+	children := make([]database.Borrower, 0, len(ids))
+	for _, id := range ids {
+		children = append(children, *borrowers[id])
+	}
+
+	return children, nil
+}
+
+// setGuardian checks the guardian borrower names, if any, and links the
+// borrower with borrowerID to them in place of any guardian they had.
+func setGuardian(ctx context.Context, tx pgx.Tx, borrowerID database.ID, borrower database.BorrowerRequest) error {
+	_, err := tx.Exec(ctx, "DELETE FROM guardians WHERE borrower_id = $1", borrowerID)
+	if err != nil {
+		return fmt.Errorf("unlink guardian: %v", err)
+	}
+	if borrower.GuardianID == nil {
+		return nil
+	}
+
+	// The guardian is locked so they can't become someone's child meanwhile
+	_, err = tx.Exec(ctx, "SELECT 1 FROM borrowers WHERE id = $1 FOR UPDATE", *borrower.GuardianID)
+	if err != nil {
+		return fmt.Errorf("lock guardian: %v", err)
+	}
+
+	guardians, err := borrowersByID(ctx, tx, []database.ID{*borrower.GuardianID})
+	if err != nil {
+		return fmt.Errorf("get guardian: %v", err)
+	}
+
+	var hasChildren bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM guardians WHERE guardian_id = $1)", borrowerID).Scan(&hasChildren)
+	if err != nil {
+		return fmt.Errorf("get borrower children: %v", err)
+	}
+
+	err = database.CheckGuardian(borrowerID, guardians[*borrower.GuardianID], hasChildren, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO guardians (borrower_id, guardian_id) VALUES ($1, $2)", borrowerID, *borrower.GuardianID)
+	if err != nil {
+		return fmt.Errorf("link guardian: %v", err)
+	}
+
+	return nil
+}
+
+// borrowersByID reads the borrowers with ids along with their loans, keyed
+// by id.
+func borrowersByID(ctx context.Context, q querier, ids []database.ID) (map[database.ID]*database.Borrower, error) {
+	borrowers := map[database.ID]*database.Borrower{}
+	if len(ids) == 0 {
+		return borrowers, nil
+	}
+
+	rows, err := q.Query(ctx, "SELECT "+borrowerColumns+" FROM borrowers WHERE id = ANY($1)", idStrings(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var borrower database.Borrower
+		err := rows.Scan(&borrower.ID, &borrower.Name, &borrower.Birthday, &borrower.Email, &borrower.VerifiedAt, &borrower.GuardianID, &borrower.Version)
+		if err != nil {
+			return nil, err
+		}
+		borrower.Birthday = borrower.Birthday.UTC()
+		if borrower.VerifiedAt != nil {
+			verifiedAt := borrower.VerifiedAt.UTC()
+			borrower.VerifiedAt = &verifiedAt
+		}
+		borrower.Books = []database.ID{}
+		borrower.Loans = []database.Loan{}
+		borrowers[borrower.ID] = &borrower
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(ctx,
+		"SELECT borrower_id, book_id, borrowed_at, due_at FROM loans WHERE borrower_id = ANY($1) ORDER BY borrowed_at, book_id",
+		idStrings(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var borrowerID database.ID
+		var loan database.Loan
+		err := rows.Scan(&borrowerID, &loan.BookID, &loan.BorrowedAt, &loan.DueAt)
+		if err != nil {
+			return nil, err
+		}
+		loan.BorrowedAt, loan.DueAt = loan.BorrowedAt.UTC(), loan.DueAt.UTC()
+
+		borrower := borrowers[borrowerID]
+		borrower.Books = append(borrower.Books, loan.BookID)
+		borrower.Loans = append(borrower.Loans, loan)
+	}
+
+	return borrowers, rows.Err()
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateImportJob starts tracking an import of total rows.
+func (s *service) CreateImportJob(ctx context.Context, kind string, total int) (*database.ID, error) {
+	id := database.NewID()
+
+	_, err := s.pool.Exec(ctx,
+		"INSERT INTO import_jobs (id, kind, status, total, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $5)",
+		id, kind, database.ImportJobRunning, total, time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create import job: %v", err)
+	}
+
+	return &id, nil
+}
+
+// RecordImportRow appends the outcome of one row to the job.
+func (s *service) RecordImportRow(ctx context.Context, jobID database.ID, result database.ImportRowResult) error {
+	counter := "succeeded"
+	if result.Status != database.ImportRowCreated {
+		counter = "failed"
+	}
+
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		updated, err := tx.Exec(ctx,
+			"UPDATE import_jobs SET "+counter+" = "+counter+" + 1, updated_at = $2 WHERE id = $1 AND status = $3",
+			jobID, time.Now().UTC(), database.ImportJobRunning,
+		)
+		if err != nil {
+			return err
+		}
+		if updated.RowsAffected() == 0 {
+			return database.ErrImportJobNotRunning
+		}
+
+		_, err = tx.Exec(ctx,
+			"INSERT INTO import_rows (job_id, row_number, status, book_id, error) VALUES ($1, $2, $3, $4, $5)",
+			jobID, result.Row, result.Status, result.BookID, result.Error,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("record import row: %w", err)
+	}
+
+	return nil
+}
+
+// FinishImportJob marks the job done. A non-empty jobErr means the import
+// stopped early.
+func (s *service) FinishImportJob(ctx context.Context, jobID database.ID, jobErr string) error {
+	status := database.ImportJobCompleted
+	if jobErr != "" {
+		status = database.ImportJobFailed
+	}
+
+	updated, err := s.pool.Exec(ctx,
+		"UPDATE import_jobs SET status = $2, error = $3, updated_at = $4, finished_at = $4 WHERE id = $1 AND status = $5",
+		jobID, status, jobErr, time.Now().UTC(), database.ImportJobRunning,
+	)
+	if err != nil {
+		return fmt.Errorf("finish import job: %v", err)
+	}
+	if updated.RowsAffected() == 0 {
+		return fmt.Errorf("finish import job: %w", database.ErrImportJobNotRunning)
+	}
+
+	return nil
+}
+
+// InterruptImportJobs marks running jobs that haven't recorded a row since
+// idleSince as interrupted.
+func (s *service) InterruptImportJobs(ctx context.Context, idleSince time.Time) (int, error) {
+	now := time.Now().UTC()
+	tag, err := s.pool.Exec(ctx,
+		"UPDATE import_jobs SET status = $1, error = $2, updated_at = $3, finished_at = $3 WHERE status = $4 AND updated_at < $5",
+		database.ImportJobInterrupted, database.ImportInterruptedError, now, database.ImportJobRunning, idleSince,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("interrupt import jobs: %v", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *service) GetImportJob(ctx context.Context, jobID database.ID) (*database.ImportJob, error) {
+	var job database.ImportJob
+	err := s.pool.QueryRow(ctx,
+		"SELECT id, kind, status, total, succeeded, failed, error, created_at, updated_at, finished_at FROM import_jobs WHERE id = $1",
+		jobID,
+	).Scan(&job.ID, &job.Kind, &job.Status, &job.Total, &job.Succeeded, &job.Failed, &job.Error, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get import job: %v", err)
+	}
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.UpdatedAt = job.UpdatedAt.UTC()
+	if job.FinishedAt != nil {
+		finishedAt := job.FinishedAt.UTC()
+		job.FinishedAt = &finishedAt
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT row_number, status, book_id, error FROM import_rows WHERE job_id = $1 ORDER BY id", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("get import job rows: %v", err)
+	}
+	defer rows.Close()
+
+	job.Rows = []database.ImportRowResult{}
+	for rows.Next() {
+		var row database.ImportRowResult
+		err := rows.Scan(&row.Row, &row.Status, &row.BookID, &row.Error)
+		if err != nil {
+			return nil, fmt.Errorf("get import job rows: %v", err)
+		}
+		job.Rows = append(job.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get import job rows: %v", err)
+	}
+
+	return &job, nil
+}
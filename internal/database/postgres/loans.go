@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BorrowBook lends a book in one transaction, locking the book and the
+// borrower so concurrent borrows of the same book can't both succeed.
+func (s *service) BorrowBook(ctx context.Context, bookID database.ID, borrowerID database.ID) error {
+	return s.borrowBook(ctx, bookID, borrowerID, nil)
+}
+
+// BorrowBookWithOverride is BorrowBook for borrowers who may be too young for
+// the book, on a librarian's say-so. The override is recorded when needed.
+func (s *service) BorrowBookWithOverride(ctx context.Context, bookID database.ID, borrowerID database.ID, override database.Override) error {
+	return s.borrowBook(ctx, bookID, borrowerID, &override)
+}
+
+func (s *service) borrowBook(ctx context.Context, bookID database.ID, borrowerID database.ID, override *database.Override) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		book := database.Book{ID: bookID}
+		err := tx.QueryRow(ctx, "SELECT available, audience FROM books WHERE id = $1 FOR UPDATE", bookID).Scan(&book.Available, &book.Audience)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("book doesn't exist")
+			}
+			return fmt.Errorf("get book: %v", err)
+		}
+
+		borrower := database.Borrower{ID: borrowerID}
+		var verified bool
+		err = tx.QueryRow(ctx,
+			"UPDATE borrowers SET version = version + 1 WHERE id = $1 RETURNING name, birthday, verified_at IS NOT NULL", borrowerID,
+		).Scan(&borrower.Name, &borrower.Birthday, &verified)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("borrower doesn't exist")
+			}
+			return fmt.Errorf("get borrower %v", err)
+		}
+		if !verified {
+			return database.ErrBorrowerNotVerified
+		}
+
+		ageOverride, err := database.CheckAge(book, borrower, override, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if !book.Available {
+			return fmt.Errorf("book isn't available")
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE books SET available = false, version = version + 1 WHERE id = $1", bookID)
+		if err != nil {
+			return fmt.Errorf("book available update: %v", err)
+		}
+
+		loan := database.NewLoan(bookID)
+		_, err = tx.Exec(ctx,
+			"INSERT INTO loans (book_id, borrower_id, borrowed_at, due_at) VALUES ($1, $2, $3, $4)",
+			loan.BookID, borrowerID, loan.BorrowedAt, loan.DueAt,
+		)
+		if err != nil {
+			return fmt.Errorf("borrow book by user: %v", err)
+		}
+
+		if ageOverride != nil {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO age_overrides (id, book_id, borrower_id, borrower_name, audience, borrower_age, librarian, reason, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				ageOverride.ID, ageOverride.BookID, ageOverride.BorrowerID, ageOverride.BorrowerName, ageOverride.Audience, ageOverride.BorrowerAge,
+				ageOverride.Librarian, ageOverride.Reason, ageOverride.CreatedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("record age override: %v", err)
+			}
+		}
+
+		return writeOutbox(ctx, tx, database.BookBorrowed, database.LoanData{Loan: loan, BorrowerID: borrowerID})
+	})
+}
+
+// ReturnBook ends the loan of a book, taking it off its borrower and making
+// it available again.
+func (s *service) ReturnBook(ctx context.Context, bookID database.ID) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		var available bool
+		err := tx.QueryRow(ctx, "SELECT available FROM books WHERE id = $1 FOR UPDATE", bookID).Scan(&available)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("book doesn't exist")
+			}
+			return fmt.Errorf("get book: %v", err)
+		}
+
+		// The loan is read first for the event, since returning drops it
+		returned := database.LoanData{Loan: database.Loan{BookID: bookID}}
+		err = tx.QueryRow(ctx, "SELECT borrower_id, borrowed_at, due_at FROM loans WHERE book_id = $1", bookID).
+			Scan(&returned.BorrowerID, &returned.BorrowedAt, &returned.DueAt)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("return book by user: %v", err)
+		}
+		returned.BorrowedAt, returned.DueAt = returned.BorrowedAt.UTC(), returned.DueAt.UTC()
+
+		tag, err := tx.Exec(ctx, `
+			UPDATE borrowers SET version = version + 1
+			WHERE id IN (SELECT borrower_id FROM loans WHERE book_id = $1)`,
+			bookID,
+		)
+		if err != nil {
+			return fmt.Errorf("return book by user: %v", err)
+		}
+
+		if tag.RowsAffected() == 0 && available {
+			return fmt.Errorf("book isn't borrowed")
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM loans WHERE book_id = $1", bookID)
+		if err != nil {
+			return fmt.Errorf("return book by user: %v", err)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE books SET available = true, version = version + 1 WHERE id = $1", bookID)
+		if err != nil {
+			return fmt.Errorf("book available update: %v", err)
+		}
+
+		return writeOutbox(ctx, tx, database.BookReturned, returned)
+	})
+}
+
+// OverdueLoans lists the loans that were due before asOf, most overdue
+// first.
+func (s *service) OverdueLoans(ctx context.Context, asOf time.Time) ([]database.OverdueLoan, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT l.book_id, l.borrowed_at, l.due_at, b.title, r.id, r.name, r.email
+		FROM loans l
+		JOIN books b ON b.id = l.book_id
+		JOIN borrowers r ON r.id = l.borrower_id
+		WHERE l.due_at < $1
+		ORDER BY l.due_at`,
+		asOf,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find overdue loans: %v", err)
+	}
+	defer rows.Close()
+
+	loans := []database.OverdueLoan{}
+	for rows.Next() {
+		var loan database.OverdueLoan
+		err := rows.Scan(
+			&loan.BookID, &loan.BorrowedAt, &loan.DueAt, &loan.BookTitle,
+			&loan.BorrowerID, &loan.BorrowerName, &loan.BorrowerEmail,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("decode overdue loans: %v", err)
+		}
+		loan.BorrowedAt, loan.DueAt = loan.BorrowedAt.UTC(), loan.DueAt.UTC()
+		loans = append(loans, loan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("decode overdue loans: %v", err)
+	}
+
+	return loans, nil
+}
+
+// CheckIntegrity looks for books on loan that are still marked available.
+// Foreign keys rule out the dangling references the Mongo backend also
+// looks for, and a book can only have one loan.
+func (s *service) CheckIntegrity(ctx context.Context) ([]database.IntegrityProblem, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT b.id, l.borrower_id
+		FROM books b
+		JOIN loans l ON l.book_id = b.id
+		WHERE b.available
+		ORDER BY b.id`)
+	if err != nil {
+		return nil, fmt.Errorf("check book loans: %v", err)
+	}
+	defer rows.Close()
+
+	problems := []database.IntegrityProblem{}
+	for rows.Next() {
+		var bookID, borrowerID database.ID
+		err := rows.Scan(&bookID, &borrowerID)
+		if err != nil {
+			return nil, fmt.Errorf("check book loans: %v", err)
+		}
+		problems = append(problems, database.IntegrityProblem{
+			Collection: "books",
+			ID:         bookID,
+			Problem:    fmt.Sprintf("is available but borrowed by %s", borrowerID.String()),
+		})
+	}
+
+	return problems, rows.Err()
+}
+
+// ListAgeOverrides lists the age restrictions overridden for a borrower,
+// newest first.
+func (s *service) ListAgeOverrides(ctx context.Context, borrowerID database.ID) ([]database.AgeOverride, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, book_id, borrower_id, borrower_name, audience, borrower_age, librarian, reason, created_at
+		FROM age_overrides WHERE borrower_id = $1 ORDER BY id DESC`,
+		borrowerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find age overrides: %v", err)
+	}
+
+	defer rows.Close()
+
+	overrides := []database.AgeOverride{}
+	for rows.Next() {
+		var override database.AgeOverride
+		err := rows.Scan(
+			&override.ID, &override.BookID, &override.BorrowerID, &override.BorrowerName, &override.Audience, &override.BorrowerAge,
+			&override.Librarian, &override.Reason, &override.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("decode age override: %v", err)
+		}
+		override.CreatedAt = override.CreatedAt.UTC()
+		overrides = append(overrides, override)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find age overrides: %v", err)
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,457 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// sqlMigration is a Migration along with the SQL that runs it. Down undoes
+// Up. Data, if set, runs after Up for data changes easier made in Go.
+type sqlMigration struct {
+	database.Migration
+	Up   string
+	Data func(ctx context.Context, tx pgx.Tx) error
+	Down string
+}
+
+// migrations are the schema changes in the order they shipped. Append new
+// ones with the next version; never renumber or edit applied ones.
+var migrations = []sqlMigration{
+	{
+		Migration: database.Migration{Version: 1, Description: "create authors and borrowers"},
+		Up: `
+			CREATE TABLE authors (
+				id text PRIMARY KEY,
+				name text NOT NULL,
+				birthday timestamptz NOT NULL,
+				email text NOT NULL,
+				version bigint NOT NULL DEFAULT 1,
+				CONSTRAINT authors_email_key UNIQUE (email),
+				CONSTRAINT authors_name_birthday_key UNIQUE (name, birthday)
+			);
+			CREATE TABLE borrowers (
+				id text PRIMARY KEY,
+				name text NOT NULL,
+				birthday timestamptz NOT NULL,
+				email text NOT NULL,
+				version bigint NOT NULL DEFAULT 1,
+				CONSTRAINT borrowers_email_key UNIQUE (email),
+				CONSTRAINT borrowers_name_birthday_key UNIQUE (name, birthday)
+			);`,
+		Down: `
+			DROP TABLE borrowers;
+			DROP TABLE authors;`,
+	},
+	{
+		Migration: database.Migration{Version: 2, Description: "create books and their contributors"},
+		Up: `
+			CREATE TABLE books (
+				id text PRIMARY KEY,
+				title text NOT NULL,
+				isbn text,
+				description text NOT NULL DEFAULT '',
+				author_id text NOT NULL REFERENCES authors (id),
+				genres text[] NOT NULL DEFAULT '{}',
+				available boolean NOT NULL DEFAULT true,
+				version bigint NOT NULL DEFAULT 1,
+				CONSTRAINT books_isbn_key UNIQUE (isbn),
+				CONSTRAINT books_author_id_title_key UNIQUE (author_id, title)
+			);
+			CREATE TABLE book_contributors (
+				book_id text NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+				position integer NOT NULL,
+				author_id text NOT NULL REFERENCES authors (id),
+				role text NOT NULL CHECK (role IN ('author', 'editor', 'translator', 'illustrator')),
+				PRIMARY KEY (book_id, position)
+			);
+			CREATE INDEX book_contributors_author_id_idx ON book_contributors (author_id);`,
+		Down: `
+			DROP TABLE book_contributors;
+			DROP TABLE books;`,
+	},
+	{
+		Migration: database.Migration{Version: 3, Description: "create loans"},
+		// A book is lent to one borrower at a time, so it keys its loan
+		Up: `
+			CREATE TABLE loans (
+				book_id text PRIMARY KEY REFERENCES books (id),
+				borrower_id text NOT NULL REFERENCES borrowers (id),
+				borrowed_at timestamptz NOT NULL,
+				due_at timestamptz NOT NULL
+			);
+			CREATE INDEX loans_borrower_id_idx ON loans (borrower_id);
+			CREATE INDEX loans_due_at_idx ON loans (due_at);`,
+		Down: `DROP TABLE loans;`,
+	},
+	{
+		Migration: database.Migration{Version: 4, Description: "create idempotency keys"},
+		Up: `
+			CREATE TABLE idempotency_keys (
+				key text PRIMARY KEY,
+				request_hash text NOT NULL,
+				completed boolean NOT NULL DEFAULT false,
+				status_code integer NOT NULL DEFAULT 0,
+				content_type text NOT NULL DEFAULT '',
+				body bytea,
+				expires_at timestamptz NOT NULL
+			);
+			CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);`,
+		Down: `DROP TABLE idempotency_keys;`,
+	},
+	{
+		Migration: database.Migration{Version: 5, Description: "create import jobs"},
+		Up: `
+			CREATE TABLE import_jobs (
+				id text PRIMARY KEY,
+				kind text NOT NULL,
+				status text NOT NULL,
+				total integer NOT NULL,
+				succeeded integer NOT NULL DEFAULT 0,
+				failed integer NOT NULL DEFAULT 0,
+				error text NOT NULL DEFAULT '',
+				created_at timestamptz NOT NULL,
+				finished_at timestamptz
+			);
+			CREATE TABLE import_rows (
+				id bigserial PRIMARY KEY,
+				job_id text NOT NULL REFERENCES import_jobs (id) ON DELETE CASCADE,
+				row_number integer NOT NULL,
+				status text NOT NULL,
+				book_id text,
+				error text NOT NULL DEFAULT ''
+			);
+			CREATE INDEX import_rows_job_id_idx ON import_rows (job_id);`,
+		Down: `
+			DROP TABLE import_rows;
+			DROP TABLE import_jobs;`,
+	},
+	{
+		Migration: database.Migration{Version: 6, Description: "create book covers"},
+		Up: `
+			CREATE TABLE cover_files (
+				id text PRIMARY KEY,
+				book_id text NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+				content_type text NOT NULL,
+				data bytea NOT NULL,
+				uploaded_at timestamptz NOT NULL
+			);
+			CREATE INDEX cover_files_book_id_idx ON cover_files (book_id);
+			ALTER TABLE books
+				ADD COLUMN cover_id text,
+				ADD COLUMN cover_content_type text,
+				ADD COLUMN cover_thumbnail_id text,
+				ADD COLUMN cover_thumbnail_content_type text,
+				ADD COLUMN cover_uploaded_at timestamptz;`,
+		Down: `
+			ALTER TABLE books
+				DROP COLUMN cover_id,
+				DROP COLUMN cover_content_type,
+				DROP COLUMN cover_thumbnail_id,
+				DROP COLUMN cover_thumbnail_content_type,
+				DROP COLUMN cover_uploaded_at;
+			DROP TABLE cover_files;`,
+	},
+	{
+		Migration: database.Migration{Version: 7, Description: "create webhooks and their deliveries"},
+		Up: `
+			CREATE TABLE webhooks (
+				id text PRIMARY KEY,
+				url text NOT NULL,
+				secret text NOT NULL,
+				events text[] NOT NULL DEFAULT '{}',
+				created_at timestamptz NOT NULL
+			);
+			CREATE TABLE webhook_deliveries (
+				id text PRIMARY KEY,
+				webhook_id text NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+				event_id text NOT NULL,
+				event_type text NOT NULL,
+				payload bytea NOT NULL,
+				status text NOT NULL,
+				attempts integer NOT NULL DEFAULT 0,
+				next_attempt_at timestamptz NOT NULL,
+				last_error text NOT NULL DEFAULT '',
+				created_at timestamptz NOT NULL,
+				delivered_at timestamptz,
+				CONSTRAINT webhook_deliveries_webhook_id_event_id_key UNIQUE (webhook_id, event_id)
+			);
+			CREATE INDEX webhook_deliveries_status_next_attempt_at_idx ON webhook_deliveries (status, next_attempt_at);`,
+		Down: `
+			DROP TABLE webhook_deliveries;
+			DROP TABLE webhooks;`,
+	},
+	{
+		Migration: database.Migration{Version: 8, Description: "create the outbox"},
+		Up: `
+			CREATE TABLE outbox (
+				id text PRIMARY KEY,
+				type text NOT NULL,
+				payload bytea NOT NULL,
+				created_at timestamptz NOT NULL,
+				attempts integer NOT NULL DEFAULT 0,
+				next_attempt_at timestamptz NOT NULL,
+				last_error text NOT NULL DEFAULT '',
+				dispatched_at timestamptz
+			);
+			CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE dispatched_at IS NULL;`,
+		Down: `DROP TABLE outbox;`,
+	},
+	{
+		Migration: database.Migration{Version: 9, Description: "create notification preferences and the sent-message log"},
+		Up: `
+			CREATE TABLE notification_preferences (
+				borrower_id text PRIMARY KEY REFERENCES borrowers (id) ON DELETE CASCADE,
+				locale text NOT NULL,
+				opt_out text[] NOT NULL DEFAULT '{}'
+			);
+			CREATE TABLE notifications (
+				id text PRIMARY KEY,
+				borrower_id text NOT NULL REFERENCES borrowers (id) ON DELETE CASCADE,
+				kind text NOT NULL,
+				key text NOT NULL,
+				locale text NOT NULL,
+				recipient text NOT NULL,
+				subject text NOT NULL,
+				status text NOT NULL,
+				attempts integer NOT NULL,
+				error text NOT NULL DEFAULT '',
+				created_at timestamptz NOT NULL,
+				sent_at timestamptz,
+				CONSTRAINT notifications_borrower_id_kind_key_key UNIQUE (borrower_id, kind, key)
+			);`,
+		Down: `
+			DROP TABLE notifications;
+			DROP TABLE notification_preferences;`,
+	},
+	{
+		Migration: database.Migration{Version: 10, Description: "verify borrowers' emails"},
+		// Borrowers from before emails were verified keep borrowing
+		Up: `
+			ALTER TABLE borrowers ADD COLUMN verified_at timestamptz;
+			UPDATE borrowers SET verified_at = now();`,
+		Down: `ALTER TABLE borrowers DROP COLUMN verified_at;`,
+	},
+	{
+		Migration: database.Migration{Version: 11, Description: "rate books and link children to guardians"},
+		Up: `
+			ALTER TABLE books ADD COLUMN audience text NOT NULL DEFAULT 'all';
+			CREATE TABLE guardians (
+				borrower_id text PRIMARY KEY REFERENCES borrowers (id) ON DELETE CASCADE,
+				guardian_id text NOT NULL REFERENCES borrowers (id)
+			);
+			CREATE INDEX guardians_guardian_id_idx ON guardians (guardian_id);
+			CREATE TABLE age_overrides (
+				id text PRIMARY KEY,
+				book_id text NOT NULL,
+				borrower_id text NOT NULL,
+				borrower_name text NOT NULL,
+				audience text NOT NULL,
+				borrower_age integer NOT NULL,
+				librarian text NOT NULL,
+				reason text NOT NULL,
+				created_at timestamptz NOT NULL
+			);
+			CREATE INDEX age_overrides_borrower_id_idx ON age_overrides (borrower_id);`,
+		Down: `
+			DROP TABLE age_overrides;
+			DROP TABLE guardians;
+			ALTER TABLE books DROP COLUMN audience;`,
+	},
+	{
+		Migration: database.Migration{Version: 12, Description: "normalize author and borrower emails"},
+		// Emails stored before they were normalized on the way in are
+		// normalized too. The old forms aren't kept
+		Data: normalizeEmails,
+	},
+	{
+		Migration: database.Migration{Version: 13, Description: "track import job progress"},
+		// Jobs from before progress was tracked last moved when they
+		// finished, or when they started if they never did
+		Up: `
+			ALTER TABLE import_jobs ADD COLUMN updated_at timestamptz;
+			UPDATE import_jobs SET updated_at = COALESCE(finished_at, created_at);
+			ALTER TABLE import_jobs ALTER COLUMN updated_at SET NOT NULL;`,
+		Down: `ALTER TABLE import_jobs DROP COLUMN updated_at;`,
+	},
+}
+
+// normalizeEmails trims and lower-cases stored author and borrower emails,
+// failing if any would collide.
+func normalizeEmails(ctx context.Context, tx pgx.Tx) error {
+	for _, table := range []string{"authors", "borrowers"} {
+		rows, err := tx.Query(ctx, "SELECT id, email FROM "+table)
+		if err != nil {
+			return fmt.Errorf("find %s: %v", table, err)
+		}
+
+		stored, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (database.StoredEmail, error) {
+			var record database.StoredEmail
+			err := row.Scan(&record.ID, &record.Email)
+			return record, err
+		})
+		if err != nil {
+			return fmt.Errorf("decode %s: %v", table, err)
+		}
+
+		normalized, err := database.NormalizeStoredEmails(table, stored)
+		if err != nil {
+			return err
+		}
+
+		for id, email := range normalized {
+			_, err := tx.Exec(ctx, "UPDATE "+table+" SET email = $1 WHERE id = $2", email, id)
+			if err != nil {
+				return fmt.Errorf("normalize %s email: %v", table, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// migrationsLock is the advisory lock held while a migration runs, so API
+// instances starting together apply each migration once.
+const migrationsLock = 4_271_913
+
+// sqlMigrations runs migrations against a Postgres database and records the
+// applied ones in its schema_migrations table. Each migration runs in its
+// own transaction.
+type sqlMigrations struct {
+	pool       *pgxpool.Pool
+	migrations []sqlMigration
+}
+
+func (m *sqlMigrations) Migrations() []database.Migration {
+	migrations := make([]database.Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		migrations = append(migrations, migration.Migration)
+	}
+	return migrations
+}
+
+func (m *sqlMigrations) Applied(ctx context.Context) (map[int]time.Time, error) {
+	_, err := m.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			description text NOT NULL,
+			applied_at timestamptz NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %v", err)
+	}
+
+	rows, err := m.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("find migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("decode migrations: %v", err)
+		}
+		applied[version] = appliedAt.UTC()
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *sqlMigrations) Apply(ctx context.Context, migration database.Migration) error {
+	return pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLock)
+		if err != nil {
+			return fmt.Errorf("lock migrations: %v", err)
+		}
+
+		// Another instance starting at the same time may have applied it
+		// while this one waited for the lock
+		var applied bool
+		err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version).Scan(&applied)
+		if err != nil || applied {
+			return err
+		}
+
+		steps := m.find(migration.Version)
+		if steps.Up != "" {
+			_, err = tx.Exec(ctx, steps.Up)
+			if err != nil {
+				return err
+			}
+		}
+		if steps.Data != nil {
+			err = steps.Data(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx,
+			"INSERT INTO schema_migrations (version, description, applied_at) VALUES ($1, $2, $3)",
+			migration.Version, migration.Description, time.Now().UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("record migration: %v", err)
+		}
+
+		return nil
+	})
+}
+
+func (m *sqlMigrations) Revert(ctx context.Context, migration database.Migration) error {
+	return pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLock)
+		if err != nil {
+			return fmt.Errorf("lock migrations: %v", err)
+		}
+
+		if down := m.find(migration.Version).Down; down != "" {
+			_, err = tx.Exec(ctx, down)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		if err != nil {
+			return fmt.Errorf("unrecord migration: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// RebuildIndexes reindexes the tables in the current schema. Unlike Mongo,
+// Postgres rebuilds indexes in place, so the migrations aren't rerun.
+func (m *sqlMigrations) RebuildIndexes(ctx context.Context, applied []database.Migration) error {
+	if len(applied) == 0 {
+		return nil
+	}
+
+	var schema string
+	err := m.pool.QueryRow(ctx, "SELECT current_schema()").Scan(&schema)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.pool.Exec(ctx, "REINDEX SCHEMA "+pgx.Identifier{schema}.Sanitize())
+	return err
+}
+
+func (m *sqlMigrations) find(version int) sqlMigration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	panic(fmt.Sprintf("unknown migration %d", version))
+}
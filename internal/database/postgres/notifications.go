@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const notificationColumns = "id, borrower_id, kind, key, locale, recipient, subject, status, attempts, error, created_at, sent_at"
+
+func (s *service) GetNotificationPreferences(ctx context.Context, borrowerID database.ID) (*database.NotificationPreferences, error) {
+	var prefs database.NotificationPreferences
+	err := s.pool.QueryRow(ctx,
+		"SELECT locale, opt_out FROM notification_preferences WHERE borrower_id = $1", borrowerID,
+	).Scan(&prefs.Locale, &prefs.OptOut)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get notification preferences: %v", err)
+	}
+
+	return &prefs, nil
+}
+
+func (s *service) SetNotificationPreferences(ctx context.Context, borrowerID database.ID, prefs database.NotificationPreferences) error {
+	optOut := prefs.OptOut
+	if optOut == nil {
+		optOut = []string{}
+	}
+
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO notification_preferences (borrower_id, locale, opt_out) VALUES ($1, $2, $3)
+		ON CONFLICT (borrower_id) DO UPDATE SET locale = excluded.locale, opt_out = excluded.opt_out`,
+		borrowerID, prefs.Locale, optOut,
+	)
+	if err != nil {
+		return fmt.Errorf("set notification preferences: %v", err)
+	}
+
+	return nil
+}
+
+// ReserveNotification records notification as being sent, unless the same
+// kind of email about the same key has been sent or is being sent already.
+// A failed one is taken over when it has had fewer than maxAttempts.
+func (s *service) ReserveNotification(ctx context.Context, notification database.Notification, maxAttempts int) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO notifications (id, borrower_id, kind, key, locale, recipient, subject, status, attempts, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (borrower_id, kind, key) DO UPDATE
+		SET locale = excluded.locale, recipient = excluded.recipient, subject = excluded.subject,
+			status = excluded.status, attempts = notifications.attempts + 1, error = ''
+		WHERE notifications.status = $11 AND notifications.attempts < $12`,
+		notification.ID, notification.BorrowerID, notification.Kind, notification.Key, notification.Locale,
+		notification.To, notification.Subject, notification.Status, notification.Attempts, notification.CreatedAt,
+		database.NotificationFailed, maxAttempts,
+	)
+	if err != nil {
+		return false, fmt.Errorf("reserve notification: %v", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateNotification saves how sending a reserved notification went: its
+// status, error and when it was sent.
+func (s *service) UpdateNotification(ctx context.Context, notification database.Notification) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE notifications SET status = $1, error = $2, sent_at = $3
+		WHERE borrower_id = $4 AND kind = $5 AND key = $6`,
+		notification.Status, notification.Error, notification.SentAt,
+		notification.BorrowerID, notification.Kind, notification.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("update notification: %v", err)
+	}
+
+	return nil
+}
+
+// ListNotifications lists the emails sent to a borrower, newest first.
+func (s *service) ListNotifications(ctx context.Context, borrowerID database.ID) ([]database.Notification, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT "+notificationColumns+" FROM notifications WHERE borrower_id = $1 ORDER BY id DESC", borrowerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find notifications: %v", err)
+	}
+	defer rows.Close()
+
+	notifications := []database.Notification{}
+	for rows.Next() {
+		var notification database.Notification
+		err := rows.Scan(
+			&notification.ID, &notification.BorrowerID, &notification.Kind, &notification.Key, &notification.Locale,
+			&notification.To, &notification.Subject, &notification.Status, &notification.Attempts, &notification.Error,
+			&notification.CreatedAt, &notification.SentAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("decode notifications: %v", err)
+		}
+
+		notification.CreatedAt = notification.CreatedAt.UTC()
+		if notification.SentAt != nil {
+			sentAt := notification.SentAt.UTC()
+			notification.SentAt = &sentAt
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
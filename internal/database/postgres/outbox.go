@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const outboxColumns = "id, type, payload, created_at, attempts, next_attempt_at, last_error, dispatched_at"
+
+// writeOutbox records an event of eventType with data in tx, the transaction
+// making the change it reports.
+func writeOutbox(ctx context.Context, tx pgx.Tx, eventType string, data any) error {
+	event, err := database.NewOutboxEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO outbox (id, type, payload, created_at, next_attempt_at) VALUES ($1, $2, $3, $4, $5)",
+		event.ID, event.Type, []byte(event.Payload), event.CreatedAt, event.NextAttemptAt,
+	)
+	if err != nil {
+		return fmt.Errorf("write %s event: %v", eventType, err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents skips events another relay has locked, so relays
+// claiming at the same time each get different ones.
+func (s *service) ClaimOutboxEvents(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]database.OutboxEvent, error) {
+	var events []database.OutboxEvent
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+outboxColumns+` FROM outbox
+			WHERE dispatched_at IS NULL AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id LIMIT $2
+			FOR UPDATE SKIP LOCKED`,
+			asOf, limit,
+		)
+		if err != nil {
+			return err
+		}
+
+		events, err = scanOutboxEvents(rows)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]database.ID, 0, len(events))
+		for i := range events {
+			events[i].NextAttemptAt = asOf.UTC().Add(lease)
+			ids = append(ids, events[i].ID)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE outbox SET next_attempt_at = $1 WHERE id = ANY ($2)", asOf.Add(lease), idStrings(ids))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox events: %v", err)
+	}
+
+	return events, nil
+}
+
+func (s *service) UpdateOutboxEvent(ctx context.Context, event database.OutboxEvent) error {
+	_, err := s.pool.Exec(ctx,
+		"UPDATE outbox SET attempts = $2, next_attempt_at = $3, last_error = $4, dispatched_at = $5 WHERE id = $1",
+		event.ID, event.Attempts, event.NextAttemptAt, event.LastError, event.DispatchedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("update outbox event: %v", err)
+	}
+
+	return nil
+}
+
+func (s *service) PruneOutbox(ctx context.Context, before time.Time) (int, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM outbox WHERE dispatched_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %v", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func scanOutboxEvents(rows pgx.Rows) ([]database.OutboxEvent, error) {
+	defer rows.Close()
+
+	events := []database.OutboxEvent{}
+	for rows.Next() {
+		var event database.OutboxEvent
+		var payload []byte
+		err := rows.Scan(
+			&event.ID, &event.Type, &payload, &event.CreatedAt, &event.Attempts,
+			&event.NextAttemptAt, &event.LastError, &event.DispatchedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Payload = payload
+		event.CreatedAt = event.CreatedAt.UTC()
+		event.NextAttemptAt = event.NextAttemptAt.UTC()
+		if event.DispatchedAt != nil {
+			dispatchedAt := event.DispatchedAt.UTC()
+			event.DispatchedAt = &dispatchedAt
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/conformance"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+var testURL string
+
+func TestMain(m *testing.M) {
+	dbContainer, err := tcpostgres.Run(context.Background(), "postgres:16-alpine",
+		tcpostgres.WithDatabase("curly_test"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		log.Fatalf("could not start postgres container: %v", err)
+	}
+
+	testURL, err = dbContainer.ConnectionString(context.Background(), "sslmode=disable")
+	if err != nil {
+		log.Fatalf("could not get postgres connection string: %v", err)
+	}
+
+	m.Run()
+
+	if err := dbContainer.Terminate(context.Background()); err != nil {
+		log.Fatalf("could not teardown postgres container: %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) database.Service {
+		srv, err := Open(testURL)
+		require.NoError(t, err)
+		t.Cleanup(srv.(*service).pool.Close)
+
+		_, err = srv.(*service).pool.Exec(context.Background(),
+			"TRUNCATE authors, borrowers, books, book_contributors, loans, idempotency_keys, import_jobs, import_rows, cover_files",
+		)
+		require.NoError(t, err)
+
+		return srv
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	pool, err := connect(testURL)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ctx := context.Background()
+	m := &sqlMigrations{pool: pool, migrations: migrations}
+
+	err = database.MigrateOnStartup(m)
+	require.NoError(t, err)
+
+	t.Run("should revert every migration", func(t *testing.T) {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			err := m.Revert(ctx, migrations[i].Migration)
+			require.NoError(t, err, "revert migration %d", migrations[i].Version)
+		}
+
+		applied, err := m.Applied(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("should apply every migration once", func(t *testing.T) {
+		for _, migration := range migrations {
+			err := m.Apply(ctx, migration.Migration)
+			require.NoError(t, err, "apply migration %d", migration.Version)
+
+			err = m.Apply(ctx, migration.Migration)
+			require.NoError(t, err, "reapply migration %d", migration.Version)
+		}
+
+		applied, err := m.Applied(ctx)
+		require.NoError(t, err)
+		assert.Len(t, applied, len(migrations))
+	})
+
+	t.Run("should normalize stored emails", func(t *testing.T) {
+		normalize := migrations[11].Migration
+		require.Equal(t, 12, normalize.Version)
+		for i := len(migrations) - 1; i >= 11; i-- {
+			require.NoError(t, m.Revert(ctx, migrations[i].Migration))
+		}
+
+		birthday := time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+		authorID, borrowerID, otherID := database.NewID(), database.NewID(), database.NewID()
+		_, err := pool.Exec(ctx, "INSERT INTO authors (id, name, birthday, email) VALUES ($1, 'Bober', $2, ' Bober@Author.com')", authorID, birthday)
+		require.NoError(t, err)
+		_, err = pool.Exec(ctx, "INSERT INTO borrowers (id, name, birthday, email) VALUES ($1, 'Bober', $2, 'bober@hotmail.com'), ($3, 'Skunk', $2, 'BOBER@hotmail.com')", borrowerID, birthday, otherID)
+		require.NoError(t, err)
+
+		err = m.Apply(ctx, normalize)
+		assert.ErrorContains(t, err, `"bober@hotmail.com" (`)
+
+		_, err = pool.Exec(ctx, "UPDATE borrowers SET email = 'skunk@hotmail.com' WHERE id = $1", otherID)
+		require.NoError(t, err)
+		for _, migration := range migrations[11:] {
+			require.NoError(t, m.Apply(ctx, migration.Migration))
+		}
+
+		var email string
+		require.NoError(t, pool.QueryRow(ctx, "SELECT email FROM authors WHERE id = $1", authorID).Scan(&email))
+		assert.Equal(t, "bober@author.com", email)
+	})
+
+	t.Run("should rebuild indexes", func(t *testing.T) {
+		err := m.RebuildIndexes(ctx, m.Migrations())
+		assert.NoError(t, err)
+	})
+}
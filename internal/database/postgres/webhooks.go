@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_error, created_at, delivered_at`
+
+func (s *service) CreateWebhook(ctx context.Context, webhook database.WebhookRequest) (*database.ID, error) {
+	id := database.NewID()
+
+	_, err := s.pool.Exec(ctx,
+		"INSERT INTO webhooks (id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5)",
+		id, webhook.URL, webhook.Secret, webhook.Events, time.Now().UTC().Truncate(time.Millisecond),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create webhook: %v", err)
+	}
+
+	return &id, nil
+}
+
+func (s *service) ListWebhooks(ctx context.Context) ([]database.Webhook, error) {
+	webhooks, err := findWebhooks(ctx, s.pool, "true")
+	if err != nil {
+		return nil, fmt.Errorf("find webhooks: %v", err)
+	}
+
+	return webhooks, nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, webhookID database.ID) (*database.Webhook, error) {
+	webhooks, err := findWebhooks(ctx, s.pool, "id = $1", webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook: %v", err)
+	}
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	return &webhooks[0], nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (s *service) DeleteWebhook(ctx context.Context, webhookID database.ID) (bool, error) {
+	result, err := s.pool.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", webhookID)
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %v", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// QueueWebhookDeliveries queues event for every webhook subscribed to its
+// type that hasn't had it queued already, and returns how many it queued.
+func (s *service) QueueWebhookDeliveries(ctx context.Context, event database.WebhookEvent) (int, error) {
+	queued := 0
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		webhooks, err := findWebhooks(ctx, tx, "$1 = ANY (events)", event.Type)
+		if err != nil {
+			return err
+		}
+
+		for _, webhook := range webhooks {
+			delivery := database.NewWebhookDelivery(webhook.ID, event)
+			result, err := tx.Exec(ctx, `
+				INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+				delivery.ID, delivery.WebhookID, delivery.EventID, delivery.EventType, []byte(delivery.Payload),
+				delivery.Status, delivery.NextAttemptAt, delivery.CreatedAt,
+			)
+			if err != nil {
+				return err
+			}
+
+			queued += int(result.RowsAffected())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("queue webhook deliveries: %v", err)
+	}
+
+	return queued, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due by asOf,
+// earliest first, and puts their next attempt off by lease so no other
+// worker takes them meanwhile. Deliveries another worker is claiming are
+// skipped rather than waited for.
+func (s *service) ClaimWebhookDeliveries(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]database.WebhookDelivery, error) {
+	var deliveries []database.WebhookDelivery
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at, id LIMIT $3
+			FOR UPDATE SKIP LOCKED`,
+			database.DeliveryPending, asOf, limit,
+		)
+		if err != nil {
+			return err
+		}
+
+		deliveries, err = scanWebhookDeliveries(rows)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]database.ID, 0, len(deliveries))
+		for i := range deliveries {
+			deliveries[i].NextAttemptAt = asOf.UTC().Add(lease)
+			ids = append(ids, deliveries[i].ID)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = ANY ($2)", asOf.Add(lease), idStrings(ids))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook deliveries: %v", err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery saves the outcome of an attempt: its status,
+// attempts, next attempt, last error and when it was delivered.
+func (s *service) UpdateWebhookDelivery(ctx context.Context, delivery database.WebhookDelivery) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_error = $5, delivered_at = $6
+		WHERE id = $1`,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastError, delivery.DeliveredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook delivery: %v", err)
+	}
+
+	return nil
+}
+
+func (s *service) GetWebhookDelivery(ctx context.Context, deliveryID database.ID) (*database.WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = $1", deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook delivery: %v", err)
+	}
+
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook delivery: %v", err)
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	return &deliveries[0], nil
+}
+
+// ListWebhookDeliveries lists deliveries with status, or all of them when
+// it's empty, newest first.
+func (s *service) ListWebhookDeliveries(ctx context.Context, status string) ([]database.WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE $1 = '' OR status = $1 ORDER BY id DESC",
+		status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find webhook deliveries: %v", err)
+	}
+
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("find webhook deliveries: %v", err)
+	}
+
+	return deliveries, nil
+}
+
+func findWebhooks(ctx context.Context, q querier, where string, args ...any) ([]database.Webhook, error) {
+	rows, err := q.Query(ctx, "SELECT id, url, secret, events, created_at FROM webhooks WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []database.Webhook{}
+	for rows.Next() {
+		var webhook database.Webhook
+		err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		webhook.CreatedAt = webhook.CreatedAt.UTC()
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func scanWebhookDeliveries(rows pgx.Rows) ([]database.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []database.WebhookDelivery{}
+	for rows.Next() {
+		var delivery database.WebhookDelivery
+		var payload []byte
+		err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		delivery.Payload = payload
+		delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+		delivery.CreatedAt = delivery.CreatedAt.UTC()
+		if delivery.DeliveredAt != nil {
+			deliveredAt := delivery.DeliveredAt.UTC()
+			delivery.DeliveredAt = &deliveredAt
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// SetBookCover stores a book's cover and thumbnail if the book is still at
+// version, replacing any previous ones, and bumps the book's version. It
+// returns nil when the book doesn't exist.
+func (s *service) SetBookCover(ctx context.Context, bookID database.ID, upload database.CoverUpload, version int64) (*database.Book, error) {
+	cover := database.Cover{
+		ID:                   database.NewID(),
+		ContentType:          upload.ContentType,
+		ThumbnailID:          database.NewID(),
+		ThumbnailContentType: upload.ThumbnailContentType,
+		UploadedAt:           time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	var updated bool
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		exists, err := checkVersion(ctx, tx, "books", bookID, version)
+		if err != nil {
+			return fmt.Errorf("set book cover: %w", err)
+		}
+		if !exists {
+			return nil
+		}
+
+		var previousCover, previousThumbnail *string
+		err = tx.QueryRowContext(ctx,
+			"SELECT cover_id, cover_thumbnail_id FROM books WHERE id = ?",
+			bookID,
+		).Scan(&previousCover, &previousThumbnail)
+		if err != nil {
+			return fmt.Errorf("get book: %v", err)
+		}
+
+		files := []struct {
+			id          database.ID
+			contentType string
+			data        []byte
+		}{
+			{cover.ID, upload.ContentType, upload.Image},
+			{cover.ThumbnailID, upload.ThumbnailContentType, upload.Thumbnail},
+		}
+		for _, file := range files {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO cover_files (id, book_id, content_type, data, uploaded_at) VALUES (?, ?, ?, ?, ?)",
+				file.id, bookID, file.contentType, file.data, cover.UploadedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("upload cover: %v", err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE books
+			SET cover_id = ?, cover_content_type = ?, cover_thumbnail_id = ?,
+				cover_thumbnail_content_type = ?, cover_uploaded_at = ?, version = version + 1
+			WHERE id = ?`,
+			cover.ID, cover.ContentType, cover.ThumbnailID, cover.ThumbnailContentType, cover.UploadedAt, bookID,
+		)
+		if err != nil {
+			return fmt.Errorf("set book cover: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM cover_files WHERE id IN (?, ?)", previousCover, previousThumbnail)
+		if err != nil {
+			return fmt.Errorf("delete previous cover: %v", err)
+		}
+
+		updated = true
+		return nil
+	})
+	if err != nil || !updated {
+		return nil, err
+	}
+
+	return s.GetBook(ctx, bookID)
+}
+
+// GetBookCover reads a book's cover, or its thumbnail. It returns nil when
+// the book doesn't exist or has no cover.
+func (s *service) GetBookCover(ctx context.Context, bookID database.ID, thumbnail bool) (*database.CoverFile, error) {
+	column := "cover_id"
+	if thumbnail {
+		column = "cover_thumbnail_id"
+	}
+
+	var file database.CoverFile
+	err := s.db.QueryRowContext(ctx,
+		"SELECT f.id, f.content_type, f.uploaded_at, f.data FROM books b JOIN cover_files f ON f.id = b."+column+" WHERE b.id = ?",
+		bookID,
+	).Scan(&file.ID, &file.ContentType, &file.UploadedAt, &file.Data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("download cover: %v", err)
+	}
+	file.UploadedAt = file.UploadedAt.UTC()
+
+	return &file, nil
+}
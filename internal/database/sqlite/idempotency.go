@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// ReserveIdempotencyKey claims key for a request. It returns nil when the key
+// was free and is now reserved, or the existing record when another request
+// already holds it. Expired records are taken over in place.
+func (s *service) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*database.IdempotencyRecord, error) {
+	now := time.Now().UTC()
+
+	// The existing record may be released between the insert and the read;
+	// try again once.
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := s.db.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (key, request_hash, expires_at) VALUES (?1, ?2, ?3)
+			ON CONFLICT (key) DO UPDATE
+			SET request_hash = excluded.request_hash, completed = false, status_code = 0,
+				content_type = '', body = NULL, expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at <= ?4`,
+			key, requestHash, now.Add(database.PendingIdempotencyTTL), now,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("reserve idempotency key: %v", err)
+		}
+		if reserved, _ := result.RowsAffected(); reserved == 1 {
+			return nil, nil
+		}
+
+		var existing database.IdempotencyRecord
+		err = s.db.QueryRowContext(ctx,
+			"SELECT key, request_hash, completed, status_code, content_type, body, expires_at FROM idempotency_keys WHERE key = ?",
+			key,
+		).Scan(&existing.Key, &existing.RequestHash, &existing.Completed, &existing.StatusCode, &existing.ContentType, &existing.Body, &existing.ExpiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, fmt.Errorf("get idempotency key: %v", err)
+		}
+
+		return &existing, nil
+	}
+
+	return nil, fmt.Errorf("reserve idempotency key: key is contended")
+}
+
+// CompleteIdempotencyKey stores the response for a reserved key so retries can
+// replay it until ttl elapses.
+func (s *service) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET completed = true, status_code = ?, content_type = ?, body = ?, expires_at = ?
+		WHERE key = ?`,
+		statusCode, contentType, body, time.Now().UTC().Add(ttl), key,
+	)
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %v", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a reservation so the request can be retried.
+func (s *service) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = ?", key)
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// CreateImportJob starts tracking an import of total rows.
+func (s *service) CreateImportJob(ctx context.Context, kind string, total int) (*database.ID, error) {
+	id := database.NewID()
+	now := time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO import_jobs (id, kind, status, total, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		id, kind, database.ImportJobRunning, total, now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create import job: %v", err)
+	}
+
+	return &id, nil
+}
+
+// RecordImportRow appends the outcome of one row to the job.
+func (s *service) RecordImportRow(ctx context.Context, jobID database.ID, result database.ImportRowResult) error {
+	counter := "succeeded"
+	if result.Status != database.ImportRowCreated {
+		counter = "failed"
+	}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		updated, err := tx.ExecContext(ctx,
+			"UPDATE import_jobs SET "+counter+" = "+counter+" + 1, updated_at = ? WHERE id = ? AND status = ?",
+			time.Now().UTC(), jobID, database.ImportJobRunning,
+		)
+		if err != nil {
+			return err
+		}
+		if recorded, _ := updated.RowsAffected(); recorded == 0 {
+			return database.ErrImportJobNotRunning
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO import_rows (job_id, row_number, status, book_id, error) VALUES (?, ?, ?, ?, ?)",
+			jobID, result.Row, result.Status, result.BookID, result.Error,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("record import row: %w", err)
+	}
+
+	return nil
+}
+
+// FinishImportJob marks the job done. A non-empty jobErr means the import
+// stopped early.
+func (s *service) FinishImportJob(ctx context.Context, jobID database.ID, jobErr string) error {
+	status := database.ImportJobCompleted
+	if jobErr != "" {
+		status = database.ImportJobFailed
+	}
+
+	now := time.Now().UTC()
+	updated, err := s.db.ExecContext(ctx,
+		"UPDATE import_jobs SET status = ?, error = ?, updated_at = ?, finished_at = ? WHERE id = ? AND status = ?",
+		status, jobErr, now, now, jobID, database.ImportJobRunning,
+	)
+	if err != nil {
+		return fmt.Errorf("finish import job: %v", err)
+	}
+	if finished, _ := updated.RowsAffected(); finished == 0 {
+		return fmt.Errorf("finish import job: %w", database.ErrImportJobNotRunning)
+	}
+
+	return nil
+}
+
+// InterruptImportJobs marks running jobs that haven't recorded a row since
+// idleSince as interrupted.
+func (s *service) InterruptImportJobs(ctx context.Context, idleSince time.Time) (int, error) {
+	now := time.Now().UTC()
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE import_jobs SET status = ?, error = ?, updated_at = ?, finished_at = ? WHERE status = ? AND updated_at < ?",
+		database.ImportJobInterrupted, database.ImportInterruptedError, now, now, database.ImportJobRunning, idleSince.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("interrupt import jobs: %v", err)
+	}
+
+	interrupted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("interrupt import jobs: %v", err)
+	}
+
+	return int(interrupted), nil
+}
+
+func (s *service) GetImportJob(ctx context.Context, jobID database.ID) (*database.ImportJob, error) {
+	var job database.ImportJob
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, kind, status, total, succeeded, failed, error, created_at, updated_at, finished_at FROM import_jobs WHERE id = ?",
+		jobID,
+	).Scan(&job.ID, &job.Kind, &job.Status, &job.Total, &job.Succeeded, &job.Failed, &job.Error, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get import job: %v", err)
+	}
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.UpdatedAt = job.UpdatedAt.UTC()
+	if job.FinishedAt != nil {
+		finishedAt := job.FinishedAt.UTC()
+		job.FinishedAt = &finishedAt
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT row_number, status, book_id, error FROM import_rows WHERE job_id = ? ORDER BY id", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("get import job rows: %v", err)
+	}
+	defer rows.Close()
+
+	job.Rows = []database.ImportRowResult{}
+	for rows.Next() {
+		var row database.ImportRowResult
+		err := rows.Scan(&row.Row, &row.Status, &row.BookID, &row.Error)
+		if err != nil {
+			return nil, fmt.Errorf("get import job rows: %v", err)
+		}
+		job.Rows = append(job.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get import job rows: %v", err)
+	}
+
+	return &job, nil
+}
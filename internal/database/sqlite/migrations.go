@@ -0,0 +1,438 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// sqlMigration is a Migration along with the SQL that runs it. Down undoes
+// Up. Data, if set, runs after Up for data changes easier made in Go.
+type sqlMigration struct {
+	database.Migration
+	Up   string
+	Data func(ctx context.Context, tx *sql.Tx) error
+	Down string
+}
+
+// migrations are the schema changes in the order they shipped. Append new
+// ones with the next version; never renumber or edit applied ones. Times are
+// declared TIMESTAMP so the driver reads them back as time.Time.
+var migrations = []sqlMigration{
+	{
+		Migration: database.Migration{Version: 1, Description: "create authors and borrowers"},
+		Up: `
+			CREATE TABLE authors (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				birthday TIMESTAMP NOT NULL,
+				email TEXT NOT NULL UNIQUE,
+				version INTEGER NOT NULL DEFAULT 1,
+				UNIQUE (name, birthday)
+			);
+			CREATE TABLE borrowers (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				birthday TIMESTAMP NOT NULL,
+				email TEXT NOT NULL UNIQUE,
+				version INTEGER NOT NULL DEFAULT 1,
+				UNIQUE (name, birthday)
+			);`,
+		Down: `
+			DROP TABLE borrowers;
+			DROP TABLE authors;`,
+	},
+	{
+		Migration: database.Migration{Version: 2, Description: "create books and their contributors"},
+		// Genres are a JSON array
+		Up: `
+			CREATE TABLE books (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				isbn TEXT UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				author_id TEXT NOT NULL REFERENCES authors (id),
+				genres TEXT NOT NULL DEFAULT '[]',
+				available INTEGER NOT NULL DEFAULT 1,
+				version INTEGER NOT NULL DEFAULT 1,
+				cover_id TEXT,
+				cover_content_type TEXT,
+				cover_thumbnail_id TEXT,
+				cover_thumbnail_content_type TEXT,
+				cover_uploaded_at TIMESTAMP,
+				UNIQUE (author_id, title)
+			);
+			CREATE TABLE book_contributors (
+				book_id TEXT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				author_id TEXT NOT NULL REFERENCES authors (id),
+				role TEXT NOT NULL CHECK (role IN ('author', 'editor', 'translator', 'illustrator')),
+				PRIMARY KEY (book_id, position)
+			);
+			CREATE INDEX book_contributors_author_id_idx ON book_contributors (author_id);`,
+		Down: `
+			DROP TABLE book_contributors;
+			DROP TABLE books;`,
+	},
+	{
+		Migration: database.Migration{Version: 3, Description: "create loans"},
+		// A book is lent to one borrower at a time, so it keys its loan
+		Up: `
+			CREATE TABLE loans (
+				book_id TEXT PRIMARY KEY REFERENCES books (id),
+				borrower_id TEXT NOT NULL REFERENCES borrowers (id),
+				borrowed_at TIMESTAMP NOT NULL,
+				due_at TIMESTAMP NOT NULL
+			);
+			CREATE INDEX loans_borrower_id_idx ON loans (borrower_id);
+			CREATE INDEX loans_due_at_idx ON loans (due_at);`,
+		Down: `DROP TABLE loans;`,
+	},
+	{
+		Migration: database.Migration{Version: 4, Description: "create idempotency keys"},
+		Up: `
+			CREATE TABLE idempotency_keys (
+				key TEXT PRIMARY KEY,
+				request_hash TEXT NOT NULL,
+				completed INTEGER NOT NULL DEFAULT 0,
+				status_code INTEGER NOT NULL DEFAULT 0,
+				content_type TEXT NOT NULL DEFAULT '',
+				body BLOB,
+				expires_at TIMESTAMP NOT NULL
+			);
+			CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);`,
+		Down: `DROP TABLE idempotency_keys;`,
+	},
+	{
+		Migration: database.Migration{Version: 5, Description: "create import jobs"},
+		Up: `
+			CREATE TABLE import_jobs (
+				id TEXT PRIMARY KEY,
+				kind TEXT NOT NULL,
+				status TEXT NOT NULL,
+				total INTEGER NOT NULL,
+				succeeded INTEGER NOT NULL DEFAULT 0,
+				failed INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP
+			);
+			CREATE TABLE import_rows (
+				id INTEGER PRIMARY KEY,
+				job_id TEXT NOT NULL REFERENCES import_jobs (id) ON DELETE CASCADE,
+				row_number INTEGER NOT NULL,
+				status TEXT NOT NULL,
+				book_id TEXT,
+				error TEXT NOT NULL DEFAULT ''
+			);
+			CREATE INDEX import_rows_job_id_idx ON import_rows (job_id);`,
+		Down: `
+			DROP TABLE import_rows;
+			DROP TABLE import_jobs;`,
+	},
+	{
+		Migration: database.Migration{Version: 6, Description: "create book covers"},
+		Up: `
+			CREATE TABLE cover_files (
+				id TEXT PRIMARY KEY,
+				book_id TEXT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+				content_type TEXT NOT NULL,
+				data BLOB NOT NULL,
+				uploaded_at TIMESTAMP NOT NULL
+			);
+			CREATE INDEX cover_files_book_id_idx ON cover_files (book_id);`,
+		Down: `DROP TABLE cover_files;`,
+	},
+	{
+		Migration: database.Migration{Version: 7, Description: "create webhooks and their deliveries"},
+		// Events are a JSON array
+		Up: `
+			CREATE TABLE webhooks (
+				id TEXT PRIMARY KEY,
+				url TEXT NOT NULL,
+				secret TEXT NOT NULL,
+				events TEXT NOT NULL DEFAULT '[]',
+				created_at TIMESTAMP NOT NULL
+			);
+			CREATE TABLE webhook_deliveries (
+				id TEXT PRIMARY KEY,
+				webhook_id TEXT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+				event_id TEXT NOT NULL,
+				event_type TEXT NOT NULL,
+				payload BLOB NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMP NOT NULL,
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				delivered_at TIMESTAMP,
+				UNIQUE (webhook_id, event_id)
+			);
+			CREATE INDEX webhook_deliveries_status_next_attempt_at_idx ON webhook_deliveries (status, next_attempt_at);`,
+		Down: `
+			DROP TABLE webhook_deliveries;
+			DROP TABLE webhooks;`,
+	},
+	{
+		Migration: database.Migration{Version: 8, Description: "create the outbox"},
+		Up: `
+			CREATE TABLE outbox (
+				id TEXT PRIMARY KEY,
+				type TEXT NOT NULL,
+				payload BLOB NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMP NOT NULL,
+				last_error TEXT NOT NULL DEFAULT '',
+				dispatched_at TIMESTAMP
+			);
+			CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE dispatched_at IS NULL;`,
+		Down: `DROP TABLE outbox;`,
+	},
+	{
+		Migration: database.Migration{Version: 9, Description: "create notification preferences and the sent-message log"},
+		Up: `
+			CREATE TABLE notification_preferences (
+				borrower_id TEXT PRIMARY KEY REFERENCES borrowers (id) ON DELETE CASCADE,
+				locale TEXT NOT NULL,
+				opt_out TEXT NOT NULL DEFAULT '[]'
+			);
+			CREATE TABLE notifications (
+				id TEXT PRIMARY KEY,
+				borrower_id TEXT NOT NULL REFERENCES borrowers (id) ON DELETE CASCADE,
+				kind TEXT NOT NULL,
+				key TEXT NOT NULL,
+				locale TEXT NOT NULL,
+				recipient TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL,
+				error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				sent_at TIMESTAMP,
+				UNIQUE (borrower_id, kind, key)
+			);`,
+		Down: `
+			DROP TABLE notifications;
+			DROP TABLE notification_preferences;`,
+	},
+	{
+		Migration: database.Migration{Version: 10, Description: "verify borrowers' emails"},
+		// Borrowers from before emails were verified keep borrowing
+		Up: `
+			ALTER TABLE borrowers ADD COLUMN verified_at TIMESTAMP;
+			UPDATE borrowers SET verified_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');`,
+		Down: `ALTER TABLE borrowers DROP COLUMN verified_at;`,
+	},
+	{
+		Migration: database.Migration{Version: 11, Description: "rate books and link children to guardians"},
+		// Guardians live in their own table since SQLite can't drop columns
+		// that reference others
+		Up: `
+			ALTER TABLE books ADD COLUMN audience TEXT NOT NULL DEFAULT 'all';
+			CREATE TABLE guardians (
+				borrower_id TEXT PRIMARY KEY REFERENCES borrowers (id) ON DELETE CASCADE,
+				guardian_id TEXT NOT NULL REFERENCES borrowers (id)
+			);
+			CREATE INDEX guardians_guardian_id_idx ON guardians (guardian_id);
+			CREATE TABLE age_overrides (
+				id TEXT PRIMARY KEY,
+				book_id TEXT NOT NULL,
+				borrower_id TEXT NOT NULL,
+				borrower_name TEXT NOT NULL,
+				audience TEXT NOT NULL,
+				borrower_age INTEGER NOT NULL,
+				librarian TEXT NOT NULL,
+				reason TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);
+			CREATE INDEX age_overrides_borrower_id_idx ON age_overrides (borrower_id);`,
+		Down: `
+			DROP TABLE age_overrides;
+			DROP TABLE guardians;
+			ALTER TABLE books DROP COLUMN audience;`,
+	},
+	{
+		Migration: database.Migration{Version: 12, Description: "normalize author and borrower emails"},
+		// Emails stored before they were normalized on the way in are
+		// normalized too. The old forms aren't kept
+		Data: normalizeEmails,
+	},
+	{
+		Migration: database.Migration{Version: 13, Description: "track import job progress"},
+		// Jobs from before progress was tracked last moved when they
+		// finished, or when they started if they never did
+		Up: `
+			ALTER TABLE import_jobs ADD COLUMN updated_at TIMESTAMP;
+			UPDATE import_jobs SET updated_at = COALESCE(finished_at, created_at);`,
+		Down: `ALTER TABLE import_jobs DROP COLUMN updated_at;`,
+	},
+}
+
+// normalizeEmails trims and lower-cases stored author and borrower emails,
+// failing if any would collide.
+func normalizeEmails(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range []string{"authors", "borrowers"} {
+		rows, err := tx.QueryContext(ctx, "SELECT id, email FROM "+table)
+		if err != nil {
+			return fmt.Errorf("find %s: %v", table, err)
+		}
+
+		var stored []database.StoredEmail
+		for rows.Next() {
+			var record database.StoredEmail
+			err := rows.Scan(&record.ID, &record.Email)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("decode %s: %v", table, err)
+			}
+			stored = append(stored, record)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("decode %s: %v", table, err)
+		}
+
+		normalized, err := database.NormalizeStoredEmails(table, stored)
+		if err != nil {
+			return err
+		}
+
+		for id, email := range normalized {
+			_, err := tx.ExecContext(ctx, "UPDATE "+table+" SET email = ? WHERE id = ?", email, id)
+			if err != nil {
+				return fmt.Errorf("normalize %s email: %v", table, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sqlMigrations runs migrations against a SQLite database and records the
+// applied ones in its schema_migrations table. Each migration runs in its
+// own transaction, which holds the write lock throughout.
+type sqlMigrations struct {
+	db         *sql.DB
+	migrations []sqlMigration
+}
+
+func (m *sqlMigrations) Migrations() []database.Migration {
+	migrations := make([]database.Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		migrations = append(migrations, migration.Migration)
+	}
+	return migrations
+}
+
+func (m *sqlMigrations) Applied(ctx context.Context) (map[int]time.Time, error) {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %v", err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("find migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("decode migrations: %v", err)
+		}
+		applied[version] = appliedAt.UTC()
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *sqlMigrations) Apply(ctx context.Context, migration database.Migration) error {
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		// Another process opening the file at the same time may have
+		// applied it while this one waited for the lock
+		var applied bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)", migration.Version).Scan(&applied)
+		if err != nil || applied {
+			return err
+		}
+
+		steps := m.find(migration.Version)
+		if steps.Up != "" {
+			_, err = tx.ExecContext(ctx, steps.Up)
+			if err != nil {
+				return err
+			}
+		}
+		if steps.Data != nil {
+			err = steps.Data(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+			migration.Version, migration.Description, time.Now().UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("record migration: %v", err)
+		}
+
+		return nil
+	})
+}
+
+func (m *sqlMigrations) Revert(ctx context.Context, migration database.Migration) error {
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		if down := m.find(migration.Version).Down; down != "" {
+			_, err := tx.ExecContext(ctx, down)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+		if err != nil {
+			return fmt.Errorf("unrecord migration: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// RebuildIndexes rebuilds every index in the database in place, so the
+// migrations aren't rerun.
+func (m *sqlMigrations) RebuildIndexes(ctx context.Context, applied []database.Migration) error {
+	if len(applied) == 0 {
+		return nil
+	}
+
+	_, err := m.db.ExecContext(ctx, "REINDEX")
+	return err
+}
+
+func (m *sqlMigrations) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return (&service{db: m.db}).inTx(ctx, fn)
+}
+
+func (m *sqlMigrations) find(version int) sqlMigration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	panic(fmt.Sprintf("unknown migration %d", version))
+}
@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+const outboxColumns = "id, type, payload, created_at, attempts, next_attempt_at, last_error, dispatched_at"
+
+// writeOutbox records an event of eventType with data in tx, the transaction
+// making the change it reports.
+func writeOutbox(ctx context.Context, tx *sql.Tx, eventType string, data any) error {
+	event, err := database.NewOutboxEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO outbox (id, type, payload, created_at, next_attempt_at) VALUES (?, ?, ?, ?, ?)",
+		event.ID, event.Type, []byte(event.Payload), event.CreatedAt, event.NextAttemptAt,
+	)
+	if err != nil {
+		return fmt.Errorf("write %s event: %v", eventType, err)
+	}
+
+	return nil
+}
+
+func (s *service) ClaimOutboxEvents(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]database.OutboxEvent, error) {
+	var events []database.OutboxEvent
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			"SELECT "+outboxColumns+" FROM outbox WHERE dispatched_at IS NULL AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?",
+			asOf.UTC(), limit,
+		)
+		if err != nil {
+			return err
+		}
+
+		events, err = scanOutboxEvents(rows)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]database.ID, 0, len(events))
+		for i := range events {
+			events[i].NextAttemptAt = asOf.UTC().Add(lease)
+			ids = append(ids, events[i].ID)
+		}
+
+		list, args := in(ids)
+		_, err = tx.ExecContext(ctx, "UPDATE outbox SET next_attempt_at = ? WHERE id IN "+list, append([]any{asOf.UTC().Add(lease)}, args...)...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox events: %v", err)
+	}
+
+	return events, nil
+}
+
+func (s *service) UpdateOutboxEvent(ctx context.Context, event database.OutboxEvent) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE outbox SET attempts = ?, next_attempt_at = ?, last_error = ?, dispatched_at = ? WHERE id = ?",
+		event.Attempts, event.NextAttemptAt.UTC(), event.LastError, utcOrNil(event.DispatchedAt), event.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update outbox event: %v", err)
+	}
+
+	return nil
+}
+
+func (s *service) PruneOutbox(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM outbox WHERE dispatched_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %v", err)
+	}
+
+	pruned, _ := result.RowsAffected()
+	return int(pruned), nil
+}
+
+func scanOutboxEvents(rows *sql.Rows) ([]database.OutboxEvent, error) {
+	defer rows.Close()
+
+	events := []database.OutboxEvent{}
+	for rows.Next() {
+		var event database.OutboxEvent
+		var payload []byte
+		err := rows.Scan(
+			&event.ID, &event.Type, &payload, &event.CreatedAt, &event.Attempts,
+			&event.NextAttemptAt, &event.LastError, &event.DispatchedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Payload = payload
+		event.CreatedAt = event.CreatedAt.UTC()
+		event.NextAttemptAt = event.NextAttemptAt.UTC()
+		if event.DispatchedAt != nil {
+			dispatchedAt := event.DispatchedAt.UTC()
+			event.DispatchedAt = &dispatchedAt
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
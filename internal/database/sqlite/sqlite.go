@@ -0,0 +1,191 @@
+// Package sqlite stores the library in a local SQLite file, for branches that
+// don't want to run a database server. Importing it registers the "sqlite"
+// driver, selected with DB_DRIVER=sqlite and configured with DB_PATH.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var path = os.Getenv("DB_PATH")
+
+func init() {
+	database.Register("sqlite", database.Driver{
+		Open: func() (database.Service, error) {
+			return Open(path)
+		},
+		Migrations: func() (database.MigrationTarget, error) {
+			db, err := connect(path)
+			if err != nil {
+				return nil, err
+			}
+			return &sqlMigrations{db: db, migrations: migrations}, nil
+		},
+	})
+}
+
+type service struct {
+	db *sql.DB
+}
+
+// Open opens the database file at path, creating it if needed, and applies
+// pending migrations unless DB_MIGRATE_ON_STARTUP is false.
+func Open(path string) (database.Service, error) {
+	db, err := connect(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.MigrateOnStartup(&sqlMigrations{db: db, migrations: migrations})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &service{db: db}, nil
+}
+
+// connect opens path with foreign keys enforced and times written in a
+// format that sorts chronologically. Transactions take the write lock when
+// they begin, so ones that read before writing, like borrowing, can't
+// interleave; others wait for it up to the busy timeout.
+func connect(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("DB_PATH is required for the sqlite driver")
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(10000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_time_format", "sqlite")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %v", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open sqlite: %v", err)
+	}
+
+	return db, nil
+}
+
+func (s *service) Health() map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("db down: %v", err)
+	}
+
+	return map[string]string{
+		"message": "It's healthy",
+	}
+}
+
+// querier is what reads and writes need from either the database or a
+// transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a transaction, committing when it returns nil.
+func (s *service) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// uniqueColumnFields maps the columns SQLite reports for unique violations to
+// the field reported for them, like the Mongo backend's unique indexes.
+var uniqueColumnFields = map[string]string{
+	"authors.email":                      "email",
+	"authors.name, authors.birthday":     "name",
+	"borrowers.email":                    "email",
+	"borrowers.name, borrowers.birthday": "name",
+	"books.isbn":                         "isbn",
+	"books.author_id, books.title":       "title",
+}
+
+// asConflict turns a unique violation from writing resource into a
+// database.ConflictError and returns nil for any other error.
+func asConflict(resource string, err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return nil
+	}
+
+	// The message ends with the constrained columns, such as
+	// "UNIQUE constraint failed: authors.email (2067)"
+	_, columns, _ := strings.Cut(sqliteErr.Error(), "UNIQUE constraint failed: ")
+	columns, _, _ = strings.Cut(columns, " (")
+
+	return &database.ConflictError{
+		Resource: resource,
+		Field:    uniqueColumnFields[columns],
+	}
+}
+
+// checkVersion reports whether the row with id in table exists, returning
+// database.ErrVersionMismatch when it isn't at version.
+func checkVersion(ctx context.Context, tx *sql.Tx, table string, id database.ID, version int64) (bool, error) {
+	var current int64
+	err := tx.QueryRowContext(ctx, "SELECT version FROM "+table+" WHERE id = ?", id).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if current != version {
+		return true, database.ErrVersionMismatch
+	}
+
+	return true, nil
+}
+
+// in returns an IN list with a placeholder for each id, and the ids as
+// arguments. SQLite has no array parameters.
+func in(ids []database.ID) (string, []any) {
+	if len(ids) == 0 {
+		return "(NULL)", nil
+	}
+
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	return "(" + strings.Repeat("?, ", len(ids)-1) + "?)", args
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/conformance"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) database.Service {
+		srv, err := Open(filepath.Join(t.TempDir(), "curly.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { srv.(*service).db.Close() })
+
+		return srv
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	db, err := connect(filepath.Join(t.TempDir(), "curly.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	m := &sqlMigrations{db: db, migrations: migrations}
+
+	err = database.MigrateOnStartup(m)
+	require.NoError(t, err)
+
+	t.Run("should revert every migration", func(t *testing.T) {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			err := m.Revert(ctx, migrations[i].Migration)
+			require.NoError(t, err, "revert migration %d", migrations[i].Version)
+		}
+
+		applied, err := m.Applied(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("should apply every migration once", func(t *testing.T) {
+		for _, migration := range migrations {
+			err := m.Apply(ctx, migration.Migration)
+			require.NoError(t, err, "apply migration %d", migration.Version)
+
+			err = m.Apply(ctx, migration.Migration)
+			require.NoError(t, err, "reapply migration %d", migration.Version)
+		}
+
+		applied, err := m.Applied(ctx)
+		require.NoError(t, err)
+		assert.Len(t, applied, len(migrations))
+	})
+
+	t.Run("should normalize stored emails", func(t *testing.T) {
+		normalize := migrations[11].Migration
+		require.Equal(t, 12, normalize.Version)
+		for i := len(migrations) - 1; i >= 11; i-- {
+			require.NoError(t, m.Revert(ctx, migrations[i].Migration))
+		}
+
+		birthday := time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+		authorID, borrowerID, otherID := database.NewID(), database.NewID(), database.NewID()
+		_, err := db.ExecContext(ctx, "INSERT INTO authors (id, name, birthday, email) VALUES (?, 'Bober', ?, ' Bober@Author.com')", authorID, birthday)
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, "INSERT INTO borrowers (id, name, birthday, email) VALUES (?, 'Bober', ?, 'bober@hotmail.com'), (?, 'Skunk', ?, 'BOBER@hotmail.com')", borrowerID, birthday, otherID, birthday)
+		require.NoError(t, err)
+
+		err = m.Apply(ctx, normalize)
+		assert.ErrorContains(t, err, `"bober@hotmail.com" (`)
+
+		_, err = db.ExecContext(ctx, "UPDATE borrowers SET email = 'skunk@hotmail.com' WHERE id = ?", otherID)
+		require.NoError(t, err)
+		for _, migration := range migrations[11:] {
+			require.NoError(t, m.Apply(ctx, migration.Migration))
+		}
+
+		var email string
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT email FROM authors WHERE id = ?", authorID).Scan(&email))
+		assert.Equal(t, "bober@author.com", email)
+	})
+
+	t.Run("should rebuild indexes", func(t *testing.T) {
+		err := m.RebuildIndexes(ctx, m.Migrations())
+		assert.NoError(t, err)
+	})
+}
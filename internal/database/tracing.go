@@ -0,0 +1,452 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("curly-computing-machine/internal/database")
+
+type tracingService struct {
+	next Service
+}
+
+// NewTracingService wraps a Service so every call runs in its own span.
+func NewTracingService(next Service) Service {
+	return &tracingService{next: next}
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "database."+name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func expandAttributes(expand Expand) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Bool("expand.author", expand.Author),
+		attribute.Bool("expand.borrower", expand.Borrower),
+	}
+}
+
+func (t *tracingService) Health() map[string]string {
+	return t.next.Health()
+}
+
+func (t *tracingService) ListBooks(ctx context.Context, expand Expand) ([]Book, error) {
+	ctx, span := startSpan(ctx, "ListBooks", expandAttributes(expand)...)
+	books, err := t.next.ListBooks(ctx, expand)
+	endSpan(span, err)
+	return books, err
+}
+
+func (t *tracingService) AddBook(ctx context.Context, book BookRequest) (*ID, error) {
+	ctx, span := startSpan(ctx, "AddBook", attribute.String("author.id", book.AuthorID.String()))
+	id, err := t.next.AddBook(ctx, book)
+	endSpan(span, err)
+	return id, err
+}
+
+func (t *tracingService) GetBook(ctx context.Context, bookID ID) (*Book, error) {
+	ctx, span := startSpan(ctx, "GetBook", attribute.String("book.id", bookID.String()))
+	book, err := t.next.GetBook(ctx, bookID)
+	endSpan(span, err)
+	return book, err
+}
+
+func (t *tracingService) GetBookExpanded(ctx context.Context, bookID ID, expand Expand) (*Book, error) {
+	attrs := append(expandAttributes(expand), attribute.String("book.id", bookID.String()))
+	ctx, span := startSpan(ctx, "GetBookExpanded", attrs...)
+	book, err := t.next.GetBookExpanded(ctx, bookID, expand)
+	endSpan(span, err)
+	return book, err
+}
+
+func (t *tracingService) UpdateBook(ctx context.Context, bookID ID, book BookRequest, version int64) (*Book, error) {
+	ctx, span := startSpan(ctx, "UpdateBook", attribute.String("book.id", bookID.String()))
+	updated, err := t.next.UpdateBook(ctx, bookID, book, version)
+	endSpan(span, err)
+	return updated, err
+}
+
+func (t *tracingService) DeleteBook(ctx context.Context, bookID ID, version int64) (bool, error) {
+	ctx, span := startSpan(ctx, "DeleteBook", attribute.String("book.id", bookID.String()))
+	deleted, err := t.next.DeleteBook(ctx, bookID, version)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (t *tracingService) GetBookByISBN(ctx context.Context, isbn string) (*Book, error) {
+	ctx, span := startSpan(ctx, "GetBookByISBN", attribute.String("book.isbn", isbn))
+	book, err := t.next.GetBookByISBN(ctx, isbn)
+	endSpan(span, err)
+	return book, err
+}
+
+func (t *tracingService) BooksByContributor(ctx context.Context, authorID ID, role string) ([]Book, error) {
+	ctx, span := startSpan(ctx, "BooksByContributor", attribute.String("author.id", authorID.String()), attribute.String("contributor.role", role))
+	books, err := t.next.BooksByContributor(ctx, authorID, role)
+	endSpan(span, err)
+	return books, err
+}
+
+func (t *tracingService) BorrowBook(ctx context.Context, bookID ID, borrowerID ID) error {
+	ctx, span := startSpan(ctx, "BorrowBook",
+		attribute.String("book.id", bookID.String()),
+		attribute.String("borrower.id", borrowerID.String()),
+	)
+	err := t.next.BorrowBook(ctx, bookID, borrowerID)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) BorrowBookWithOverride(ctx context.Context, bookID ID, borrowerID ID, override Override) error {
+	ctx, span := startSpan(ctx, "BorrowBookWithOverride",
+		attribute.String("book.id", bookID.String()),
+		attribute.String("borrower.id", borrowerID.String()),
+		attribute.String("override.librarian", override.Librarian),
+	)
+	err := t.next.BorrowBookWithOverride(ctx, bookID, borrowerID, override)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) ReturnBook(ctx context.Context, bookID ID) error {
+	ctx, span := startSpan(ctx, "ReturnBook", attribute.String("book.id", bookID.String()))
+	err := t.next.ReturnBook(ctx, bookID)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) OverdueLoans(ctx context.Context, asOf time.Time) ([]OverdueLoan, error) {
+	ctx, span := startSpan(ctx, "OverdueLoans")
+	loans, err := t.next.OverdueLoans(ctx, asOf)
+	endSpan(span, err)
+	return loans, err
+}
+
+func (t *tracingService) CreateAuthor(ctx context.Context, author AuthorRequest) (*ID, error) {
+	ctx, span := startSpan(ctx, "CreateAuthor")
+	id, err := t.next.CreateAuthor(ctx, author)
+	endSpan(span, err)
+	return id, err
+}
+
+func (t *tracingService) GetAuthor(ctx context.Context, authorID ID) (*Author, error) {
+	ctx, span := startSpan(ctx, "GetAuthor", attribute.String("author.id", authorID.String()))
+	author, err := t.next.GetAuthor(ctx, authorID)
+	endSpan(span, err)
+	return author, err
+}
+
+func (t *tracingService) UpdateAuthor(ctx context.Context, authorID ID, author AuthorRequest, version int64) (*Author, error) {
+	ctx, span := startSpan(ctx, "UpdateAuthor", attribute.String("author.id", authorID.String()))
+	updated, err := t.next.UpdateAuthor(ctx, authorID, author, version)
+	endSpan(span, err)
+	return updated, err
+}
+
+func (t *tracingService) DeleteAuthor(ctx context.Context, authorID ID, version int64) (bool, error) {
+	ctx, span := startSpan(ctx, "DeleteAuthor", attribute.String("author.id", authorID.String()))
+	deleted, err := t.next.DeleteAuthor(ctx, authorID, version)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (t *tracingService) FindAuthorByEmail(ctx context.Context, email string) (*Author, error) {
+	ctx, span := startSpan(ctx, "FindAuthorByEmail")
+	author, err := t.next.FindAuthorByEmail(ctx, email)
+	endSpan(span, err)
+	return author, err
+}
+
+func (t *tracingService) FindAuthorByName(ctx context.Context, name string) (*Author, error) {
+	ctx, span := startSpan(ctx, "FindAuthorByName")
+	author, err := t.next.FindAuthorByName(ctx, name)
+	endSpan(span, err)
+	return author, err
+}
+
+func (t *tracingService) CreateBorrower(ctx context.Context, borrower BorrowerRequest) (*ID, error) {
+	ctx, span := startSpan(ctx, "CreateBorrower")
+	id, err := t.next.CreateBorrower(ctx, borrower)
+	endSpan(span, err)
+	return id, err
+}
+
+func (t *tracingService) GetBorrower(ctx context.Context, borrowerID ID) (*Borrower, error) {
+	ctx, span := startSpan(ctx, "GetBorrower", attribute.String("borrower.id", borrowerID.String()))
+	borrower, err := t.next.GetBorrower(ctx, borrowerID)
+	endSpan(span, err)
+	return borrower, err
+}
+
+func (t *tracingService) UpdateBorrower(ctx context.Context, borrowerID ID, borrower BorrowerRequest, version int64) (*Borrower, error) {
+	ctx, span := startSpan(ctx, "UpdateBorrower", attribute.String("borrower.id", borrowerID.String()))
+	updated, err := t.next.UpdateBorrower(ctx, borrowerID, borrower, version)
+	endSpan(span, err)
+	return updated, err
+}
+
+func (t *tracingService) DeleteBorrower(ctx context.Context, borrowerID ID, version int64) (bool, error) {
+	ctx, span := startSpan(ctx, "DeleteBorrower", attribute.String("borrower.id", borrowerID.String()))
+	deleted, err := t.next.DeleteBorrower(ctx, borrowerID, version)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (t *tracingService) VerifyBorrower(ctx context.Context, borrowerID ID, email string) (*Borrower, error) {
+	ctx, span := startSpan(ctx, "VerifyBorrower", attribute.String("borrower.id", borrowerID.String()))
+	borrower, err := t.next.VerifyBorrower(ctx, borrowerID, email)
+	span.SetAttributes(attribute.Bool("borrower.verified", borrower != nil))
+	endSpan(span, err)
+	return borrower, err
+}
+
+func (t *tracingService) BorrowedBooks(ctx context.Context, borrowerID ID, expand Expand) ([]Book, error) {
+	attrs := append(expandAttributes(expand), attribute.String("borrower.id", borrowerID.String()))
+	ctx, span := startSpan(ctx, "BorrowedBooks", attrs...)
+	books, err := t.next.BorrowedBooks(ctx, borrowerID, expand)
+	endSpan(span, err)
+	return books, err
+}
+
+func (t *tracingService) ListChildren(ctx context.Context, guardianID ID) ([]Borrower, error) {
+	ctx, span := startSpan(ctx, "ListChildren", attribute.String("borrower.id", guardianID.String()))
+	children, err := t.next.ListChildren(ctx, guardianID)
+	span.SetAttributes(attribute.Int("children", len(children)))
+	endSpan(span, err)
+	return children, err
+}
+
+func (t *tracingService) ListAgeOverrides(ctx context.Context, borrowerID ID) ([]AgeOverride, error) {
+	ctx, span := startSpan(ctx, "ListAgeOverrides", attribute.String("borrower.id", borrowerID.String()))
+	overrides, err := t.next.ListAgeOverrides(ctx, borrowerID)
+	span.SetAttributes(attribute.Int("age_overrides", len(overrides)))
+	endSpan(span, err)
+	return overrides, err
+}
+
+func (t *tracingService) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*IdempotencyRecord, error) {
+	ctx, span := startSpan(ctx, "ReserveIdempotencyKey")
+	record, err := t.next.ReserveIdempotencyKey(ctx, key, requestHash)
+	endSpan(span, err)
+	return record, err
+}
+
+func (t *tracingService) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error {
+	ctx, span := startSpan(ctx, "CompleteIdempotencyKey")
+	err := t.next.CompleteIdempotencyKey(ctx, key, statusCode, contentType, body, ttl)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, span := startSpan(ctx, "ReleaseIdempotencyKey")
+	err := t.next.ReleaseIdempotencyKey(ctx, key)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) CreateImportJob(ctx context.Context, kind string, total int) (*ID, error) {
+	ctx, span := startSpan(ctx, "CreateImportJob", attribute.String("import.kind", kind), attribute.Int("import.total", total))
+	id, err := t.next.CreateImportJob(ctx, kind, total)
+	endSpan(span, err)
+	return id, err
+}
+
+func (t *tracingService) RecordImportRow(ctx context.Context, jobID ID, result ImportRowResult) error {
+	ctx, span := startSpan(ctx, "RecordImportRow", attribute.String("import.id", jobID.String()))
+	err := t.next.RecordImportRow(ctx, jobID, result)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) FinishImportJob(ctx context.Context, jobID ID, jobErr string) error {
+	ctx, span := startSpan(ctx, "FinishImportJob", attribute.String("import.id", jobID.String()))
+	err := t.next.FinishImportJob(ctx, jobID, jobErr)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) InterruptImportJobs(ctx context.Context, idleSince time.Time) (int, error) {
+	ctx, span := startSpan(ctx, "InterruptImportJobs")
+	n, err := t.next.InterruptImportJobs(ctx, idleSince)
+	endSpan(span, err)
+	return n, err
+}
+
+func (t *tracingService) GetImportJob(ctx context.Context, jobID ID) (*ImportJob, error) {
+	ctx, span := startSpan(ctx, "GetImportJob", attribute.String("import.id", jobID.String()))
+	job, err := t.next.GetImportJob(ctx, jobID)
+	endSpan(span, err)
+	return job, err
+}
+
+func (t *tracingService) SetBookCover(ctx context.Context, bookID ID, cover CoverUpload, version int64) (*Book, error) {
+	ctx, span := startSpan(ctx, "SetBookCover",
+		attribute.String("book.id", bookID.String()),
+		attribute.String("cover.content_type", cover.ContentType),
+		attribute.Int("cover.size", len(cover.Image)),
+	)
+	book, err := t.next.SetBookCover(ctx, bookID, cover, version)
+	endSpan(span, err)
+	return book, err
+}
+
+func (t *tracingService) GetBookCover(ctx context.Context, bookID ID, thumbnail bool) (*CoverFile, error) {
+	ctx, span := startSpan(ctx, "GetBookCover", attribute.String("book.id", bookID.String()), attribute.Bool("cover.thumbnail", thumbnail))
+	file, err := t.next.GetBookCover(ctx, bookID, thumbnail)
+	endSpan(span, err)
+	return file, err
+}
+
+func (t *tracingService) CheckIntegrity(ctx context.Context) ([]IntegrityProblem, error) {
+	ctx, span := startSpan(ctx, "CheckIntegrity")
+	problems, err := t.next.CheckIntegrity(ctx)
+	endSpan(span, err)
+	return problems, err
+}
+
+func (t *tracingService) CreateWebhook(ctx context.Context, webhook WebhookRequest) (*ID, error) {
+	ctx, span := startSpan(ctx, "CreateWebhook", attribute.StringSlice("webhook.events", webhook.Events))
+	id, err := t.next.CreateWebhook(ctx, webhook)
+	endSpan(span, err)
+	return id, err
+}
+
+func (t *tracingService) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	ctx, span := startSpan(ctx, "ListWebhooks")
+	webhooks, err := t.next.ListWebhooks(ctx)
+	endSpan(span, err)
+	return webhooks, err
+}
+
+func (t *tracingService) GetWebhook(ctx context.Context, webhookID ID) (*Webhook, error) {
+	ctx, span := startSpan(ctx, "GetWebhook", attribute.String("webhook.id", webhookID.String()))
+	webhook, err := t.next.GetWebhook(ctx, webhookID)
+	endSpan(span, err)
+	return webhook, err
+}
+
+func (t *tracingService) DeleteWebhook(ctx context.Context, webhookID ID) (bool, error) {
+	ctx, span := startSpan(ctx, "DeleteWebhook", attribute.String("webhook.id", webhookID.String()))
+	deleted, err := t.next.DeleteWebhook(ctx, webhookID)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (t *tracingService) QueueWebhookDeliveries(ctx context.Context, event WebhookEvent) (int, error) {
+	ctx, span := startSpan(ctx, "QueueWebhookDeliveries", attribute.String("event.id", event.ID), attribute.String("event.type", event.Type))
+	queued, err := t.next.QueueWebhookDeliveries(ctx, event)
+	span.SetAttributes(attribute.Int("webhook.deliveries", queued))
+	endSpan(span, err)
+	return queued, err
+}
+
+func (t *tracingService) ClaimWebhookDeliveries(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "ClaimWebhookDeliveries", attribute.Int("limit", limit))
+	deliveries, err := t.next.ClaimWebhookDeliveries(ctx, asOf, lease, limit)
+	span.SetAttributes(attribute.Int("webhook.deliveries", len(deliveries)))
+	endSpan(span, err)
+	return deliveries, err
+}
+
+func (t *tracingService) UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	ctx, span := startSpan(ctx, "UpdateWebhookDelivery", attribute.String("delivery.id", delivery.ID.String()), attribute.String("delivery.status", delivery.Status))
+	err := t.next.UpdateWebhookDelivery(ctx, delivery)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) GetWebhookDelivery(ctx context.Context, deliveryID ID) (*WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "GetWebhookDelivery", attribute.String("delivery.id", deliveryID.String()))
+	delivery, err := t.next.GetWebhookDelivery(ctx, deliveryID)
+	endSpan(span, err)
+	return delivery, err
+}
+
+func (t *tracingService) ListWebhookDeliveries(ctx context.Context, status string) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "ListWebhookDeliveries", attribute.String("delivery.status", status))
+	deliveries, err := t.next.ListWebhookDeliveries(ctx, status)
+	endSpan(span, err)
+	return deliveries, err
+}
+
+func (t *tracingService) ClaimOutboxEvents(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	ctx, span := startSpan(ctx, "ClaimOutboxEvents", attribute.Int("limit", limit))
+	events, err := t.next.ClaimOutboxEvents(ctx, asOf, lease, limit)
+	span.SetAttributes(attribute.Int("outbox.events", len(events)))
+	endSpan(span, err)
+	return events, err
+}
+
+func (t *tracingService) UpdateOutboxEvent(ctx context.Context, event OutboxEvent) error {
+	ctx, span := startSpan(ctx, "UpdateOutboxEvent", attribute.String("event.id", event.ID.String()), attribute.String("event.type", event.Type))
+	err := t.next.UpdateOutboxEvent(ctx, event)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) PruneOutbox(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := startSpan(ctx, "PruneOutbox")
+	pruned, err := t.next.PruneOutbox(ctx, before)
+	span.SetAttributes(attribute.Int("outbox.pruned", pruned))
+	endSpan(span, err)
+	return pruned, err
+}
+
+func (t *tracingService) GetNotificationPreferences(ctx context.Context, borrowerID ID) (*NotificationPreferences, error) {
+	ctx, span := startSpan(ctx, "GetNotificationPreferences", attribute.String("borrower.id", borrowerID.String()))
+	prefs, err := t.next.GetNotificationPreferences(ctx, borrowerID)
+	endSpan(span, err)
+	return prefs, err
+}
+
+func (t *tracingService) SetNotificationPreferences(ctx context.Context, borrowerID ID, prefs NotificationPreferences) error {
+	ctx, span := startSpan(ctx, "SetNotificationPreferences", attribute.String("borrower.id", borrowerID.String()))
+	err := t.next.SetNotificationPreferences(ctx, borrowerID, prefs)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) ReserveNotification(ctx context.Context, notification Notification, maxAttempts int) (bool, error) {
+	ctx, span := startSpan(ctx, "ReserveNotification",
+		attribute.String("borrower.id", notification.BorrowerID.String()),
+		attribute.String("notification.kind", notification.Kind),
+	)
+	reserved, err := t.next.ReserveNotification(ctx, notification, maxAttempts)
+	span.SetAttributes(attribute.Bool("notification.reserved", reserved))
+	endSpan(span, err)
+	return reserved, err
+}
+
+func (t *tracingService) UpdateNotification(ctx context.Context, notification Notification) error {
+	ctx, span := startSpan(ctx, "UpdateNotification",
+		attribute.String("borrower.id", notification.BorrowerID.String()),
+		attribute.String("notification.kind", notification.Kind),
+		attribute.String("notification.status", notification.Status),
+	)
+	err := t.next.UpdateNotification(ctx, notification)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingService) ListNotifications(ctx context.Context, borrowerID ID) ([]Notification, error) {
+	ctx, span := startSpan(ctx, "ListNotifications", attribute.String("borrower.id", borrowerID.String()))
+	notifications, err := t.next.ListNotifications(ctx, borrowerID)
+	span.SetAttributes(attribute.Int("notifications", len(notifications)))
+	endSpan(span, err)
+	return notifications, err
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Event types webhooks can subscribe to besides the book events.
+const (
+	LoanOverdue     = "loan.overdue"
+	BorrowerCreated = "borrower.created"
+)
+
+// WebhookEventTypes are the event types webhooks can subscribe to.
+var WebhookEventTypes = []string{BookCreated, BookBorrowed, BookReturned, LoanOverdue, BorrowerCreated}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead deliveries ran out of attempts. They stay in the
+	// dead-letter list until they're redelivered.
+	DeliveryDead = "dead"
+)
+
+// Webhook is a subscription to have events POSTed to URL.
+type Webhook struct {
+	ID  ID     `json:"id" bson:"_id"`
+	URL string `json:"url" bson:"url"`
+	// Secret signs the payloads; it's never shown after the webhook is
+	// created.
+	Secret    string    `json:"-" bson:"secret"`
+	Events    []string  `json:"events" bson:"events"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+func (w *Webhook) Render(rw http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// minSecretLength keeps secrets long enough that signatures can't be forged
+// by guessing them.
+const minSecretLength = 16
+
+// AllowPrivateWebhooks lets webhooks reach loopback, link-local and private
+// addresses. It's off unless WEBHOOK_ALLOW_PRIVATE is "true", so registering
+// a webhook can't be used to make the server POST to itself or its network.
+var AllowPrivateWebhooks = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+
+// WebhookAddressAllowed reports whether webhooks may be delivered to ip.
+func WebhookAddressAllowed(ip netip.Addr) bool {
+	if AllowPrivateWebhooks {
+		return true
+	}
+
+	ip = ip.Unmap()
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+func (w *WebhookRequest) Bind(r *http.Request) error {
+	target, err := url.Parse(w.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if !webhookHostAllowed(r.Context(), target.Hostname()) {
+		return fmt.Errorf("url must not point to a loopback, link-local or private address")
+	}
+
+	if len(w.Secret) < minSecretLength {
+		return fmt.Errorf("secret must be at least %d characters", minSecretLength)
+	}
+
+	if len(w.Events) == 0 {
+		return fmt.Errorf("events is required")
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(WebhookEventTypes, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	slices.Sort(w.Events)
+	w.Events = slices.Compact(w.Events)
+
+	return nil
+}
+
+// webhookHostAllowed checks the addresses host resolves to now. They can
+// change later, so the worker checks the address it dials too; hosts that
+// don't resolve yet are left to it.
+func webhookHostAllowed(ctx context.Context, host string) bool {
+	if AllowPrivateWebhooks {
+		return true
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return false
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return WebhookAddressAllowed(ip)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return true
+	}
+	for _, addr := range addrs {
+		if !WebhookAddressAllowed(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookEvent is something webhooks subscribed to its type are told about.
+type WebhookEvent struct {
+	// ID identifies the event. It's queued for each webhook at most once, so
+	// events found again, like a loan that's still overdue, aren't resent.
+	ID      string
+	Type    string
+	Payload json.RawMessage
+}
+
+// WebhookDelivery is an event on its way to one webhook.
+type WebhookDelivery struct {
+	ID            ID              `json:"id" bson:"_id"`
+	WebhookID     ID              `json:"webhook_id" bson:"webhook_id"`
+	EventID       string          `json:"event_id" bson:"event_id"`
+	EventType     string          `json:"event_type" bson:"event_type"`
+	Payload       json.RawMessage `json:"payload" bson:"payload"`
+	Status        string          `json:"status" bson:"status"`
+	Attempts      int             `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at" bson:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+func (d *WebhookDelivery) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewWebhookDelivery is the first attempt to deliver event to webhookID, due
+// at once.
+func NewWebhookDelivery(webhookID ID, event WebhookEvent) WebhookDelivery {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return WebhookDelivery{
+		ID:            NewID(),
+		WebhookID:     webhookID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Payload:       event.Payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+func (s *service) CreateWebhook(ctx context.Context, webhook WebhookRequest) (*ID, error) {
+	newWebhook := Webhook{
+		ID:        NewID(),
+		URL:       webhook.URL,
+		Secret:    webhook.Secret,
+		Events:    webhook.Events,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	_, err := s.webhooksColl.InsertOne(ctx, newWebhook)
+	if err != nil {
+		return nil, fmt.Errorf("create webhook: %v", err)
+	}
+
+	return &newWebhook.ID, nil
+}
+
+func (s *service) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	curs, err := s.webhooksColl.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("find webhooks: %v", err)
+	}
+
+	webhooks := []Webhook{}
+	err = curs.All(ctx, &webhooks)
+	if err != nil {
+		return nil, fmt.Errorf("decode webhooks: %v", err)
+	}
+
+	return webhooks, nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, webhookID ID) (*Webhook, error) {
+	var webhook Webhook
+	err := s.webhooksColl.FindOne(ctx, bson.M{"_id": webhookID}).Decode(&webhook)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get webhook: %v", err)
+	}
+
+	return &webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (s *service) DeleteWebhook(ctx context.Context, webhookID ID) (bool, error) {
+	result, err := s.webhooksColl.DeleteOne(ctx, bson.M{"_id": webhookID})
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %v", err)
+	}
+
+	_, err = s.webhookDeliveriesColl.DeleteMany(ctx, bson.M{"webhook_id": webhookID})
+	if err != nil {
+		return false, fmt.Errorf("delete webhook deliveries: %v", err)
+	}
+
+	return result.DeletedCount == 1, nil
+}
+
+// QueueWebhookDeliveries queues event for every webhook subscribed to its
+// type that hasn't had it queued already, and returns how many it queued.
+func (s *service) QueueWebhookDeliveries(ctx context.Context, event WebhookEvent) (int, error) {
+	curs, err := s.webhooksColl.Find(ctx, bson.M{"events": event.Type})
+	if err != nil {
+		return 0, fmt.Errorf("find webhooks: %v", err)
+	}
+
+	var webhooks []Webhook
+	err = curs.All(ctx, &webhooks)
+	if err != nil {
+		return 0, fmt.Errorf("decode webhooks: %v", err)
+	}
+
+	queued := 0
+	for _, webhook := range webhooks {
+		_, err := s.webhookDeliveriesColl.InsertOne(ctx, NewWebhookDelivery(webhook.ID, event))
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return queued, fmt.Errorf("queue webhook delivery: %v", err)
+		}
+		queued++
+	}
+
+	return queued, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due by asOf,
+// earliest first, and puts their next attempt off by lease so no other
+// worker takes them meanwhile.
+func (s *service) ClaimWebhookDeliveries(ctx context.Context, asOf time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	filter := bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": asOf}}
+	update := bson.M{"$set": bson.M{"next_attempt_at": asOf.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{bson.E{Key: "next_attempt_at", Value: 1}, bson.E{Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	deliveries := []WebhookDelivery{}
+	for len(deliveries) < limit {
+		var delivery WebhookDelivery
+		err := s.webhookDeliveriesColl.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("claim webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery saves the outcome of an attempt: its status,
+// attempts, next attempt, last error and when it was delivered.
+func (s *service) UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"last_error":      delivery.LastError,
+			"delivered_at":    delivery.DeliveredAt,
+		},
+	}
+
+	_, err := s.webhookDeliveriesColl.UpdateByID(ctx, delivery.ID, update)
+	if err != nil {
+		return fmt.Errorf("update webhook delivery: %v", err)
+	}
+
+	return nil
+}
+
+func (s *service) GetWebhookDelivery(ctx context.Context, deliveryID ID) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := s.webhookDeliveriesColl.FindOne(ctx, bson.M{"_id": deliveryID}).Decode(&delivery)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get webhook delivery: %v", err)
+	}
+
+	return &delivery, nil
+}
+
+// ListWebhookDeliveries lists deliveries with status, or all of them when
+// it's empty, newest first.
+func (s *service) ListWebhookDeliveries(ctx context.Context, status string) ([]WebhookDelivery, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	curs, err := s.webhookDeliveriesColl.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("find webhook deliveries: %v", err)
+	}
+
+	deliveries := []WebhookDelivery{}
+	err = curs.All(ctx, &deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("decode webhook deliveries: %v", err)
+	}
+
+	return deliveries, nil
+}
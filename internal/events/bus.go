@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it's dropped. Dropped subscribers' channels are closed, so clients
+// reconnect and resume from the history.
+const subscriberBuffer = 64
+
+// Bus hands published events to the subscribers of one process, and keeps
+// the latest ones so subscribers can resume. Event IDs are a sequence number
+// prefixed with when the Bus was created, so IDs from before a restart
+// aren't mistaken for new ones.
+type Bus struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	size        int
+	history     []database.BookEvent
+	subscribers map[chan database.BookEvent]struct{}
+}
+
+// NewBus returns a Bus keeping the last history events.
+func NewBus(history int) *Bus {
+	return &Bus{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:        history,
+		subscribers: map[chan database.BookEvent]struct{}{},
+	}
+}
+
+// Publish numbers event and sends it to every subscriber.
+func (b *Bus) Publish(event database.BookEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.ID = fmt.Sprintf("%s-%d", b.epoch, b.seq)
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			b.drop(subscriber)
+		}
+	}
+}
+
+// WatchBooks subscribes to events until ctx is done, starting after the
+// event with ID after if it's set.
+func (b *Bus) WatchBooks(ctx context.Context, after string) (<-chan database.BookEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	missed, err := b.since(after)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber := make(chan database.BookEvent, len(missed)+subscriberBuffer)
+	for _, event := range missed {
+		subscriber <- event
+	}
+	b.subscribers[subscriber] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(subscriber)
+	}()
+
+	return subscriber, nil
+}
+
+// since returns the events in the history after the one with ID after.
+func (b *Bus) since(after string) ([]database.BookEvent, error) {
+	if after == "" {
+		return nil, nil
+	}
+
+	seq, ok := b.parseID(after)
+	if !ok || seq > b.seq {
+		return nil, database.ErrCannotResume
+	}
+
+	// The history holds events b.seq-len(b.history)+1 to b.seq
+	missed := b.seq - seq
+	if missed > uint64(len(b.history)) {
+		return nil, database.ErrCannotResume
+	}
+
+	return append([]database.BookEvent(nil), b.history[uint64(len(b.history))-missed:]...), nil
+}
+
+// parseID returns the sequence number of an event ID this Bus handed out.
+func (b *Bus) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+
+	parsed, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return parsed, true
+}
+
+// drop unsubscribes subscriber if it's still subscribed. b.mu must be held.
+func (b *Bus) drop(subscriber chan database.BookEvent) {
+	if _, ok := b.subscribers[subscriber]; !ok {
+		return
+	}
+	delete(b.subscribers, subscriber)
+	close(subscriber)
+}
@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive returns the next n events from events, failing if they don't come.
+func receive(t *testing.T, events <-chan database.BookEvent, n int) []database.BookEvent {
+	t.Helper()
+
+	received := make([]database.BookEvent, 0, n)
+	for len(received) < n {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "events closed")
+			received = append(received, event)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for events")
+		}
+	}
+	return received
+}
+
+func publishN(bus *Bus, n int) {
+	for i := 0; i < n; i++ {
+		bus.Publish(database.BookEvent{Type: database.BookUpdated, BookID: database.NewID()})
+	}
+}
+
+func TestBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("should send published events to every subscriber", func(t *testing.T) {
+		bus := NewBus(10)
+		first, err := bus.WatchBooks(ctx, "")
+		require.NoError(t, err)
+		second, err := bus.WatchBooks(ctx, "")
+		require.NoError(t, err)
+
+		bookID := database.NewID()
+		bus.Publish(database.BookEvent{Type: database.BookBorrowed, BookID: bookID})
+
+		for _, events := range []<-chan database.BookEvent{first, second} {
+			event := receive(t, events, 1)[0]
+			assert.Equal(t, database.BookBorrowed, event.Type)
+			assert.Equal(t, bookID, event.BookID)
+			assert.NotEmpty(t, event.ID)
+			assert.False(t, event.Time.IsZero())
+		}
+	})
+
+	t.Run("should resume after an event in the history", func(t *testing.T) {
+		bus := NewBus(10)
+		events, err := bus.WatchBooks(ctx, "")
+		require.NoError(t, err)
+		publishN(bus, 5)
+		published := receive(t, events, 5)
+
+		resumed, err := bus.WatchBooks(ctx, published[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, published[2:], receive(t, resumed, 3))
+
+		resumed, err = bus.WatchBooks(ctx, published[4].ID)
+		require.NoError(t, err)
+		assert.Empty(t, resumed)
+	})
+
+	t.Run("should stop sending when the context is done", func(t *testing.T) {
+		bus := NewBus(10)
+		ctx, cancel := context.WithCancel(ctx)
+		events, err := bus.WatchBooks(ctx, "")
+		require.NoError(t, err)
+
+		cancel()
+		_, ok := <-events
+		assert.False(t, ok)
+		publishN(bus, 1)
+	})
+
+	t.Run("should drop subscribers that fall behind", func(t *testing.T) {
+		bus := NewBus(10)
+		events, err := bus.WatchBooks(ctx, "")
+		require.NoError(t, err)
+
+		publishN(bus, subscriberBuffer+1)
+		receive(t, events, subscriberBuffer)
+		_, ok := <-events
+		assert.False(t, ok)
+	})
+
+	other := NewBus(10)
+	publishN(other, 1)
+	otherEvents, err := other.WatchBooks(ctx, "")
+	require.NoError(t, err)
+	publishN(other, 1)
+	fromOtherBus := receive(t, otherEvents, 1)[0].ID
+
+	testcases := []struct {
+		name  string
+		after string
+	}{
+		{name: "an event older than the history", after: "first"},
+		{name: "an event that hasn't happened", after: "future"},
+		{name: "an event from another bus", after: fromOtherBus},
+		{name: "an invalid ID", after: "bober"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should not resume after "+testcase.name, func(t *testing.T) {
+			bus := NewBus(2)
+			events, err := bus.WatchBooks(ctx, "")
+			require.NoError(t, err)
+			publishN(bus, 4)
+			published := receive(t, events, 4)
+
+			after := testcase.after
+			switch after {
+			case "first":
+				after = published[0].ID
+			case "future":
+				after = published[3].ID[:len(published[3].ID)-1] + "9"
+			}
+
+			_, err = bus.WatchBooks(ctx, after)
+			assert.ErrorIs(t, err, database.ErrCannotResume)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Package events reports changes to books as they happen. When the backend
+// can watch for changes itself (MongoDB change streams, on a replica set),
+// those are used, so changes made by other API instances or curlyctl show up
+// too. Otherwise writes made through this process are published on an
+// in-process Bus.
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// DefaultHistory is how many events a Bus keeps for clients resuming after
+// a disconnect.
+const DefaultHistory = 1000
+
+// New returns next, wrapped to publish its writes if needed, and what to
+// watch for book events.
+func New(next database.Service) (database.Service, database.BookWatcher) {
+	if watcher, ok := next.(database.BookWatcher); ok {
+		// Change streams fail to open on a standalone server
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := watcher.WatchBooks(ctx, "")
+		cancel()
+		if err == nil {
+			return next, watcher
+		}
+		log.Printf("events: can't watch for changes, publishing them in process: %v", err)
+	}
+
+	bus := NewBus(DefaultHistory)
+	return NewService(next, bus), bus
+}
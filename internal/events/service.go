@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"log"
+
+	"curly-computing-machine/internal/database"
+)
+
+// service publishes the book writes made through the Service it embeds.
+type service struct {
+	database.Service
+
+	bus *Bus
+}
+
+// NewService wraps next so its successful writes to books are published on
+// bus.
+func NewService(next database.Service, bus *Bus) database.Service {
+	return &service{Service: next, bus: bus}
+}
+
+func (s *service) AddBook(ctx context.Context, book database.BookRequest) (*database.ID, error) {
+	id, err := s.Service.AddBook(ctx, book)
+	if err == nil {
+		s.publish(ctx, database.BookCreated, *id, nil)
+	}
+	return id, err
+}
+
+func (s *service) UpdateBook(ctx context.Context, bookID database.ID, book database.BookRequest, version int64) (*database.Book, error) {
+	updated, err := s.Service.UpdateBook(ctx, bookID, book, version)
+	if err == nil && updated != nil {
+		s.publish(ctx, database.BookUpdated, bookID, updated)
+	}
+	return updated, err
+}
+
+func (s *service) DeleteBook(ctx context.Context, bookID database.ID, version int64) (bool, error) {
+	deleted, err := s.Service.DeleteBook(ctx, bookID, version)
+	if err == nil && deleted {
+		s.publish(ctx, database.BookDeleted, bookID, nil)
+	}
+	return deleted, err
+}
+
+func (s *service) BorrowBook(ctx context.Context, bookID database.ID, borrowerID database.ID) error {
+	err := s.Service.BorrowBook(ctx, bookID, borrowerID)
+	if err == nil {
+		s.publish(ctx, database.BookBorrowed, bookID, nil)
+	}
+	return err
+}
+
+func (s *service) BorrowBookWithOverride(ctx context.Context, bookID database.ID, borrowerID database.ID, override database.Override) error {
+	err := s.Service.BorrowBookWithOverride(ctx, bookID, borrowerID, override)
+	if err == nil {
+		s.publish(ctx, database.BookBorrowed, bookID, nil)
+	}
+	return err
+}
+
+func (s *service) ReturnBook(ctx context.Context, bookID database.ID) error {
+	err := s.Service.ReturnBook(ctx, bookID)
+	if err == nil {
+		s.publish(ctx, database.BookReturned, bookID, nil)
+	}
+	return err
+}
+
+func (s *service) SetBookCover(ctx context.Context, bookID database.ID, cover database.CoverUpload, version int64) (*database.Book, error) {
+	book, err := s.Service.SetBookCover(ctx, bookID, cover, version)
+	if err == nil && book != nil {
+		s.publish(ctx, database.BookUpdated, bookID, book)
+	}
+	return book, err
+}
+
+// publish sends an event for the book, reading it first if the write didn't
+// return it. The write has already happened, so a failed read only leaves
+// the book out of the event.
+func (s *service) publish(ctx context.Context, eventType string, bookID database.ID, book *database.Book) {
+	if book == nil && eventType != database.BookDeleted {
+		var err error
+		book, err = s.Service.GetBook(context.WithoutCancel(ctx), bookID)
+		if err != nil {
+			log.Printf("events: get book %s: %v", bookID.String(), err)
+		}
+	}
+
+	s.bus.Publish(database.BookEvent{Type: eventType, BookID: bookID, Book: book})
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	next := memory.New()
+
+	srv, watcher := New(next)
+
+	assert.IsType(t, &Bus{}, watcher)
+	assert.IsType(t, &service{}, srv)
+}
+
+func TestService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := NewBus(DefaultHistory)
+	srv := NewService(memory.New(), bus)
+	events, err := bus.WatchBooks(ctx, "")
+	require.NoError(t, err)
+
+	birthday := time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+	authorID, err := srv.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "bober@author.com"})
+	require.NoError(t, err)
+	borrowerID, err := srv.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "bober@hotmail.com"})
+	require.NoError(t, err)
+	_, err = srv.VerifyBorrower(ctx, *borrowerID, "bober@hotmail.com")
+	require.NoError(t, err)
+
+	bookID, err := srv.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+
+	testcases := []struct {
+		name      string
+		write     func() error
+		eventType string
+		check     func(t *testing.T, book *database.Book)
+	}{
+		{
+			name:      "adding",
+			write:     func() error { return nil },
+			eventType: database.BookCreated,
+			check: func(t *testing.T, book *database.Book) {
+				assert.Equal(t, "Hobbit", book.Title)
+			},
+		},
+		{
+			name: "updating",
+			write: func() error {
+				_, err := srv.UpdateBook(ctx, *bookID, database.BookRequest{Title: "The Hobbit", AuthorID: *authorID, Available: true}, 1)
+				return err
+			},
+			eventType: database.BookUpdated,
+			check: func(t *testing.T, book *database.Book) {
+				assert.Equal(t, "The Hobbit", book.Title)
+			},
+		},
+		{
+			name:      "borrowing",
+			write:     func() error { return srv.BorrowBook(ctx, *bookID, *borrowerID) },
+			eventType: database.BookBorrowed,
+			check: func(t *testing.T, book *database.Book) {
+				assert.False(t, book.Available)
+			},
+		},
+		{
+			name:      "returning",
+			write:     func() error { return srv.ReturnBook(ctx, *bookID) },
+			eventType: database.BookReturned,
+			check: func(t *testing.T, book *database.Book) {
+				assert.True(t, book.Available)
+			},
+		},
+		{
+			name: "uploading a cover",
+			write: func() error {
+				book, err := srv.GetBook(ctx, *bookID)
+				if err != nil {
+					return err
+				}
+				_, err = srv.SetBookCover(ctx, *bookID, database.CoverUpload{ContentType: "image/png", Image: []byte("cover")}, book.Version)
+				return err
+			},
+			eventType: database.BookUpdated,
+			check: func(t *testing.T, book *database.Book) {
+				assert.NotNil(t, book.Cover)
+			},
+		},
+		{
+			name: "deleting",
+			write: func() error {
+				_, err := srv.DeleteBook(ctx, *bookID, 5)
+				return err
+			},
+			eventType: database.BookDeleted,
+			check: func(t *testing.T, book *database.Book) {
+				assert.Nil(t, book)
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should publish "+testcase.name+" a book", func(t *testing.T) {
+			require.NoError(t, testcase.write())
+
+			event := receive(t, events, 1)[0]
+			assert.Equal(t, testcase.eventType, event.Type)
+			assert.Equal(t, *bookID, event.BookID)
+			testcase.check(t, event.Book)
+		})
+	}
+
+	t.Run("should not publish failed writes", func(t *testing.T) {
+		err := srv.ReturnBook(ctx, *bookID)
+		assert.Error(t, err)
+		err = srv.BorrowBook(ctx, database.NewID(), *borrowerID)
+		assert.Error(t, err)
+
+		assert.Empty(t, events)
+	})
+}
@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var requiredCSVColumns = []string{"title", "author_email"}
+
+// ReadBooksCSV parses a CSV with a header row naming its columns: title, isbn,
+// description, author_name, author_email, author_birthday and genres. Genres
+// are separated by semicolons. Only title and author_email are
+// required columns; unknown columns are ignored. Rows that can't be parsed
+// are returned with Err set so they can be reported individually.
+func ReadBooksCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("csv is empty")
+		}
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[strings.ReplaceAll(name, " ", "_")] = i
+	}
+
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv is missing the %s column", name)
+		}
+	}
+
+	rows := []Row{}
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("read csv: %w", err)
+			}
+			rows = append(rows, Row{Line: parseErr.StartLine, Err: err})
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+
+		record, err := bookRecord(field)
+		rows = append(rows, Row{Line: line, Record: record, Err: err})
+	}
+
+	return rows, nil
+}
+
+func bookRecord(field func(name string) string) (BookRecord, error) {
+	record := BookRecord{
+		Title:       field("title"),
+		ISBN:        field("isbn"),
+		Description: field("description"),
+		AuthorName:  field("author_name"),
+		AuthorEmail: field("author_email"),
+		Genres:      []string{},
+	}
+
+	for _, genre := range strings.Split(field("genres"), ";") {
+		genre = strings.TrimSpace(genre)
+		if genre != "" {
+			record.Genres = append(record.Genres, genre)
+		}
+	}
+
+	if birthday := field("author_birthday"); birthday != "" {
+		parsed, err := parseDate(birthday)
+		if err != nil {
+			return record, fmt.Errorf("author_birthday must be YYYY-MM-DD or RFC 3339")
+		}
+		record.AuthorBirthday = parsed
+	}
+
+	return record, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		return parsed, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
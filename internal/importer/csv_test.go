@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBooksCSV(t *testing.T) {
+	t.Run("should parse rows by header name", func(t *testing.T) {
+		csv := "Title,Author Email,author_name,author_birthday,genres,copies,shelf,isbn\n" +
+			"Hobbit,bober@author.com,Bober,1996-05-17,fantasy; adventure,3,A1,0-261-10221-4\n" +
+			"Silmarillion,bober@author.com,,,,,\n"
+
+		rows, err := ReadBooksCSV(strings.NewReader(csv))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(rows))
+
+		assert.NoError(t, rows[0].Err)
+		assert.Equal(t, 2, rows[0].Line)
+		assert.Equal(t, BookRecord{
+			Title:          "Hobbit",
+			ISBN:           "0-261-10221-4",
+			AuthorName:     "Bober",
+			AuthorEmail:    "bober@author.com",
+			AuthorBirthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+			Genres:         []string{"fantasy", "adventure"},
+		}, rows[0].Record)
+
+		assert.NoError(t, rows[1].Err)
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Equal(t, []string{}, rows[1].Record.Genres)
+	})
+
+	t.Run("should report invalid rows individually", func(t *testing.T) {
+		csv := "title,author_email,author_birthday\n" +
+			"Hobbit,bober@author.com,17/05/1996\n" +
+			"Hobbit,bober@author.com,\"1996\n"
+
+		rows, err := ReadBooksCSV(strings.NewReader(csv))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(rows))
+		assert.ErrorContains(t, rows[0].Err, "author_birthday must be")
+		assert.Error(t, rows[1].Err)
+		assert.Equal(t, 3, rows[1].Line)
+	})
+
+	testcases := []struct {
+		name   string
+		csv    string
+		errMsg string
+	}{
+		{name: "should reject an empty csv", csv: "", errMsg: "csv is empty"},
+		{name: "should reject a csv without titles", csv: "name,author_email\n", errMsg: "missing the title column"},
+		{name: "should reject a csv without author emails", csv: "title,author_name\n", errMsg: "missing the author_email column"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			rows, err := ReadBooksCSV(strings.NewReader(testcase.csv))
+			assert.ErrorContains(t, err, testcase.errMsg)
+			assert.Nil(t, rows)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Package importer loads catalog records into a database.Service with the
+// same validation and duplicate checks as the HTTP API.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"curly-computing-machine/internal/database"
+)
+
+// BookRecord is one book to import, whatever format it was read from.
+type BookRecord struct {
+	Title          string
+	ISBN           string
+	Description    string
+	AuthorName     string
+	AuthorEmail    string
+	AuthorBirthday time.Time
+	Genres         []string
+}
+
+// Row is a parsed record, or the reason it couldn't be parsed, along with
+// its position in the source: a line for CSV, a record number for MARC.
+type Row struct {
+	Line   int
+	Record BookRecord
+	Err    error
+}
+
+// Importer adds records to the catalog, creating authors that don't exist
+// yet. Authors are matched by email, or by name when the record has no email
+// (MARC records never do).
+type Importer struct {
+	// AuthorEmailDomain, when set, lets records without an author email
+	// create their author with a placeholder address in this domain.
+	// Without it such records can only use authors that already exist.
+	AuthorEmailDomain string
+
+	db      database.Service
+	authors map[string]database.ID
+}
+
+func New(db database.Service) *Importer {
+	return &Importer{
+		db:      db,
+		authors: make(map[string]database.ID),
+	}
+}
+
+// ImportBook adds record as a new available book.
+func (i *Importer) ImportBook(ctx context.Context, record BookRecord) (*database.ID, error) {
+	authorID, err := i.authorID(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	bookRequest := database.BookRequest{
+		Title:       record.Title,
+		ISBN:        record.ISBN,
+		Description: record.Description,
+		AuthorID:    authorID,
+		Genres:      record.Genres,
+		Available:   true,
+	}
+
+	err = bookRequest.Bind(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.db.AddBook(ctx, bookRequest)
+}
+
+func (i *Importer) authorID(ctx context.Context, record BookRecord) (database.ID, error) {
+	if strings.TrimSpace(record.AuthorEmail) == "" {
+		return i.authorIDByName(ctx, record)
+	}
+
+	// Emails are matched the way they're stored, so "Tolkien@Author.com"
+	// finds tolkien@author.com
+	email, err := database.NormalizeEmail(record.AuthorEmail)
+	if err != nil {
+		return "", fmt.Errorf("author: %v", err)
+	}
+
+	if id, ok := i.authors[email]; ok {
+		return id, nil
+	}
+
+	author, err := i.db.FindAuthorByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if author != nil {
+		i.authors[email] = author.ID
+		return author.ID, nil
+	}
+
+	id, err := i.createAuthor(ctx, record, email)
+	if err != nil {
+		return "", err
+	}
+
+	i.authors[email] = id
+	return id, nil
+}
+
+func (i *Importer) authorIDByName(ctx context.Context, record BookRecord) (database.ID, error) {
+	name := strings.TrimSpace(record.AuthorName)
+	if name == "" {
+		return "", fmt.Errorf("author email or name is required")
+	}
+
+	key := "name:" + name
+	if id, ok := i.authors[key]; ok {
+		return id, nil
+	}
+
+	author, err := i.db.FindAuthorByName(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if author != nil {
+		i.authors[key] = author.ID
+		return author.ID, nil
+	}
+
+	if i.AuthorEmailDomain == "" {
+		return "", fmt.Errorf("author %q does not exist and the record has no email to create it with", name)
+	}
+
+	id, err := i.createAuthor(ctx, record, placeholderEmail(name, i.AuthorEmailDomain))
+	if err != nil {
+		return "", err
+	}
+
+	i.authors[key] = id
+	return id, nil
+}
+
+func (i *Importer) createAuthor(ctx context.Context, record BookRecord, email string) (database.ID, error) {
+	authorRequest := database.AuthorRequest{
+		Name:     strings.TrimSpace(record.AuthorName),
+		Birthday: record.AuthorBirthday,
+		Email:    email,
+	}
+
+	err := authorRequest.Bind(nil)
+	if err != nil {
+		return "", fmt.Errorf("author: %v", err)
+	}
+
+	id, err := i.db.CreateAuthor(ctx, authorRequest)
+	if err != nil {
+		return "", fmt.Errorf("author: %v", err)
+	}
+
+	return *id, nil
+}
+
+// placeholderEmail builds an address like "j.r.r.tolkien@domain" from an
+// author's name, keeping only ASCII letters, digits and dots in the local
+// part.
+func placeholderEmail(name, domain string) string {
+	var local strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r > unicode.MaxASCII && unicode.IsLetter(r):
+			continue
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			local.WriteRune(r)
+		case local.Len() > 0 && !strings.HasSuffix(local.String(), "."):
+			local.WriteRune('.')
+		}
+	}
+
+	return strings.Trim(local.String(), ".") + "@" + domain
+}
+
+// Run imports rows into the catalog and reports each outcome to the job,
+// finishing it once every row has been handled. If ctx is done first, Run
+// returns with the job still running; it's interrupted once found idle.
+func (i *Importer) Run(ctx context.Context, jobID database.ID, rows []Row) {
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			return
+		}
+
+		result := database.ImportRowResult{
+			Row:    row.Line,
+			Status: database.ImportRowCreated,
+		}
+
+		err := row.Err
+		if err == nil {
+			result.BookID, err = i.ImportBook(ctx, row.Record)
+		}
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			result.Status = database.ImportRowFailed
+			result.Error = err.Error()
+		}
+
+		// A job that isn't running anymore was interrupted while this row
+		// was slow; leave it as it is
+		err = i.db.RecordImportRow(ctx, jobID, result)
+		if err != nil && (ctx.Err() != nil || errors.Is(err, database.ErrImportJobNotRunning)) {
+			return
+		}
+		if err != nil {
+			i.finish(ctx, jobID, err.Error())
+			return
+		}
+	}
+
+	i.finish(ctx, jobID, "")
+}
+
+func (i *Importer) finish(ctx context.Context, jobID database.ID, jobErr string) {
+	err := i.db.FinishImportJob(ctx, jobID, jobErr)
+	if err != nil {
+		log.Printf("import job %s: %v", jobID.String(), err)
+	}
+}
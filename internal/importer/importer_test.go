@@ -0,0 +1,39 @@
+package importer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportBook(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	importer := New(db)
+
+	birthday := time.Date(1892, time.January, 3, 0, 0, 0, 0, time.UTC)
+	existing, err := db.CreateAuthor(ctx, database.AuthorRequest{Name: "Tolkien", Birthday: birthday, Email: "tolkien@author.com"})
+	require.NoError(t, err)
+
+	t.Run("should match authors by their normalized email", func(t *testing.T) {
+		for title, email := range map[string]string{"Hobbit": "Tolkien@Author.com", "Silmarillion": " TOLKIEN@author.com "} {
+			bookID, err := importer.ImportBook(ctx, BookRecord{Title: title, AuthorEmail: email})
+			require.NoError(t, err, email)
+
+			book, err := db.GetBook(ctx, *bookID)
+			require.NoError(t, err)
+			assert.Equal(t, *existing, book.AuthorID, email)
+		}
+	})
+
+	t.Run("should reject invalid author emails", func(t *testing.T) {
+		_, err := importer.ImportBook(ctx, BookRecord{Title: "Hobbit", AuthorEmail: "tolkien"})
+		assert.EqualError(t, err, "author: email must be an address like name@example.com")
+	})
+}
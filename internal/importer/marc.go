@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"curly-computing-machine/internal/marc"
+)
+
+// ReadBooksMARC parses binary MARC21 records, one row per record. Records
+// must be in UTF-8; MARC-8 ones fail their row, since their text would be
+// stored garbled.
+func ReadBooksMARC(r io.Reader) ([]Row, error) {
+	records, err := marc.ReadISO2709(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := marcRows(records)
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		if !record.IsUnicode() {
+			rows[i].Err = fmt.Errorf("record isn't UTF-8 (leader position 09 is %q, not \"a\"); convert MARC-8 records first", record.Leader[9:10])
+		}
+	}
+
+	return rows, nil
+}
+
+// ReadBooksMARCXML parses a MARCXML collection, one row per record.
+func ReadBooksMARCXML(r io.Reader) ([]Row, error) {
+	records, err := marc.ReadXML(r)
+	if err != nil {
+		return nil, err
+	}
+	return marcRows(records)
+}
+
+func marcRows(records []marc.Record) ([]Row, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("marc has no records")
+	}
+
+	rows := make([]Row, 0, len(records))
+	for i, record := range records {
+		book, err := marcBookRecord(record)
+		rows = append(rows, Row{Line: i + 1, Record: book, Err: err})
+	}
+
+	return rows, nil
+}
+
+// marcBookRecord maps the main entry (100) to the author, the first ISBN
+// (020) to the ISBN, the title statement (245) to the title, summaries (520)
+// to the description and topical subjects (650) to genres. MARC carries no
+// email, so authors are matched by name.
+func marcBookRecord(record marc.Record) (BookRecord, error) {
+	book := BookRecord{Genres: []string{}}
+
+	if fields := record.FieldsByTag("245"); len(fields) > 0 {
+		title := trimPunctuation(fields[0].Subfield("a"))
+		if subtitle := trimPunctuation(fields[0].Subfield("b")); subtitle != "" {
+			title += ": " + subtitle
+		}
+		book.Title = title
+	}
+
+	if fields := record.FieldsByTag("020"); len(fields) > 0 {
+		// Qualifiers follow the number, as in "0261102214 (pbk.)"
+		if isbn := strings.Fields(fields[0].Subfield("a")); len(isbn) > 0 {
+			book.ISBN = isbn[0]
+		}
+	}
+
+	if fields := record.FieldsByTag("100"); len(fields) > 0 {
+		book.AuthorName = personalName(fields[0])
+		book.AuthorBirthday = birthYear(fields[0].Subfield("d"))
+	}
+
+	var summaries []string
+	for _, field := range record.FieldsByTag("520") {
+		if summary := strings.TrimSpace(field.Subfield("a")); summary != "" {
+			summaries = append(summaries, summary)
+		}
+	}
+	book.Description = strings.Join(summaries, "\n\n")
+
+	seen := make(map[string]bool)
+	for _, field := range record.FieldsByTag("650") {
+		genre := trimPunctuation(field.Subfield("a"))
+		if genre != "" && !seen[genre] {
+			seen[genre] = true
+			book.Genres = append(book.Genres, genre)
+		}
+	}
+
+	if book.Title == "" {
+		return book, fmt.Errorf("record has no title (245 $a)")
+	}
+	if book.AuthorName == "" {
+		return book, fmt.Errorf("record has no main entry personal name (100 $a)")
+	}
+
+	return book, nil
+}
+
+// personalName turns an inverted surname entry ("Tolkien, J. R. R.,") into
+// the name as written ("J. R. R. Tolkien").
+func personalName(field marc.Field) string {
+	name := trimPunctuation(field.Subfield("a"))
+	if field.Ind1 != "1" {
+		return name
+	}
+
+	surname, forenames, ok := strings.Cut(name, ",")
+	if !ok {
+		return name
+	}
+	return strings.TrimSpace(forenames) + " " + strings.TrimSpace(surname)
+}
+
+// birthYear reads the year a "1892-1973." style date range starts with, as
+// January 1st of that year. MARC rarely records the full date.
+func birthYear(dates string) time.Time {
+	dates = strings.TrimSpace(dates)
+	if len(dates) < 4 {
+		return time.Time{}
+	}
+
+	year, err := strconv.Atoi(dates[:4])
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// trimPunctuation drops the ISBD punctuation MARC leaves at the end of
+// subfields, such as "The hobbit :" or "Fantasy fiction.".
+func trimPunctuation(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimRight(value, " /:;,=")
+	if strings.HasSuffix(value, ".") && !strings.HasSuffix(value, "..") && !endsWithInitial(value) {
+		value = strings.TrimSuffix(value, ".")
+	}
+	return strings.TrimSpace(value)
+}
+
+// endsWithInitial reports whether value ends in an abbreviation like "R."
+// whose full stop belongs to the name.
+func endsWithInitial(value string) bool {
+	fields := strings.Fields(value)
+	last := fields[len(fields)-1]
+	return len([]rune(last)) == 2
+}
@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBooksMARCXML(t *testing.T) {
+	t.Run("should map author, title, summary and subjects", func(t *testing.T) {
+		doc := `<collection xmlns="http://www.loc.gov/MARC21/slim">
+			<record>
+				<leader>00000nam a2200000 a 4500</leader>
+				<datafield tag="020" ind1=" " ind2=" "><subfield code="a">0261102214 (pbk.)</subfield></datafield>
+				<datafield tag="100" ind1="1" ind2=" ">
+					<subfield code="a">Tolkien, J. R. R.,</subfield>
+					<subfield code="d">1892-1973.</subfield>
+				</datafield>
+				<datafield tag="245" ind1="1" ind2="4">
+					<subfield code="a">The hobbit :</subfield>
+					<subfield code="b">or there and back again /</subfield>
+				</datafield>
+				<datafield tag="520" ind1=" " ind2=" "><subfield code="a">Bilbo goes on an adventure.</subfield></datafield>
+				<datafield tag="650" ind1=" " ind2="0"><subfield code="a">Fantasy fiction.</subfield></datafield>
+				<datafield tag="650" ind1=" " ind2="7"><subfield code="a">Fantasy fiction</subfield></datafield>
+				<datafield tag="650" ind1=" " ind2="0"><subfield code="a">Dragons.</subfield></datafield>
+			</record>
+			<record>
+				<leader>00000nam a2200000 a 4500</leader>
+				<datafield tag="100" ind1="0" ind2=" "><subfield code="a">Homer.</subfield></datafield>
+			</record>
+		</collection>`
+
+		rows, err := ReadBooksMARCXML(strings.NewReader(doc))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(rows))
+
+		assert.NoError(t, rows[0].Err)
+		assert.Equal(t, 1, rows[0].Line)
+		assert.Equal(t, BookRecord{
+			Title:          "The hobbit: or there and back again",
+			ISBN:           "0261102214",
+			Description:    "Bilbo goes on an adventure.",
+			AuthorName:     "J. R. R. Tolkien",
+			AuthorBirthday: time.Date(1892, time.January, 1, 0, 0, 0, 0, time.UTC),
+			Genres:         []string{"Fantasy fiction", "Dragons"},
+		}, rows[0].Record)
+
+		assert.ErrorContains(t, rows[1].Err, "record has no title")
+		assert.Equal(t, 2, rows[1].Line)
+		assert.Equal(t, "Homer", rows[1].Record.AuthorName)
+	})
+
+	t.Run("should reject a collection without records", func(t *testing.T) {
+		_, err := ReadBooksMARCXML(strings.NewReader(`<collection></collection>`))
+		assert.ErrorContains(t, err, "marc has no records")
+	})
+}
+
+// iso2709 encodes one binary record with characters coded as coding (leader
+// position 09) and fields given as tag and raw content.
+func iso2709(coding byte, fields ...[2]string) string {
+	var directory, data strings.Builder
+	for _, field := range fields {
+		content := field[1] + "\x1e"
+		fmt.Fprintf(&directory, "%s%04d%05d", field[0], len(content), data.Len())
+		data.WriteString(content)
+	}
+	directory.WriteString("\x1e")
+
+	base := 24 + directory.Len()
+	length := base + data.Len() + 1
+	leader := fmt.Sprintf("%05dnam %c22%05d a 4500", length, coding, base)
+	return leader + directory.String() + data.String() + "\x1d"
+}
+
+func TestReadBooksMARC(t *testing.T) {
+	t.Run("should only import records in UTF-8", func(t *testing.T) {
+		fields := [][2]string{
+			{"100", "1 \x1faTolkien, J. R. R.,"},
+			{"245", "14\x1faThe hobbit"},
+		}
+
+		rows, err := ReadBooksMARC(strings.NewReader(iso2709('a', fields...) + iso2709(' ', fields...)))
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+
+		assert.NoError(t, rows[0].Err)
+		assert.Equal(t, "The hobbit", rows[0].Record.Title)
+		assert.ErrorContains(t, rows[1].Err, "record isn't UTF-8")
+		assert.Equal(t, 2, rows[1].Line)
+	})
+}
+
+func TestPlaceholderEmail(t *testing.T) {
+	testcases := []struct {
+		name  string
+		email string
+	}{
+		{name: "J. R. R. Tolkien", email: "j.r.r.tolkien@example.org"},
+		{name: "Ursula K. Le Guin", email: "ursula.k.le.guin@example.org"},
+		{name: "Gabriel García Márquez", email: "gabriel.garca.mrquez@example.org"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.email, placeholderEmail(tc.name, "example.org"))
+		})
+	}
+}
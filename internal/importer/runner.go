@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"curly-computing-machine/internal/database"
+)
+
+// Runner runs imports in the background on a context it owns, so they
+// outlive the requests that start them but stop when it does. A job left
+// running by a runner that stopped, in this process or another sharing the
+// database, is marked interrupted once it's been idle for idleTimeout.
+type Runner struct {
+	db          database.Service
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// DefaultIdleTimeout is how long a running job can go without recording a
+// row before it's interrupted, unless NewRunner is given a positive timeout.
+const DefaultIdleTimeout = 2 * time.Minute
+
+func NewRunner(db database.Service, idleTimeout time.Duration) *Runner {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{db: db, idleTimeout: idleTimeout, now: time.Now, ctx: ctx, cancel: cancel}
+}
+
+// Start imports rows into jobID in the background, keeping the trace of
+// parent but not its cancellation.
+func (r *Runner) Start(parent context.Context, imp *Importer, jobID database.ID, rows []Row) {
+	ctx := trace.ContextWithSpanContext(r.ctx, trace.SpanContextFromContext(parent))
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("import job %s: panic: %v\n%s", jobID.String(), p, debug.Stack())
+				imp.finish(context.WithoutCancel(ctx), jobID, "the import stopped unexpectedly")
+			}
+		}()
+
+		imp.Run(ctx, jobID, rows)
+	}()
+}
+
+// Run marks idle jobs interrupted, straight away and then every half
+// idleTimeout, until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	sweep := time.NewTicker(r.idleTimeout / 2)
+	defer sweep.Stop()
+
+	for {
+		r.logErr(r.InterruptIdle(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sweep.C:
+		}
+	}
+}
+
+// InterruptIdle marks running jobs that have been idle for idleTimeout as
+// interrupted and returns how many it marked.
+func (r *Runner) InterruptIdle(ctx context.Context) (int, error) {
+	return r.db.InterruptImportJobs(ctx, r.now().Add(-r.idleTimeout))
+}
+
+// Stop cancels the imports still running and waits for them to return.
+// Their jobs are left running until they're found idle.
+func (r *Runner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *Runner) logErr(interrupted int, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("importer: interrupt idle jobs: %v", err)
+	}
+	if interrupted > 0 {
+		log.Printf("importer: interrupted %d idle import jobs", interrupted)
+	}
+}
@@ -0,0 +1,86 @@
+package importer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingDB panics when a book is added.
+type panickingDB struct {
+	database.Service
+}
+
+func (panickingDB) AddBook(ctx context.Context, book database.BookRequest) (*database.ID, error) {
+	panic("boom")
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	birthday := time.Date(1892, time.January, 3, 0, 0, 0, 0, time.UTC)
+	rows := []Row{{Line: 2, Record: BookRecord{Title: "Hobbit", AuthorName: "Tolkien", AuthorEmail: "tolkien@author.com", AuthorBirthday: birthday}}}
+
+	t.Run("should run imports to the end", func(t *testing.T) {
+		runner := NewRunner(db, time.Minute)
+		jobID, err := db.CreateImportJob(ctx, "books_csv", len(rows))
+		require.NoError(t, err)
+
+		runner.Start(ctx, New(db), *jobID, rows)
+		runner.wg.Wait()
+
+		job, err := db.GetImportJob(ctx, *jobID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobCompleted, job.Status)
+		assert.Equal(t, 1, job.Succeeded)
+	})
+
+	t.Run("should fail a job whose import panics", func(t *testing.T) {
+		runner := NewRunner(db, time.Minute)
+		jobID, err := db.CreateImportJob(ctx, "books_csv", len(rows))
+		require.NoError(t, err)
+
+		runner.Start(ctx, New(panickingDB{db}), *jobID, rows)
+		runner.wg.Wait()
+
+		job, err := db.GetImportJob(ctx, *jobID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobFailed, job.Status)
+		assert.Equal(t, "the import stopped unexpectedly", job.Error)
+	})
+
+	t.Run("should interrupt jobs idle for the timeout", func(t *testing.T) {
+		runner := NewRunner(db, time.Minute)
+		jobID, err := db.CreateImportJob(ctx, "books_csv", len(rows))
+		require.NoError(t, err)
+
+		interrupted, err := runner.InterruptIdle(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, interrupted)
+
+		runner.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		interrupted, err = runner.InterruptIdle(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, interrupted)
+
+		job, err := db.GetImportJob(ctx, *jobID)
+		require.NoError(t, err)
+		assert.Equal(t, database.ImportJobInterrupted, job.Status)
+	})
+	t.Run("should fall back to the default timeout when it isn't positive", func(t *testing.T) {
+		for _, timeout := range []time.Duration{0, -time.Minute} {
+			runner := NewRunner(db, timeout)
+			assert.Equal(t, DefaultIdleTimeout, runner.idleTimeout)
+
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			runner.Run(ctx)
+		}
+	})
+}
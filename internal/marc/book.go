@@ -0,0 +1,92 @@
+package marc
+
+import (
+	"strconv"
+
+	"curly-computing-machine/internal/database"
+)
+
+// bookLeader describes a new (n) record of language material (a) at
+// monographic level (m) in Unicode (a). Lengths and addresses only matter in
+// binary MARC and are left zeroed.
+const bookLeader = "00000nam a2200000 a 4500"
+
+// FromBook describes book as a bibliographic record: its ID as the control
+// number (001), ISBN (020), primary author as the main entry (100), title
+// statement (245), summary (520), genres as topical subjects (650) and other
+// contributors as added entries (700) with their role as relator term.
+// authors holds the contributors' details; any that are missing are left out.
+func FromBook(book database.Book, authors map[database.ID]*database.Author) Record {
+	record := Record{
+		Leader: bookLeader,
+		Fields: []Field{
+			{Tag: "001", Value: book.ID.String()},
+		},
+	}
+
+	if book.ISBN != "" {
+		record.Fields = append(record.Fields, Field{
+			Tag:       "020",
+			Subfields: []Subfield{{Code: "a", Value: book.ISBN}},
+		})
+	}
+
+	author := authors[book.AuthorID]
+	if author != nil {
+		record.Fields = append(record.Fields, personalName("100", author))
+	}
+
+	record.Fields = append(record.Fields, Field{
+		Tag:       "245",
+		Ind1:      titleAddedEntry(author),
+		Ind2:      "0",
+		Subfields: []Subfield{{Code: "a", Value: book.Title}},
+	})
+
+	if book.Description != "" {
+		record.Fields = append(record.Fields, Field{
+			Tag:       "520",
+			Subfields: []Subfield{{Code: "a", Value: book.Description}},
+		})
+	}
+
+	for _, genre := range book.Genres {
+		record.Fields = append(record.Fields, Field{
+			Tag:       "650",
+			Ind2:      "4",
+			Subfields: []Subfield{{Code: "a", Value: genre}},
+		})
+	}
+
+	for _, contributor := range book.Contributors {
+		if contributor.AuthorID == book.AuthorID && contributor.Role == database.RoleAuthor {
+			continue
+		}
+		if added := authors[contributor.AuthorID]; added != nil {
+			field := personalName("700", added)
+			field.Subfields = append(field.Subfields, Subfield{Code: "e", Value: contributor.Role})
+			record.Fields = append(record.Fields, field)
+		}
+	}
+
+	return record
+}
+
+// personalName is a main or added entry for author written in direct order,
+// with the birth year as the start of its dates.
+func personalName(tag string, author *database.Author) Field {
+	field := Field{Tag: tag, Ind1: "0", Subfields: []Subfield{{Code: "a", Value: author.Name}}}
+	if !author.Birthday.IsZero() {
+		field.Subfields = append(field.Subfields, Subfield{Code: "d", Value: strconv.Itoa(author.Birthday.Year()) + "-"})
+	}
+	return field
+}
+
+// titleAddedEntry is 245's first indicator: 1 when the title is traced in
+// addition to a main entry, 0 when the title is the main entry.
+func titleAddedEntry(author *database.Author) string {
+	if author == nil {
+		return "0"
+	}
+	return "1"
+}
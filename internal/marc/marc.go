@@ -0,0 +1,288 @@
+// Package marc reads binary MARC21 (ISO 2709) and MARCXML records and writes
+// MARCXML.
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	leaderLength     = 24
+	directoryEntry   = 12
+	subfieldDelim    = 0x1F
+	fieldTerminator  = 0x1E
+	recordTerminator = 0x1D
+)
+
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is a control field (tags 001-009) holding Value, or a data field
+// holding indicators and subfields.
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      string
+	Ind2      string
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  string
+	Value string
+}
+
+// IsUnicode reports whether the leader codes the record's characters as
+// UCS/Unicode (position 09 is "a") rather than MARC-8 (blank).
+func (r Record) IsUnicode() bool {
+	return len(r.Leader) > 9 && r.Leader[9] == 'a'
+}
+
+func (f Field) IsControl() bool {
+	return f.Tag < "010"
+}
+
+// Subfield returns the first value of subfield code, or "" if there is none.
+func (f Field) Subfield(code string) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// FieldsByTag returns every field with tag, in record order.
+func (r Record) FieldsByTag(tag string) []Field {
+	var fields []Field
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ReadISO2709 reads every record from a binary MARC21 stream.
+func ReadISO2709(r io.Reader) ([]Record, error) {
+	reader := bufio.NewReader(r)
+	records := []Record{}
+
+	for {
+		raw, err := reader.ReadBytes(recordTerminator)
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(raw)) > 0 {
+				return nil, fmt.Errorf("record %d: missing record terminator", len(records)+1)
+			}
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read marc: %w", err)
+		}
+
+		record, err := parseISO2709(raw)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+func parseISO2709(raw []byte) (Record, error) {
+	if len(raw) < leaderLength+1 {
+		return Record{}, fmt.Errorf("record is too short")
+	}
+
+	leader := string(raw[:leaderLength])
+	baseAddress, ok := parseDigits(leader[12:17])
+	if !ok || baseAddress <= leaderLength || baseAddress > len(raw) {
+		return Record{}, fmt.Errorf("invalid base address of data %q", leader[12:17])
+	}
+
+	directory := raw[leaderLength : baseAddress-1]
+	if len(directory)%directoryEntry != 0 {
+		return Record{}, fmt.Errorf("invalid directory length %d", len(directory))
+	}
+
+	data := raw[baseAddress:]
+	record := Record{Leader: leader}
+
+	for i := 0; i < len(directory); i += directoryEntry {
+		entry := string(directory[i : i+directoryEntry])
+		tag := entry[:3]
+		length, lengthOK := parseDigits(entry[3:7])
+		start, startOK := parseDigits(entry[7:12])
+		if !lengthOK || !startOK || length < 1 || start < 0 || start+length > len(data) {
+			return Record{}, fmt.Errorf("invalid directory entry %q", entry)
+		}
+
+		value := bytes.TrimSuffix(data[start:start+length], []byte{fieldTerminator})
+		record.Fields = append(record.Fields, parseField(tag, value))
+	}
+
+	return record, nil
+}
+
+// parseDigits parses a fixed-width number from a leader or directory, which
+// are unsigned ASCII digits only, unlike what strconv.Atoi accepts.
+func parseDigits(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+
+	n := 0
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+func parseField(tag string, value []byte) Field {
+	field := Field{Tag: tag}
+	if field.IsControl() {
+		field.Value = string(value)
+		return field
+	}
+
+	if len(value) >= 2 {
+		field.Ind1 = string(value[0])
+		field.Ind2 = string(value[1])
+		value = value[2:]
+	}
+
+	for _, chunk := range bytes.Split(value, []byte{subfieldDelim}) {
+		if len(chunk) == 0 {
+			continue
+		}
+		field.Subfields = append(field.Subfields, Subfield{
+			Code:  string(chunk[0]),
+			Value: string(chunk[1:]),
+		})
+	}
+
+	return field
+}
+
+const xmlNamespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"collection"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadXML reads a MARCXML document holding either a collection of records or
+// a single record.
+func ReadXML(r io.Reader) ([]Record, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read marcxml: %w", err)
+	}
+
+	var collection xmlCollection
+	err = xml.Unmarshal(content, &collection)
+	if err != nil {
+		var single xmlRecord
+		if xml.Unmarshal(content, &single) != nil {
+			return nil, fmt.Errorf("parse marcxml: %v", err)
+		}
+		collection.Records = []xmlRecord{single}
+	}
+
+	records := make([]Record, 0, len(collection.Records))
+	for _, xr := range collection.Records {
+		record := Record{Leader: xr.Leader}
+		// Element order is lost by the decoder; MARC orders fields by tag
+		// with control fields first, which is what the spec requires anyway.
+		for _, cf := range xr.ControlFields {
+			record.Fields = append(record.Fields, Field{Tag: cf.Tag, Value: cf.Value})
+		}
+		for _, df := range xr.DataFields {
+			field := Field{Tag: df.Tag, Ind1: df.Ind1, Ind2: df.Ind2}
+			for _, sf := range df.Subfields {
+				field.Subfields = append(field.Subfields, Subfield{Code: sf.Code, Value: sf.Value})
+			}
+			record.Fields = append(record.Fields, field)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// WriteXML writes records as a MARCXML collection.
+func WriteXML(w io.Writer, records []Record) error {
+	collection := xmlCollection{Xmlns: xmlNamespace}
+	for _, record := range records {
+		xr := xmlRecord{Leader: record.Leader}
+		for _, field := range record.Fields {
+			if field.IsControl() {
+				xr.ControlFields = append(xr.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+				continue
+			}
+
+			df := xmlDataField{Tag: field.Tag, Ind1: indicator(field.Ind1), Ind2: indicator(field.Ind2)}
+			for _, subfield := range field.Subfields {
+				df.Subfields = append(df.Subfields, xmlSubfield{Code: subfield.Code, Value: subfield.Value})
+			}
+			xr.DataFields = append(xr.DataFields, df)
+		}
+		collection.Records = append(collection.Records, xr)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(collection)
+	if err != nil {
+		return fmt.Errorf("encode marcxml: %v", err)
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func indicator(value string) string {
+	if value == "" {
+		return " "
+	}
+	return value
+}
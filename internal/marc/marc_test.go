@@ -0,0 +1,138 @@
+package marc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// iso2709 encodes fields, given as tag and raw content, as one binary record.
+func iso2709(fields ...[2]string) string {
+	var directory, data strings.Builder
+	for _, field := range fields {
+		content := field[1] + "\x1e"
+		fmt.Fprintf(&directory, "%s%04d%05d", field[0], len(content), data.Len())
+		data.WriteString(content)
+	}
+	directory.WriteString("\x1e")
+
+	base := leaderLength + directory.Len()
+	length := base + data.Len() + 1
+	leader := fmt.Sprintf("%05dnam a22%05d a 4500", length, base)
+	return leader + directory.String() + data.String() + "\x1d"
+}
+
+// withDirectory replaces the first directory entry of a record made by
+// iso2709.
+func withDirectory(raw, entry string) string {
+	return raw[:leaderLength] + entry + raw[leaderLength+directoryEntry:]
+}
+
+func TestReadISO2709(t *testing.T) {
+	t.Run("should read fields and subfields", func(t *testing.T) {
+		raw := iso2709(
+			[2]string{"001", "12345"},
+			[2]string{"100", "1 \x1faTolkien, J. R. R.,\x1fd1892-1973."},
+			[2]string{"245", "14\x1faThe hobbit :\x1fbor there and back again."},
+		) + iso2709([2]string{"245", "10\x1faSilmarillion"})
+
+		records, err := ReadISO2709(strings.NewReader(raw))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(records))
+
+		assert.Equal(t, []Field{
+			{Tag: "001", Value: "12345"},
+			{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "Tolkien, J. R. R.,"}, {Code: "d", Value: "1892-1973."}}},
+			{Tag: "245", Ind1: "1", Ind2: "4", Subfields: []Subfield{{Code: "a", Value: "The hobbit :"}, {Code: "b", Value: "or there and back again."}}},
+		}, records[0].Fields)
+		assert.Equal(t, "Silmarillion", records[1].FieldsByTag("245")[0].Subfield("a"))
+	})
+
+	testcases := []struct {
+		name   string
+		raw    string
+		errMsg string
+	}{
+		{name: "should reject a truncated record", raw: iso2709([2]string{"245", "10\x1faHobbit"})[:40], errMsg: "missing record terminator"},
+		{name: "should reject a short record", raw: "00010nam\x1d", errMsg: "record is too short"},
+		{name: "should reject a bad base address", raw: "00030nam a22xxxxx a 4500\x1e\x1d", errMsg: "invalid base address"},
+		{name: "should reject a negative field start", raw: withDirectory(iso2709([2]string{"245", "10\x1faHobbit"}), "2450005-0001"), errMsg: "invalid directory entry"},
+		{name: "should reject a signed field length", raw: withDirectory(iso2709([2]string{"245", "10\x1faHobbit"}), "245+00500000"), errMsg: "invalid directory entry"},
+		{name: "should reject a field past the end", raw: withDirectory(iso2709([2]string{"245", "10\x1faHobbit"}), "245999900000"), errMsg: "invalid directory entry"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadISO2709(strings.NewReader(tc.raw))
+			assert.ErrorContains(t, err, tc.errMsg)
+		})
+	}
+}
+
+func TestXML(t *testing.T) {
+	t.Run("should read a single record", func(t *testing.T) {
+		doc := `<record xmlns="http://www.loc.gov/MARC21/slim">
+			<leader>00000nam a2200000 a 4500</leader>
+			<controlfield tag="001">12345</controlfield>
+			<datafield tag="650" ind1=" " ind2="0"><subfield code="a">Fantasy fiction.</subfield></datafield>
+		</record>`
+
+		records, err := ReadXML(strings.NewReader(doc))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(records))
+		assert.Equal(t, "12345", records[0].FieldsByTag("001")[0].Value)
+		assert.Equal(t, "Fantasy fiction.", records[0].FieldsByTag("650")[0].Subfield("a"))
+	})
+
+	t.Run("should read back what it writes", func(t *testing.T) {
+		birthday := time.Date(1892, time.January, 3, 0, 0, 0, 0, time.UTC)
+		author := &database.Author{ID: database.NewID(), Name: "J. R. R. Tolkien", Birthday: birthday}
+		illustrator := &database.Author{ID: database.NewID(), Name: "Alan Lee"}
+		book := database.Book{
+			ID:          database.NewID(),
+			Title:       "Hobbit",
+			ISBN:        "9780261102217",
+			Description: "There & back again",
+			AuthorID:    author.ID,
+			Contributors: []database.Contributor{
+				{AuthorID: author.ID, Role: database.RoleAuthor},
+				{AuthorID: illustrator.ID, Role: database.RoleIllustrator},
+				{AuthorID: database.NewID(), Role: database.RoleEditor},
+			},
+			Genres: []string{"fantasy", "adventure"},
+		}
+		authors := map[database.ID]*database.Author{author.ID: author, illustrator.ID: illustrator}
+
+		var out bytes.Buffer
+		err := WriteXML(&out, []Record{FromBook(book, authors)})
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), `<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+
+		records, err := ReadXML(&out)
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{{
+			Leader: bookLeader,
+			Fields: []Field{
+				{Tag: "001", Value: book.ID.String()},
+				{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "9780261102217"}}},
+				{Tag: "100", Ind1: "0", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "J. R. R. Tolkien"}, {Code: "d", Value: "1892-"}}},
+				{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []Subfield{{Code: "a", Value: "Hobbit"}}},
+				{Tag: "520", Ind1: " ", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "There & back again"}}},
+				{Tag: "650", Ind1: " ", Ind2: "4", Subfields: []Subfield{{Code: "a", Value: "fantasy"}}},
+				{Tag: "650", Ind1: " ", Ind2: "4", Subfields: []Subfield{{Code: "a", Value: "adventure"}}},
+				{Tag: "700", Ind1: "0", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "Alan Lee"}, {Code: "e", Value: "illustrator"}}},
+			},
+		}}, records)
+	})
+
+	t.Run("should reject malformed xml", func(t *testing.T) {
+		_, err := ReadXML(strings.NewReader("<collection><record>"))
+		assert.ErrorContains(t, err, "parse marcxml")
+	})
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is an email to one recipient.
+type Message struct {
+	// ID makes the Message-ID header unique.
+	ID      string
+	To      string
+	Subject string
+	Body    string
+	Locale  string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it.
+type SMTPMailer struct {
+	addr    string
+	from    string
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+// NewSMTPMailer sends from the address from through the server at addr,
+// which is host:port. Without a username it doesn't authenticate.
+func NewSMTPMailer(addr, from, username, password string, timeout time.Duration) *SMTPMailer {
+	mailer := &SMTPMailer{addr: addr, from: from, timeout: timeout}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("dial smtp server: %v", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(m.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("greet smtp server: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return fmt.Errorf("starttls: %v", err)
+		}
+	}
+	if m.auth != nil {
+		err = client.Auth(m.auth)
+		if err != nil {
+			return fmt.Errorf("authenticate: %v", err)
+		}
+	}
+
+	err = client.Mail(m.from)
+	if err != nil {
+		return fmt.Errorf("mail from: %v", err)
+	}
+	err = client.Rcpt(msg.To)
+	if err != nil {
+		return fmt.Errorf("rcpt to: %v", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %v", err)
+	}
+	_, err = w.Write(msg.format(m.from, time.Now()))
+	if err != nil {
+		return fmt.Errorf("write message: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("send message: %v", err)
+	}
+
+	return client.Quit()
+}
+
+// format renders msg as an RFC 5322 message from from, sent at date, with a
+// quoted-printable UTF-8 body.
+func (msg Message) format(from string, date time.Time) []byte {
+	var b bytes.Buffer
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", msg.ID, domain))
+	if msg.Locale != "" {
+		header("Content-Language", msg.Locale)
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+
+	return b.Bytes()
+}
@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSink is a local SMTP server that keeps the messages it's sent instead
+// of delivering them. Recipients in reject are refused.
+type smtpSink struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	reject   map[string]bool
+	received []received
+}
+
+// received is a message as the sink got it, decoded.
+type received struct {
+	From    string
+	To      string
+	Header  mail.Header
+	Subject string
+	Body    string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	sink := &smtpSink{ln: ln, reject: map[string]bool{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(t, conn)
+		}
+	}()
+
+	return sink
+}
+
+func (s *smtpSink) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *smtpSink) Reject(to string, reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject[to] = reject
+}
+
+func (s *smtpSink) Received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.received...)
+}
+
+func (s *smtpSink) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+
+	var from, to string
+	text.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 sink")
+		case "MAIL":
+			from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			s.mu.Lock()
+			rejected := s.reject[to]
+			s.mu.Unlock()
+			if rejected {
+				text.PrintfLine("550 mailbox unavailable")
+				continue
+			}
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			raw, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.received = append(s.received, decode(t, from, to, raw))
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func decode(t *testing.T, from, to string, raw []byte) received {
+	msg, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(raw)))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+
+	return received{
+		From:    from,
+		To:      to,
+		Header:  msg.Header,
+		Subject: subject,
+		Body:    strings.ReplaceAll(string(body), "\r\n", "\n"),
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	sink := newSMTPSink(t)
+	mailer := NewSMTPMailer(sink.Addr(), "library@example.com", "", "", 5*time.Second)
+
+	t.Run("should send the message", func(t *testing.T) {
+		err := mailer.Send(context.Background(), Message{
+			ID:      "abc123",
+			To:      "bober@hotmail.com",
+			Subject: "«Cien años de soledad» vence mañana",
+			Body:    "Hola, Bober:\n\nDevuélvelo a tiempo, por favor. " + strings.Repeat("=", 80) + "\n",
+			Locale:  "es",
+		})
+		require.NoError(t, err)
+
+		messages := sink.Received()
+		require.Len(t, messages, 1)
+		msg := messages[0]
+
+		assert.Equal(t, "library@example.com", msg.From)
+		assert.Equal(t, "bober@hotmail.com", msg.To)
+		assert.Equal(t, "library@example.com", msg.Header.Get("From"))
+		assert.Equal(t, "bober@hotmail.com", msg.Header.Get("To"))
+		assert.Equal(t, "<abc123@example.com>", msg.Header.Get("Message-ID"))
+		assert.Equal(t, "es", msg.Header.Get("Content-Language"))
+		assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+		assert.Equal(t, "«Cien años de soledad» vence mañana", msg.Subject)
+		assert.Equal(t, "Hola, Bober:\n\nDevuélvelo a tiempo, por favor. "+strings.Repeat("=", 80)+"\n", msg.Body)
+
+		_, err = msg.Header.Date()
+		assert.NoError(t, err)
+	})
+
+	t.Run("should fail when the recipient is refused", func(t *testing.T) {
+		sink.Reject("nobody@example.com", true)
+
+		err := mailer.Send(context.Background(), Message{ID: "def456", To: "nobody@example.com", Subject: "Hi", Body: "Hi\n"})
+		assert.ErrorContains(t, err, "mailbox unavailable")
+		assert.Len(t, sink.Received(), 1)
+	})
+
+	t.Run("should fail when the server is unreachable", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		ln.Close()
+
+		err = NewSMTPMailer(addr, "library@example.com", "", "", time.Second).Send(context.Background(), Message{To: "bober@hotmail.com"})
+		assert.ErrorContains(t, err, "dial smtp server")
+	})
+}
@@ -0,0 +1,233 @@
+// Package notify emails borrowers: a welcome and a link to verify their
+// address when they sign up, reminders before their loans are due and after
+// they're overdue, and word when a book they put on hold is ready. Emails
+// are rendered from templates in the borrower's locale and skipped for the
+// kinds they've opted out of. Each one is recorded in the sent-message log
+// under a key for what it's about, which keeps it from being sent twice.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+var (
+	smtpAddr     = os.Getenv("SMTP_ADDR")
+	smtpFrom     = os.Getenv("SMTP_FROM")
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	dueInDays    = os.Getenv("NOTIFY_DUE_IN_DAYS")
+	interval     = os.Getenv("NOTIFY_INTERVAL")
+	maxAttempts  = os.Getenv("NOTIFY_MAX_ATTEMPTS")
+)
+
+// Config tunes a Notifier and its Scheduler.
+type Config struct {
+	// MaxAttempts is how many times an email is tried before it's given up
+	// on.
+	MaxAttempts int
+	// Timeout bounds sending each email.
+	Timeout time.Duration
+	// DueIn is how long before a loan is due its reminder is sent.
+	DueIn time.Duration
+	// Interval is how often the scheduler looks for loans to remind
+	// borrowers of.
+	Interval time.Duration
+}
+
+var DefaultConfig = Config{
+	MaxAttempts: 5,
+	Timeout:     30 * time.Second,
+	DueIn:       3 * 24 * time.Hour,
+	Interval:    time.Hour,
+}
+
+// Enabled reports whether SMTP_ADDR says where to send emails.
+func Enabled() bool {
+	return smtpAddr != ""
+}
+
+// New returns a Notifier sending through the SMTP server at SMTP_ADDR, as
+// SMTP_FROM and authenticating with SMTP_USERNAME and SMTP_PASSWORD if
+// they're set. NOTIFY_DUE_IN_DAYS, NOTIFY_INTERVAL and NOTIFY_MAX_ATTEMPTS
+// tune it.
+func New(db database.Service) *Notifier {
+	config := DefaultConfig
+
+	for _, setting := range []struct {
+		name  string
+		value string
+		min   int
+		into  func(int)
+	}{
+		{"NOTIFY_DUE_IN_DAYS", dueInDays, 0, func(days int) { config.DueIn = time.Duration(days) * 24 * time.Hour }},
+		{"NOTIFY_MAX_ATTEMPTS", maxAttempts, 1, func(attempts int) { config.MaxAttempts = attempts }},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(setting.value)
+		if err != nil || parsed < setting.min {
+			log.Fatalf("invalid %s %q", setting.name, setting.value)
+		}
+		setting.into(parsed)
+	}
+
+	if interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("invalid NOTIFY_INTERVAL %q", interval)
+		}
+		config.Interval = parsed
+	}
+
+	if smtpFrom == "" {
+		log.Fatal("SMTP_FROM is required to send emails")
+	}
+
+	templates, err := LoadTemplates(templateFS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mailer := NewSMTPMailer(smtpAddr, smtpFrom, smtpUsername, smtpPassword, config.Timeout)
+	return NewNotifier(db, mailer, templates, VerifierFromEnv(), config)
+}
+
+// Notifier emails borrowers.
+type Notifier struct {
+	db        database.Service
+	mailer    Mailer
+	templates *Templates
+	verifier  *Verifier
+	config    Config
+	now       func() time.Time
+}
+
+func NewNotifier(db database.Service, mailer Mailer, templates *Templates, verifier *Verifier, config Config) *Notifier {
+	return &Notifier{
+		db:        db,
+		mailer:    mailer,
+		templates: templates,
+		verifier:  verifier,
+		config:    config,
+		now:       time.Now,
+	}
+}
+
+// Email is one to be sent to a borrower.
+type Email struct {
+	BorrowerID database.ID
+	To         string
+	Kind       string
+	// Key is what the email is about. The borrower gets the kind of email
+	// about each key once.
+	Key  string
+	Data Data
+}
+
+// Notify sends email unless the borrower has opted out of its kind or it's
+// been sent already, and reports whether it sent it. A failed email is
+// recorded as such and tried again the next time it's notified, until it
+// runs out of attempts.
+func (n *Notifier) Notify(ctx context.Context, email Email) (bool, error) {
+	prefs, err := n.db.GetNotificationPreferences(ctx, email.BorrowerID)
+	if err != nil {
+		return false, err
+	}
+	if prefs == nil {
+		defaults := database.DefaultNotificationPreferences()
+		prefs = &defaults
+	}
+	if !prefs.Wants(email.Kind) {
+		return false, nil
+	}
+
+	subject, body, locale, err := n.templates.Render(prefs.Locale, email.Kind, email.Data)
+	if err != nil {
+		return false, err
+	}
+
+	notification := database.NewNotification(email.BorrowerID, email.Kind, email.Key)
+	notification.Locale = locale
+	notification.To = email.To
+	notification.Subject = subject
+
+	reserved, err := n.db.ReserveNotification(ctx, notification, n.config.MaxAttempts)
+	if err != nil || !reserved {
+		return false, err
+	}
+
+	sendErr := n.mailer.Send(ctx, Message{
+		ID:      notification.ID.String(),
+		To:      email.To,
+		Subject: subject,
+		Body:    body,
+		Locale:  locale,
+	})
+	if sendErr != nil {
+		notification.Status = database.NotificationFailed
+		notification.Error = sendErr.Error()
+	} else {
+		sentAt := n.now().UTC().Truncate(time.Millisecond)
+		notification.Status = database.NotificationSent
+		notification.SentAt = &sentAt
+	}
+
+	// The outcome is saved even when ctx is done, so that a reserved email
+	// isn't left looking like it's still being sent
+	err = n.db.UpdateNotification(context.WithoutCancel(ctx), notification)
+	if sendErr != nil {
+		return false, fmt.Errorf("send %s email to %s: %v", email.Kind, email.BorrowerID, sendErr)
+	}
+	if err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Welcome emails a borrower who has just signed up.
+func (n *Notifier) Welcome(ctx context.Context, borrower database.Borrower) (bool, error) {
+	return n.Notify(ctx, Email{
+		BorrowerID: borrower.ID,
+		To:         borrower.Email,
+		Kind:       database.NotificationWelcome,
+		Key:        borrower.ID.String(),
+		Data:       Data{Name: borrower.Name},
+	})
+}
+
+// SendVerification emails borrower a link to verify their email address.
+// The borrower gets one email per key, so a new key sends a new link.
+func (n *Notifier) SendVerification(ctx context.Context, borrower database.Borrower, key string) (bool, error) {
+	return n.Notify(ctx, Email{
+		BorrowerID: borrower.ID,
+		To:         borrower.Email,
+		Kind:       database.NotificationVerifyEmail,
+		Key:        key,
+		Data: Data{
+			Name:  borrower.Name,
+			DueAt: n.now().Add(n.verifier.ttl),
+			Link:  n.verifier.Link(borrower),
+		},
+	})
+}
+
+// HoldReady tells a borrower that the book they put on hold, identified by
+// holdKey, is being kept for them until keptUntil.
+func (n *Notifier) HoldReady(ctx context.Context, borrower database.Borrower, book database.Book, holdKey string, keptUntil time.Time) (bool, error) {
+	return n.Notify(ctx, Email{
+		BorrowerID: borrower.ID,
+		To:         borrower.Email,
+		Kind:       database.NotificationHoldReady,
+		Key:        holdKey,
+		Data:       Data{Name: borrower.Name, BookTitle: book.Title, DueAt: keptUntil},
+	})
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNotifier returns a notifier that sends to a local SMTP sink, and a
+// borrower to notify.
+func newTestNotifier(t *testing.T) (*Notifier, *smtpSink, database.Service, database.Borrower) {
+	db := memory.New()
+	sink := newSMTPSink(t)
+
+	templates, err := LoadTemplates(templateFS)
+	require.NoError(t, err)
+
+	config := DefaultConfig
+	config.MaxAttempts = 2
+	mailer := NewSMTPMailer(sink.Addr(), "library@example.com", "", "", 5*time.Second)
+	verifier := NewVerifier([]byte("secret"), DefaultVerificationTTL, "http://localhost:8080/v1/email-verification")
+	notifier := NewNotifier(db, mailer, templates, verifier, config)
+
+	id, err := db.CreateBorrower(context.Background(), database.BorrowerRequest{
+		Name:     "Bober",
+		Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Email:    "bober@hotmail.com",
+	})
+	require.NoError(t, err)
+	borrower, err := db.VerifyBorrower(context.Background(), *id, "bober@hotmail.com")
+	require.NoError(t, err)
+
+	return notifier, sink, db, *borrower
+}
+
+func TestNotifier(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should send each email once and log it", func(t *testing.T) {
+		notifier, sink, db, borrower := newTestNotifier(t)
+
+		sent, err := notifier.Welcome(ctx, borrower)
+		require.NoError(t, err)
+		assert.True(t, sent)
+
+		sent, err = notifier.Welcome(ctx, borrower)
+		require.NoError(t, err)
+		assert.False(t, sent)
+
+		messages := sink.Received()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "bober@hotmail.com", messages[0].To)
+		assert.Equal(t, "Welcome to the library, Bober", messages[0].Subject)
+		assert.Equal(t, "en", messages[0].Header.Get("Content-Language"))
+
+		notifications, err := db.ListNotifications(ctx, borrower.ID)
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+		assert.Equal(t, database.NotificationWelcome, notifications[0].Kind)
+		assert.Equal(t, borrower.ID.String(), notifications[0].Key)
+		assert.Equal(t, database.NotificationSent, notifications[0].Status)
+		assert.Equal(t, "Welcome to the library, Bober", notifications[0].Subject)
+		assert.Equal(t, "<"+notifications[0].ID.String()+"@example.com>", messages[0].Header.Get("Message-ID"))
+		assert.NotNil(t, notifications[0].SentAt)
+	})
+
+	t.Run("should write in the borrower's locale", func(t *testing.T) {
+		notifier, sink, db, borrower := newTestNotifier(t)
+		require.NoError(t, db.SetNotificationPreferences(ctx, borrower.ID, database.NotificationPreferences{Locale: "es-MX", OptOut: []string{}}))
+
+		keptUntil := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+		sent, err := notifier.HoldReady(ctx, borrower, database.Book{Title: "Hobbit"}, "hold-1", keptUntil)
+		require.NoError(t, err)
+		assert.True(t, sent)
+
+		messages := sink.Received()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "«Hobbit» ya está disponible", messages[0].Subject)
+		assert.Contains(t, messages[0].Body, "2024-03-05")
+		assert.Equal(t, "es", messages[0].Header.Get("Content-Language"))
+
+		notifications, err := db.ListNotifications(ctx, borrower.ID)
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+		assert.Equal(t, "es", notifications[0].Locale)
+	})
+
+	t.Run("should skip kinds the borrower opted out of", func(t *testing.T) {
+		notifier, sink, db, borrower := newTestNotifier(t)
+		require.NoError(t, db.SetNotificationPreferences(ctx, borrower.ID, database.NotificationPreferences{
+			Locale: "en",
+			OptOut: []string{database.NotificationWelcome},
+		}))
+
+		sent, err := notifier.Welcome(ctx, borrower)
+		require.NoError(t, err)
+		assert.False(t, sent)
+		assert.Empty(t, sink.Received())
+
+		notifications, err := db.ListNotifications(ctx, borrower.ID)
+		require.NoError(t, err)
+		assert.Empty(t, notifications)
+	})
+
+	t.Run("should retry failed emails until they run out of attempts", func(t *testing.T) {
+		notifier, sink, db, borrower := newTestNotifier(t)
+		sink.Reject(borrower.Email, true)
+
+		for attempt := 1; attempt <= 2; attempt++ {
+			sent, err := notifier.Welcome(ctx, borrower)
+			assert.ErrorContains(t, err, "send welcome email")
+			assert.False(t, sent)
+		}
+
+		notifications, err := db.ListNotifications(ctx, borrower.ID)
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+		assert.Equal(t, database.NotificationFailed, notifications[0].Status)
+		assert.Equal(t, 2, notifications[0].Attempts)
+		assert.Contains(t, notifications[0].Error, "mailbox unavailable")
+
+		sink.Reject(borrower.Email, false)
+		sent, err := notifier.Welcome(ctx, borrower)
+		require.NoError(t, err)
+		assert.False(t, sent, "it ran out of attempts")
+		assert.Empty(t, sink.Received())
+	})
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// Scheduler reminds borrowers of loans that are due soon or overdue. Several
+// schedulers can share a database: the sent-message log keeps them from
+// sending the same reminder twice.
+type Scheduler struct {
+	notifier *Notifier
+	now      func() time.Time
+}
+
+func NewScheduler(notifier *Notifier) *Scheduler {
+	return &Scheduler{notifier: notifier, now: time.Now}
+}
+
+// Run sends reminders every Interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.notifier.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := s.RemindDue(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("notify: remind borrowers: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RemindDue emails a reminder about every loan due within DueIn, or overdue,
+// that hasn't had one, and returns how many it sent. It carries on past
+// loans it fails to remind of, and returns their errors along with the
+// count.
+func (s *Scheduler) RemindDue(ctx context.Context) (int, error) {
+	now := s.now().UTC()
+	loans, err := s.notifier.db.OverdueLoans(ctx, now.Add(s.notifier.config.DueIn))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, loan := range loans {
+		email := Email{
+			BorrowerID: loan.BorrowerID,
+			To:         loan.BorrowerEmail,
+			Kind:       database.NotificationDueSoon,
+			Key:        fmt.Sprintf("%s:%d", loan.BookID, loan.BorrowedAt.UnixMilli()),
+			Data: Data{
+				Name:      loan.BorrowerName,
+				BookTitle: loan.BookTitle,
+				DueAt:     loan.DueAt,
+				Days:      days(now, loan.DueAt),
+			},
+		}
+		if loan.DueAt.Before(now) {
+			email.Kind = database.NotificationOverdue
+			email.Data.Days = days(loan.DueAt, now)
+		}
+
+		ok, err := s.notifier.Notify(ctx, email)
+		if err != nil {
+			if ctx.Err() != nil {
+				return sent, err
+			}
+			errs = append(errs, err)
+		}
+		if ok {
+			sent++
+		}
+	}
+
+	return sent, errors.Join(errs...)
+}
+
+// days is how many calendar days, in UTC, to is after from.
+func days(from, to time.Time) int {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+	return int(to.Sub(from) / (24 * time.Hour))
+}
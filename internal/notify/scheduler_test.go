@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	notifier, sink, db, borrower := newTestNotifier(t)
+
+	authorID, err := db.CreateAuthor(ctx, database.AuthorRequest{
+		Name:     "Tolkien",
+		Birthday: time.Date(1892, time.January, 3, 0, 0, 0, 0, time.UTC),
+		Email:    "tolkien@author.com",
+	})
+	require.NoError(t, err)
+	bookID, err := db.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+	require.NoError(t, db.BorrowBook(ctx, *bookID, borrower.ID))
+
+	loans, err := db.OverdueLoans(ctx, time.Now().Add(database.LoanPeriod+time.Hour))
+	require.NoError(t, err)
+	require.Len(t, loans, 1)
+	dueAt := loans[0].DueAt
+
+	scheduler := NewScheduler(notifier)
+	remindAt := func(t *testing.T, now time.Time) int {
+		scheduler.now = func() time.Time { return now }
+		sent, err := scheduler.RemindDue(ctx)
+		require.NoError(t, err)
+		return sent
+	}
+
+	t.Run("should leave loans that aren't due soon", func(t *testing.T) {
+		assert.Equal(t, 0, remindAt(t, dueAt.Add(-4*24*time.Hour)))
+		assert.Empty(t, sink.Received())
+	})
+
+	t.Run("should remind of loans due soon once", func(t *testing.T) {
+		assert.Equal(t, 1, remindAt(t, dueAt.Add(-2*24*time.Hour)))
+		assert.Equal(t, 0, remindAt(t, dueAt.Add(-24*time.Hour)))
+
+		messages := sink.Received()
+		require.Len(t, messages, 1)
+		assert.Equal(t, `"Hobbit" is due in 2 days`, messages[0].Subject)
+	})
+
+	t.Run("should tell borrowers once when they're overdue", func(t *testing.T) {
+		assert.Equal(t, 1, remindAt(t, dueAt.Add(3*24*time.Hour)))
+		assert.Equal(t, 0, remindAt(t, dueAt.Add(4*24*time.Hour)))
+
+		messages := sink.Received()
+		require.Len(t, messages, 2)
+		assert.Equal(t, `"Hobbit" is overdue`, messages[1].Subject)
+		assert.Contains(t, messages[1].Body, "3 days ago")
+	})
+
+	t.Run("should keep reminding others when one fails", func(t *testing.T) {
+		other, err := db.CreateBorrower(ctx, database.BorrowerRequest{
+			Name:     "Skunk",
+			Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+			Email:    "skunk@hotmail.com",
+		})
+		require.NoError(t, err)
+		_, err = db.VerifyBorrower(ctx, *other, "skunk@hotmail.com")
+		require.NoError(t, err)
+		secondID, err := db.AddBook(ctx, database.BookRequest{Title: "Silmarillion", AuthorID: *authorID, Available: true})
+		require.NoError(t, err)
+		require.NoError(t, db.BorrowBook(ctx, *secondID, *other))
+		thirdID, err := db.AddBook(ctx, database.BookRequest{Title: "Beren and Lúthien", AuthorID: *authorID, Available: true})
+		require.NoError(t, err)
+		require.NoError(t, db.BorrowBook(ctx, *thirdID, borrower.ID))
+
+		sink.Reject("skunk@hotmail.com", true)
+		scheduler.now = func() time.Time { return time.Now().Add(database.LoanPeriod + 24*time.Hour) }
+		sent, err := scheduler.RemindDue(ctx)
+		assert.ErrorContains(t, err, other.String())
+		assert.Equal(t, 1, sent)
+	})
+}
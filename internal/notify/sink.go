@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"curly-computing-machine/internal/database"
+)
+
+// Sink welcomes borrowers and asks them to verify their email address as
+// their borrower.created events are relayed from the outbox. The sent-message
+// log keeps an event relayed again from emailing them twice.
+type Sink struct {
+	notifier *Notifier
+}
+
+func NewSink(notifier *Notifier) *Sink {
+	return &Sink{notifier: notifier}
+}
+
+func (s *Sink) Name() string {
+	return "email"
+}
+
+func (s *Sink) Dispatch(ctx context.Context, event database.OutboxEvent) error {
+	if event.Type != database.BorrowerCreated {
+		return nil
+	}
+
+	var data database.BorrowerCreatedData
+	err := json.Unmarshal(event.Payload, &data)
+	if err != nil {
+		return fmt.Errorf("decode %s event: %v", event.Type, err)
+	}
+
+	_, err = s.notifier.Welcome(ctx, data.Borrower)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.notifier.SendVerification(ctx, data.Borrower, data.Borrower.ID.String())
+	return err
+}
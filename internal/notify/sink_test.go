@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSink(t *testing.T) {
+	ctx := context.Background()
+	notifier, sink, db, borrower := newTestNotifier(t)
+	emails := NewSink(notifier)
+
+	events, err := db.ClaimOutboxEvents(ctx, time.Now().Add(time.Second), time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, database.BorrowerCreated, events[0].Type)
+
+	t.Run("should welcome new borrowers and ask them to verify their email once", func(t *testing.T) {
+		require.NoError(t, emails.Dispatch(ctx, events[0]))
+		require.NoError(t, emails.Dispatch(ctx, events[0]))
+
+		messages := sink.Received()
+		require.Len(t, messages, 2)
+		assert.Equal(t, borrower.Email, messages[0].To)
+		assert.Equal(t, "Welcome to the library, Bober", messages[0].Subject)
+		assert.Equal(t, borrower.Email, messages[1].To)
+		assert.Equal(t, "Verify your email address", messages[1].Subject)
+		assert.Contains(t, messages[1].Body, "http://localhost:8080/v1/email-verification?token=")
+	})
+
+	t.Run("should ignore other events", func(t *testing.T) {
+		event, err := database.NewOutboxEvent(database.BookCreated, database.BookCreatedData{Book: database.Book{Title: "Hobbit"}})
+		require.NoError(t, err)
+
+		require.NoError(t, emails.Dispatch(ctx, event))
+		assert.Len(t, sink.Received(), 2)
+	})
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// templateFS holds a directory per locale with a template per kind of
+// notification. Each template defines a "subject" and a "body".
+//
+//go:embed templates
+var templateFS embed.FS
+
+// Data is what templates are rendered with.
+type Data struct {
+	// Name is the borrower's.
+	Name      string
+	BookTitle string
+	// DueAt is when the loan is due or, for holds, when the book stops
+	// being kept.
+	DueAt time.Time
+	// Days is how many days are left until DueAt, or how many have passed
+	// since it for overdue loans.
+	Days int
+	// Link is the URL borrowers follow to verify their email address.
+	Link string
+}
+
+var funcs = template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+}
+
+// Templates are the notification templates by locale and kind.
+type Templates struct {
+	locales map[string]map[string]*template.Template
+}
+
+// LoadTemplates parses the templates in fsys, which has templateFS's layout,
+// and checks that every locale has every kind.
+func LoadTemplates(fsys fs.FS) (*Templates, error) {
+	dirs, err := fs.ReadDir(fsys, "templates")
+	if err != nil {
+		return nil, fmt.Errorf("read templates: %v", err)
+	}
+
+	templates := &Templates{locales: map[string]map[string]*template.Template{}}
+	for _, dir := range dirs {
+		locale := dir.Name()
+		templates.locales[locale] = map[string]*template.Template{}
+
+		for _, kind := range slices.Concat(database.NotificationKinds, []string{database.NotificationVerifyEmail}) {
+			file := path.Join("templates", locale, kind+".tmpl")
+			tmpl, err := template.New(kind).Funcs(funcs).ParseFS(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %v", file, err)
+			}
+			if tmpl.Lookup("subject") == nil || tmpl.Lookup("body") == nil {
+				return nil, fmt.Errorf("%s must define a subject and a body", file)
+			}
+			templates.locales[locale][kind] = tmpl
+		}
+	}
+
+	if templates.locales[database.DefaultLocale] == nil {
+		return nil, fmt.Errorf("no templates for the default locale %q", database.DefaultLocale)
+	}
+
+	return templates, nil
+}
+
+// Render returns the subject and body of the kind of email in locale, and
+// the locale it was rendered in. Locales without templates fall back to
+// their language, like pt-BR to pt, and then to the default locale.
+func (t *Templates) Render(locale, kind string, data Data) (subject, body, rendered string, err error) {
+	rendered = t.match(locale)
+	tmpl, ok := t.locales[rendered][kind]
+	if !ok {
+		return "", "", "", fmt.Errorf("no %s template", kind)
+	}
+
+	var b bytes.Buffer
+	err = tmpl.ExecuteTemplate(&b, "subject", data)
+	if err != nil {
+		return "", "", "", fmt.Errorf("render %s subject: %v", kind, err)
+	}
+	subject = strings.Join(strings.Fields(b.String()), " ")
+
+	b.Reset()
+	err = tmpl.ExecuteTemplate(&b, "body", data)
+	if err != nil {
+		return "", "", "", fmt.Errorf("render %s body: %v", kind, err)
+	}
+
+	return subject, strings.TrimSpace(b.String()) + "\n", rendered, nil
+}
+
+func (t *Templates) match(locale string) string {
+	if _, ok := t.locales[locale]; ok {
+		return locale
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if _, ok := t.locales[language]; ok {
+		return language
+	}
+	return database.DefaultLocale
+}
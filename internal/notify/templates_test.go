@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates(t *testing.T) {
+	templates, err := LoadTemplates(templateFS)
+	require.NoError(t, err)
+
+	data := Data{
+		Name:      "Bober",
+		BookTitle: "Hobbit",
+		DueAt:     time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC),
+		Days:      3,
+		Link:      "http://localhost:8080/v1/email-verification?token=t",
+	}
+
+	locales, err := fs.ReadDir(templateFS, "templates")
+	require.NoError(t, err)
+	for _, locale := range locales {
+		for _, kind := range slices.Concat(database.NotificationKinds, []string{database.NotificationVerifyEmail}) {
+			t.Run("should render "+locale.Name()+" "+kind, func(t *testing.T) {
+				subject, body, rendered, err := templates.Render(locale.Name(), kind, data)
+				require.NoError(t, err)
+
+				assert.Equal(t, locale.Name(), rendered)
+				assert.NotEmpty(t, subject)
+				assert.NotContains(t, subject, "\n")
+				assert.Contains(t, body, "Bober")
+				assert.NotContains(t, subject+body, "<no value>")
+				switch kind {
+				case database.NotificationWelcome:
+				case database.NotificationVerifyEmail:
+					assert.Contains(t, body, data.Link)
+				default:
+					assert.Contains(t, subject+body, "Hobbit")
+				}
+			})
+		}
+	}
+
+	t.Run("should fall back to the language and then the default locale", func(t *testing.T) {
+		for locale, want := range map[string]string{
+			"es":    "es",
+			"es-MX": "es",
+			"pt-BR": database.DefaultLocale,
+			"":      database.DefaultLocale,
+		} {
+			_, _, rendered, err := templates.Render(locale, database.NotificationWelcome, data)
+			require.NoError(t, err)
+			assert.Equal(t, want, rendered, locale)
+		}
+	})
+
+	t.Run("should say when a loan is due", func(t *testing.T) {
+		for days, want := range map[int]string{
+			0: `"Hobbit" is due today`,
+			1: `"Hobbit" is due tomorrow`,
+			3: `"Hobbit" is due in 3 days`,
+		} {
+			data.Days = days
+			subject, body, _, err := templates.Render("en", database.NotificationDueSoon, data)
+			require.NoError(t, err)
+			assert.Equal(t, want, subject)
+			assert.Contains(t, body, "2024-03-05")
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+var (
+	verificationSecret = os.Getenv("VERIFICATION_SECRET")
+	verificationTTL    = os.Getenv("VERIFICATION_TTL")
+	verificationURL    = os.Getenv("VERIFICATION_URL")
+)
+
+// DefaultVerificationTTL is how long verification links work for unless
+// VERIFICATION_TTL says otherwise.
+const DefaultVerificationTTL = 48 * time.Hour
+
+// randomSecret stands in for VERIFICATION_SECRET, so that everything in the
+// process that signs or checks tokens agrees on it.
+var randomSecret = sync.OnceValue(func() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Fatalf("generate verification secret: %v", err)
+	}
+	log.Print("VERIFICATION_SECRET isn't set, so verification links stop working when the server restarts")
+	return secret
+})
+
+// Verifier signs the tokens emailed to borrowers to prove they own their
+// email address, and checks them when they come back. A token names the
+// borrower and the address it was sent to, so it stops working if the
+// borrower changes their email in the meantime.
+type Verifier struct {
+	secret []byte
+	ttl    time.Duration
+	url    string
+	now    func() time.Time
+}
+
+// NewVerifier returns a Verifier signing with secret tokens that expire after
+// ttl, linking to them at url.
+func NewVerifier(secret []byte, ttl time.Duration, url string) *Verifier {
+	return &Verifier{secret: secret, ttl: ttl, url: url, now: time.Now}
+}
+
+// VerifierFromEnv returns a Verifier signing with VERIFICATION_SECRET, with
+// tokens lasting VERIFICATION_TTL and linked to at VERIFICATION_URL, which
+// defaults to the API's own /v1/email-verification.
+func VerifierFromEnv() *Verifier {
+	secret := []byte(verificationSecret)
+	if len(secret) == 0 {
+		secret = randomSecret()
+	}
+
+	ttl := DefaultVerificationTTL
+	if verificationTTL != "" {
+		parsed, err := time.ParseDuration(verificationTTL)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("invalid VERIFICATION_TTL %q", verificationTTL)
+		}
+		ttl = parsed
+	}
+
+	link := verificationURL
+	if link == "" {
+		link = fmt.Sprintf("http://localhost:%s/v1/email-verification", os.Getenv("PORT"))
+	}
+
+	return NewVerifier(secret, ttl, link)
+}
+
+type claims struct {
+	BorrowerID database.ID `json:"sub"`
+	Email      string      `json:"email"`
+	ExpiresAt  int64       `json:"exp"`
+}
+
+// Token returns a token proving that whoever has it reads borrower's email.
+func (v *Verifier) Token(borrower database.Borrower) string {
+	payload, _ := json.Marshal(claims{
+		BorrowerID: borrower.ID,
+		Email:      borrower.Email,
+		ExpiresAt:  v.now().Add(v.ttl).Unix(),
+	})
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + v.sign(encoded)
+}
+
+// Link returns the URL emailed to borrower for verifying their address.
+func (v *Verifier) Link(borrower database.Borrower) string {
+	separator := "?"
+	if strings.Contains(v.url, "?") {
+		separator = "&"
+	}
+	return v.url + separator + "token=" + url.QueryEscape(v.Token(borrower))
+}
+
+// Check returns the borrower and email address token was issued for, as long
+// as it was signed by v and hasn't expired.
+func (v *Verifier) Check(token string) (database.ID, string, error) {
+	encoded, signed, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signed), []byte(v.sign(encoded))) {
+		return "", "", errors.New("invalid verification token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", errors.New("invalid verification token")
+	}
+	var c claims
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return "", "", errors.New("invalid verification token")
+	}
+
+	if v.now().Unix() >= c.ExpiresAt {
+		return "", "", errors.New("verification token has expired")
+	}
+
+	return c.BorrowerID, c.Email, nil
+}
+
+func (v *Verifier) sign(encoded string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	verifier := NewVerifier([]byte("secret"), time.Hour, "https://library.example.com/verify")
+	verifier.now = func() time.Time { return now }
+
+	borrower := database.Borrower{ID: database.NewID(), Name: "Bober", Email: "bober@hotmail.com"}
+	token := verifier.Token(borrower)
+
+	t.Run("should check its own tokens", func(t *testing.T) {
+		borrowerID, email, err := verifier.Check(token)
+		require.NoError(t, err)
+		assert.Equal(t, borrower.ID, borrowerID)
+		assert.Equal(t, borrower.Email, email)
+	})
+
+	t.Run("should link to the token", func(t *testing.T) {
+		link, err := url.Parse(verifier.Link(borrower))
+		require.NoError(t, err)
+		assert.Equal(t, "library.example.com", link.Host)
+		assert.Equal(t, token, link.Query().Get("token"))
+
+		withQuery := NewVerifier([]byte("secret"), time.Hour, "https://library.example.com/verify?lang=es")
+		assert.True(t, strings.HasPrefix(withQuery.Link(borrower), "https://library.example.com/verify?lang=es&token="))
+	})
+
+	encoded, signed, _ := strings.Cut(token, ".")
+	testcases := []struct {
+		name  string
+		token string
+		check func(*Verifier)
+		err   string
+	}{
+		{name: "malformed", token: "token", err: "invalid verification token"},
+		{name: "tampered with", token: encoded + "x." + signed, err: "invalid verification token"},
+		{name: "unsigned", token: encoded + ".", err: "invalid verification token"},
+		{
+			name:  "signed with another secret",
+			token: NewVerifier([]byte("other"), time.Hour, "").Token(borrower),
+			err:   "invalid verification token",
+		},
+		{
+			name:  "expired",
+			token: token,
+			check: func(v *Verifier) { v.now = func() time.Time { return now.Add(time.Hour) } },
+			err:   "verification token has expired",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run("should reject tokens that are "+testcase.name, func(t *testing.T) {
+			v := *verifier
+			if testcase.check != nil {
+				testcase.check(&v)
+			}
+			_, _, err := v.Check(testcase.token)
+			assert.EqualError(t, err, testcase.err)
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package outbox
+
+import (
+	"context"
+	"log"
+
+	"curly-computing-machine/internal/database"
+)
+
+// LogSink writes events to a log, for seeing what's happening while
+// developing.
+type LogSink struct {
+	logger *log.Logger
+}
+
+func NewLogSink(logger *log.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+func (s *LogSink) Dispatch(ctx context.Context, event database.OutboxEvent) error {
+	s.logger.Printf("event %s %s: %s", event.Type, event.ID.String(), event.Payload)
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package outbox relays the domain events that backends write to their
+// outbox alongside the changes they report. A Relay claims undispatched
+// events and hands each one to every Sink, retrying with backoff until all
+// of them take it. Delivery is at least once: an event is dispatched again
+// if any sink failed or the relay died before recording the dispatch, so
+// sinks, and whoever they pass events to, should drop events whose ID
+// they've seen.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/notify"
+	"curly-computing-machine/internal/retry"
+	"curly-computing-machine/internal/webhooks"
+)
+
+var (
+	sinkNames   = os.Getenv("OUTBOX_SINKS")
+	interval    = os.Getenv("OUTBOX_POLL_INTERVAL")
+	retention   = os.Getenv("OUTBOX_RETENTION")
+	redisURL    = os.Getenv("OUTBOX_REDIS_URL")
+	redisStream = os.Getenv("OUTBOX_REDIS_STREAM")
+)
+
+// Sink is somewhere events are dispatched to.
+type Sink interface {
+	// Name identifies the sink in errors.
+	Name() string
+	// Dispatch hands event on. It may be called again with an event it
+	// already took.
+	Dispatch(ctx context.Context, event database.OutboxEvent) error
+}
+
+// Config tunes a Relay.
+type Config struct {
+	// PollInterval is how often the relay looks for events to dispatch.
+	PollInterval time.Duration
+	// Backoff is the wait before dispatching an event again after it
+	// failed. Each retry after it waits twice as long as the one before, up
+	// to MaxBackoff. Events are never given up on.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a claimed event is kept from other relays. It
+	// should outlast dispatching a batch.
+	Lease time.Duration
+	// Retention is how long dispatched events are kept before they're
+	// pruned.
+	Retention time.Duration
+	// BatchSize is how many events are claimed at a time.
+	BatchSize int
+}
+
+var DefaultConfig = Config{
+	PollInterval: time.Second,
+	Backoff:      time.Second,
+	MaxBackoff:   5 * time.Minute,
+	Lease:        time.Minute,
+	Retention:    7 * 24 * time.Hour,
+	BatchSize:    100,
+}
+
+// New returns a relay for db's outbox configured from the environment.
+// OUTBOX_SINKS is a comma-separated list of webhooks, email, log and redis,
+// and defaults to webhooks, along with email when SMTP_ADDR is set. The
+// redis sink adds events to the stream named by OUTBOX_REDIS_STREAM on the
+// server at OUTBOX_REDIS_URL.
+func New(db database.Service) *Relay {
+	config := DefaultConfig
+	retry.ParseDurations(
+		retry.Duration{Name: "OUTBOX_POLL_INTERVAL", Value: interval, Into: &config.PollInterval},
+		retry.Duration{Name: "OUTBOX_RETENTION", Value: retention, Into: &config.Retention},
+	)
+
+	names := sinkNames
+	if names == "" {
+		names = "webhooks"
+		if notify.Enabled() {
+			names += ",email"
+		}
+	}
+
+	var sinks []Sink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "webhooks":
+			sinks = append(sinks, webhooks.NewSink(db))
+		case "email":
+			if !notify.Enabled() {
+				log.Fatal("the email outbox sink needs SMTP_ADDR")
+			}
+			sinks = append(sinks, notify.NewSink(notify.New(db)))
+		case "log":
+			sinks = append(sinks, NewLogSink(log.Default()))
+		case "redis":
+			sink, err := NewRedisSink(redisURL, redisStream)
+			if err != nil {
+				log.Fatal(err)
+			}
+			sinks = append(sinks, sink)
+		default:
+			log.Fatalf("unknown outbox sink %q, want webhooks, email, log or redis", name)
+		}
+	}
+
+	return NewRelay(db, config, sinks...)
+}
+
+// Relay dispatches outbox events to sinks. Several relays, in this process
+// or others, can share a database: claiming an event keeps the others off
+// it while it's dispatched. Events are claimed oldest first, but one that
+// fails is retried after later ones, so sinks may see events out of order.
+type Relay struct {
+	db     database.Service
+	sinks  []Sink
+	config Config
+	now    func() time.Time
+}
+
+func NewRelay(db database.Service, config Config, sinks ...Sink) *Relay {
+	return &Relay{db: db, sinks: sinks, config: config, now: time.Now}
+}
+
+// Run dispatches events and prunes dispatched ones until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	dispatch := time.NewTicker(r.config.PollInterval)
+	defer dispatch.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-dispatch.C:
+			_, err := r.DispatchDue(ctx)
+			r.logErr("dispatch", err)
+		case <-prune.C:
+			_, err := r.db.PruneOutbox(ctx, r.now().Add(-r.config.Retention))
+			r.logErr("prune", err)
+		}
+	}
+}
+
+func (r *Relay) logErr(action string, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("outbox: %s: %v", action, err)
+	}
+}
+
+// DispatchDue dispatches every event that's due and returns how many it
+// dispatched to all the sinks.
+func (r *Relay) DispatchDue(ctx context.Context) (int, error) {
+	dispatched := 0
+	for {
+		claimed, err := r.db.ClaimOutboxEvents(ctx, r.now().UTC(), r.config.Lease, r.config.BatchSize)
+		if err != nil {
+			return dispatched, err
+		}
+
+		for _, event := range claimed {
+			ok, err := r.dispatch(ctx, event)
+			if err != nil {
+				return dispatched, err
+			}
+			if ok {
+				dispatched++
+			}
+		}
+
+		if len(claimed) < r.config.BatchSize {
+			return dispatched, nil
+		}
+	}
+}
+
+// dispatch hands an event to every sink and saves the outcome, reporting
+// whether they all took it.
+func (r *Relay) dispatch(ctx context.Context, event database.OutboxEvent) (bool, error) {
+	var failed error
+	for _, sink := range r.sinks {
+		err := sink.Dispatch(ctx, event)
+		if err != nil {
+			failed = fmt.Errorf("%s: %v", sink.Name(), err)
+			break
+		}
+	}
+
+	now := r.now().UTC()
+	if failed == nil {
+		event.DispatchedAt = &now
+		event.LastError = ""
+	} else {
+		event.Attempts++
+		event.NextAttemptAt = now.Add(r.Backoff(event.Attempts))
+		event.LastError = failed.Error()
+		log.Printf("outbox: dispatch %s %s: %v", event.Type, event.ID.String(), failed)
+	}
+
+	err := r.db.UpdateOutboxEvent(ctx, event)
+	if err != nil {
+		return false, err
+	}
+
+	return failed == nil, nil
+}
+
+// Backoff is how long to wait before dispatching an event again after
+// attempts failures.
+func (r *Relay) Backoff(attempts int) time.Duration {
+	return retry.Backoff(r.config.Backoff, r.config.MaxBackoff, attempts)
+}
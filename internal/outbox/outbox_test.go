@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink keeps the events dispatched to it, failing while err is set.
+type recordingSink struct {
+	mu     sync.Mutex
+	err    error
+	events []database.OutboxEvent
+}
+
+func (s *recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Dispatch(ctx context.Context, event database.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) types() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	types := []string{}
+	for _, event := range s.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func borrowAndReturn(t *testing.T, db database.Service) {
+	t.Helper()
+	ctx := context.Background()
+
+	birthday := time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+	authorID, err := db.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "bober@author.com"})
+	require.NoError(t, err)
+	borrowerID, err := db.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "bober@hotmail.com"})
+	require.NoError(t, err)
+	_, err = db.VerifyBorrower(ctx, *borrowerID, "bober@hotmail.com")
+	require.NoError(t, err)
+	bookID, err := db.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+	require.NoError(t, db.BorrowBook(ctx, *bookID, *borrowerID))
+	require.NoError(t, db.ReturnBook(ctx, *bookID))
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	borrowAndReturn(t, db)
+
+	first, second := &recordingSink{}, &recordingSink{}
+	relay := NewRelay(db, DefaultConfig, first, second)
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+
+	dispatched, err := relay.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, dispatched)
+
+	expected := []string{database.BorrowerCreated, database.BookCreated, database.BookBorrowed, database.BookReturned}
+	assert.Equal(t, expected, first.types())
+	assert.Equal(t, expected, second.types())
+
+	// Dispatched events aren't dispatched again
+	now = now.Add(time.Hour)
+	dispatched, err = relay.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, dispatched)
+	assert.Len(t, first.events, 4)
+
+	pruned, err := db.PruneOutbox(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 4, pruned)
+}
+
+func TestRelayRetries(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	borrowAndReturn(t, db)
+
+	first, failing := &recordingSink{}, &recordingSink{err: errors.New("broker is down")}
+	relay := NewRelay(db, DefaultConfig, first, failing)
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+
+	dispatched, err := relay.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, dispatched)
+	assert.Len(t, first.events, 4)
+
+	// Not due again until the backoff has passed
+	now = now.Add(DefaultConfig.Backoff - time.Millisecond)
+	dispatched, err = relay.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, dispatched)
+	assert.Len(t, first.events, 4)
+
+	// Sinks that took an event get it again, with the same ID, when another
+	// one failed
+	failing.err = nil
+	now = now.Add(time.Millisecond)
+	dispatched, err = relay.DispatchDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, dispatched)
+	require.Len(t, first.events, 8)
+	assert.Equal(t, first.events[0].ID, first.events[4].ID)
+	assert.Len(t, failing.events, 4)
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(memory.New(), Config{Backoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	testcases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 3, expected: 4 * time.Second},
+		{attempts: 5, expected: 10 * time.Second},
+		{attempts: 100, expected: 10 * time.Second},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(t, testcase.expected, relay.Backoff(testcase.attempts), "after %d attempts", testcase.attempts)
+	}
+}
+
+func TestRelayRun(t *testing.T) {
+	db := memory.New()
+	sink := &recordingSink{}
+	config := DefaultConfig
+	config.PollInterval = 10 * time.Millisecond
+	relay := NewRelay(db, config, sink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	borrowAndReturn(t, db)
+	assert.Eventually(t, func() bool { return len(sink.types()) == 4 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestLogSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewLogSink(log.New(&out, "", 0))
+
+	event, err := database.NewOutboxEvent(database.BookCreated, database.BookCreatedData{Book: database.Book{Title: "Hobbit"}})
+	require.NoError(t, err)
+	require.NoError(t, sink.Dispatch(context.Background(), event))
+
+	assert.Contains(t, out.String(), "event book.created "+event.ID.String())
+	assert.Contains(t, out.String(), `"title":"Hobbit"`)
+}
@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisStream is the stream events are added to when
+// OUTBOX_REDIS_STREAM isn't set.
+const DefaultRedisStream = "curly:events"
+
+// redisStreamLength is about how many events the stream keeps. Consumers
+// further behind than that lose the oldest.
+const redisStreamLength = 100_000
+
+// RedisSink adds events to a Redis stream, for consumers reading it with
+// XREAD or as a consumer group. Each entry has the event's id, type,
+// created_at and payload fields.
+type RedisSink struct {
+	client *redis.Client
+	stream string
+}
+
+// NewRedisSink connects to the server at url, such as
+// redis://:password@localhost:6379/0, to add events to stream.
+func NewRedisSink(url, stream string) (*RedisSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("OUTBOX_REDIS_URL is required for the redis sink")
+	}
+	if stream == "" {
+		stream = DefaultRedisStream
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse OUTBOX_REDIS_URL: %v", err)
+	}
+
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = client.Ping(ctx).Err()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %v", err)
+	}
+
+	return &RedisSink{client: client, stream: stream}, nil
+}
+
+func (s *RedisSink) Name() string {
+	return "redis"
+}
+
+func (s *RedisSink) Dispatch(ctx context.Context, event database.OutboxEvent) error {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: redisStreamLength,
+		Approx: true,
+		Values: map[string]any{
+			"id":         event.ID.String(),
+			"type":       event.Type,
+			"created_at": event.CreatedAt.Format(time.RFC3339Nano),
+			"payload":    string(event.Payload),
+		},
+	}).Err()
+}
@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisSink(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	sink, err := NewRedisSink("redis://"+server.Addr(), "")
+	require.NoError(t, err)
+
+	event, err := database.NewOutboxEvent(database.BookBorrowed, database.LoanData{Loan: database.NewLoan(database.NewID()), BorrowerID: database.NewID()})
+	require.NoError(t, err)
+	require.NoError(t, sink.Dispatch(ctx, event))
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	entries, err := client.XRange(ctx, DefaultRedisStream, "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, event.ID.String(), entries[0].Values["id"])
+	assert.Equal(t, database.BookBorrowed, entries[0].Values["type"])
+	assert.JSONEq(t, string(event.Payload), entries[0].Values["payload"].(string))
+
+	t.Run("should need a URL", func(t *testing.T) {
+		_, err := NewRedisSink("", "")
+		assert.Error(t, err)
+	})
+}
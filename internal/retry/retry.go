@@ -0,0 +1,45 @@
+// Package retry holds what the background workers that retry with
+// exponential backoff share: the backoff itself, and reading the durations
+// that tune them from the environment.
+package retry
+
+import (
+	"log"
+	"time"
+)
+
+// Backoff is how long to wait before trying again after attempts failures:
+// base after the first, and twice as long after each one after it, up to max.
+func Backoff(base, max time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= max {
+			return max
+		}
+	}
+	return min(backoff, max)
+}
+
+// Duration is a setting read from the environment variable Name, whose value
+// is Value, into Into.
+type Duration struct {
+	Name  string
+	Value string
+	Into  *time.Duration
+}
+
+// ParseDurations sets each duration whose variable is set, exiting if one
+// isn't a positive duration. The others keep the value they have.
+func ParseDurations(settings ...Duration) {
+	for _, setting := range settings {
+		if setting.Value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(setting.Value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("invalid %s %q", setting.Name, setting.Value)
+		}
+		*setting.Into = parsed
+	}
+}
@@ -0,0 +1,37 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	testcases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 4, expected: 8 * time.Second},
+		{attempts: 5, expected: 10 * time.Second},
+		{attempts: 100, expected: 10 * time.Second},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(t, testcase.expected, Backoff(time.Second, 10*time.Second, testcase.attempts), "after %d attempts", testcase.attempts)
+	}
+}
+
+func TestParseDurations(t *testing.T) {
+	poll, retention := time.Second, time.Hour
+
+	ParseDurations(
+		Duration{Name: "POLL", Value: "5s", Into: &poll},
+		Duration{Name: "RETENTION", Value: "", Into: &retention},
+	)
+
+	assert.Equal(t, 5*time.Second, poll)
+	assert.Equal(t, time.Hour, retention)
+}
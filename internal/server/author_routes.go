@@ -2,13 +2,11 @@ package server
 
 import (
 	"curly-computing-machine/internal/database"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (h *Server) CreateAuthor(w http.ResponseWriter, r *http.Request) {
@@ -16,28 +14,28 @@ func (h *Server) CreateAuthor(w http.ResponseWriter, r *http.Request) {
 
 	err := render.Bind(r, &authorRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		bindError(w, err)
 		return
 	}
 
 	authorID, err := h.db.CreateAuthor(r.Context(), authorRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	response := struct {
-		ID primitive.ObjectID `json:"id"`
+		ID database.ID `json:"id"`
 	}{
 		ID: *authorID,
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, response)
 }
 
 func (h *Server) GetAuthor(w http.ResponseWriter, r *http.Request) {
-	authorID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "author_id"))
+	authorID, err := database.ParseID(chi.URLParam(r, "author_id"))
 	if err != nil {
 		http.Error(w, "invalid author_id", http.StatusBadRequest)
 		return
@@ -54,5 +52,107 @@ func (h *Server) GetAuthor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if notModified(w, r, author.Version) {
+		return
+	}
+
+	render.Render(w, r, author)
+}
+
+func (h *Server) UpdateAuthor(w http.ResponseWriter, r *http.Request) {
+	authorID, err := database.ParseID(chi.URLParam(r, "author_id"))
+	if err != nil {
+		http.Error(w, "invalid author_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		author, err := h.db.GetAuthor(r.Context(), authorID)
+		if err != nil || author == nil {
+			return 0, false, err
+		}
+		return author.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	authorRequest := database.AuthorRequest{}
+
+	err = render.Bind(r, &authorRequest)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	author, err := h.db.UpdateAuthor(r.Context(), authorID, authorRequest, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if author == nil {
+		http.Error(w, fmt.Errorf("no author with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", etag(author.Version))
 	render.Render(w, r, author)
 }
+
+func (h *Server) DeleteAuthor(w http.ResponseWriter, r *http.Request) {
+	authorID, err := database.ParseID(chi.URLParam(r, "author_id"))
+	if err != nil {
+		http.Error(w, "invalid author_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		author, err := h.db.GetAuthor(r.Context(), authorID)
+		if err != nil || author == nil {
+			return 0, false, err
+		}
+		return author.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	deleted, err := h.db.DeleteAuthor(r.Context(), authorID, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, fmt.Errorf("no author with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AuthorBooks lists the books crediting an author, optionally only in the
+// role given by the role query parameter.
+func (h *Server) AuthorBooks(w http.ResponseWriter, r *http.Request) {
+	authorID, err := database.ParseID(chi.URLParam(r, "author_id"))
+	if err != nil {
+		http.Error(w, "invalid author_id", http.StatusBadRequest)
+		return
+	}
+
+	role := r.URL.Query().Get("role")
+	if role != "" && !database.IsContributorRole(role) {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	books, err := h.db.BooksByContributor(r.Context(), authorID, role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.setCoverURLsInList(r, books)
+	render.JSON(w, r, books)
+}
@@ -1,23 +1,32 @@
 package server
 
 import (
+	"bytes"
 	"curly-computing-machine/internal/database"
-	"encoding/json"
+	"curly-computing-machine/internal/marc"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (h *Server) ListBooks(w http.ResponseWriter, r *http.Request) {
-	books, err := h.db.ListBooks(r.Context())
+	expand, err := expandParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	books, err := h.db.ListBooks(r.Context(), expand)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(books)
+	h.setCoverURLsInList(r, books)
+	render.JSON(w, r, books)
 }
 
 func (h *Server) AddBook(w http.ResponseWriter, r *http.Request) {
@@ -25,40 +34,54 @@ func (h *Server) AddBook(w http.ResponseWriter, r *http.Request) {
 
 	err := render.Bind(r, &bookRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		bindError(w, err)
 		return
 	}
 
 	bookID, err := h.db.AddBook(r.Context(), bookRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	response := struct {
-		ID primitive.ObjectID `json:"id"`
+		ID database.ID `json:"id"`
 	}{
 		ID: *bookID,
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, response)
 }
 
 func (h *Server) BorrowBook(w http.ResponseWriter, r *http.Request) {
-	bookID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "book_id"))
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
 	if err != nil {
 		http.Error(w, "invalid book_id", http.StatusBadRequest)
 		return
 	}
 
-	borrowerID, err := primitive.ObjectIDFromHex(r.URL.Query().Get("borrower_id"))
+	borrowerID, err := database.ParseID(r.URL.Query().Get("borrower_id"))
 	if err != nil {
 		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
 		return
 	}
 
-	err = h.db.BorrowBook(r.Context(), bookID, borrowerID)
+	// Librarians may lend books to borrowers too young for them, saying why
+	if reason := r.URL.Query().Get("override_reason"); reason != "" {
+		librarian, ok := h.librarian(r)
+		if !ok {
+			http.Error(w, "only librarians can override age restrictions", http.StatusForbidden)
+			return
+		}
+		err = h.db.BorrowBookWithOverride(r.Context(), bookID, borrowerID, database.Override{Librarian: librarian, Reason: reason})
+	} else {
+		err = h.db.BorrowBook(r.Context(), bookID, borrowerID)
+	}
+	if errors.Is(err, database.ErrBorrowerNotVerified) || errors.Is(err, database.ErrAgeRestricted) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -66,3 +89,185 @@ func (h *Server) BorrowBook(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (h *Server) GetBook(w http.ResponseWriter, r *http.Request) {
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
+	if err != nil {
+		http.Error(w, "invalid book_id", http.StatusBadRequest)
+		return
+	}
+
+	expand, err := expandParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.db.GetBookExpanded(r.Context(), bookID, expand)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if book == nil {
+		http.Error(w, fmt.Errorf("no book with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	// Embedded documents change without the book's version moving, so
+	// expanded reads carry the ETag for If-Match but are never 304
+	if expand != (database.Expand{}) {
+		w.Header().Set("ETag", etag(book.Version))
+	} else if notModified(w, r, book.Version) {
+		return
+	}
+
+	h.setCoverURLs(r, book)
+	render.Render(w, r, book)
+}
+
+// GetBookByISBN looks a book up by ISBN-10 or ISBN-13, with or without
+// hyphens.
+func (h *Server) GetBookByISBN(w http.ResponseWriter, r *http.Request) {
+	isbn, err := database.NormalizeISBN(chi.URLParam(r, "isbn"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.db.GetBookByISBN(r.Context(), isbn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if book == nil {
+		http.Error(w, fmt.Errorf("no book with this ISBN").Error(), http.StatusNotFound)
+		return
+	}
+
+	if notModified(w, r, book.Version) {
+		return
+	}
+
+	h.setCoverURLs(r, book)
+	render.Render(w, r, book)
+}
+
+// ExportBookMARC renders a book and its contributors as a MARCXML record.
+func (h *Server) ExportBookMARC(w http.ResponseWriter, r *http.Request) {
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
+	if err != nil {
+		http.Error(w, "invalid book_id", http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.db.GetBook(r.Context(), bookID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if book == nil {
+		http.Error(w, fmt.Errorf("no book with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	authors := make(map[database.ID]*database.Author)
+	for _, contributor := range append(book.Contributors, database.Contributor{AuthorID: book.AuthorID}) {
+		if _, ok := authors[contributor.AuthorID]; ok {
+			continue
+		}
+
+		author, err := h.db.GetAuthor(r.Context(), contributor.AuthorID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		authors[contributor.AuthorID] = author
+	}
+
+	var body bytes.Buffer
+	err = marc.WriteXML(&body, []marc.Record{marc.FromBook(*book, authors)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/marcxml+xml")
+	w.Write(body.Bytes())
+}
+
+func (h *Server) UpdateBook(w http.ResponseWriter, r *http.Request) {
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
+	if err != nil {
+		http.Error(w, "invalid book_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		book, err := h.db.GetBook(r.Context(), bookID)
+		if err != nil || book == nil {
+			return 0, false, err
+		}
+		return book.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	bookRequest := database.BookRequest{}
+
+	err = render.Bind(r, &bookRequest)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	book, err := h.db.UpdateBook(r.Context(), bookID, bookRequest, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if book == nil {
+		http.Error(w, fmt.Errorf("no book with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", etag(book.Version))
+	h.setCoverURLs(r, book)
+	render.Render(w, r, book)
+}
+
+func (h *Server) DeleteBook(w http.ResponseWriter, r *http.Request) {
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
+	if err != nil {
+		http.Error(w, "invalid book_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		book, err := h.db.GetBook(r.Context(), bookID)
+		if err != nil || book == nil {
+			return 0, false, err
+		}
+		return book.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	deleted, err := h.db.DeleteBook(r.Context(), bookID, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, fmt.Errorf("no book with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
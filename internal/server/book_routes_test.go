@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookRoutes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	authorID, err := s.db.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: time.Date(1970, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@author.com"})
+	require.NoError(t, err)
+	bookID, err := s.db.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+	missingID := database.NewID()
+
+	t.Run("should not add books crediting missing authors", func(t *testing.T) {
+		rec := s.do(http.MethodPost, "/v1/books", fmt.Sprintf(`{"title":"Hoho","author_id":%q}`, missingID.String()), nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+		assert.Equal(t, "author doesn't exist: "+missingID.String()+"\n", rec.Body.String())
+	})
+
+	t.Run("should not update books to credit missing authors", func(t *testing.T) {
+		body := fmt.Sprintf(`{"title":"Hobbit","author_id":%q,"contributors":[{"author_id":%q,"role":"editor"}]}`, authorID.String(), missingID.String())
+		rec := s.do(http.MethodPut, "/v1/books/"+bookID.String(), body, http.Header{"If-Match": {`"1"`}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+
+	t.Run("should not delete what's still in use", func(t *testing.T) {
+		borrowerID, err := s.db.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bober", Birthday: time.Date(1970, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@hotmail.com"})
+		require.NoError(t, err)
+		_, err = s.db.VerifyBorrower(ctx, *borrowerID, "bober@hotmail.com")
+		require.NoError(t, err)
+		require.NoError(t, s.db.BorrowBook(ctx, *bookID, *borrowerID))
+
+		tests := []struct {
+			path string
+			err  error
+		}{
+			{path: "/v1/books/" + bookID.String(), err: database.ErrBookBorrowed},
+			{path: "/v1/borrowers/" + borrowerID.String(), err: database.ErrBorrowerHasBooks},
+			{path: "/v1/authors/" + authorID.String(), err: database.ErrAuthorHasBooks},
+		}
+		for _, tt := range tests {
+			rec := s.do(http.MethodDelete, tt.path, "", http.Header{"If-Match": {"*"}})
+			assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.err.Error()+"\n", rec.Body.String())
+		}
+	})
+}
@@ -2,13 +2,11 @@ package server
 
 import (
 	"curly-computing-machine/internal/database"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (h *Server) CreateBorrower(w http.ResponseWriter, r *http.Request) {
@@ -16,28 +14,28 @@ func (h *Server) CreateBorrower(w http.ResponseWriter, r *http.Request) {
 
 	err := render.Bind(r, &borrowerRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		bindError(w, err)
 		return
 	}
 
 	borrowerID, err := h.db.CreateBorrower(r.Context(), borrowerRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	response := struct {
-		ID primitive.ObjectID `json:"id"`
+		ID database.ID `json:"id"`
 	}{
 		ID: *borrowerID,
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, response)
 }
 
 func (h *Server) GetBorrower(w http.ResponseWriter, r *http.Request) {
-	borrowerID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "borrower_id"))
+	borrowerID, err := database.ParseID(chi.URLParam(r, "borrower_id"))
 	if err != nil {
 		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
 		return
@@ -54,21 +52,105 @@ func (h *Server) GetBorrower(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if notModified(w, r, borrower.Version) {
+		return
+	}
+
 	render.Render(w, r, borrower)
 }
 
 func (h *Server) BorrowedBooks(w http.ResponseWriter, r *http.Request) {
-	borrowerID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "borrower_id"))
+	borrowerID, err := database.ParseID(chi.URLParam(r, "borrower_id"))
 	if err != nil {
 		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
 		return
 	}
 
-	books, err := h.db.BorrowedBooks(r.Context(), borrowerID)
+	expand, err := expandParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	books, err := h.db.BorrowedBooks(r.Context(), borrowerID, expand)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(books)
+	h.setCoverURLsInList(r, books)
+	render.JSON(w, r, books)
+}
+
+func (h *Server) UpdateBorrower(w http.ResponseWriter, r *http.Request) {
+	borrowerID, err := database.ParseID(chi.URLParam(r, "borrower_id"))
+	if err != nil {
+		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		borrower, err := h.db.GetBorrower(r.Context(), borrowerID)
+		if err != nil || borrower == nil {
+			return 0, false, err
+		}
+		return borrower.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	borrowerRequest := database.BorrowerRequest{}
+
+	err = render.Bind(r, &borrowerRequest)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	borrower, err := h.db.UpdateBorrower(r.Context(), borrowerID, borrowerRequest, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if borrower == nil {
+		http.Error(w, fmt.Errorf("no borrower with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", etag(borrower.Version))
+	render.Render(w, r, borrower)
+}
+
+func (h *Server) DeleteBorrower(w http.ResponseWriter, r *http.Request) {
+	borrowerID, err := database.ParseID(chi.URLParam(r, "borrower_id"))
+	if err != nil {
+		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		borrower, err := h.db.GetBorrower(r.Context(), borrowerID)
+		if err != nil || borrower == nil {
+			return 0, false, err
+		}
+		return borrower.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	deleted, err := h.db.DeleteBorrower(r.Context(), borrowerID, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, fmt.Errorf("no borrower with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"curly-computing-machine/internal/cover"
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// coverCacheControl lets clients and proxies keep covers but revalidate
+// them on every use, since a cover's URL stays the same across uploads.
+// Uploads store new files, so a changed cover always has a new ETag.
+const coverCacheControl = "public, no-cache"
+
+// SetBookCover stores the body as the book's cover and generates its
+// thumbnail. The body must be a JPEG, PNG or WebP image matching its
+// Content-Type. Like other writes to a book, it must carry If-Match.
+func (h *Server) SetBookCover(w http.ResponseWriter, r *http.Request) {
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
+	if err != nil {
+		http.Error(w, "invalid book_id", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r, func() (int64, bool, error) {
+		book, err := h.db.GetBook(r.Context(), bookID)
+		if err != nil || book == nil {
+			return 0, false, err
+		}
+		return book.Version, true, nil
+	})
+	if !ok {
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, cover.ErrUnsupportedType.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	image, err := io.ReadAll(r.Body)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	err = cover.Validate(contentType, image)
+	if err != nil {
+		if errors.Is(err, cover.ErrUnsupportedType) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	thumbnail, thumbnailType, err := cover.Thumbnail(contentType, image)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.db.SetBookCover(r.Context(), bookID, database.CoverUpload{
+		ContentType:          contentType,
+		Image:                image,
+		ThumbnailContentType: thumbnailType,
+		Thumbnail:            thumbnail,
+	}, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if book == nil {
+		http.Error(w, fmt.Errorf("no book with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	h.setCoverURLs(r, book)
+	w.Header().Set("ETag", etag(book.Version))
+	render.Render(w, r, book)
+}
+
+func (h *Server) GetBookCover(w http.ResponseWriter, r *http.Request) {
+	h.serveCover(w, r, false)
+}
+
+func (h *Server) GetBookCoverThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serveCover(w, r, true)
+}
+
+// serveCover writes a stored cover with caching headers. http.ServeContent
+// answers conditional and range requests from them.
+func (h *Server) serveCover(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	bookID, err := database.ParseID(chi.URLParam(r, "book_id"))
+	if err != nil {
+		http.Error(w, "invalid book_id", http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.db.GetBookCover(r.Context(), bookID, thumbnail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if file == nil {
+		http.Error(w, fmt.Errorf("no cover for a book with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, file.ID.String()))
+	w.Header().Set("Cache-Control", coverCacheControl)
+	http.ServeContent(w, r, "", file.UploadedAt, bytes.NewReader(file.Data))
+}
+
+// setCoverURLs points each book that has a cover at where the API version
+// serving r exposes it.
+func (h *Server) setCoverURLs(r *http.Request, books ...*database.Book) {
+	prefix := h.apiPrefix(r)
+	for _, book := range books {
+		if book.Cover != nil {
+			book.CoverURL = prefix + "/books/" + book.ID.String() + "/cover"
+		}
+	}
+}
+
+// setCoverURLsInList is setCoverURLs for a slice of books.
+func (h *Server) setCoverURLsInList(r *http.Request, books []database.Book) {
+	for i := range books {
+		h.setCoverURLs(r, &books[i])
+	}
+}
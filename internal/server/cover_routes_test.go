@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverRoutes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, func(s *Server) { s.maxCoverBytes = 1 << 20 })
+
+	authorID, err := s.db.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: time.Date(1970, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@author.com"})
+	require.NoError(t, err)
+	bookID, err := s.db.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+
+	var cover bytes.Buffer
+	err = png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	require.NoError(t, err)
+	path := "/v1/books/" + bookID.String() + "/cover"
+
+	t.Run("should require If-Match", func(t *testing.T) {
+		rec := s.do(http.MethodPut, path, cover.String(), http.Header{"Content-Type": {"image/png"}})
+		assert.Equal(t, http.StatusPreconditionRequired, rec.Code, rec.Body.String())
+	})
+
+	t.Run("should store the cover at the current version", func(t *testing.T) {
+		rec := s.do(http.MethodPut, path, cover.String(), http.Header{"Content-Type": {"image/png"}, "If-Match": {`"1"`}})
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("should have the cover revalidated by its ETag", func(t *testing.T) {
+		rec := s.do(http.MethodGet, path, "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "public, no-cache", rec.Header().Get("Cache-Control"))
+
+		rec = s.do(http.MethodGet, path, "", http.Header{"If-None-Match": {rec.Header().Get("ETag")}})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("should keep the cover when the version is stale", func(t *testing.T) {
+		book, err := s.db.GetBook(ctx, *bookID)
+		require.NoError(t, err)
+
+		rec := s.do(http.MethodPut, path, cover.String(), http.Header{"Content-Type": {"image/png"}, "If-Match": {`"1"`}})
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+		unchanged, err := s.db.GetBook(ctx, *bookID)
+		require.NoError(t, err)
+		assert.Equal(t, book.Cover.ID, unchanged.Cover.ID)
+	})
+}
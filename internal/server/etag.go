@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"curly-computing-machine/internal/database"
+)
+
+// etag formats a document version as a strong entity tag.
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// notModified sets the ETag for version and reports whether the client's
+// If-None-Match already names it, in which case a 304 has been written.
+func notModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	tag := etag(version)
+	w.Header().Set("ETag", tag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion reads the version a write is conditioned on. Writes must
+// carry If-Match; "*" matches whatever version current reports. When it
+// returns false the error response has already been written.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, current func() (int64, bool, error)) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+
+	if header == "*" {
+		version, exists, err := current()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return 0, false
+		}
+		if !exists {
+			http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+			return 0, false
+		}
+		return version, true
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || strings.Contains(header, ",") || strings.HasPrefix(header, "W/") {
+		http.Error(w, "If-Match must be a single strong ETag", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return version, true
+}
+
+// writeError reports a failed write, mapping version conflicts to 412,
+// unique field conflicts and deletes of what's still in use to 409,
+// references to missing authors to 400 and everything else to 500.
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrVersionMismatch) {
+		http.Error(w, "precondition failed: resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	var conflict *database.ConflictError
+	if errors.As(err, &conflict) {
+		http.Error(w, conflict.Error(), http.StatusConflict)
+		return
+	}
+
+	for _, inUse := range []error{database.ErrGuardianOfOthers, database.ErrBookBorrowed, database.ErrAuthorHasBooks, database.ErrBorrowerHasBooks} {
+		if errors.Is(err, inUse) {
+			http.Error(w, inUse.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	var missingAuthor *database.MissingAuthorError
+	if errors.As(err, &missingAuthor) {
+		http.Error(w, missingAuthor.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var guardian *database.GuardianError
+	if errors.As(err, &guardian) {
+		http.Error(w, guardian.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotModified(t *testing.T) {
+	testcases := []struct {
+		name         string
+		ifNoneMatch  string
+		notModified  bool
+		expectedCode int
+	}{
+		{name: "should serve without If-None-Match", ifNoneMatch: "", notModified: false, expectedCode: http.StatusOK},
+		{name: "should serve a changed resource", ifNoneMatch: `"2"`, notModified: false, expectedCode: http.StatusOK},
+		{name: "should return 304 for a matching tag", ifNoneMatch: `"3"`, notModified: true, expectedCode: http.StatusNotModified},
+		{name: "should return 304 for a weak match in a list", ifNoneMatch: `"1", W/"3"`, notModified: true, expectedCode: http.StatusNotModified},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/books/1", nil)
+			if testcase.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", testcase.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			assert.Equal(t, testcase.notModified, notModified(rec, req, 3))
+			assert.Equal(t, testcase.expectedCode, rec.Code)
+			assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	current := func() (int64, bool, error) { return 7, true, nil }
+	missing := func() (int64, bool, error) { return 0, false, nil }
+
+	testcases := []struct {
+		name         string
+		ifMatch      string
+		current      func() (int64, bool, error)
+		version      int64
+		ok           bool
+		expectedCode int
+	}{
+		{name: "should require If-Match", ifMatch: "", current: current, ok: false, expectedCode: http.StatusPreconditionRequired},
+		{name: "should parse a strong tag", ifMatch: `"4"`, current: current, version: 4, ok: true, expectedCode: http.StatusOK},
+		{name: "should resolve a wildcard", ifMatch: "*", current: current, version: 7, ok: true, expectedCode: http.StatusOK},
+		{name: "should fail a wildcard for a missing resource", ifMatch: "*", current: missing, ok: false, expectedCode: http.StatusPreconditionFailed},
+		{name: "should reject a weak tag", ifMatch: `W/"4"`, current: current, ok: false, expectedCode: http.StatusBadRequest},
+		{name: "should reject a malformed tag", ifMatch: `"abc"`, current: current, ok: false, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/books/1", nil)
+			if testcase.ifMatch != "" {
+				req.Header.Set("If-Match", testcase.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			version, ok := ifMatchVersion(rec, req, testcase.current)
+
+			assert.Equal(t, testcase.ok, ok)
+			assert.Equal(t, testcase.version, version)
+			assert.Equal(t, testcase.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, fmt.Errorf("update book: %w", database.ErrVersionMismatch))
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	writeError(rec, &database.ConflictError{Resource: "author", Field: "email"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "email already exists\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	writeError(rec, &database.MissingAuthorError{AuthorID: "6ad60d8f7ddcb5431855ba24"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "author doesn't exist: 6ad60d8f7ddcb5431855ba24\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	writeError(rec, fmt.Errorf("get authors: connection refused"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
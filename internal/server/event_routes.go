@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"curly-computing-machine/internal/database"
+)
+
+// heartbeatInterval is how often an idle event stream gets a comment, so
+// proxies don't close it.
+const heartbeatInterval = 15 * time.Second
+
+// StreamEvents sends book events as Server-Sent Events until the client goes
+// away. Browsers reconnect with the Last-Event-ID header, and get what they
+// missed; if that's no longer known they get a reset event first, telling
+// them to reload the books they show.
+func (h *Server) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	reset := false
+	events, err := h.bookEvents.WatchBooks(r.Context(), r.Header.Get("Last-Event-ID"))
+	if errors.Is(err, database.ErrCannotResume) {
+		reset = true
+		events, err = h.bookEvents.WatchBooks(r.Context(), "")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if reset {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	if controller.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				// The client reconnects and resumes
+				return
+			}
+
+			if event.Book != nil {
+				h.setCoverURLs(r, event.Book)
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("encode event %s: %v", event.ID, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+
+		if controller.Flush() != nil {
+			return
+		}
+	}
+}
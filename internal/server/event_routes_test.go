@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+	"curly-computing-machine/internal/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is one event read off a stream; comments and retry hints are
+// skipped.
+type sseEvent struct {
+	id, event, data string
+}
+
+func readEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			event.data = value
+		case "":
+			if event.event != "" {
+				return event
+			}
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	bus := events.NewBus(events.DefaultHistory)
+	db := events.NewService(memory.New(), bus)
+	s := &Server{
+		readLimiter:  newRateLimiter(100, 100),
+		writeLimiter: newRateLimiter(100, 100),
+		db:           db,
+		bookEvents:   bus,
+	}
+
+	server := httptest.NewUnstartedServer(s.RegisterRoutes())
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	ctx := context.Background()
+	authorID, err := db.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@author.com"})
+	require.NoError(t, err)
+
+	subscribe := func(t *testing.T, lastEventID string) *bufio.Reader {
+		ctx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body)
+	}
+
+	var created sseEvent
+
+	t.Run("should stream book events past the write timeout", func(t *testing.T) {
+		stream := subscribe(t, "")
+		time.Sleep(2 * server.Config.WriteTimeout)
+
+		bookID, err := db.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+		require.NoError(t, err)
+
+		created = readEvent(t, stream)
+		assert.NotEmpty(t, created.id)
+		assert.Equal(t, database.BookCreated, created.event)
+		assert.Contains(t, created.data, `"book_id":"`+bookID.String()+`"`)
+		assert.Contains(t, created.data, `"title":"Hobbit"`)
+	})
+
+	t.Run("should resume after the last event", func(t *testing.T) {
+		_, err := db.AddBook(ctx, database.BookRequest{Title: "Silmarillion", AuthorID: *authorID})
+		require.NoError(t, err)
+
+		event := readEvent(t, subscribe(t, created.id))
+		assert.Equal(t, database.BookCreated, event.event)
+		assert.Contains(t, event.data, `"title":"Silmarillion"`)
+	})
+
+	t.Run("should reset clients that can't resume", func(t *testing.T) {
+		event := readEvent(t, subscribe(t, "unknown"))
+		assert.Equal(t, "reset", event.event)
+	})
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"curly-computing-machine/internal/database"
+)
+
+// expandParam reads the comma separated expand query parameter, which may
+// name author and borrower.
+func expandParam(r *http.Request) (database.Expand, error) {
+	var expand database.Expand
+
+	for _, value := range r.URL.Query()["expand"] {
+		for _, name := range strings.Split(value, ",") {
+			switch strings.TrimSpace(name) {
+			case "":
+			case "author":
+				expand.Author = true
+			case "borrower":
+				expand.Borrower = true
+			default:
+				return expand, fmt.Errorf("unknown expand %q", name)
+			}
+		}
+	}
+
+	return expand, nil
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandParam(t *testing.T) {
+	testcases := []struct {
+		name   string
+		query  string
+		expand database.Expand
+		errMsg string
+	}{
+		{name: "should expand nothing by default", query: ""},
+		{name: "should expand the author", query: "?expand=author", expand: database.Expand{Author: true}},
+		{name: "should expand a list", query: "?expand=author,%20borrower", expand: database.Expand{Author: true, Borrower: true}},
+		{name: "should expand repeated parameters", query: "?expand=borrower&expand=author", expand: database.Expand{Author: true, Borrower: true}},
+		{name: "should reject unknown names", query: "?expand=publisher", errMsg: `unknown expand "publisher"`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			expand, err := expandParam(httptest.NewRequest("GET", "/v1/books"+tc.query, nil))
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expand, expand)
+		})
+	}
+}
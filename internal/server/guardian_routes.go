@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// ListChildren lists the child accounts a borrower is the guardian of.
+func (h *Server) ListChildren(w http.ResponseWriter, r *http.Request) {
+	borrower, ok := h.borrowerParam(w, r)
+	if !ok {
+		return
+	}
+
+	children, err := h.db.ListChildren(r.Context(), borrower.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, children)
+}
+
+// CreateChild creates a child account with the borrower as its guardian.
+func (h *Server) CreateChild(w http.ResponseWriter, r *http.Request) {
+	guardian, ok := h.borrowerParam(w, r)
+	if !ok {
+		return
+	}
+
+	borrowerRequest := database.BorrowerRequest{}
+	err := render.Bind(r, &borrowerRequest)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+	borrowerRequest.GuardianID = &guardian.ID
+
+	borrowerID, err := h.db.CreateBorrower(r.Context(), borrowerRequest)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	response := struct {
+		ID database.ID `json:"id"`
+	}{
+		ID: *borrowerID,
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, response)
+}
+
+// ListAgeOverrides lists the age-restricted books librarians have lent the
+// borrower anyway. Overrides are kept when the borrower is deleted, so they
+// can still be listed by the borrower's ID.
+func (h *Server) ListAgeOverrides(w http.ResponseWriter, r *http.Request) {
+	borrowerID, err := database.ParseID(chi.URLParam(r, "borrower_id"))
+	if err != nil {
+		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
+		return
+	}
+
+	overrides, err := h.db.ListAgeOverrides(r.Context(), borrowerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(overrides) == 0 {
+		if _, ok := h.borrowerParam(w, r); !ok {
+			return
+		}
+	}
+
+	render.JSON(w, r, overrides)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgeRestrictionRoutes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, func(s *Server) { s.librarians = []librarian{{name: "ania", key: "ania-key"}} })
+	db := s.db
+
+	authorID, err := db.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: time.Date(1970, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@author.com"})
+	require.NoError(t, err)
+	parentID, err := db.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bober", Birthday: time.Date(1980, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@hotmail.com"})
+	require.NoError(t, err)
+
+	librarian := http.Header{"X-Api-Key": {"ania-key"}}
+
+	t.Run("should only let librarians manage child accounts", func(t *testing.T) {
+		for _, header := range []http.Header{nil, {"X-Api-Key": {"wrong-key"}}} {
+			rec := s.do(http.MethodPost, "/v1/borrowers/"+parentID.String()+"/children", `{"name":"Bobrzyk","birthday":"2016-01-01T00:00:00Z","email":"bobrzyk@hotmail.com"}`, header)
+			assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+			for _, path := range []string{"/children", "/age-overrides"} {
+				rec = s.do(http.MethodGet, "/v1/borrowers/"+parentID.String()+path, "", header)
+				assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+			}
+		}
+	})
+
+	var childID database.ID
+	t.Run("should create child accounts for guardians", func(t *testing.T) {
+		birthday := time.Now().UTC().Truncate(24*time.Hour).AddDate(-10, 0, -1)
+		body := fmt.Sprintf(`{"name":"Bobrzyk","birthday":%q,"email":"bobrzyk@hotmail.com"}`, birthday.Format(time.RFC3339))
+
+		rec := s.do(http.MethodPost, "/v1/borrowers/"+parentID.String()+"/children", body, librarian)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		var created struct {
+			ID database.ID `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		childID = created.ID
+
+		rec = s.do(http.MethodGet, "/v1/borrowers/"+parentID.String()+"/children", "", librarian)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var children []database.Borrower
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &children))
+		require.Len(t, children, 1)
+		assert.Equal(t, childID, children[0].ID)
+		assert.Equal(t, parentID, children[0].GuardianID)
+
+		_, err := db.VerifyBorrower(ctx, childID, "bobrzyk@hotmail.com")
+		require.NoError(t, err)
+	})
+
+	t.Run("should not let children be guardians", func(t *testing.T) {
+		rec := s.do(http.MethodPost, "/v1/borrowers/"+childID.String()+"/children", `{"name":"Bobas","birthday":"2024-01-01T00:00:00Z","email":"bobas@hotmail.com"}`, librarian)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+
+	t.Run("should not delete guardians of other borrowers", func(t *testing.T) {
+		rec := s.do(http.MethodDelete, "/v1/borrowers/"+parentID.String(), "", http.Header{"If-Match": {"*"}})
+		assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	})
+
+	t.Run("should reject unknown audiences", func(t *testing.T) {
+		rec := s.do(http.MethodPost, "/v1/books", fmt.Sprintf(`{"title":"It","author_id":%q,"audience":"toddlers"}`, authorID.String()), nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+
+	bookID, err := db.AddBook(ctx, database.BookRequest{Title: "It", AuthorID: *authorID, Available: true, Audience: database.AudienceMature})
+	require.NoError(t, err)
+	borrowPath := "/v1/books/" + bookID.String() + "/borrow?borrower_id=" + childID.String()
+
+	t.Run("should not lend books to borrowers too young for them", func(t *testing.T) {
+		rec := s.do(http.MethodPost, borrowPath, "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), database.ErrAgeRestricted.Error())
+	})
+
+	t.Run("should only let librarians override age restrictions", func(t *testing.T) {
+		for _, header := range []http.Header{nil, {"X-Api-Key": {"wrong-key"}}} {
+			rec := s.do(http.MethodPost, borrowPath+"&override_reason=school+project", "", header)
+			assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), "only librarians")
+		}
+	})
+
+	t.Run("should lend and record books lent on a librarian's override", func(t *testing.T) {
+		rec := s.do(http.MethodPost, borrowPath+"&override_reason=school+project", "", librarian)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		rec = s.do(http.MethodGet, "/v1/borrowers/"+childID.String()+"/age-overrides", "", librarian)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var overrides []database.AgeOverride
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overrides))
+		require.Len(t, overrides, 1)
+		assert.Equal(t, *bookID, overrides[0].BookID)
+		assert.Equal(t, database.AudienceMature, overrides[0].Audience)
+		assert.Equal(t, 10, overrides[0].BorrowerAge)
+		assert.Equal(t, "ania", overrides[0].Librarian)
+		assert.Equal(t, "school project", overrides[0].Reason)
+	})
+
+	t.Run("should keep age overrides of deleted borrowers", func(t *testing.T) {
+		require.NoError(t, db.ReturnBook(ctx, *bookID))
+		rec := s.do(http.MethodDelete, "/v1/borrowers/"+childID.String(), "", http.Header{"If-Match": {"*"}})
+		require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+		rec = s.do(http.MethodGet, "/v1/borrowers/"+childID.String()+"/age-overrides", "", librarian)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var overrides []database.AgeOverride
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overrides))
+		require.Len(t, overrides, 1)
+		assert.Equal(t, "Bobrzyk", overrides[0].BorrowerName)
+
+		rec = s.do(http.MethodGet, "/v1/borrowers/"+database.NewID().String()+"/age-overrides", "", librarian)
+		assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	})
+}
+
+func TestLibrariansFromEnv(t *testing.T) {
+	t.Setenv("LIBRARIAN_KEYS", "ania:key-1, bober:key:2,,nokey:,:noname")
+
+	assert.Equal(t, []librarian{{name: "ania", key: "key-1"}, {name: "bober", key: "key:2"}}, librariansFromEnv())
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const maxIdempotencyKeyLength = 255
+
+type idempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*database.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+// idempotent makes a POST handler safe to retry. When the client sends an
+// Idempotency-Key header the first response is stored for ttl and replayed
+// for later requests with the same key instead of running the handler again.
+// Keys are scoped to the client so they can't collide across callers.
+func idempotent(store idempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get("Idempotency-Key")
+			if idempotencyKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				bindError(w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := hashParts(clientKey(r), r.Method, r.URL.Path, idempotencyKey)
+			requestHash := hashParts(r.URL.RawQuery, string(body))
+
+			existing, err := store.ReserveIdempotencyKey(r.Context(), key, requestHash)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if existing != nil {
+				switch {
+				case existing.RequestHash != requestHash:
+					http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+				case !existing.Completed:
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "a request with this Idempotency-Key is still in progress", http.StatusConflict)
+				default:
+					if existing.ContentType != "" {
+						w.Header().Set("Content-Type", existing.ContentType)
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(existing.StatusCode)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			recorded := &bytes.Buffer{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(recorded)
+
+			next.ServeHTTP(ww, r)
+
+			// Server errors aren't a stable outcome, so let the client retry them
+			ctx := context.WithoutCancel(r.Context())
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status >= http.StatusInternalServerError {
+				err = store.ReleaseIdempotencyKey(ctx, key)
+			} else {
+				err = store.CompleteIdempotencyKey(ctx, key, status, ww.Header().Get("Content-Type"), recorded.Bytes(), ttl)
+			}
+			if err != nil {
+				log.Printf("idempotency key %s: %v", strconv.Quote(idempotencyKey), err)
+			}
+		})
+	}
+}
+
+func hashParts(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*database.IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]*database.IdempotencyRecord)}
+}
+
+func (m *memoryIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, key string, requestHash string) (*database.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[key]; ok {
+		copied := *existing
+		return &copied, nil
+	}
+	m.records[key] = &database.IdempotencyRecord{Key: key, RequestHash: requestHash}
+	return nil, nil
+}
+
+func (m *memoryIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[key]
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = body
+	return nil
+}
+
+func (m *memoryIdempotencyStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	calls := 0
+	status := http.StatusCreated
+	handler := idempotent(newMemoryIdempotencyStore(), time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	}))
+
+	do := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("should run the handler every time without a key", func(t *testing.T) {
+		do("", `{}`)
+		rec := do("", `{}`)
+		assert.Equal(t, `{"call":2}`, rec.Body.String())
+	})
+
+	t.Run("should replay the first response for a retried key", func(t *testing.T) {
+		first := do("retry-1", `{"title":"Hobbit"}`)
+		assert.Equal(t, http.StatusCreated, first.Code)
+
+		second := do("retry-1", `{"title":"Hobbit"}`)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+		assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should reject a reused key with a different body", func(t *testing.T) {
+		rec := do("retry-1", `{"title":"Silmarillion"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should let server errors be retried", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		rec := do("retry-2", `{}`)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		status = http.StatusCreated
+		rec = do("retry-2", `{}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, 5, calls)
+	})
+
+	t.Run("should report a request still in progress", func(t *testing.T) {
+		store := newMemoryIdempotencyStore()
+		inFlight := idempotent(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			retry := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`{}`))
+			retry.Header.Set("Idempotency-Key", "slow")
+			rec := httptest.NewRecorder()
+			idempotent(store, time.Hour)(http.HandlerFunc(okHandler)).ServeHTTP(rec, retry)
+
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			body, _ := io.ReadAll(rec.Body)
+			assert.Contains(t, string(body), "still in progress")
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "slow")
+		inFlight.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/importer"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func (h *Server) ImportBooks(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "text/csv" {
+			http.Error(w, "content type must be text/csv", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	rows, err := importer.ReadBooksCSV(r.Body)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	h.startImport(w, r, "books_csv", importer.New(h.db), rows)
+}
+
+// ImportMARC imports binary MARC21 (application/marc) or MARCXML. MARC has no
+// author emails, so authors are matched by name; author_email_domain allows
+// creating missing authors with placeholder addresses in that domain.
+func (h *Server) ImportMARC(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, "content type must be application/marc or application/marcxml+xml", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var rows []importer.Row
+	var kind string
+	switch mediaType {
+	case "application/marc":
+		kind = "books_marc"
+		rows, err = importer.ReadBooksMARC(r.Body)
+	case "application/marcxml+xml", "application/xml":
+		kind = "books_marcxml"
+		rows, err = importer.ReadBooksMARCXML(r.Body)
+	default:
+		http.Error(w, "content type must be application/marc or application/marcxml+xml", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	imp := importer.New(h.db)
+	imp.AuthorEmailDomain = r.URL.Query().Get("author_email_domain")
+
+	h.startImport(w, r, kind, imp, rows)
+}
+
+// startImport records a job for rows and runs it in the background,
+// answering 202 with the job's location.
+func (h *Server) startImport(w http.ResponseWriter, r *http.Request, kind string, imp *importer.Importer, rows []importer.Row) {
+	jobID, err := h.db.CreateImportJob(r.Context(), kind, len(rows))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.imports.Start(r.Context(), imp, *jobID, rows)
+
+	response := struct {
+		ID database.ID `json:"id"`
+	}{
+		ID: *jobID,
+	}
+
+	w.Header().Set("Location", path.Dir(r.URL.Path)+"/jobs/"+jobID.String())
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, response)
+}
+
+func (h *Server) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := database.ParseID(chi.URLParam(r, "job_id"))
+	if err != nil {
+		http.Error(w, "invalid job_id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.db.GetImportJob(r.Context(), jobID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if job == nil {
+		http.Error(w, fmt.Errorf("no import job with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	render.Render(w, r, job)
+}
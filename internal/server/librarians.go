@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// librarian is someone allowed to override age restrictions and manage child
+// accounts, and the API key they send in X-API-Key to prove it.
+type librarian struct {
+	name string
+	key  string
+}
+
+// librariansFromEnv reads LIBRARIAN_KEYS, a comma-separated list of
+// name:key pairs. Without it nobody can override age restrictions or manage
+// child accounts.
+func librariansFromEnv() []librarian {
+	var librarians []librarian
+	for _, entry := range strings.Split(os.Getenv("LIBRARIAN_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || key == "" {
+			log.Printf("ignoring LIBRARIAN_KEYS entry without a name and key")
+			continue
+		}
+		librarians = append(librarians, librarian{name: name, key: key})
+	}
+	return librarians
+}
+
+// librarian returns the name of the librarian whose API key the request
+// carries. Keys are compared in constant time so timing doesn't give away
+// how close a guess was.
+func (h *Server) librarian(r *http.Request) (string, bool) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return "", false
+	}
+
+	for _, librarian := range h.librarians {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(librarian.key)) == 1 {
+			return librarian.name, true
+		}
+	}
+	return "", false
+}
+
+// librariansOnly refuses requests that don't carry a librarian's API key.
+func (h *Server) librariansOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := h.librarian(r); !ok {
+			http.Error(w, "this needs a librarian's X-API-Key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// borrowerParam returns the borrower in the URL, or writes the error and
+// returns false when it's invalid or doesn't exist.
+func (h *Server) borrowerParam(w http.ResponseWriter, r *http.Request) (*database.Borrower, bool) {
+	borrowerID, err := database.ParseID(chi.URLParam(r, "borrower_id"))
+	if err != nil {
+		http.Error(w, "invalid borrower_id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	borrower, err := h.db.GetBorrower(r.Context(), borrowerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if borrower == nil {
+		http.Error(w, "no borrower with this ID", http.StatusNotFound)
+		return nil, false
+	}
+
+	return borrower, true
+}
+
+func (h *Server) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	borrower, ok := h.borrowerParam(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := h.db.GetNotificationPreferences(r.Context(), borrower.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if prefs == nil {
+		defaults := database.DefaultNotificationPreferences()
+		prefs = &defaults
+	}
+
+	render.Render(w, r, prefs)
+}
+
+func (h *Server) SetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs := database.NotificationPreferences{}
+
+	err := render.Bind(r, &prefs)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	borrower, ok := h.borrowerParam(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.db.SetNotificationPreferences(r.Context(), borrower.ID, prefs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.Render(w, r, &prefs)
+}
+
+// ListNotifications lists the emails sent to a borrower, newest first.
+func (h *Server) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	borrower, ok := h.borrowerParam(w, r)
+	if !ok {
+		return
+	}
+
+	notifications, err := h.db.ListNotifications(r.Context(), borrower.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, notifications)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationRoutes(t *testing.T) {
+	s := newTestServer(t)
+	db := s.db
+
+	borrowerID, err := db.CreateBorrower(context.Background(), database.BorrowerRequest{
+		Name:     "Bober",
+		Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Email:    "bober@hotmail.com",
+	})
+	require.NoError(t, err)
+	prefsPath := "/v1/borrowers/" + borrowerID.String() + "/notification-preferences"
+
+	t.Run("should default to every email in english", func(t *testing.T) {
+		rec := s.do(http.MethodGet, prefsPath, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.JSONEq(t, `{"locale":"en","opt_out":[]}`, rec.Body.String())
+	})
+
+	t.Run("should reject invalid preferences", func(t *testing.T) {
+		rec := s.do(http.MethodPut, prefsPath, `{"locale":"en","opt_out":["spam"]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = s.do(http.MethodPut, prefsPath, `{"locale":"english","opt_out":[]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should set preferences", func(t *testing.T) {
+		rec := s.do(http.MethodPut, prefsPath, `{"locale":"es","opt_out":["welcome","due_soon","welcome"]}`, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.JSONEq(t, `{"locale":"es","opt_out":["due_soon","welcome"]}`, rec.Body.String())
+
+		rec = s.do(http.MethodGet, prefsPath, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.JSONEq(t, `{"locale":"es","opt_out":["due_soon","welcome"]}`, rec.Body.String())
+	})
+
+	t.Run("should list the emails sent to a borrower", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/v1/borrowers/"+borrowerID.String()+"/notifications", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.JSONEq(t, `[]`, rec.Body.String())
+
+		notification := database.NewNotification(*borrowerID, database.NotificationOverdue, "loan-1")
+		notification.Locale = "es"
+		notification.To = "bober@hotmail.com"
+		notification.Subject = "«Hobbit» está vencido"
+		_, err := db.ReserveNotification(context.Background(), notification, 1)
+		require.NoError(t, err)
+
+		rec = s.do(http.MethodGet, "/v1/borrowers/"+borrowerID.String()+"/notifications", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var notifications []database.Notification
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &notifications))
+		require.Len(t, notifications, 1)
+		assert.Equal(t, database.NotificationSending, notifications[0].Status)
+		assert.Equal(t, "«Hobbit» está vencido", notifications[0].Subject)
+	})
+
+	t.Run("should 404 for unknown borrowers", func(t *testing.T) {
+		unknown := database.NewID().String()
+		for _, rec := range []*httptest.ResponseRecorder{
+			s.do(http.MethodGet, "/v1/borrowers/"+unknown+"/notification-preferences", "", nil),
+			s.do(http.MethodPut, "/v1/borrowers/"+unknown+"/notification-preferences", `{"locale":"en","opt_out":[]}`, nil),
+			s.do(http.MethodGet, "/v1/borrowers/"+unknown+"/notifications", "", nil),
+		} {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		}
+
+		rec := s.do(http.MethodGet, "/v1/borrowers/nope/notifications", "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	legacyrouter "github.com/getkin/kin-openapi/routers/legacy"
+)
+
+func init() {
+	// MARC and image bodies are opaque to the spec; register them so they are
+	// accepted as strings instead of failing as an unsupported content type.
+	for _, contentType := range []string{"application/marc", "application/marcxml+xml", "application/xml", "image/jpeg", "image/png", "image/webp"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.FileBodyDecoder)
+	}
+}
+
+// specValidator checks requests, and the responses to them, against doc.
+// Invalid requests are rejected with 400; invalid responses are logged since
+// they are a server bug rather than the client's. It buffers every response,
+// so it is only meant for local and test environments.
+func specValidator(doc *openapi3.T, prefix string) (func(http.Handler) http.Handler, error) {
+	// Match paths regardless of the host the spec was written for
+	specDoc := *doc
+	specDoc.Servers = openapi3.Servers{{URL: prefix}}
+
+	router, err := legacyrouter.NewRouter(&specDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				if err == routers.ErrMethodNotAllowed {
+					http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				http.Error(w, "route is not in the API spec", http.StatusNotFound)
+				return
+			}
+
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+			err = openapi3filter.ValidateRequest(r.Context(), requestInput)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			recorded := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(recorded, r)
+
+			err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 recorded.status,
+				Header:                 recorded.header,
+				Body:                   io.NopCloser(bytes.NewReader(recorded.body.Bytes())),
+				Options:                options,
+			})
+			if err != nil {
+				log.Printf("response to %s %s doesn't match the API spec: %v", r.Method, r.URL.Path, err)
+			}
+
+			for key, values := range recorded.header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(recorded.status)
+			w.Write(recorded.body.Bytes())
+		})
+	}, nil
+}
+
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.status = status
+	b.wroteHeader = true
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
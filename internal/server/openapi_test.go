@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"curly-computing-machine/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unversionedRoutes are served outside the versioned API, so they're
+// documented in the README rather than in a spec.
+var unversionedRoutes = []string{"GET /", "GET /health", "GET /events"}
+
+func TestRoutesDocumented(t *testing.T) {
+	s := &Server{
+		readLimiter:  newRateLimiter(1, 1),
+		writeLimiter: newRateLimiter(1, 1),
+	}
+
+	versions := s.apiVersions()
+	docs := make(map[string]*openapi3.T)
+	for _, version := range versions {
+		doc, err := version.spec(context.Background())
+		require.NoError(t, err)
+		docs[version.prefix] = doc
+	}
+
+	routed := make(map[string]bool)
+	err := chi.Walk(s.router(), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path := strings.TrimSuffix(route, "/")
+		if path == "" {
+			path = "/"
+		}
+		routed[method+" "+path] = true
+		if slices.Contains(unversionedRoutes, method+" "+path) {
+			return nil
+		}
+
+		// Unversioned paths are aliases of the oldest version
+		prefix := versions[0].prefix
+		for _, version := range versions {
+			if path == version.prefix || strings.HasPrefix(path, version.prefix+"/") {
+				prefix = version.prefix
+				path = strings.TrimPrefix(path, prefix)
+				break
+			}
+		}
+
+		item := docs[prefix].Paths.Find(path)
+		if item == nil || item.GetOperation(method) == nil {
+			t.Errorf("%s %s is routed but missing from the %s spec", method, route, prefix)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for _, route := range unversionedRoutes {
+		assert.True(t, routed[route], "%s is no longer routed", route)
+	}
+}
+
+func TestSpecValidator(t *testing.T) {
+	doc, err := openapi.LoadV1(context.Background())
+	assert.NoError(t, err)
+
+	validator, err := specValidator(doc, "/v1")
+	assert.NoError(t, err)
+
+	created := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"6711f3f5b1d2c3a4e5f60718"}`))
+	}
+	handler := validator(http.HandlerFunc(created))
+
+	testcases := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "should pass a valid request",
+			method:       http.MethodPost,
+			path:         "/v1/authors",
+			body:         `{"name":"Bober","birthday":"1996-05-17T00:00:00Z","email":"bober@author.com"}`,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "should reject a request missing a required field",
+			method:       http.MethodPost,
+			path:         "/v1/authors",
+			body:         `{"name":"Bober","email":"bober@author.com"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "should reject an invalid path parameter",
+			method:       http.MethodGet,
+			path:         "/v1/authors/not-an-id",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "should reject a route missing from the spec",
+			method:       http.MethodGet,
+			path:         "/v1/publishers",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testcase.method, testcase.path, strings.NewReader(testcase.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, testcase.expectedCode, rec.Code)
+		})
+	}
+}
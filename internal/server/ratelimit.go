@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// visitorTTL is how long an idle client's bucket is kept before it is dropped.
+const visitorTTL = 10 * time.Minute
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter hands out one token bucket per client key.
+type rateLimiter struct {
+	mu        sync.Mutex
+	visitors  map[string]*visitor
+	limit     rate.Limit
+	burst     int
+	lastSweep time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		visitors:  make(map[string]*visitor),
+		limit:     rate.Limit(perSecond),
+		burst:     burst,
+		lastSweep: time.Now(),
+	}
+}
+
+// reserve takes a token for key and reports how long the client has to wait
+// before the request would be allowed. Zero means the request may proceed.
+func (l *rateLimiter) reserve(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > visitorTTL {
+		for k, v := range l.visitors {
+			if now.Sub(v.lastSeen) > visitorTTL {
+				delete(l.visitors, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	v, ok := l.visitors[key]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.visitors[key] = v
+	}
+	v.lastSeen = now
+
+	reservation := v.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return visitorTTL
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// rateLimit throttles clients with separate budgets for safe (read) and
+// state-changing (write) methods. Clients are told apart by clientKey.
+func rateLimit(read, write *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := write
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				limiter = read
+			}
+
+			delay := limiter.reserve(clientKey(r))
+			if delay > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type clientKeyContextKey struct{}
+
+// identifyClient records who the client is for clientKey: the librarian
+// whose API key they send, or their remote IP. Keys that aren't configured
+// are ignored, so making one up doesn't buy a client a fresh budget.
+func (h *Server) identifyClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := remoteKey(r)
+		if name, ok := h.librarian(r); ok {
+			key = "librarian:" + name
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKeyContextKey{}, key)))
+	})
+}
+
+// clientKey identifies the client as identifyClient did, or by remote IP for
+// requests that didn't pass through it.
+func clientKey(r *http.Request) string {
+	if key, ok := r.Context().Value(clientKeyContextKey{}).(string); ok {
+		return key
+	}
+	return remoteKey(r)
+}
+
+func remoteKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limitBody caps the request body so decoding in render.Bind can't be fed
+// arbitrarily large payloads.
+func limitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bindError reports a failed render.Bind, telling oversized bodies apart from
+// invalid ones.
+func bindError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRateLimit(t *testing.T) {
+	s := &Server{librarians: []librarian{{name: "ania", key: "alpha"}, {name: "bober", key: "beta"}}}
+	handler := s.identifyClient(rateLimit(newRateLimiter(1, 2), newRateLimiter(1, 1))(http.HandlerFunc(okHandler)))
+
+	do := func(method string, remoteAddr string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/books", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("should allow reads up to the burst and then throttle", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "10.0.0.1:1234", "").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "10.0.0.1:1234", "").Code)
+
+		rec := do(http.MethodGet, "10.0.0.1:4321", "")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("should keep a separate budget for writes", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "10.0.0.2:1234", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "10.0.0.2:1234", "").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "10.0.0.2:1234", "").Code)
+	})
+
+	t.Run("should key clients by API key before IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "10.0.0.3:1234", "alpha").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "10.0.0.3:1234", "beta").Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "10.0.0.4:1234", "alpha").Code)
+	})
+
+	t.Run("should key clients with unknown API keys by IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "10.0.0.5:1234", "made-up-1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "10.0.0.5:1234", "made-up-2").Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "10.0.0.5:1234", "").Code)
+	})
+}
+
+func TestLimitBody(t *testing.T) {
+	bind := func(w http.ResponseWriter, r *http.Request) {
+		authorRequest := database.AuthorRequest{}
+		err := render.Bind(r, &authorRequest)
+		if err != nil {
+			bindError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	handler := limitBody(64)(http.HandlerFunc(bind))
+
+	testcases := []struct {
+		name          string
+		body          string
+		chunked       bool
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			name:         "should bind a body under the limit",
+			body:         `{"name":"Bo","birthday":"1996-05-17T00:00:00Z","email":"b@a.c"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:          "should reject a body with a large content length",
+			body:          `{"name":"` + strings.Repeat("a", 100) + `"}`,
+			expectedCode:  http.StatusRequestEntityTooLarge,
+			expectedError: "request body too large",
+		},
+		{
+			name:          "should reject a large body of unknown length",
+			body:          `{"name":"` + strings.Repeat("a", 100) + `"}`,
+			chunked:       true,
+			expectedCode:  http.StatusRequestEntityTooLarge,
+			expectedError: "request body too large",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/authors", strings.NewReader(testcase.body))
+			req.Header.Set("Content-Type", "application/json")
+			if testcase.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, testcase.expectedCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), testcase.expectedError)
+		})
+	}
+}
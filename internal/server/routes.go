@@ -8,42 +8,122 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
+	return otelhttp.NewHandler(s.router(), "http.server")
+}
+
+func (s *Server) router() chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
+	r.Use(routeSpanName)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "If-Match", "If-None-Match", "Last-Event-ID", "X-API-Key", "traceparent", "tracestate"},
+		ExposedHeaders:   []string{"Deprecation", "ETag", "Idempotent-Replayed", "Link", "Retry-After", "Sunset"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	r.Use(s.identifyClient)
+	r.Use(rateLimit(s.readLimiter, s.writeLimiter))
+
 	r.Get("/", s.HelloWorldHandler)
 
 	r.Get("/health", s.healthHandler)
 
+	// Streams stay out of the versioned API, whose spec validator buffers
+	// responses
+	r.Get("/events", s.StreamEvents)
+
+	s.mountAPIVersions(r)
+
+	return r
+}
+
+// v1Routes registers the version 1 resource routes on r.
+func (s *Server) v1Routes(r chi.Router) {
+	idempotent := idempotent(s.db, s.idempotencyTTL)
+
 	r.Route("/books", func(r chi.Router) {
-		r.Get("/", s.ListBooks)
-		r.Post("/", s.AddBook)
-		r.Post("/{book_id}/borrow", s.BorrowBook)
+		r.Group(func(r chi.Router) {
+			r.Use(limitBody(s.maxBodyBytes))
+
+			r.Get("/", s.ListBooks)
+			r.With(idempotent).Post("/", s.AddBook)
+			r.Get("/{book_id}", s.GetBook)
+			r.Get("/isbn/{isbn}", s.GetBookByISBN)
+			r.Get("/{book_id}/marc", s.ExportBookMARC)
+			r.Put("/{book_id}", s.UpdateBook)
+			r.Delete("/{book_id}", s.DeleteBook)
+			r.With(idempotent).Post("/{book_id}/borrow", s.BorrowBook)
+			r.Get("/{book_id}/cover", s.GetBookCover)
+			r.Get("/{book_id}/cover/thumbnail", s.GetBookCoverThumbnail)
+		})
+
+		r.With(limitBody(s.maxCoverBytes)).Put("/{book_id}/cover", s.SetBookCover)
 	})
 
-	r.Route("/authors", func(r chi.Router) {
-		r.Post("/", s.CreateAuthor)
-		r.Get("/{author_id}", s.GetAuthor)
+	r.Group(func(r chi.Router) {
+		r.Use(limitBody(s.maxBodyBytes))
+
+		r.Route("/authors", func(r chi.Router) {
+			r.Post("/", s.CreateAuthor)
+			r.Get("/{author_id}", s.GetAuthor)
+			r.Put("/{author_id}", s.UpdateAuthor)
+			r.Delete("/{author_id}", s.DeleteAuthor)
+			r.Get("/{author_id}/books", s.AuthorBooks)
+		})
+
+		r.Route("/borrowers", func(r chi.Router) {
+			r.With(idempotent).Post("/", s.CreateBorrower)
+			r.Get("/{borrower_id}", s.GetBorrower)
+			r.Put("/{borrower_id}", s.UpdateBorrower)
+			r.Delete("/{borrower_id}", s.DeleteBorrower)
+			r.Get("/{borrower_id}/books", s.BorrowedBooks)
+			r.Get("/{borrower_id}/notifications", s.ListNotifications)
+			r.Get("/{borrower_id}/notification-preferences", s.GetNotificationPreferences)
+			r.Put("/{borrower_id}/notification-preferences", s.SetNotificationPreferences)
+			r.Post("/{borrower_id}/verification", s.SendVerification)
+			r.With(s.librariansOnly).Get("/{borrower_id}/children", s.ListChildren)
+			r.With(s.librariansOnly, idempotent).Post("/{borrower_id}/children", s.CreateChild)
+			r.With(s.librariansOnly).Get("/{borrower_id}/age-overrides", s.ListAgeOverrides)
+		})
+
+		r.Get("/email-verification", s.VerifyEmail)
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Post("/", s.CreateWebhook)
+			r.Get("/", s.ListWebhooks)
+			r.Delete("/{webhook_id}", s.DeleteWebhook)
+			r.Get("/deliveries", s.ListWebhookDeliveries)
+			r.Post("/deliveries/{delivery_id}/redeliver", s.RedeliverWebhook)
+		})
 	})
 
-	r.Route("/borrowers", func(r chi.Router) {
-		r.Post("/", s.CreateBorrower)
-		r.Get("/{borrower_id}", s.GetBorrower)
-		r.Get("/{borrower_id}/books", s.BorrowedBooks)
+	r.Route("/import", func(r chi.Router) {
+		r.With(limitBody(s.maxImportBytes)).Post("/books", s.ImportBooks)
+		r.With(limitBody(s.maxImportBytes)).Post("/marc", s.ImportMARC)
+		r.Get("/jobs/{job_id}", s.GetImportJob)
 	})
+}
 
-	return r
+// routeSpanName renames the request span after the matched chi route pattern,
+// which is only known once the router has dispatched the request.
+func routeSpanName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		pattern := chi.RouteContext(r.Context()).RoutePattern()
+		if pattern != "" {
+			trace.SpanFromContext(r.Context()).SetName(r.Method + " " + pattern)
+		}
+	})
 }
 
 func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -10,20 +11,74 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 
 	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/cache"
+	"curly-computing-machine/internal/events"
+	"curly-computing-machine/internal/importer"
+	"curly-computing-machine/internal/notify"
+	"curly-computing-machine/internal/outbox"
+	"curly-computing-machine/internal/webhooks"
 )
 
 type Server struct {
 	port int
 
-	db database.Service
+	maxBodyBytes   int64
+	maxImportBytes int64
+	maxCoverBytes  int64
+	readLimiter    *rateLimiter
+	writeLimiter   *rateLimiter
+
+	idempotencyTTL time.Duration
+
+	validateSpec bool
+
+	db         database.Service
+	bookEvents database.BookWatcher
+
+	// imports runs import jobs after the requests that start them return
+	imports *importer.Runner
+
+	// notifier is nil when emails aren't configured
+	notifier *notify.Notifier
+	verifier *notify.Verifier
+
+	// librarians can lend books to borrowers too young for them
+	librarians []librarian
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	db, bookEvents := events.New(database.New())
 	NewServer := &Server{
 		port: port,
 
-		db: database.New(),
+		maxBodyBytes:   int64(envInt("MAX_BODY_BYTES", 1<<20)),
+		maxImportBytes: int64(envInt("MAX_IMPORT_BYTES", 32<<20)),
+		maxCoverBytes:  int64(envInt("MAX_COVER_BYTES", 5<<20)),
+		readLimiter:    newRateLimiter(envFloat("RATE_LIMIT_READ_RPS", 20), envInt("RATE_LIMIT_READ_BURST", 40)),
+		writeLimiter:   newRateLimiter(envFloat("RATE_LIMIT_WRITE_RPS", 5), envInt("RATE_LIMIT_WRITE_BURST", 10)),
+
+		idempotencyTTL: envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		// Requests and responses are checked against the OpenAPI spec outside production
+		validateSpec: os.Getenv("APP_ENV") == "local" || os.Getenv("APP_ENV") == "test",
+
+		// Spans wrap the cache, so they record whether reads were hits
+		db:         database.NewTracingService(cache.New(db)),
+		bookEvents: bookEvents,
+
+		verifier: notify.VerifierFromEnv(),
+
+		librarians: librariansFromEnv(),
+	}
+
+	NewServer.imports = importer.NewRunner(NewServer.db, envDuration("IMPORT_IDLE_TIMEOUT", importer.DefaultIdleTimeout))
+	go NewServer.imports.Run(context.Background())
+	go outbox.New(NewServer.db).Run(context.Background())
+	go webhooks.NewWorker(NewServer.db, webhooks.ConfigFromEnv()).Run(context.Background())
+	if notify.Enabled() {
+		NewServer.notifier = notify.New(NewServer.db)
+		go notify.NewScheduler(NewServer.notifier).Run(context.Background())
 	}
 
 	// Declare Server config
@@ -34,6 +89,35 @@ func NewServer() *http.Server {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	// Imports stop with the server; the jobs they leave running are
+	// interrupted by whichever server next finds them idle
+	server.RegisterOnShutdown(NewServer.imports.Stop)
 
 	return server
 }
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// envDuration falls back for durations that aren't positive too, since
+// none of the settings read with it can be zero or negative.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
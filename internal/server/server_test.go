@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database/memory"
+	"curly-computing-machine/internal/importer"
+)
+
+// testServer is a Server with its routes registered, for tests that make
+// requests to it.
+type testServer struct {
+	*Server
+	handler http.Handler
+}
+
+// newTestServer returns a server on a fresh in-memory database, with rate
+// limits tests won't reach and responses checked against the spec. opts set
+// up anything else the test needs before the routes are registered.
+func newTestServer(t *testing.T, opts ...func(s *Server)) *testServer {
+	t.Helper()
+
+	s := &Server{
+		maxBodyBytes: 1 << 20,
+		readLimiter:  newRateLimiter(100, 100),
+		writeLimiter: newRateLimiter(100, 100),
+		validateSpec: true,
+		db:           memory.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.imports = importer.NewRunner(s.db, time.Minute)
+	t.Cleanup(s.imports.Stop)
+
+	return &testServer{Server: s, handler: s.RegisterRoutes()}
+}
+
+// do sends a request with header, marking body as JSON if there is one.
+func (s *testServer) do(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
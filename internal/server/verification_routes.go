@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/render"
+)
+
+// SendVerification emails a borrower a new link to verify their email
+// address.
+func (h *Server) SendVerification(w http.ResponseWriter, r *http.Request) {
+	borrower, ok := h.borrowerParam(w, r)
+	if !ok {
+		return
+	}
+
+	if borrower.VerifiedAt != nil {
+		http.Error(w, "borrower's email is already verified", http.StatusConflict)
+		return
+	}
+
+	if h.notifier == nil {
+		http.Error(w, "emails aren't configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Every request sends a new link, rather than being deduplicated like
+	// the link sent when the borrower signs up
+	_, err := h.notifier.SendVerification(r.Context(), *borrower, database.NewID().String())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail marks the borrower a verification token was emailed to as
+// verified, as long as their email hasn't changed since.
+func (h *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	borrowerID, email, err := h.verifier.Check(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	borrower, err := h.db.VerifyBorrower(r.Context(), borrowerID, email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if borrower == nil {
+		http.Error(w, "verification token is for an email the borrower no longer has", http.StatusBadRequest)
+		return
+	}
+
+	render.Render(w, r, borrower)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mailbox records the emails sent through it.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []notify.Message
+}
+
+func (o *mailbox) Send(ctx context.Context, msg notify.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+func (o *mailbox) last() notify.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.messages[len(o.messages)-1]
+}
+
+var linkPattern = regexp.MustCompile(`http://\S+`)
+
+func TestVerificationRoutes(t *testing.T) {
+	verifier := notify.NewVerifier([]byte("secret"), time.Hour, "http://localhost:8080/v1/email-verification")
+	s := newTestServer(t, func(s *Server) { s.verifier = verifier })
+	db := s.db
+
+	t.Run("should reject invalid emails", func(t *testing.T) {
+		for _, email := range []string{"", "bober", "bober@", "Bober <bober@hotmail.com>", "bober@hotmail.com, skunk@hotmail.com"} {
+			body, err := json.Marshal(database.BorrowerRequest{Name: "Bober", Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC), Email: email})
+			require.NoError(t, err)
+			rec := s.do(http.MethodPost, "/v1/borrowers", string(body), nil)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, email)
+		}
+	})
+
+	rec := s.do(http.MethodPost, "/v1/borrowers", `{"name":"Bober","birthday":"1996-05-17T00:00:00Z","email":"  Bober@Hotmail.COM "}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		ID database.ID `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	borrowerPath := "/v1/borrowers/" + created.ID.String()
+
+	t.Run("should normalize emails before checking they're unique", func(t *testing.T) {
+		rec := s.do(http.MethodGet, borrowerPath, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"email":"bober@hotmail.com"`)
+		assert.NotContains(t, rec.Body.String(), "verified_at")
+
+		rec = s.do(http.MethodPost, "/v1/borrowers", `{"name":"Bober","birthday":"1996-05-17T00:00:00Z","email":"BOBER@hotmail.com"}`, nil)
+		assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	})
+
+	authorID, err := db.CreateAuthor(context.Background(), database.AuthorRequest{Name: "Tolkien", Birthday: time.Date(1892, time.January, 3, 0, 0, 0, 0, time.UTC), Email: "tolkien@author.com"})
+	require.NoError(t, err)
+	bookID, err := db.AddBook(context.Background(), database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+	borrowPath := "/v1/books/" + bookID.String() + "/borrow?borrower_id=" + created.ID.String()
+
+	t.Run("should not lend to unverified borrowers", func(t *testing.T) {
+		rec := s.do(http.MethodPost, borrowPath, "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, "borrower hasn't verified their email\n", rec.Body.String())
+	})
+
+	t.Run("should not send verification emails without a mail server", func(t *testing.T) {
+		rec := s.do(http.MethodPost, borrowerPath+"/verification", "", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	templates, err := notify.LoadTemplates(os.DirFS("../notify"))
+	require.NoError(t, err)
+	mails := &mailbox{}
+	s.notifier = notify.NewNotifier(db, mails, templates, verifier, notify.DefaultConfig)
+
+	var token string
+	t.Run("should email a verification link", func(t *testing.T) {
+		rec := s.do(http.MethodPost, borrowerPath+"/verification", "", nil)
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+		msg := mails.last()
+		assert.Equal(t, "bober@hotmail.com", msg.To)
+		link, err := url.Parse(linkPattern.FindString(msg.Body))
+		require.NoError(t, err)
+		assert.Equal(t, "/v1/email-verification", link.Path)
+		token = link.Query().Get("token")
+		require.NotEmpty(t, token)
+
+		rec = s.do(http.MethodPost, "/v1/borrowers/"+database.NewID().String()+"/verification", "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("should reject missing and invalid tokens", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/v1/email-verification", "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = s.do(http.MethodGet, "/v1/email-verification?token=x"+url.QueryEscape(token), "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "invalid verification token\n", rec.Body.String())
+	})
+
+	t.Run("should verify the borrower", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/v1/email-verification?token="+url.QueryEscape(token), "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var borrower database.Borrower
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &borrower))
+		assert.NotNil(t, borrower.VerifiedAt)
+
+		rec = s.do(http.MethodPost, borrowerPath+"/verification", "", nil)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		rec = s.do(http.MethodPost, borrowPath, "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	})
+
+	t.Run("should reject tokens for an old email", func(t *testing.T) {
+		current, err := db.GetBorrower(context.Background(), created.ID)
+		require.NoError(t, err)
+		_, err = db.UpdateBorrower(context.Background(), created.ID, database.BorrowerRequest{Name: "Bober", Birthday: current.Birthday, Email: "bober@gmail.com"}, current.Version)
+		require.NoError(t, err)
+
+		rec := s.do(http.MethodGet, "/v1/email-verification?token="+url.QueryEscape(token), "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "verification token is for an email the borrower no longer has\n", rec.Body.String())
+	})
+}
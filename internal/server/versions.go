@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"curly-computing-machine/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiVersion is one mounted version of the resource API. Once a successor
+// ships, set deprecatedAt (and sunsetAt when a removal date is agreed) so
+// every response advertises it.
+type apiVersion struct {
+	prefix       string
+	routes       func(r chi.Router)
+	spec         func(ctx context.Context) (*openapi3.T, error)
+	deprecatedAt time.Time
+	sunsetAt     time.Time
+}
+
+// The unversioned routes predate /v1 and are kept as an alias of it until
+// clients have migrated.
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunsetAt     = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+// apiVersions lists the mounted versions, oldest first. To add /v2, write a
+// v2Routes alongside v1Routes and append it here.
+func (s *Server) apiVersions() []apiVersion {
+	return []apiVersion{
+		{prefix: "/v1", routes: s.v1Routes, spec: openapi.LoadV1},
+	}
+}
+
+// apiPrefix is the version prefix r was routed under, or "" for the
+// unversioned routes.
+func (s *Server) apiPrefix(r *http.Request) string {
+	for _, version := range s.apiVersions() {
+		if strings.HasPrefix(r.URL.Path, version.prefix+"/") {
+			return version.prefix
+		}
+	}
+	return ""
+}
+
+func (s *Server) mountAPIVersions(r chi.Router) {
+	versions := s.apiVersions()
+
+	for i, version := range versions {
+		successor := ""
+		if i < len(versions)-1 {
+			successor = versions[i+1].prefix
+		}
+
+		r.Route(version.prefix, func(r chi.Router) {
+			if !version.deprecatedAt.IsZero() {
+				r.Use(deprecated(version.deprecatedAt, version.sunsetAt, version.prefix, successor))
+			}
+			if s.validateSpec {
+				r.Use(s.mustSpecValidator(version))
+			}
+			version.routes(r)
+		})
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(deprecated(legacyDeprecatedAt, legacySunsetAt, "", versions[0].prefix))
+		versions[0].routes(r)
+	})
+}
+
+func (s *Server) mustSpecValidator(version apiVersion) func(http.Handler) http.Handler {
+	doc, err := version.spec(context.Background())
+	if err != nil {
+		log.Fatalf("%s spec: %v", version.prefix, err)
+	}
+
+	validator, err := specValidator(doc, version.prefix)
+	if err != nil {
+		log.Fatalf("%s spec router: %v", version.prefix, err)
+	}
+
+	return validator
+}
+
+// deprecated marks responses with the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers, and links to the same resource under the version
+// clients should move to.
+func deprecated(at time.Time, sunset time.Time, prefix string, successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(at.Unix(), 10))
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor+strings.TrimPrefix(r.URL.Path, prefix)))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
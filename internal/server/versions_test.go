@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIVersions(t *testing.T) {
+	s := &Server{
+		maxBodyBytes: 1 << 20,
+		readLimiter:  newRateLimiter(100, 100),
+		writeLimiter: newRateLimiter(100, 100),
+	}
+	handler := s.RegisterRoutes()
+
+	t.Run("should serve v1 without deprecation headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/authors/not-an-id", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, rec.Header().Get("Deprecation"))
+		assert.Empty(t, rec.Header().Get("Sunset"))
+	})
+
+	t.Run("should serve unversioned routes as deprecated aliases of v1", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/authors/not-an-id", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "@1792368000", rec.Header().Get("Deprecation"))
+		assert.Equal(t, "Mon, 19 Apr 2027 00:00:00 GMT", rec.Header().Get("Sunset"))
+		assert.Equal(t, `</v1/authors/not-an-id>; rel="successor-version"`, rec.Header().Get("Link"))
+	})
+
+	t.Run("should keep operational routes at the root", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Deprecation"))
+	})
+}
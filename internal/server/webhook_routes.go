@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func (h *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookRequest := database.WebhookRequest{}
+
+	err := render.Bind(r, &webhookRequest)
+	if err != nil {
+		bindError(w, err)
+		return
+	}
+
+	webhookID, err := h.db.CreateWebhook(r.Context(), webhookRequest)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	response := struct {
+		ID database.ID `json:"id"`
+	}{
+		ID: *webhookID,
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, response)
+}
+
+func (h *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.db.ListWebhooks(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, webhooks)
+}
+
+func (h *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := database.ParseID(chi.URLParam(r, "webhook_id"))
+	if err != nil {
+		http.Error(w, "invalid webhook_id", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.db.DeleteWebhook(r.Context(), webhookID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, fmt.Errorf("no webhook with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries lists deliveries, newest first. The status query
+// parameter narrows them down; status=dead is the dead-letter list.
+func (h *Server) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains([]string{database.DeliveryPending, database.DeliveryDelivered, database.DeliveryDead}, status) {
+		http.Error(w, "status must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.db.ListWebhookDeliveries(r.Context(), status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, deliveries)
+}
+
+// RedeliverWebhook queues a delivery to be attempted again at once, with a
+// fresh set of attempts. It's how dead-lettered deliveries are retried once
+// the receiver is fixed, but works for delivered ones too.
+func (h *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := database.ParseID(chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		http.Error(w, "invalid delivery_id", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.db.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if delivery == nil {
+		http.Error(w, fmt.Errorf("no webhook delivery with this ID").Error(), http.StatusNotFound)
+		return
+	}
+
+	delivery.Status = database.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC().Truncate(time.Millisecond)
+	delivery.LastError = ""
+	delivery.DeliveredAt = nil
+
+	err = h.db.UpdateWebhookDelivery(r.Context(), *delivery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.Render(w, r, delivery)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/outbox"
+	"curly-computing-machine/internal/webhooks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRoutes(t *testing.T) {
+	// The receiver fails until it's fixed.
+	var fixed atomic.Bool
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		if !fixed.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t)
+	db := s.db
+
+	config := webhooks.DefaultConfig
+	config.MaxAttempts = 1
+	worker := webhooks.NewWorker(db, config)
+
+	t.Run("should reject an invalid webhook", func(t *testing.T) {
+		rec := s.do(http.MethodPost, "/v1/webhooks", `{"url":"ftp://example.com","secret":"0123456789abcdef","events":["book.created"]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = s.do(http.MethodPost, "/v1/webhooks", `{"url":"http://example.com","secret":"short","events":["book.created"]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = s.do(http.MethodPost, "/v1/webhooks", `{"url":"http://example.com","secret":"0123456789abcdef","events":["book.burned"]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should reject webhooks to private addresses", func(t *testing.T) {
+		for _, url := range []string{
+			"http://127.0.0.1:8080/hook",
+			"http://localhost/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://10.0.0.1/hook",
+			"http://[::1]/hook",
+			"http://[::ffff:192.168.0.1]/hook",
+		} {
+			rec := s.do(http.MethodPost, "/v1/webhooks", `{"url":"`+url+`","secret":"0123456789abcdef","events":["book.created"]}`, nil)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+			assert.Contains(t, rec.Body.String(), "private address", url)
+		}
+	})
+
+	// The receiver listens on loopback.
+	allowed := database.AllowPrivateWebhooks
+	database.AllowPrivateWebhooks = true
+	t.Cleanup(func() { database.AllowPrivateWebhooks = allowed })
+
+	rec := s.do(http.MethodPost, "/v1/webhooks", `{"url":"`+receiver.URL+`","secret":"0123456789abcdef","events":["borrower.created"]}`, nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		ID database.ID `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	t.Run("should list webhooks without their secrets", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/v1/webhooks", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), created.ID.String())
+		assert.NotContains(t, rec.Body.String(), "0123456789abcdef")
+	})
+
+	_, err := db.CreateBorrower(context.Background(), database.BorrowerRequest{Name: "Bober", Birthday: time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC), Email: "bober@hotmail.com"})
+	require.NoError(t, err)
+	_, err = outbox.NewRelay(db, outbox.DefaultConfig, webhooks.NewSink(db)).DispatchDue(context.Background())
+	require.NoError(t, err)
+	_, err = worker.DeliverDue(context.Background())
+	require.NoError(t, err)
+
+	var dead []database.WebhookDelivery
+	t.Run("should dead-letter deliveries that run out of attempts", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/v1/webhooks/deliveries?status=dead", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dead))
+		require.Len(t, dead, 1)
+		assert.Equal(t, database.BorrowerCreated, dead[0].EventType)
+		assert.Equal(t, "webhook responded 500 Internal Server Error", dead[0].LastError)
+
+		rec = s.do(http.MethodGet, "/v1/webhooks/deliveries?status=lost", "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should redeliver a dead delivery", func(t *testing.T) {
+		require.Len(t, dead, 1)
+		fixed.Store(true)
+
+		rec := s.do(http.MethodPost, "/v1/webhooks/deliveries/"+dead[0].ID.String()+"/redeliver", "", nil)
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+		var queued database.WebhookDelivery
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &queued))
+		assert.Equal(t, database.DeliveryPending, queued.Status)
+		assert.Zero(t, queued.Attempts)
+
+		_, err := worker.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), received.Load())
+
+		rec = s.do(http.MethodGet, "/v1/webhooks/deliveries?status=delivered", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), dead[0].ID.String())
+
+		rec = s.do(http.MethodPost, "/v1/webhooks/deliveries/"+database.NewID().String()+"/redeliver", "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("should delete a webhook", func(t *testing.T) {
+		rec := s.do(http.MethodDelete, "/v1/webhooks/"+created.ID.String(), "", nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = s.do(http.MethodDelete, "/v1/webhooks/"+created.ID.String(), "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
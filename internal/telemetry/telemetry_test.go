@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	// Setup replaces the global provider and propagator, which other tests
+	// in the binary may rely on
+	savedExporter := exporter
+	savedProvider := otel.GetTracerProvider()
+	savedPropagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		exporter = savedExporter
+		otel.SetTracerProvider(savedProvider)
+		otel.SetTextMapPropagator(savedPropagator)
+	})
+
+	testcases := []struct {
+		name     string
+		exporter string
+		errMsg   string
+	}{
+		{name: "should default to no exporter", exporter: ""},
+		{name: "should accept none exporter", exporter: "none"},
+		{name: "should accept stdout exporter", exporter: "stdout"},
+		{name: "should reject unknown exporter", exporter: "zipkin", errMsg: "unknown traces exporter"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			exporter = testcase.exporter
+
+			shutdown, err := Setup(context.Background())
+			if testcase.errMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testcase.errMsg)
+				assert.Nil(t, shutdown)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package webhooks
+
+import (
+	"context"
+
+	"curly-computing-machine/internal/database"
+)
+
+// Sink queues deliveries of outbox events to the webhooks subscribed to
+// them. Deliveries are keyed by the event's ID, so an event relayed again
+// isn't delivered twice.
+type Sink struct {
+	db database.Service
+}
+
+func NewSink(db database.Service) *Sink {
+	return &Sink{db: db}
+}
+
+func (s *Sink) Name() string {
+	return "webhooks"
+}
+
+func (s *Sink) Dispatch(ctx context.Context, event database.OutboxEvent) error {
+	webhookEvent, err := newEvent(event.ID.String(), event.Type, event.CreatedAt, event.Payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.QueueWebhookDeliveries(ctx, webhookEvent)
+	return err
+}
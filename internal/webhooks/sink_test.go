@@ -0,0 +1,57 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSink(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	_, err := db.CreateWebhook(ctx, database.WebhookRequest{URL: "http://localhost/loans", Secret: testSecret, Events: []string{database.BookBorrowed}})
+	require.NoError(t, err)
+
+	sink := NewSink(db)
+	borrowed, err := database.NewOutboxEvent(database.BookBorrowed, database.LoanData{Loan: database.NewLoan(database.NewID()), BorrowerID: database.NewID()})
+	require.NoError(t, err)
+	created, err := database.NewOutboxEvent(database.BookCreated, database.BookCreatedData{Book: database.Book{Title: "Hobbit"}})
+	require.NoError(t, err)
+
+	// Relaying an event again doesn't deliver it twice
+	require.NoError(t, sink.Dispatch(ctx, borrowed))
+	require.NoError(t, sink.Dispatch(ctx, borrowed))
+	require.NoError(t, sink.Dispatch(ctx, created))
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1, "only book.borrowed is subscribed to")
+	assert.Equal(t, borrowed.ID.String(), deliveries[0].EventID)
+
+	var payload struct {
+		ID        string            `json:"id"`
+		Type      string            `json:"type"`
+		CreatedAt time.Time         `json:"created_at"`
+		Data      database.LoanData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(deliveries[0].Payload, &payload))
+	assert.Equal(t, borrowed.ID.String(), payload.ID)
+	assert.Equal(t, database.BookBorrowed, payload.Type)
+	assert.True(t, borrowed.CreatedAt.Equal(payload.CreatedAt))
+	assert.JSONEq(t, string(borrowed.Payload), mustMarshal(t, payload.Data))
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+
+	encoded, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(encoded)
+}
@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "0123456789abcdef"
+	body := []byte(`{"id":"1","type":"book.created"}`)
+	signedAt := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	header := Sign(secret, signedAt, body)
+
+	testcases := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		valid  bool
+	}{
+		{name: "valid", secret: secret, header: header, body: body, now: signedAt.Add(time.Minute), valid: true},
+		{name: "wrong secret", secret: "fedcba9876543210", header: header, body: body, now: signedAt, valid: false},
+		{name: "changed body", secret: secret, header: header, body: []byte(`{"id":"2","type":"book.created"}`), now: signedAt, valid: false},
+		{name: "too old", secret: secret, header: header, body: body, now: signedAt.Add(time.Hour), valid: false},
+		{name: "malformed", secret: secret, header: "v1=abc", body: body, now: signedAt, valid: false},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			err := Verify(testcase.secret, testcase.header, testcase.body, 5*time.Minute, testcase.now)
+			if testcase.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	event, err := NewEvent("event-1", database.BookCreated, database.BookCreatedData{Book: database.Book{Title: "Hobbit"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "event-1", event.ID)
+	assert.Equal(t, database.BookCreated, event.Type)
+
+	var payload struct {
+		ID   string                   `json:"id"`
+		Type string                   `json:"type"`
+		Data database.BookCreatedData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(event.Payload, &payload))
+	assert.Equal(t, "event-1", payload.ID)
+	assert.Equal(t, database.BookCreated, payload.Type)
+	assert.Equal(t, "Hobbit", payload.Data.Book.Title)
+}
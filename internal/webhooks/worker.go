@@ -0,0 +1,283 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/retry"
+)
+
+var (
+	maxAttempts     = os.Getenv("WEBHOOK_MAX_ATTEMPTS")
+	timeout         = os.Getenv("WEBHOOK_TIMEOUT")
+	pollInterval    = os.Getenv("WEBHOOK_POLL_INTERVAL")
+	overdueInterval = os.Getenv("WEBHOOK_OVERDUE_INTERVAL")
+)
+
+// Config tunes a Worker.
+type Config struct {
+	// MaxAttempts is how many times a delivery is tried before it's
+	// dead-lettered.
+	MaxAttempts int
+	// Timeout bounds each attempt, including reading the response.
+	Timeout time.Duration
+	// Backoff is the wait before the first retry. Each retry after it waits
+	// twice as long as the one before, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is how often the worker looks for due deliveries.
+	PollInterval time.Duration
+	// OverdueInterval is how often the worker looks for overdue loans to
+	// report.
+	OverdueInterval time.Duration
+	// BatchSize is how many deliveries are claimed at a time.
+	BatchSize int
+}
+
+// DefaultConfig retries for about a day and a half before giving up.
+var DefaultConfig = Config{
+	MaxAttempts:     12,
+	Timeout:         10 * time.Second,
+	Backoff:         30 * time.Second,
+	MaxBackoff:      6 * time.Hour,
+	PollInterval:    time.Second,
+	OverdueInterval: time.Hour,
+	BatchSize:       50,
+}
+
+// ConfigFromEnv is DefaultConfig with WEBHOOK_MAX_ATTEMPTS, WEBHOOK_TIMEOUT,
+// WEBHOOK_POLL_INTERVAL and WEBHOOK_OVERDUE_INTERVAL applied.
+func ConfigFromEnv() Config {
+	config := DefaultConfig
+
+	if maxAttempts != "" {
+		parsed, err := strconv.Atoi(maxAttempts)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("invalid WEBHOOK_MAX_ATTEMPTS %q", maxAttempts)
+		}
+		config.MaxAttempts = parsed
+	}
+
+	retry.ParseDurations(
+		retry.Duration{Name: "WEBHOOK_TIMEOUT", Value: timeout, Into: &config.Timeout},
+		retry.Duration{Name: "WEBHOOK_POLL_INTERVAL", Value: pollInterval, Into: &config.PollInterval},
+		retry.Duration{Name: "WEBHOOK_OVERDUE_INTERVAL", Value: overdueInterval, Into: &config.OverdueInterval},
+	)
+
+	return config
+}
+
+// Worker delivers queued webhook deliveries and queues overdue loans.
+// Several workers, in this process or others, can share a database: claiming
+// a delivery keeps the others off it while it's attempted.
+type Worker struct {
+	db     database.Service
+	config Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewWorker(db database.Service, config Config) *Worker {
+	return &Worker{
+		db:     db,
+		config: config,
+		client: newClient(config.Timeout),
+		now:    time.Now,
+	}
+}
+
+// newClient returns a client that only connects to addresses webhooks are
+// allowed to reach. The check is made on the address actually dialled, so a
+// webhook's host can't be pointed somewhere private after it's registered,
+// and redirects aren't followed, so a webhook can't send the worker there
+// either. Proxies are bypassed, since the check can't see past them.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !database.WebhookAddressAllowed(addrPort.Addr()) {
+				return fmt.Errorf("webhooks may not be delivered to %s", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Run delivers and looks for overdue loans until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	deliveries := time.NewTicker(w.config.PollInterval)
+	defer deliveries.Stop()
+	overdue := time.NewTicker(w.config.OverdueInterval)
+	defer overdue.Stop()
+
+	w.logErr("queue overdue loans", w.QueueOverdue(ctx))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deliveries.C:
+			_, err := w.DeliverDue(ctx)
+			w.logErr("deliver", err)
+		case <-overdue.C:
+			w.logErr("queue overdue loans", w.QueueOverdue(ctx))
+		}
+	}
+}
+
+func (w *Worker) logErr(action string, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("webhooks: %s: %v", action, err)
+	}
+}
+
+// DeliverDue attempts every delivery that's due and returns how many it
+// attempted.
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	// The lease outlasts an attempt, so a claimed delivery is only taken
+	// again if this worker dies before saving its outcome.
+	lease := 2*w.config.Timeout + time.Minute
+
+	attempted := 0
+	for {
+		claimed, err := w.db.ClaimWebhookDeliveries(ctx, w.now().UTC(), lease, w.config.BatchSize)
+		if err != nil {
+			return attempted, err
+		}
+
+		for _, delivery := range claimed {
+			err := w.attempt(ctx, delivery)
+			if err != nil {
+				return attempted, err
+			}
+			attempted++
+		}
+
+		if len(claimed) < w.config.BatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// attempt POSTs a delivery to its webhook and saves the outcome.
+func (w *Worker) attempt(ctx context.Context, delivery database.WebhookDelivery) error {
+	webhook, err := w.db.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	if webhook == nil {
+		// Deleting a webhook deletes its deliveries; this one was claimed
+		// just before.
+		delivery.Status = database.DeliveryDead
+		delivery.LastError = "webhook deleted"
+		return w.db.UpdateWebhookDelivery(ctx, delivery)
+	}
+
+	now := w.now().UTC()
+	err = w.post(ctx, webhook, delivery)
+	switch {
+	case err == nil:
+		delivery.Status = database.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= w.config.MaxAttempts:
+		delivery.Status = database.DeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(w.Backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	return w.db.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// post sends a delivery, failing unless the webhook answers with a 2xx.
+func (w *Worker) post(ctx context.Context, webhook *database.Webhook, delivery database.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fmt.Errorf("build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "curly-computing-machine-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, w.now(), delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Backoff is how long to wait before retrying a delivery that has failed
+// attempts times.
+func (w *Worker) Backoff(attempts int) time.Duration {
+	return retry.Backoff(w.config.Backoff, w.config.MaxBackoff, attempts)
+}
+
+// OverdueData is the data of loan.overdue events.
+type OverdueData struct {
+	Loan database.OverdueLoan `json:"loan"`
+}
+
+// QueueOverdue queues a loan.overdue event for every overdue loan. A loan is
+// only reported once: its event ID is derived from the loan, so finding it
+// again on later scans queues nothing new.
+func (w *Worker) QueueOverdue(ctx context.Context) error {
+	loans, err := w.db.OverdueLoans(ctx, w.now().UTC())
+	if err != nil {
+		return err
+	}
+
+	for _, loan := range loans {
+		id := fmt.Sprintf("%s:%s:%d", database.LoanOverdue, loan.BookID, loan.BorrowedAt.UnixMilli())
+		event, err := NewEvent(id, database.LoanOverdue, OverdueData{Loan: loan})
+		if err != nil {
+			return err
+		}
+
+		_, err = w.db.QueueWebhookDeliveries(ctx, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"curly-computing-machine/internal/database"
+	"curly-computing-machine/internal/database/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef"
+
+// receiver is a webhook endpoint answering with the statuses it's given in
+// turn, then 204s.
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(rc.t, err)
+	assert.NoError(rc.t, Verify(testSecret, r.Header.Get(SignatureHeader), body, time.Minute, time.Now()))
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.received = append(rc.received, r)
+	rc.bodies = append(rc.bodies, body)
+
+	status := http.StatusNoContent
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// allowPrivateWebhooks lets webhooks reach the test's receivers, which listen
+// on loopback, until the test ends.
+func allowPrivateWebhooks(t *testing.T) {
+	allowed := database.AllowPrivateWebhooks
+	database.AllowPrivateWebhooks = true
+	t.Cleanup(func() { database.AllowPrivateWebhooks = allowed })
+}
+
+// newTestWorker returns a worker whose clock the test moves, and a webhook
+// subscribed to every event that posts to rc.
+func newTestWorker(t *testing.T, rc *receiver) (*Worker, *time.Time, database.Service) {
+	allowPrivateWebhooks(t)
+	db := memory.New()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	_, err := db.CreateWebhook(context.Background(), database.WebhookRequest{URL: srv.URL, Secret: testSecret, Events: database.WebhookEventTypes})
+	require.NoError(t, err)
+
+	config := DefaultConfig
+	config.MaxAttempts = 3
+	worker := NewWorker(db, config)
+	now := time.Now()
+	worker.now = func() time.Time { return now }
+	return worker, &now, db
+}
+
+// queueEvent queues an event for delivery. Deliveries are due from when
+// they're queued, so now, the clock of a test worker if there is one, is
+// moved to then.
+func queueEvent(t *testing.T, db database.Service, now *time.Time, id string) {
+	event, err := NewEvent(id, database.BookCreated, database.BookCreatedData{Book: database.Book{Title: "Hobbit"}})
+	require.NoError(t, err)
+	_, err = db.QueueWebhookDeliveries(context.Background(), event)
+	require.NoError(t, err)
+
+	if now != nil {
+		*now = time.Now()
+	}
+}
+
+func TestWorkerDelivers(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t}
+	worker, now, db := newTestWorker(t, rc)
+	queueEvent(t, db, now, "event-1")
+
+	attempted, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	require.Len(t, rc.received, 1)
+	assert.Equal(t, database.BookCreated, rc.received[0].Header.Get(EventHeader))
+	assert.Equal(t, "application/json", rc.received[0].Header.Get("Content-Type"))
+	assert.Contains(t, string(rc.bodies[0]), `"id":"event-1"`)
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, database.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+	assert.Equal(t, deliveries[0].ID.String(), rc.received[0].Header.Get(DeliveryHeader))
+
+	// Nothing's left to deliver.
+	attempted, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+}
+
+func TestWorkerRetries(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t, statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}}
+	worker, now, db := newTestWorker(t, rc)
+	queueEvent(t, db, now, "event-1")
+
+	delivery := func() database.WebhookDelivery {
+		deliveries, err := db.ListWebhookDeliveries(ctx, "")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		return deliveries[0]
+	}
+
+	_, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	failed := delivery()
+	assert.Equal(t, database.DeliveryPending, failed.Status)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "webhook responded 500 Internal Server Error", failed.LastError)
+	assert.WithinDuration(t, now.Add(DefaultConfig.Backoff), failed.NextAttemptAt, time.Millisecond)
+
+	// Not due again until the backoff has passed.
+	attempted, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+
+	*now = failed.NextAttemptAt
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	failed = delivery()
+	assert.Equal(t, 2, failed.Attempts)
+	assert.WithinDuration(t, now.Add(2*DefaultConfig.Backoff), failed.NextAttemptAt, time.Millisecond)
+
+	// The last attempt dead-letters it.
+	*now = failed.NextAttemptAt
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	dead, err := db.ListWebhookDeliveries(ctx, database.DeliveryDead)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "webhook responded 503 Service Unavailable", dead[0].LastError)
+	assert.Len(t, rc.received, 3)
+
+	*now = now.Add(24 * time.Hour)
+	attempted, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+}
+
+func TestWorkerRefusesPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t}
+	worker, now, db := newTestWorker(t, rc)
+	// The webhook was registered while it was allowed, or its host has
+	// since been pointed at a private address.
+	database.AllowPrivateWebhooks = false
+	queueEvent(t, db, now, "event-1")
+
+	_, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, database.DeliveryPending, deliveries[0].Status)
+	assert.Contains(t, deliveries[0].LastError, "webhooks may not be delivered to 127.0.0.1")
+	assert.Empty(t, rc.received)
+}
+
+func TestWorkerDoesNotFollowRedirects(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t}
+	worker, now, db := newTestWorker(t, rc)
+
+	target := httptest.NewServer(rc)
+	t.Cleanup(target.Close)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	webhooks, err := db.ListWebhooks(ctx)
+	require.NoError(t, err)
+	_, err = db.DeleteWebhook(ctx, webhooks[0].ID)
+	require.NoError(t, err)
+	_, err = db.CreateWebhook(ctx, database.WebhookRequest{URL: redirect.URL, Secret: testSecret, Events: database.WebhookEventTypes})
+	require.NoError(t, err)
+	queueEvent(t, db, now, "event-1")
+
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "webhook responded 307 Temporary Redirect", deliveries[0].LastError)
+	assert.Empty(t, rc.received)
+}
+
+func TestWorkerBackoff(t *testing.T) {
+	worker := NewWorker(memory.New(), Config{Backoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	testcases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 4, expected: 8 * time.Second},
+		{attempts: 5, expected: 10 * time.Second},
+		{attempts: 100, expected: 10 * time.Second},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(t, testcase.expected, worker.Backoff(testcase.attempts), "after %d attempts", testcase.attempts)
+	}
+}
+
+func TestWorkerQueueOverdue(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t}
+	worker, now, db := newTestWorker(t, rc)
+
+	birthday := time.Date(1996, time.May, 17, 0, 0, 0, 0, time.UTC)
+	authorID, err := db.CreateAuthor(ctx, database.AuthorRequest{Name: "Bober", Birthday: birthday, Email: "bober@author.com"})
+	require.NoError(t, err)
+	borrowerID, err := db.CreateBorrower(ctx, database.BorrowerRequest{Name: "Bober", Birthday: birthday, Email: "bober@hotmail.com"})
+	require.NoError(t, err)
+	_, err = db.VerifyBorrower(ctx, *borrowerID, "bober@hotmail.com")
+	require.NoError(t, err)
+	bookID, err := db.AddBook(ctx, database.BookRequest{Title: "Hobbit", AuthorID: *authorID, Available: true})
+	require.NoError(t, err)
+	require.NoError(t, db.BorrowBook(ctx, *bookID, *borrowerID))
+
+	require.NoError(t, worker.QueueOverdue(ctx))
+	deliveries, err := db.ListWebhookDeliveries(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, deliveries, "the loan isn't overdue yet")
+
+	*now = now.Add(database.LoanPeriod + time.Hour)
+	require.NoError(t, worker.QueueOverdue(ctx))
+	require.NoError(t, worker.QueueOverdue(ctx))
+
+	deliveries, err = db.ListWebhookDeliveries(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1, "a loan is reported once")
+	assert.Equal(t, database.LoanOverdue, deliveries[0].EventType)
+
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	require.Len(t, rc.bodies, 1)
+	assert.Contains(t, string(rc.bodies[0]), `"book_title":"Hobbit"`)
+}
+
+func TestWorkerRun(t *testing.T) {
+	allowPrivateWebhooks(t)
+	rc := &receiver{t: t}
+	db := memory.New()
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	_, err := db.CreateWebhook(context.Background(), database.WebhookRequest{URL: srv.URL, Secret: testSecret, Events: database.WebhookEventTypes})
+	require.NoError(t, err)
+
+	config := DefaultConfig
+	config.PollInterval = 10 * time.Millisecond
+	worker := NewWorker(db, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	queueEvent(t, db, nil, "event-1")
+	assert.Eventually(t, func() bool {
+		delivered, err := db.ListWebhookDeliveries(context.Background(), database.DeliveryDelivered)
+		return err == nil && len(delivered) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
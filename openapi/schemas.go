@@ -0,0 +1,184 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"curly-computing-machine/internal/database"
+
+	"gopkg.in/yaml.v3"
+)
+
+// V1Types are the Go types whose schemas are generated into the v1 spec.
+var V1Types = []any{
+	database.BookRequest{},
+	database.Book{},
+	database.Contributor{},
+	database.AuthorRequest{},
+	database.Author{},
+	database.BorrowerRequest{},
+	database.Borrower{},
+	database.ImportJob{},
+	database.ImportRowResult{},
+	database.WebhookRequest{},
+	database.Webhook{},
+	database.WebhookDelivery{},
+	database.NotificationPreferences{},
+	database.Notification{},
+	database.AgeOverride{},
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	idType   = reflect.TypeOf(database.ID(""))
+	rawType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// SyncSchemas rewrites components.schemas in spec so it matches types. Other
+// schemas and the rest of the document are left as they are.
+func SyncSchemas(spec []byte, types []any) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(spec, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("parse spec: %v", err)
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("spec is empty")
+	}
+
+	componentsNode := mappingValue(doc.Content[0], "components")
+	if componentsNode == nil {
+		return nil, fmt.Errorf("spec has no components")
+	}
+	schemas := mappingValue(componentsNode, "schemas")
+	if schemas == nil {
+		return nil, fmt.Errorf("spec has no components.schemas")
+	}
+
+	components := make(map[reflect.Type]bool, len(types))
+	for _, value := range types {
+		components[reflect.TypeOf(value)] = true
+	}
+
+	for _, value := range types {
+		t := reflect.TypeOf(value)
+		setMappingValue(schemas, t.Name(), structSchema(t, components))
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode spec: %v", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// schemaFor describes t the way encoding/json renders it. Slices are nullable
+// since a nil slice encodes as null, and types in components are referenced
+// rather than inlined. Raw JSON can be anything, so its schema is empty.
+func schemaFor(t reflect.Type, components map[reflect.Type]bool) *yaml.Node {
+	switch {
+	case t == timeType:
+		return mapping("type", scalar("string"), "format", scalar("date-time"))
+	case t == idType:
+		return mapping("$ref", quoted("#/components/schemas/ID"))
+	case t == rawType:
+		return mapping()
+	case components[t]:
+		return mapping("$ref", quoted("#/components/schemas/"+t.Name()))
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem(), components)
+	case reflect.Bool:
+		return mapping("type", scalar("boolean"))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return mapping("type", scalar("integer"))
+	case reflect.Int64, reflect.Uint64:
+		return mapping("type", scalar("integer"), "format", scalar("int64"))
+	case reflect.Float32, reflect.Float64:
+		return mapping("type", scalar("number"))
+	case reflect.String:
+		return mapping("type", scalar("string"))
+	case reflect.Slice, reflect.Array:
+		return mapping("type", scalar("array"), "nullable", scalar("true"), "items", schemaFor(t.Elem(), components))
+	case reflect.Struct:
+		return structSchema(t, components)
+	}
+
+	return mapping()
+}
+
+// structSchema describes a struct as an object whose properties are required
+// unless their json tag has omitempty.
+func structSchema(t reflect.Type, components map[reflect.Type]bool) *yaml.Node {
+	properties := mapping()
+	required := &yaml.Node{Kind: yaml.SequenceNode}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		setMappingValue(properties, name, schemaFor(field.Type, components))
+		if !strings.Contains(opts, "omitempty") {
+			required.Content = append(required.Content, scalar(name))
+		}
+	}
+
+	schema := mapping("type", scalar("object"))
+	if len(required.Content) > 0 {
+		setMappingValue(schema, "required", required)
+	}
+	setMappingValue(schema, "properties", properties)
+	return schema
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+func quoted(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle}
+}
+
+func mapping(pairs ...any) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i < len(pairs); i += 2 {
+		setMappingValue(node, pairs[i].(string), pairs[i+1].(*yaml.Node))
+	}
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, scalar(key), value)
+}
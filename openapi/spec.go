@@ -0,0 +1,37 @@
+// Package openapi holds the OpenAPI specs of every mounted API version.
+//
+// Paths are written by hand, while the schemas of the request and response
+// types are generated from the Go structs; run `go generate ./openapi` after
+// changing them.
+package openapi
+
+//go:generate go run ../cmd/openapi-gen
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+//go:embed v1.yaml
+var V1 []byte
+
+// LoadV1 parses and validates the version 1 spec.
+func LoadV1(ctx context.Context) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+
+	doc, err := loader.LoadFromData(V1)
+	if err != nil {
+		return nil, fmt.Errorf("load v1 spec: %v", err)
+	}
+
+	err = doc.Validate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("validate v1 spec: %v", err)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,23 @@
+package openapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadV1(t *testing.T) {
+	doc, err := LoadV1(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, doc)
+}
+
+func TestV1SchemasUpToDate(t *testing.T) {
+	synced, err := SyncSchemas(V1, V1Types)
+	assert.NoError(t, err)
+
+	if string(synced) != string(V1) {
+		t.Fatal("v1.yaml schemas are out of date with the Go types; run `go generate ./openapi`")
+	}
+}